@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/ab/design-reviewer/internal/cli"
+	"github.com/ab/design-reviewer/internal/version"
 )
 
 func main() {
@@ -18,13 +19,20 @@ func main() {
 	case "login":
 		fs := flag.NewFlagSet("login", flag.ExitOnError)
 		server := fs.String("server", "", "server URL")
+		callbackHost := fs.String("callback-host", "localhost", "interface for the local login callback server")
+		timeout := fs.Duration("timeout", cli.DefaultLoginTimeout, "how long to wait for the browser login to complete")
+		profile := fs.String("profile", "", "profile to save the login to (default: current profile)")
 		fs.Parse(os.Args[2:])
-		if err := cli.Login(*server); err != nil {
+		opts := cli.LoginOptions{CallbackHost: *callbackHost, Timeout: *timeout, Profile: *profile}
+		if err := cli.LoginWithOptions(*server, opts); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 	case "logout":
-		if err := cli.Logout(); err != nil {
+		fs := flag.NewFlagSet("logout", flag.ExitOnError)
+		profile := fs.String("profile", "", "profile to log out of (default: current profile)")
+		fs.Parse(os.Args[2:])
+		if err := cli.LogoutProfile(*profile); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -32,15 +40,38 @@ func main() {
 		fs := flag.NewFlagSet("push", flag.ExitOnError)
 		name := fs.String("name", "", "project name")
 		server := fs.String("server", "", "server URL")
+		projectID := fs.String("project-id", "", "push to this existing project instead of matching by name")
+		width := fs.Int("width", 0, "canvas width the design was made for, in pixels (overrides design.json)")
+		height := fs.Int("height", 0, "canvas height, in pixels (optional)")
+		profile := fs.String("profile", "", "profile to push with (default: current profile)")
+		noRetry := fs.Bool("no-retry", false, "fail on the first network error instead of retrying with backoff")
 		fs.Parse(os.Args[2:])
 		if fs.NArg() < 1 {
-			fmt.Fprintln(os.Stderr, "Usage: design-reviewer push <directory> [--name <project-name>] [--server URL]")
+			fmt.Fprintln(os.Stderr, "Usage: design-reviewer push <directory|file.html> [--name <project-name>] [--project-id ID] [--width PX] [--height PX] [--server URL] [--profile NAME] [--no-retry]")
+			os.Exit(1)
+		}
+		opts := cli.PushOptions{ProjectID: *projectID, Width: *width, Height: *height, Profile: *profile, NoRetry: *noRetry}
+		if err := cli.PushWithOptions(fs.Arg(0), *name, *server, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "profiles":
+		var err error
+		switch {
+		case len(os.Args) == 2:
+			err = cli.ListProfiles(os.Stdout)
+		case len(os.Args) == 4 && os.Args[2] == "use":
+			err = cli.UseProfile(os.Args[3])
+		default:
+			fmt.Fprintln(os.Stderr, "Usage: design-reviewer profiles [use <name>]")
 			os.Exit(1)
 		}
-		if err := cli.Push(fs.Arg(0), *name, *server); err != nil {
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+	case "version", "--version", "-version":
+		fmt.Println("design-reviewer " + version.String())
 	case "init":
 		dir := "."
 		if len(os.Args) > 2 {
@@ -61,8 +92,10 @@ func usage() {
 	fmt.Fprintln(os.Stderr, `Usage: design-reviewer <command> [options]
 
 Commands:
-  login   [--server URL]                          Log in via Google OAuth
-  logout                                          Remove stored token
-  push    <directory> [--name <name>] [--server URL]  Upload a design project
-  init    [directory]                                 Generate DESIGN_GUIDELINES.md`)
+  login   [--server URL] [--callback-host H] [--timeout D] [--profile NAME]  Log in via Google OAuth
+  logout  [--profile NAME]                        Remove stored token
+  push    <directory|file.html> [--name <name>] [--project-id ID] [--width PX] [--server URL] [--profile NAME] [--no-retry]  Upload a design project
+  profiles [use <name>]                               List server profiles, or switch the current one
+  init    [directory]                                 Generate DESIGN_GUIDELINES.md
+  version                                             Print the CLI version and commit`)
 }
@@ -0,0 +1,25 @@
+package main
+
+import "os"
+
+// defaultCSP is the Content-Security-Policy for app pages. Scripts load only
+// from the app itself, so the templates carry no inline script; styles may
+// be inline because the templates and scripts set style attributes. Images
+// may come from any https origin so APP_LOGO_URL can point elsewhere. Only
+// same-origin design files may be framed, and the app itself never is.
+const defaultCSP = "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data: https:; frame-src 'self'; frame-ancestors 'none'; " +
+	"object-src 'none'; base-uri 'self'; form-action 'self'"
+
+// cspFromEnv returns CONTENT_SECURITY_POLICY, defaulting to defaultCSP. The
+// value "off" disables the header.
+func cspFromEnv() string {
+	switch v := os.Getenv("CONTENT_SECURITY_POLICY"); v {
+	case "":
+		return defaultCSP
+	case "off":
+		return ""
+	default:
+		return v
+	}
+}
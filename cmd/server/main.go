@@ -1,21 +1,27 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 
 	"github.com/ab/design-reviewer/internal/api"
 	"github.com/ab/design-reviewer/internal/auth"
 	"github.com/ab/design-reviewer/internal/db"
-	"github.com/ab/design-reviewer/internal/seed"
+	"github.com/ab/design-reviewer/internal/digest"
+	"github.com/ab/design-reviewer/internal/mail"
+	"github.com/ab/design-reviewer/internal/retention"
 	"github.com/ab/design-reviewer/internal/storage"
+	"github.com/ab/design-reviewer/internal/version"
 )
 
 func main() {
@@ -24,11 +30,30 @@ func main() {
 	port := flag.Int("port", 8080, "server port")
 	dbPath := flag.String("db", "./data/design-reviewer.db", "SQLite database path")
 	uploads := flag.String("uploads", "./data/uploads", "upload directory")
+	showVersion := flag.Bool("version", false, "print the server version and exit")
+	readOnly := flag.Bool("read-only", false, "reject all writes with 503 (maintenance mode); also READ_ONLY=true")
+	seedDemo := flag.Bool("seed", false, "create a demo project in an empty database; also SEED=true")
+	disablePublic := flag.Bool("disable-public", false, "turn off share links, public and org visibility, and embed URLs; also DISABLE_PUBLIC=true")
+	tlsCert := flag.String("tls-cert", "", "serve HTTPS with this certificate file (requires --tls-key)")
+	tlsKey := flag.String("tls-key", "", "private key file for --tls-cert")
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println("design-reviewer server " + version.String())
+		return
+	}
+
 	os.MkdirAll(filepath.Dir(*dbPath), 0o755)
 
-	database, err := db.New(*dbPath)
+	busyTimeout := db.DefaultBusyTimeout
+	if v := os.Getenv("DB_BUSY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("invalid DB_BUSY_TIMEOUT: %q", v)
+		}
+		busyTimeout = d
+	}
+	database, err := db.NewWithBusyTimeout(*dbPath, busyTimeout)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -36,17 +61,34 @@ func main() {
 
 	store := storage.New(*uploads)
 
-	seed.Run(database, *uploads)
+	if _, err := seedIfEnabled(database, *uploads, *seedDemo); err != nil {
+		log.Fatal(err)
+	}
 
 	h := &api.Handler{DB: database, Storage: store, TemplatesDir: "web/templates", StaticDir: "web/static"}
+	h.Branding = api.Branding{AppName: os.Getenv("APP_NAME"), LogoURL: os.Getenv("APP_LOGO_URL")}
 
 	// Configure auth if env vars are set
 	clientID := os.Getenv("GOOGLE_CLIENT_ID")
 	clientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
 	sessionSecret := os.Getenv("SESSION_SECRET")
-	baseURL := os.Getenv("BASE_URL")
+	// BASE_PATH serves the app under a subpath; BASE_URL is the external
+	// URL of that subpath, which it is appended to if missing.
+	h.BasePath = api.CleanBasePath(os.Getenv("BASE_PATH"))
+	tlsCfg, err := tlsFromFlags(*tlsCert, *tlsKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	baseURL := strings.TrimRight(os.Getenv("BASE_URL"), "/")
 	if baseURL == "" {
-		baseURL = fmt.Sprintf("http://localhost:%d", *port)
+		scheme := "http"
+		if tlsCfg.Enabled() {
+			scheme = "https"
+		}
+		baseURL = fmt.Sprintf("%s://localhost:%d", scheme, *port)
+	}
+	if !strings.HasSuffix(baseURL, h.BasePath) {
+		baseURL += h.BasePath
 	}
 
 	if clientID != "" && clientSecret != "" && sessionSecret != "" {
@@ -57,6 +99,9 @@ func main() {
 			CLIRedirectURL: baseURL + "/auth/google/cli-callback",
 			SessionSecret:  sessionSecret,
 			BaseURL:        baseURL,
+			SecureCookies:  tlsCfg.Enabled(),
+
+			AllowedEmailDomains: auth.ParseEmailDomains(os.Getenv("ALLOWED_EMAIL_DOMAINS")),
 		}
 		h.Auth = cfg
 		oauthCfg := auth.NewGoogleOAuthConfig(*cfg)
@@ -66,21 +111,176 @@ func main() {
 		fmt.Println("auth disabled (set GOOGLE_CLIENT_ID, GOOGLE_CLIENT_SECRET, SESSION_SECRET to enable)")
 	}
 
+	// Configure email (magic-link login, digests) if SMTP is set
+	if sender := mail.SMTPFromEnv(); sender != nil {
+		h.Mailer = sender
+		interval := 24 * time.Hour
+		if v := os.Getenv("DIGEST_INTERVAL"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				log.Fatalf("invalid DIGEST_INTERVAL: %v", err)
+			}
+			interval = d
+		}
+		runner := &digest.Runner{DB: database, Sender: sender, BaseURL: baseURL}
+		runner.Start(context.Background(), interval)
+		fmt.Printf("email enabled (digests every %s)\n", interval)
+	} else {
+		fmt.Println("email disabled (set SMTP_HOST, SMTP_FROM to enable)")
+	}
+
+	rl := api.NewRateLimiter()
+	if v := os.Getenv("COMMENT_RATE_LIMIT"); v != "" {
+		perMin, err := strconv.Atoi(v)
+		if err != nil || perMin < 1 {
+			log.Fatalf("invalid COMMENT_RATE_LIMIT: %q", v)
+		}
+		rl.SetUserWriteRate(perMin, max(1, perMin/2))
+	}
+	if v := os.Getenv("RATE_LIMIT_WARN_FRACTION"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f >= 1 {
+			log.Fatalf("invalid RATE_LIMIT_WARN_FRACTION: %q", v)
+		}
+		rl.SetWarnFraction(f)
+	}
+	h.WriteLimiter = rl
+
+	if v := os.Getenv("MAX_COMMENTS_PER_VERSION"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("invalid MAX_COMMENTS_PER_VERSION: %q", v)
+		}
+		h.MaxCommentsPerVersion = n
+	}
+	if v := os.Getenv("MAX_PAGES_PER_UPLOAD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("invalid MAX_PAGES_PER_UPLOAD: %q", v)
+		}
+		h.MaxPagesPerUpload = n
+	}
+	if v := os.Getenv("KEEPALIVE_INTERVAL"); v == "off" {
+		h.KeepAliveInterval = -1
+	} else if v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("invalid KEEPALIVE_INTERVAL: %q", v)
+		}
+		if d == 0 {
+			d = -1
+		}
+		h.KeepAliveInterval = d
+	}
+
+	if v := os.Getenv("DISABLE_PUBLIC"); v != "" && !*disablePublic {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("invalid DISABLE_PUBLIC: %q", v)
+		}
+		*disablePublic = on
+	}
+	if *disablePublic {
+		h.DisablePublic = true
+		database.PrivateOnly = true
+		fmt.Println("public access disabled: every project is private")
+	}
+
+	// ADMIN_EMAILS is a comma-separated list of instance admins.
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			h.Admins = append(h.Admins, email)
+		}
+	}
+
+	if v := os.Getenv("ROBOTS_ALLOW_SHARES"); v != "" {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("invalid ROBOTS_ALLOW_SHARES: %q", v)
+		}
+		h.RobotsAllowShares = on
+	}
+
 	mux := http.NewServeMux()
 	h.RegisterRoutes(mux)
 
-	rl := api.NewRateLimiter()
+	var handler http.Handler = mux
+	if v := os.Getenv("READ_ONLY"); v != "" && !*readOnly {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("invalid READ_ONLY: %q", v)
+		}
+		*readOnly = on
+	}
+	if *readOnly {
+		handler = api.ReadOnly(handler)
+		fmt.Println("read-only mode: writes are disabled")
+	}
+
+	// RETENTION_DAYS archives projects idle for that many days; off by default.
+	if v := os.Getenv("RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			log.Fatalf("invalid RETENTION_DAYS: %q", v)
+		}
+		if days > 0 && !*readOnly {
+			runner := &retention.Runner{DB: database, MaxIdle: time.Duration(days) * 24 * time.Hour}
+			runner.Start(context.Background(), time.Hour)
+			fmt.Printf("retention enabled (projects idle %d days are archived)\n", days)
+		}
+	}
+	if username, password, ok := basicAuthFromEnv(); ok {
+		if h.Auth != nil {
+			fmt.Println("basic auth ignored: Google OAuth is configured")
+		} else {
+			handler = basicAuth(handler, username, password)
+			fmt.Printf("basic auth enabled (everyone signs in as %q)\n", username)
+		}
+	}
+
+	timeouts, err := timeoutsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	addr := fmt.Sprintf(":%d", *port)
-	fmt.Printf("server running on %s\n", addr)
-	log.Fatal(http.ListenAndServe(addr, securityHeaders(rl.Middleware(mux))))
+	fmt.Printf("server %s running on %s\n", version.String(), addr)
+	if h.BasePath != "" {
+		fmt.Printf("serving under %s/\n", h.BasePath)
+	}
+	handler = securityHeaders(rl.Middleware(handler), cspFromEnv())
+	srv := newServer(addr, api.WithBasePath(h.BasePath, handler), timeouts)
+	if tlsCfg.Enabled() {
+		fmt.Println("serving HTTPS (HTTP/2 enabled)")
+	}
+	log.Fatal(tlsCfg.listenAndServe(srv))
+}
+
+// isFramedPath reports whether path serves design files, which the viewer
+// (or an external embed) shows in an iframe.
+func isFramedPath(path string) bool {
+	if strings.HasPrefix(path, "/designs/") || strings.HasPrefix(path, "/embed/") {
+		return true
+	}
+	// Public share links: /p/{token}/designs/...
+	if rest, ok := strings.CutPrefix(path, "/p/"); ok {
+		_, after, _ := strings.Cut(rest, "/")
+		return strings.HasPrefix(after, "designs/")
+	}
+	return false
 }
 
-func securityHeaders(next http.Handler) http.Handler {
+// securityHeaders sets the security headers on every response. Design
+// files are uploaded content shown in an iframe, so they get neither
+// X-Frame-Options nor the app's CSP; an empty csp leaves the CSP off.
+func securityHeaders(next http.Handler, csp string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("X-Content-Type-Options", "nosniff")
-		if !strings.HasPrefix(r.URL.Path, "/designs/") {
+		if !isFramedPath(r.URL.Path) {
 			w.Header().Set("X-Frame-Options", "DENY")
+			if csp != "" {
+				w.Header().Set("Content-Security-Policy", csp)
+			}
 		}
 		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
 		w.Header().Set("Permissions-Policy", "camera=(), microphone=(), geolocation=()")
@@ -1,21 +1,35 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/ab/design-reviewer/internal/api"
+	"github.com/ab/design-reviewer/internal/auth"
+	"github.com/ab/design-reviewer/internal/db"
+	"github.com/ab/design-reviewer/internal/storage"
 )
 
 func TestSecurityHeaders(t *testing.T) {
 	handler := securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
-	}))
+	}), defaultCSP)
 
 	expected := map[string]string{
 		"X-Content-Type-Options": "nosniff",
 		"X-Frame-Options":       "DENY",
 		"Referrer-Policy":       "strict-origin-when-cross-origin",
 		"Permissions-Policy":    "camera=(), microphone=(), geolocation=()",
+		"Content-Security-Policy": defaultCSP,
 	}
 
 	for _, method := range []string{"GET", "POST", "PUT", "DELETE"} {
@@ -33,10 +47,35 @@ func TestSecurityHeaders(t *testing.T) {
 	}
 }
 
+func TestSecurityHeadersEmbedNoFrameOptions(t *testing.T) {
+	handler := securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), defaultCSP)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/embed/v/1/sig/index.html", nil))
+	if got := rr.Header().Get("X-Frame-Options"); got != "" {
+		t.Errorf("X-Frame-Options on /embed/ path: got %q, want empty", got)
+	}
+}
+
+func TestSecurityHeadersPublicShareDesigns(t *testing.T) {
+	handler := securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), defaultCSP)
+	cases := map[string]string{
+		"/p/tok/designs/v/index.html": "",
+		"/p/tok":                      "DENY",
+		"/p/tok/api/versions/v/flow":  "DENY",
+	}
+	for path, want := range cases {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if got := rr.Header().Get("X-Frame-Options"); got != want {
+			t.Errorf("%s: X-Frame-Options = %q, want %q", path, got, want)
+		}
+	}
+}
+
 func TestSecurityHeadersDesignsNoFrameOptions(t *testing.T) {
 	handler := securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
-	}))
+	}), defaultCSP)
 
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest("GET", "/designs/some-version/index.html", nil)
@@ -55,7 +94,7 @@ func TestSecurityHeadersPreserveInnerHandler(t *testing.T) {
 		w.Header().Set("X-Custom", "test")
 		w.WriteHeader(http.StatusTeapot)
 		w.Write([]byte("hello"))
-	}))
+	}), defaultCSP)
 
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest("GET", "/any-path", nil)
@@ -71,3 +110,268 @@ func TestSecurityHeadersPreserveInnerHandler(t *testing.T) {
 		t.Errorf("body: got %q, want %q", rr.Body.String(), "hello")
 	}
 }
+
+func TestContentSecurityPolicyOnApp(t *testing.T) {
+	database, err := db.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	store := storage.New(filepath.Join(t.TempDir(), "uploads"))
+	p, _ := database.CreateProject("csp", "")
+	v, _ := database.CreateVersion(p.ID, "")
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	f, _ := zw.Create("index.html")
+	f.Write([]byte("<script>alert(1)</script>"))
+	zw.Close()
+	if err := store.SaveUpload(v.ID, &zipBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &api.Handler{DB: database, Storage: store, TemplatesDir: "../../web/templates", StaticDir: "../../web/static"}
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	handler := securityHeaders(mux, defaultCSP)
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	for _, path := range []string{"/", "/projects/" + p.ID} {
+		rr := get(path)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Security-Policy"); got != defaultCSP {
+			t.Errorf("%s: CSP = %q", path, got)
+		}
+		// script-src 'self' blocks inline scripts, so pages must not use any.
+		if strings.Contains(rr.Body.String(), "<script>") {
+			t.Errorf("%s: page has an inline script the CSP would block", path)
+		}
+	}
+
+	for _, path := range []string{"/static/viewer-config.js", "/static/annotations.js", "/static/style.css"} {
+		if rr := get(path); rr.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", path, rr.Code)
+		}
+	}
+
+	// Uploaded designs keep their own scripts.
+	rr := get("/designs/" + v.ID + "/index.html")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("design file: expected 200, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Content-Security-Policy"); got != "" {
+		t.Errorf("design file: CSP = %q, want none", got)
+	}
+}
+
+func TestCSPFromEnv(t *testing.T) {
+	t.Setenv("CONTENT_SECURITY_POLICY", "")
+	if got := cspFromEnv(); got != defaultCSP {
+		t.Errorf("unset: got %q, want the default", got)
+	}
+	t.Setenv("CONTENT_SECURITY_POLICY", "default-src 'none'")
+	if got := cspFromEnv(); got != "default-src 'none'" {
+		t.Errorf("custom: got %q", got)
+	}
+	t.Setenv("CONTENT_SECURITY_POLICY", "off")
+	if got := cspFromEnv(); got != "" {
+		t.Errorf("off: got %q, want empty", got)
+	}
+	rr := httptest.NewRecorder()
+	securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), "").ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if got := rr.Header().Get("Content-Security-Policy"); got != "" {
+		t.Errorf("disabled CSP still sent: %q", got)
+	}
+}
+
+func TestTimeoutsFromEnv(t *testing.T) {
+	t.Setenv("SERVER_READ_TIMEOUT", "10m")
+	got, err := timeoutsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Read != 10*time.Minute || got.ReadHeader != defaultTimeouts.ReadHeader {
+		t.Errorf("unexpected timeouts: %+v", got)
+	}
+
+	t.Setenv("SERVER_IDLE_TIMEOUT", "soon")
+	if _, err := timeoutsFromEnv(); err == nil {
+		t.Error("expected error for invalid duration")
+	}
+}
+
+func TestServerDropsSlowRequest(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	ts := httptest.NewUnstartedServer(handler)
+	ts.Config = newServer("", handler, serverTimeouts{
+		ReadHeader: 100 * time.Millisecond,
+		Read:       time.Second,
+		Write:      time.Second,
+		Idle:       time.Second,
+	})
+	ts.Start()
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Start a request but never finish the headers.
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	_, err = io.ReadAll(conn)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("server kept the slow connection open")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("connection closed after %s, want about 100ms", elapsed)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	var gotName, gotEmail string
+	handler := basicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotName, gotEmail = auth.GetUserFromContext(r.Context())
+	}), "team", "s3cret")
+
+	for name, setAuth := range map[string]func(*http.Request){
+		"no header":      func(*http.Request) {},
+		"wrong password": func(r *http.Request) { r.SetBasicAuth("team", "nope") },
+		"wrong username": func(r *http.Request) { r.SetBasicAuth("other", "s3cret") },
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		setAuth(req)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, rr.Code)
+		}
+		if rr.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: missing WWW-Authenticate challenge", name)
+		}
+	}
+	if gotEmail != "" {
+		t.Fatal("handler ran for a rejected request")
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("team", "s3cret")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if gotName != "team" || gotEmail != "team@basic-auth.local" {
+		t.Errorf("synthetic user = %q <%q>", gotName, gotEmail)
+	}
+}
+
+func TestBasicAuthRobots(t *testing.T) {
+	handler := basicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), "team", "s3cret")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/robots.txt", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("robots.txt should skip basic auth, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/ping", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("/ping should skip basic auth, got %d", rr.Code)
+	}
+}
+
+func TestSeedIfEnabled(t *testing.T) {
+	newDB := func(t *testing.T) *db.DB {
+		d, err := db.New(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { d.Close() })
+		return d
+	}
+
+	t.Setenv("SEED", "")
+	d := newDB(t)
+	if p, err := seedIfEnabled(d, t.TempDir(), false); err != nil || p != nil {
+		t.Fatalf("disabled: got %v, %v", p, err)
+	}
+	if projects, _ := d.ListProjects(); len(projects) != 0 {
+		t.Errorf("disabled: expected no projects, got %d", len(projects))
+	}
+
+	if p, err := seedIfEnabled(d, t.TempDir(), true); err != nil || p == nil {
+		t.Fatalf("--seed: got %v, %v", p, err)
+	}
+	// Seeding again finds the database in use and creates nothing.
+	if p, _ := seedIfEnabled(d, t.TempDir(), true); p != nil {
+		t.Error("second seed should create nothing")
+	}
+	if projects, _ := d.ListProjects(); len(projects) != 1 {
+		t.Errorf("expected 1 project, got %d", len(projects))
+	}
+
+	t.Setenv("SEED", "true")
+	if p, err := seedIfEnabled(newDB(t), t.TempDir(), false); err != nil || p == nil {
+		t.Errorf("SEED=true: got %v, %v", p, err)
+	}
+	t.Setenv("SEED", "sometimes")
+	if _, err := seedIfEnabled(newDB(t), t.TempDir(), false); err == nil {
+		t.Error("expected an error for an invalid SEED")
+	}
+}
+
+func TestTLSFromFlags(t *testing.T) {
+	t.Setenv("TLS_AUTOCERT_DOMAIN", "")
+	plain, err := tlsFromFlags("", "")
+	if err != nil || plain.Enabled() {
+		t.Fatalf("default should be plain HTTP: %+v, %v", plain, err)
+	}
+	if _, err := tlsFromFlags("cert.pem", ""); err == nil {
+		t.Error("expected error for cert without key")
+	}
+
+	files, err := tlsFromFlags("cert.pem", "key.pem")
+	if err != nil || !files.Enabled() || files.Autocert != nil {
+		t.Fatalf("cert and key should enable TLS: %+v, %v", files, err)
+	}
+	srv := newServer(":0", http.NotFoundHandler(), defaultTimeouts)
+	files.apply(srv)
+	if srv.TLSConfig != nil {
+		t.Error("cert files shouldn't replace the default TLS config")
+	}
+
+	t.Setenv("TLS_AUTOCERT_DOMAIN", "review.example.com, www.example.com")
+	t.Setenv("TLS_AUTOCERT_CACHE", t.TempDir())
+	if _, err := tlsFromFlags("cert.pem", "key.pem"); err == nil {
+		t.Error("expected error combining autocert with a cert")
+	}
+	ac, err := tlsFromFlags("", "")
+	if err != nil || !ac.Enabled() || ac.Autocert == nil {
+		t.Fatalf("autocert should enable TLS: %+v, %v", ac, err)
+	}
+	if err := ac.Autocert.HostPolicy(nil, "www.example.com"); err != nil {
+		t.Errorf("listed domain rejected: %v", err)
+	}
+	if err := ac.Autocert.HostPolicy(nil, "other.example.com"); err == nil {
+		t.Error("unlisted domain accepted")
+	}
+	srv = newServer(":0", http.NotFoundHandler(), defaultTimeouts)
+	ac.apply(srv)
+	if srv.TLSConfig == nil || !slices.Contains(srv.TLSConfig.NextProtos, "h2") {
+		t.Error("autocert TLS config should offer HTTP/2")
+	}
+
+	// TLS makes the session cookie Secure even with an http:// BaseURL.
+	cfg := &auth.Config{BaseURL: "http://localhost:8080", SecureCookies: ac.Enabled()}
+	if !cfg.Secure() {
+		t.Error("cookies should be Secure when TLS is on")
+	}
+}
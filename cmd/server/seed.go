@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ab/design-reviewer/internal/db"
+	"github.com/ab/design-reviewer/internal/seed"
+)
+
+// seedIfEnabled creates the demo project when --seed or SEED=true asks for
+// it. Seeding is off by default so production instances start empty. It
+// returns the project created, if any.
+func seedIfEnabled(database *db.DB, uploadsDir string, flagOn bool) (*db.Project, error) {
+	on := flagOn
+	if v := os.Getenv("SEED"); v != "" && !flagOn {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SEED: %q", v)
+		}
+		on = b
+	}
+	if !on {
+		return nil, nil
+	}
+	return seed.Run(database, uploadsDir), nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// serverTimeouts bounds how long a client may hold a connection, so slow or
+// stalled clients can't tie up the server.
+type serverTimeouts struct {
+	ReadHeader time.Duration
+	Read       time.Duration // whole request including body; must fit a 50 MB upload on a slow link
+	Write      time.Duration // counted from the end of the headers, so it includes reading the body
+	Idle       time.Duration
+}
+
+var defaultTimeouts = serverTimeouts{
+	ReadHeader: 10 * time.Second,
+	Read:       5 * time.Minute,
+	Write:      6 * time.Minute,
+	Idle:       2 * time.Minute,
+}
+
+// timeoutsFromEnv returns defaultTimeouts with any of SERVER_READ_HEADER_TIMEOUT,
+// SERVER_READ_TIMEOUT, SERVER_WRITE_TIMEOUT and SERVER_IDLE_TIMEOUT applied.
+func timeoutsFromEnv() (serverTimeouts, error) {
+	t := defaultTimeouts
+	for _, v := range []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"SERVER_READ_HEADER_TIMEOUT", &t.ReadHeader},
+		{"SERVER_READ_TIMEOUT", &t.Read},
+		{"SERVER_WRITE_TIMEOUT", &t.Write},
+		{"SERVER_IDLE_TIMEOUT", &t.Idle},
+	} {
+		s := os.Getenv(v.env)
+		if s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return t, fmt.Errorf("invalid %s: %q", v.env, s)
+		}
+		*v.dst = d
+	}
+	return t, nil
+}
+
+func newServer(addr string, handler http.Handler, t serverTimeouts) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: t.ReadHeader,
+		ReadTimeout:       t.Read,
+		WriteTimeout:      t.Write,
+		IdleTimeout:       t.Idle,
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsSettings says how the server terminates TLS itself. The zero value
+// serves plain HTTP, which suits running behind a proxy.
+type tlsSettings struct {
+	CertFile, KeyFile string
+	// Autocert obtains certificates from Let's Encrypt for the domains in
+	// TLS_AUTOCERT_DOMAIN; nil unless that is set.
+	Autocert *autocert.Manager
+}
+
+// Enabled reports whether the server should serve HTTPS.
+func (t tlsSettings) Enabled() bool {
+	return t.Autocert != nil || t.CertFile != ""
+}
+
+// tlsFromFlags builds tlsSettings from the --tls-cert and --tls-key flags,
+// or from TLS_AUTOCERT_DOMAIN (comma-separated) and TLS_AUTOCERT_CACHE
+// (default ./data/autocert). A cert and key, and autocert, are exclusive.
+func tlsFromFlags(certFile, keyFile string) (tlsSettings, error) {
+	if (certFile == "") != (keyFile == "") {
+		return tlsSettings{}, errors.New("--tls-cert and --tls-key must be set together")
+	}
+	var domains []string
+	for _, d := range strings.Split(os.Getenv("TLS_AUTOCERT_DOMAIN"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	if len(domains) == 0 {
+		return tlsSettings{CertFile: certFile, KeyFile: keyFile}, nil
+	}
+	if certFile != "" {
+		return tlsSettings{}, errors.New("TLS_AUTOCERT_DOMAIN can't be combined with --tls-cert")
+	}
+	cache := os.Getenv("TLS_AUTOCERT_CACHE")
+	if cache == "" {
+		cache = "./data/autocert"
+	}
+	return tlsSettings{Autocert: &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(cache),
+	}}, nil
+}
+
+// apply configures srv for autocert; with a cert and key, the defaults
+// ServeTLS uses already negotiate HTTP/2.
+func (t tlsSettings) apply(srv *http.Server) {
+	if t.Autocert != nil {
+		srv.TLSConfig = t.Autocert.TLSConfig()
+	}
+}
+
+// listenAndServe serves srv over HTTPS when TLS is enabled and plain HTTP
+// otherwise. With autocert it also answers ACME HTTP-01 challenges on :80,
+// redirecting every other request there to HTTPS.
+func (t tlsSettings) listenAndServe(srv *http.Server) error {
+	if !t.Enabled() {
+		return srv.ListenAndServe()
+	}
+	t.apply(srv)
+	if t.Autocert != nil {
+		go func() {
+			if err := http.ListenAndServe(":80", t.Autocert.HTTPHandler(nil)); err != nil {
+				log.Printf("autocert http-01 listener: %v", err)
+			}
+		}()
+	}
+	return srv.ListenAndServeTLS(t.CertFile, t.KeyFile)
+}
@@ -218,11 +218,28 @@ func TestUploadRejectsZipWithoutHTML(t *testing.T) {
 	fw.Write(z)
 	mw.Close()
 
-	resp, _ := http.Post(env.Server.URL+"/api/upload", mw.FormDataContentType(), &body)
-	resp.Body.Close()
+	resp, err := http.Post(env.Server.URL+"/api/upload", mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
 	if resp.StatusCode != 400 {
 		t.Errorf("expected 400 for zip without html, got %d", resp.StatusCode)
 	}
+	var res struct {
+		Error      string   `json:"error"`
+		Required   string   `json:"required"`
+		FoundTypes []string `json:"found_types"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("expected JSON error body: %v", err)
+	}
+	if !strings.Contains(res.Error, "at least one .html file") || res.Required != ".html" {
+		t.Errorf("error should name the .html requirement, got %+v", res)
+	}
+	if len(res.FoundTypes) != 1 || res.FoundTypes[0] != ".txt" {
+		t.Errorf("found_types = %v, want [.txt]", res.FoundTypes)
+	}
 }
 
 func TestStorageListHTMLFiles(t *testing.T) {
@@ -533,6 +550,87 @@ func TestViewerIframeServesDesign(t *testing.T) {
 	}
 }
 
+func TestDesignAssetContentTypes(t *testing.T) {
+	env := setup(t)
+	z := makeZip(t, map[string]string{
+		"index.html": `<script type="module" src="app.mjs"></script>`,
+		"app.mjs":    "export const x = 1;",
+		"img.webp":   "RIFF\x00\x00\x00\x00WEBPVP8 ",
+	})
+	res := uploadZip(t, env.Server.URL, "mime-proj", z)
+	vid := res["version_id"].(string)
+
+	for file, want := range map[string]string{
+		"app.mjs":  "text/javascript",
+		"img.webp": "image/webp",
+	} {
+		resp, err := http.Get(env.Server.URL + "/designs/" + vid + "/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Fatalf("%s: expected 200, got %d", file, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, want) {
+			t.Errorf("%s: Content-Type = %q, want %s", file, ct, want)
+		}
+	}
+}
+
+func TestDesignFileRangeAndHead(t *testing.T) {
+	env := setup(t)
+	z := makeZip(t, map[string]string{
+		"index.html": "<h1>range</h1>",
+		"clip.txt":   "0123456789",
+	})
+	res := uploadZip(t, env.Server.URL, "range-proj", z)
+	vid := res["version_id"].(string)
+	fileURL := env.Server.URL + "/designs/" + vid + "/clip.txt"
+
+	req, _ := http.NewRequest("GET", fileURL, nil)
+	req.Header.Set("Range", "bytes=2-5")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("expected 206, got %d", resp.StatusCode)
+	}
+	if string(b) != "2345" {
+		t.Errorf("range body = %q, want %q", b, "2345")
+	}
+	if cr := resp.Header.Get("Content-Range"); cr != "bytes 2-5/10" {
+		t.Errorf("Content-Range = %q, want bytes 2-5/10", cr)
+	}
+
+	resp, err = http.Head(fileURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("HEAD: expected 200, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" || resp.ContentLength != 10 {
+		t.Errorf("HEAD: Accept-Ranges = %q, Content-Length = %d", resp.Header.Get("Accept-Ranges"), resp.ContentLength)
+	}
+
+	// Path traversal is still rejected before any range handling.
+	req, _ = http.NewRequest("GET", env.Server.URL+"/designs/"+vid+"/..%2F..%2Fdesign-reviewer.db", nil)
+	req.Header.Set("Range", "bytes=0-3")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusOK {
+		t.Errorf("traversal: expected rejection, got %d", resp.StatusCode)
+	}
+}
+
 // --- Phase 5: Annotations ---
 
 func TestCreateCommentAndGetComments(t *testing.T) {
@@ -708,6 +806,29 @@ func TestCommentCarryOverIntegration(t *testing.T) {
 	}
 }
 
+func TestUploadReportsOpenCommentCount(t *testing.T) {
+	env := setup(t)
+	z := makeZip(t, map[string]string{"index.html": "x"})
+
+	res1 := uploadZip(t, env.Server.URL, "gate-proj", z)
+	if res1["open_comment_count"].(float64) != 0 {
+		t.Errorf("first upload open_comment_count = %v, want 0", res1["open_comment_count"])
+	}
+	vid1 := res1["version_id"].(string)
+
+	body := `{"page":"index.html","x_percent":10,"y_percent":20,"author_name":"Alice","author_email":"a@t.com","body":"fix the header"}`
+	resp, err := http.Post(env.Server.URL+"/api/versions/"+vid1+"/comments", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	res2 := uploadZip(t, env.Server.URL, "gate-proj", z)
+	if res2["open_comment_count"].(float64) != 1 {
+		t.Errorf("open_comment_count = %v, want 1", res2["open_comment_count"])
+	}
+}
+
 func TestViewerHasAnnotationElements(t *testing.T) {
 	env := setup(t)
 	z := makeZip(t, map[string]string{"index.html": "x"})
@@ -2055,13 +2176,13 @@ func TestMembersAPIReturnsHTMLSpecialCharsUnescaped(t *testing.T) {
 	if resp.StatusCode != 200 {
 		t.Fatalf("expected 200, got %d", resp.StatusCode)
 	}
-	var members []map[string]string
+	var members []map[string]any
 	json.NewDecoder(resp.Body).Decode(&members)
-	if len(members) != 1 {
-		t.Fatalf("expected 1 member, got %d", len(members))
+	if len(members) != 2 {
+		t.Fatalf("expected owner and 1 member, got %d", len(members))
 	}
-	if members[0]["email"] != xssEmail {
-		t.Errorf("email = %q, want %q", members[0]["email"], xssEmail)
+	if members[1]["email"] != xssEmail {
+		t.Errorf("email = %q, want %q", members[1]["email"], xssEmail)
 	}
 }
 
@@ -3333,7 +3454,7 @@ func TestInviteExpiredTokenRejected(t *testing.T) {
 	token := invRes["invite_url"][strings.LastIndex(invRes["invite_url"], "/")+1:]
 
 	// Expire the invite
-	env.DB.Exec(`UPDATE project_invites SET expires_at = datetime('now', '-1 hour') WHERE token = ?`, token)
+	env.DB.Exec(`UPDATE project_invites SET expires_at = datetime('now', '-1 hour') WHERE id = ?`, invRes["id"])
 
 	// Bob tries to accept expired invite
 	bobSession, _ := authpkg.SignSession("test-secret", authpkg.User{Name: "Bob", Email: "bob@test.com"})
@@ -3366,7 +3487,7 @@ func TestInviteNullExpiryRejected(t *testing.T) {
 	token := invRes["invite_url"][strings.LastIndex(invRes["invite_url"], "/")+1:]
 
 	// Set expires_at to NULL (simulate legacy invite)
-	env.DB.Exec(`UPDATE project_invites SET expires_at = NULL WHERE token = ?`, token)
+	env.DB.Exec(`UPDATE project_invites SET expires_at = NULL WHERE id = ?`, invRes["id"])
 
 	// Bob tries to accept NULL-expiry invite
 	bobSession, _ := authpkg.SignSession("test-secret", authpkg.User{Name: "Bob", Email: "bob@test.com"})
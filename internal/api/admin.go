@@ -0,0 +1,27 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// handleAdminListUsers lists every user seen on the instance with how many
+// projects they own. Routed behind adminOnly.
+func (h *Handler) handleAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.DB.ListUsers()
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	type apiUser struct {
+		Email         string `json:"email"`
+		Name          string `json:"name"`
+		OwnedProjects int    `json:"owned_projects"`
+	}
+	out := make([]apiUser, len(users))
+	for i, u := range users {
+		out[i] = apiUser{Email: u.Email, Name: u.Name, OwnedProjects: u.OwnedProjects}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ab/design-reviewer/internal/db"
+)
+
+func TestHandleAdminListUsers(t *testing.T) {
+	h := setupTestHandler(t)
+	h.Admins = []string{"Root@Test.com"}
+	mine, _ := h.DB.CreateProject("mine", "alice@test.com")
+	h.DB.CreateProject("also-mine", "alice@test.com")
+	h.DB.AddMember(mine.ID, "bob@test.com")
+	coOwned, _ := h.DB.CreateProject("co-owned", "alice@test.com")
+	h.DB.AddMember(coOwned.ID, "carol@test.com")
+	h.DB.SetMemberRole(coOwned.ID, "carol@test.com", db.RoleOwner)
+	h.DB.CreateToken("tok", "Dave", "dave@test.com")
+
+	mux := h.adminOnly(http.HandlerFunc(h.handleAdminListUsers))
+	get := func(name, email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/admin/users", nil)
+		if email != "" {
+			req = withUser(req, name, email)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("Root", "root@test.com")
+	if w.Code != 200 {
+		t.Fatalf("admin: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var users []struct {
+		Email         string `json:"email"`
+		Name          string `json:"name"`
+		OwnedProjects int    `json:"owned_projects"`
+	}
+	json.NewDecoder(w.Body).Decode(&users)
+	got := map[string]int{}
+	for _, u := range users {
+		got[u.Email] = u.OwnedProjects
+	}
+	want := map[string]int{"alice@test.com": 3, "bob@test.com": 0, "carol@test.com": 1, "dave@test.com": 0}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d users, got %v", len(want), got)
+	}
+	for email, n := range want {
+		if got[email] != n {
+			t.Errorf("%s: owned_projects = %d, want %d", email, got[email], n)
+		}
+	}
+	if users[len(users)-1].Name != "Dave" {
+		t.Errorf("expected the token's user name, got %+v", users[len(users)-1])
+	}
+
+	if w := get("Alice", "alice@test.com"); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: expected 403, got %d", w.Code)
+	}
+	if w := get("", ""); w.Code != http.StatusNotFound {
+		t.Errorf("anonymous: expected 404, got %d", w.Code)
+	}
+}
+
+func logoUpload(t *testing.T, filename string, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("logo", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	mw.Close()
+	req := httptest.NewRequest("POST", "/api/admin/branding", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestHandleAdminSetLogo(t *testing.T) {
+	h := setupTestHandler(t)
+	h.Admins = []string{"root@test.com"}
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDRlogo")
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/branding/logo", nil))
+		return w
+	}
+
+	// Without an upload, the bundled logo is served.
+	w := get()
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "<svg") {
+		t.Fatalf("default: expected the bundled SVG, got %d: %.60s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, withUser(logoUpload(t, "logo.png", png), "Alice", "alice@test.com"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: expected 403, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, withUser(logoUpload(t, "logo.txt", []byte("not an image")), "Root", "root@test.com"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("non-image: expected 400, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, withUser(logoUpload(t, "logo.png", png), "Root", "root@test.com"))
+	if w.Code != 200 {
+		t.Fatalf("admin: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = get()
+	if w.Code != 200 || !bytes.Equal(w.Body.Bytes(), png) {
+		t.Fatalf("expected the uploaded logo, got %d: %q", w.Code, w.Body.Bytes())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "max-age") {
+		t.Errorf("Cache-Control = %q, want it cached", cc)
+	}
+	if w.Header().Get("Last-Modified") == "" {
+		t.Error("expected Last-Modified for revalidation")
+	}
+}
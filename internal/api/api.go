@@ -4,9 +4,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/ab/design-reviewer/internal/auth"
 	"github.com/ab/design-reviewer/internal/db"
+	"github.com/ab/design-reviewer/internal/mail"
 	"github.com/ab/design-reviewer/internal/storage"
 )
 
@@ -29,6 +32,14 @@ func (n noDirFS) Open(name string) (http.File, error) {
 	return f, nil
 }
 
+// staticFile serves a single file from StaticDir at a root-level path, for
+// things browsers request without being told (favicon, manifest).
+func (h *Handler) staticFile(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(h.StaticDir, name))
+	}
+}
+
 // DataStore abstracts database operations for testability.
 type DataStore interface {
 	CreateProject(name, ownerEmail string) (*db.Project, error)
@@ -36,32 +47,97 @@ type DataStore interface {
 	GetProjectByName(name string) (*db.Project, error)
 	ListProjectsWithVersionCount() ([]db.ProjectWithVersionCount, error)
 	ListProjectsWithVersionCountForUser(email string) ([]db.ProjectWithVersionCount, error)
+	GetProjectSummary(email string) (*db.ProjectSummary, error)
 	UpdateProjectStatus(id, status string) error
+	UpdateProjectStatuses(ids []string, status string) error
 	CreateVersion(projectID, storagePath string) (*db.Version, error)
+	CreateVersionBy(projectID, storagePath, createdBy string) (*db.Version, error)
+	SetVersionUploadInfo(id, filename, source string) error
+	SetVersionChecksum(id, sum string) error
+	SetVersionWarnings(id string, warnings []string) error
+	SetPageTitles(versionID string, titles map[string]string) error
+	SetCanvasSize(versionID string, width, height int) error
+	ImportProject(name, ownerEmail, status string, versions []db.ImportedVersion, save func(ids []string) error) (*db.Project, []string, error)
 	GetVersion(id string) (*db.Version, error)
 	GetLatestVersion(projectID string) (*db.Version, error)
 	ListVersions(projectID string) ([]db.Version, error)
+	ListVersionsPage(projectID string, limit, offset int) ([]db.Version, int, error)
+	GetPageOrder(versionID string) ([]string, error)
+	SetPageOrder(versionID string, pages []string) error
 	CreateComment(versionID, page string, xPct, yPct float64, authorName, authorEmail, body string) (*db.Comment, error)
+	CreateCommentWithAnchor(versionID, page string, xPct, yPct float64, anchor, authorName, authorEmail, body string) (*db.Comment, error)
 	GetCommentsForVersion(versionID string) ([]db.Comment, error)
+	CountCommentsForVersion(versionID string) (int, error)
 	GetUnresolvedCommentsUpTo(versionID string) ([]db.Comment, error)
+	GetVersionCommentsOnPage(versionID, page string) ([]db.Comment, error)
 	GetComment(id string) (*db.Comment, error)
-	ToggleResolve(commentID string) (bool, error)
+	ToggleResolve(commentID, actorEmail string) (bool, error)
+	ResolveCommentsByAuthor(versionID, authorEmail, actorEmail string) (int, error)
+	GetSetting(key string) ([]byte, time.Time, error)
+	SetSettings(values map[string][]byte) error
+	GetDisplayName(email string) (string, error)
+	SetDisplayName(email, name string) error
+	ResolveWithReply(commentID, actorName, actorEmail, body string) (*db.Reply, error)
+	GetCommentEvents(commentID string) ([]db.CommentEvent, error)
+	GetCommentMetrics(projectID string) (*db.CommentMetrics, error)
 	MoveComment(id string, x, y float64) error
+	MoveCommentWithAnchor(id string, x, y float64, anchor string) error
+	UpdateCommentPage(id, page string) error
+	MoveCommentsToPage(versionID, from, to string) (int, error)
+	SetCommentAssignee(id, email string) error
+	GetDefaultAssignee(projectID string) (string, error)
+	GetDefaultAssigneeForVersion(versionID string) (string, error)
+	SetDefaultAssignee(projectID, email string) error
+	GetProjectVisibility(projectID string) (string, error)
+	SetProjectVisibility(projectID, visibility string) error
+	GetPinnedVersion(projectID string) (string, error)
+	SetPinnedVersion(projectID, versionID string) error
+	SetProjectKeep(projectID string, keep bool) error
+	GetProjectRetention(projectID string) (keep, archived bool, err error)
+	GetRequireResolvedForApproval(projectID string) (bool, error)
+	SetRequireResolvedForApproval(projectID string, required bool) error
 	CreateReply(commentID, authorName, authorEmail, body string) (*db.Reply, error)
 	GetReplies(commentID string) ([]db.Reply, error)
+	GetReply(id string) (*db.Reply, error)
+	ToggleReplyResolve(replyID string) (bool, error)
 	CreateToken(token, userName, userEmail string) error
 	GetUserByToken(token string) (name, email string, err error)
 	CanAccessProject(projectID, email string) (bool, error)
+	CanWriteProject(projectID, email string) (bool, error)
 	GetProjectOwner(projectID string) (string, error)
+	IsOwner(projectID, email string) (bool, error)
 	CreateInvite(projectID, createdBy string) (*db.ProjectInvite, error)
+	CreateShortInvite(projectID, createdBy string) (*db.ProjectInvite, error)
 	GetInviteByToken(token string) (*db.ProjectInvite, error)
 	DeleteInvite(id string) error
 	AddMember(projectID, email string) error
 	ListMembers(projectID string) ([]db.ProjectMember, error)
 	RemoveMember(projectID, email string) error
+	SetMemberRole(projectID, email, role string) error
+	IsMemberOfAnyProject(email string) (bool, error)
+	CreatePublicShare(projectID, createdBy, commentMode string) (*db.PublicShare, error)
+	GetPublicShareByToken(token string) (*db.PublicShare, error)
+	ListPublicShares(projectID string) ([]db.PublicShare, error)
+	SetPublicShareCommentMode(projectID, id, commentMode string) error
+	DeletePublicShare(projectID, id string) error
+	CreateCommentTemplate(projectID, body, createdBy string) (*db.CommentTemplate, error)
+	ListCommentTemplates(projectID string) ([]db.CommentTemplate, error)
+	DeleteCommentTemplate(projectID, id string) error
+	Subscribe(projectID, email string) error
+	Unsubscribe(projectID, email string) error
+	IsSubscribed(projectID, email string) (bool, error)
+	WatchComment(commentID, email string) error
+	UnwatchComment(commentID, email string) error
+	IsWatchingComment(commentID, email string) (bool, error)
+	ListReplyNotifications(email string, limit int) ([]db.ReplyNotification, error)
 	CreateSession(id, userName, userEmail string) error
 	GetSession(id string) (string, string, error)
 	DeleteSession(id string) error
+	ListUsers() ([]db.UserSummary, error)
+	GetCommentWithReplies(id string) (*db.Comment, []db.Reply, error)
+	GetAutoInReviewOnComment(projectID string) (bool, error)
+	SetAutoInReviewOnComment(projectID string, enabled bool) error
+	StartReviewOnFirstComment(versionID string) (bool, error)
 }
 
 type Handler struct {
@@ -71,6 +147,73 @@ type Handler struct {
 	StaticDir    string
 	Auth         *auth.Config // nil = auth disabled
 	OAuthConfig  OAuthProvider
+	Mailer       mail.Sender // nil = email login disabled
+	Branding     Branding
+	WriteLimiter *RateLimiter // nil = no per-user limit on comment writes
+	Logger       *log.Logger  // nil = the standard logger
+	// MaxCommentsPerVersion caps the comments on one version; 0 means
+	// DefaultMaxCommentsPerVersion.
+	MaxCommentsPerVersion int
+	// MaxPagesPerUpload caps the HTML pages in one upload; 0 means
+	// DefaultMaxPagesPerUpload.
+	MaxPagesPerUpload int
+	// KeepAliveInterval is how often an open viewer pings /ping to keep an
+	// auto-stopping machine awake; 0 means DefaultKeepAliveInterval and a
+	// negative value disables the pings.
+	KeepAliveInterval time.Duration
+	// BasePath is the subpath the app is served under, such as
+	// "/design-reviewer", or "" at the root. Routes are registered without
+	// it (see WithBasePath); it is added to every URL the app generates.
+	BasePath string
+	// RobotsAllowShares lets crawlers index public share links (/p/);
+	// robots.txt disallows them by default.
+	RobotsAllowShares bool
+	// DisablePublic turns off every way in without signing in, whatever
+	// projects are configured for: public share links, public projects
+	// and embed URLs. Pair it with db.DB.PrivateOnly, which stops org
+	// visibility from granting access.
+	DisablePublic bool
+	// Admins are the emails of instance admins, who can use the /api/admin
+	// routes. Empty means nobody can.
+	Admins []string
+}
+
+// errPublicDisabled is the 403 for requests to set up public access on a
+// server running with DisablePublic.
+const errPublicDisabled = "public access is disabled on this server"
+
+// link prefixes an app path with the base path.
+func (h *Handler) link(path string) string {
+	return h.BasePath + path
+}
+
+func (h *Handler) logger() *log.Logger {
+	if h.Logger != nil {
+		return h.Logger
+	}
+	return log.Default()
+}
+
+// Branding customizes the app name and logo shown in page templates.
+type Branding struct {
+	AppName string
+	LogoURL string
+}
+
+const defaultAppName = "Design Reviewer"
+
+// brand returns the configured branding with defaults filled in. Without a
+// configured logo URL, pages show /branding/logo, which serves the logo an
+// admin uploaded or the bundled one.
+func (h *Handler) brand() Branding {
+	b := h.Branding
+	if b.AppName == "" {
+		b.AppName = defaultAppName
+	}
+	if b.LogoURL == "" {
+		b.LogoURL = h.link("/branding/logo")
+	}
+	return b
 }
 
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
@@ -82,81 +225,286 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 		mux.HandleFunc("POST /api/auth/token", h.handleTokenExchange)
 		mux.HandleFunc("GET /auth/logout", h.handleLogout)
 		mux.HandleFunc("GET /login", h.handleLoginPage)
+		mux.HandleFunc("POST /auth/email", h.handleEmailLogin)
+		mux.HandleFunc("GET /auth/email/verify", h.handleEmailVerify)
+		// Signed embed URLs (no session; the signature grants access)
+		mux.HandleFunc("GET /embed/{version_id}/{exp}/{sig}/{filepath...}", h.handleEmbedFile)
 	}
 
 	// Static files (no auth)
 	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServer(noDirFS{http.Dir(h.StaticDir)})))
+	mux.HandleFunc("GET /favicon.ico", h.staticFile("favicon.ico"))
+	mux.HandleFunc("GET /site.webmanifest", h.staticFile("site.webmanifest"))
+	mux.HandleFunc("GET /robots.txt", h.handleRobots)
+	mux.HandleFunc("GET /branding/logo", h.handleBrandingLogo)
+	mux.HandleFunc("POST /theme", h.handleSetTheme)
+
+	// Build version (no auth, for diagnostics)
+	mux.HandleFunc("GET /api/version", h.handleVersion)
+	// Keep-alive pings from the viewer (no auth, not rate-limited)
+	mux.HandleFunc("GET /ping", h.handlePing)
+
+	// Public share links (no auth). Every handler resolves the token itself
+	// and checks that the requested version or comment belongs to the shared
+	// project.
+	mux.HandleFunc("GET /p/{token}", h.handlePublicViewer)
+	mux.HandleFunc("GET /p/{token}/designs/{version_id}/{filepath...}", h.handlePublicDesignFile)
+	mux.HandleFunc("GET /p/{token}/api/projects/{id}/versions", h.handlePublicListVersions)
+	mux.HandleFunc("GET /p/{token}/api/versions/{id}/flow", h.handlePublicGetFlow)
+	mux.HandleFunc("GET /p/{token}/api/versions/{id}/comments", h.handlePublicGetComments)
+	mux.HandleFunc("POST /p/{token}/api/versions/{id}/comments", h.handlePublicCreateComment)
+	mux.HandleFunc("POST /p/{token}/api/comments/{id}/replies", h.handlePublicCreateReply)
 
 	// Web routes (web middleware)
 	webHome := http.HandlerFunc(h.handleHome)
 	webViewer := http.HandlerFunc(h.handleViewer)
 	if h.Auth != nil {
 		mux.Handle("GET /{$}", h.webMiddleware(webHome))
-		mux.Handle("GET /projects/{id}", h.webMiddleware(h.projectAccess(webViewer)))
+		// Public projects open without signing in, read-only.
+		mux.Handle("GET /projects/{id}", h.allowPublic(projectOfPath,
+			http.HandlerFunc(h.handlePublicProjectViewer), h.webMiddleware(h.projectAccess(webViewer))))
 		mux.Handle("GET /invite/{token}", h.webMiddleware(http.HandlerFunc(h.handleAcceptInvite)))
 	} else {
 		mux.Handle("GET /{$}", webHome)
 		mux.Handle("GET /projects/{id}", webViewer)
 	}
 
+	// Anything else gets the styled 404 (plain for API paths)
+	mux.HandleFunc("GET /", h.handleNotFound)
+
 	// Design files
 	designHandler := http.HandlerFunc(h.handleDesignFile)
 	if h.Auth != nil {
-		mux.Handle("GET /designs/{version_id}/{filepath...}", h.webMiddleware(h.versionAccess(designHandler)))
+		mux.Handle("GET /designs/{version_id}/{filepath...}", h.allowPublic(h.projectOfVersion("version_id"),
+			designHandler, h.webMiddleware(h.versionAccess(designHandler))))
 	} else {
 		mux.Handle("GET /designs/{version_id}/{filepath...}", designHandler)
 	}
 
 	// API routes (API middleware)
 	apiUpload := http.HandlerFunc(h.handleUpload)
+	apiUploadInit := http.HandlerFunc(h.handleUploadInit)
+	apiUploadChunk := http.HandlerFunc(h.handleUploadChunk)
+	apiUploadComplete := http.HandlerFunc(h.handleUploadComplete)
 	apiListProjects := http.HandlerFunc(h.handleListProjects)
+	apiGetSummary := http.HandlerFunc(h.handleGetSummary)
 	apiListVersions := http.HandlerFunc(h.handleListVersions)
+	apiSetPageOrder := http.HandlerFunc(h.handleSetPageOrder)
+	apiSetPinnedVersion := http.HandlerFunc(h.handleSetPinnedVersion)
+	apiSetKeep := http.HandlerFunc(h.handleSetKeep)
+	apiVersionDiff := http.HandlerFunc(h.handleVersionDiff)
+	apiExportProject := http.HandlerFunc(h.handleExportProject)
+	apiStaticSite := http.HandlerFunc(h.handleStaticSite)
+	apiImportProject := http.HandlerFunc(h.handleImportProject)
 	apiUpdateStatus := http.HandlerFunc(h.handleUpdateStatus)
 	apiGetComments := http.HandlerFunc(h.handleGetComments)
+	apiAnonGetComments := http.HandlerFunc(h.handleAnonGetComments)
 	apiCreateComment := http.HandlerFunc(h.handleCreateComment)
 	apiCreateReply := http.HandlerFunc(h.handleCreateReply)
+	apiToggleReplyResolve := http.HandlerFunc(h.handleToggleReplyResolve)
 	apiToggleResolve := http.HandlerFunc(h.handleToggleResolve)
+	apiResolveByAuthor := http.HandlerFunc(h.handleResolveByAuthor)
+	apiGetComment := http.HandlerFunc(h.handleGetComment)
+	apiVersionReport := http.HandlerFunc(h.handleVersionReport)
+	apiPageHTML := http.HandlerFunc(h.handlePageHTML)
+	apiGetCommentEvents := http.HandlerFunc(h.handleGetCommentEvents)
 	apiMoveComment := http.HandlerFunc(h.handleMoveComment)
+	apiUpdateCommentPage := http.HandlerFunc(h.handleUpdateCommentPage)
+	apiMoveCommentsPage := http.HandlerFunc(h.handleMoveCommentsPage)
+	apiGetHeatmap := http.HandlerFunc(h.handleGetHeatmap)
 
 	// Flow API handler
 	apiGetFlow := http.HandlerFunc(h.handleGetFlow)
+	apiListVersionFiles := http.HandlerFunc(h.handleListVersionFiles)
+	apiCreateEmbedURL := http.HandlerFunc(h.handleCreateEmbedURL)
 
 	// Sharing API handlers
 	apiCreateInvite := http.HandlerFunc(h.handleCreateInvite)
 	apiDeleteInvite := http.HandlerFunc(h.handleDeleteInvite)
 	apiListMembers := http.HandlerFunc(h.handleListMembers)
 	apiRemoveMember := http.HandlerFunc(h.handleRemoveMember)
+	apiSetMemberRole := http.HandlerFunc(h.handleSetMemberRole)
+	apiLeaveProject := http.HandlerFunc(h.handleLeaveProject)
+	apiCreatePublicShare := http.HandlerFunc(h.handleCreatePublicShare)
+	apiListPublicShares := http.HandlerFunc(h.handleListPublicShares)
+	apiUpdatePublicShare := http.HandlerFunc(h.handleUpdatePublicShare)
+	apiDeletePublicShare := http.HandlerFunc(h.handleDeletePublicShare)
+
+	// Comment template handlers
+	apiListCommentTemplates := http.HandlerFunc(h.handleListCommentTemplates)
+	apiCreateCommentTemplate := http.HandlerFunc(h.handleCreateCommentTemplate)
+	apiDeleteCommentTemplate := http.HandlerFunc(h.handleDeleteCommentTemplate)
+
+	// Default assignee handlers
+	apiGetDefaultAssignee := http.HandlerFunc(h.handleGetDefaultAssignee)
+	apiSetDefaultAssignee := http.HandlerFunc(h.handleSetDefaultAssignee)
+	apiGetVisibility := http.HandlerFunc(h.handleGetVisibility)
+	apiSetVisibility := http.HandlerFunc(h.handleSetVisibility)
+	apiGetApprovalSettings := http.HandlerFunc(h.handleGetApprovalSettings)
+	apiSetApprovalSettings := http.HandlerFunc(h.handleSetApprovalSettings)
+	apiGetReviewSettings := http.HandlerFunc(h.handleGetReviewSettings)
+	apiSetReviewSettings := http.HandlerFunc(h.handleSetReviewSettings)
+	apiGetMetrics := http.HandlerFunc(h.handleGetMetrics)
+	apiBulkUpdateStatus := http.HandlerFunc(h.handleBulkUpdateStatus)
+
+	// Admin handlers
+	apiAdminUsers := http.HandlerFunc(h.handleAdminListUsers)
+	apiAdminSetLogo := http.HandlerFunc(h.handleAdminSetLogo)
+
+	// User preference handlers
+	apiSetDisplayName := http.HandlerFunc(h.handleSetDisplayName)
+
+	// Digest subscription handlers
+	apiGetSubscription := http.HandlerFunc(h.handleGetSubscription)
+	apiSubscribe := http.HandlerFunc(h.handleSubscribe)
+	apiUnsubscribe := http.HandlerFunc(h.handleUnsubscribe)
+
+	// Comment watch handlers
+	apiGetWatch := http.HandlerFunc(h.handleGetWatch)
+	apiWatch := http.HandlerFunc(h.handleWatch)
+	apiUnwatch := http.HandlerFunc(h.handleUnwatch)
+	apiListNotifications := http.HandlerFunc(h.handleListNotifications)
 
 	if h.Auth != nil {
 		mux.Handle("POST /api/upload", h.apiMiddleware(apiUpload))
+		mux.Handle("POST /api/upload/init", h.apiMiddleware(apiUploadInit))
+		mux.Handle("PUT /api/upload/{uploadId}/chunk", h.apiMiddleware(apiUploadChunk))
+		mux.Handle("POST /api/upload/{uploadId}/complete", h.apiMiddleware(apiUploadComplete))
 		mux.Handle("GET /api/projects", h.apiMiddleware(apiListProjects))
-		mux.Handle("GET /api/projects/{id}/versions", h.apiMiddleware(h.projectAccess(apiListVersions)))
+		mux.Handle("GET /api/summary", h.apiMiddleware(apiGetSummary))
+		mux.Handle("GET /api/admin/users", h.apiMiddleware(h.adminOnly(apiAdminUsers)))
+		mux.Handle("POST /api/admin/branding", h.apiMiddleware(h.adminOnly(apiAdminSetLogo)))
+		mux.Handle("PATCH /api/me/display-name", h.apiMiddleware(apiSetDisplayName))
+		// The read-only calls the viewer makes also work anonymously for
+		// public projects.
+		mux.Handle("GET /api/projects/{id}/versions", h.allowPublic(projectOfPath,
+			apiListVersions, h.apiMiddleware(h.projectAccess(apiListVersions))))
+		mux.Handle("PUT /api/projects/{id}/versions/{versionID}/page-order", h.apiMiddleware(h.ownerOnly(apiSetPageOrder)))
+		mux.Handle("PATCH /api/projects/{id}/pinned-version", h.apiMiddleware(h.ownerOnly(apiSetPinnedVersion)))
+		mux.Handle("PATCH /api/projects/{id}/keep", h.apiMiddleware(h.ownerOnly(apiSetKeep)))
+		mux.Handle("GET /api/projects/{id}/versions/{from}/diff/{to}", h.apiMiddleware(h.projectAccess(apiVersionDiff)))
+		mux.Handle("GET /api/projects/{id}/archive", h.apiMiddleware(h.ownerOnly(apiExportProject)))
+		mux.Handle("GET /api/projects/{id}/static-site.zip", h.apiMiddleware(h.ownerOnly(apiStaticSite)))
+		mux.Handle("POST /api/import", h.apiMiddleware(apiImportProject))
 		mux.Handle("PATCH /api/projects/{id}/status", h.apiMiddleware(h.ownerOnly(apiUpdateStatus)))
-		mux.Handle("GET /api/versions/{id}/comments", h.apiMiddleware(h.versionAccess(apiGetComments)))
-		mux.Handle("POST /api/versions/{id}/comments", h.apiMiddleware(h.versionAccess(apiCreateComment)))
-		mux.Handle("POST /api/comments/{id}/replies", h.apiMiddleware(h.commentAccess(apiCreateReply)))
-		mux.Handle("PATCH /api/comments/{id}/resolve", h.apiMiddleware(h.commentAccess(apiToggleResolve)))
-		mux.Handle("PATCH /api/comments/{id}/move", h.apiMiddleware(h.commentAccess(apiMoveComment)))
-		mux.Handle("GET /api/versions/{id}/flow", h.apiMiddleware(h.versionAccess(apiGetFlow)))
+		// Ownership is checked per project by the handler.
+		mux.Handle("POST /api/projects/status", h.apiMiddleware(apiBulkUpdateStatus))
+		mux.Handle("GET /api/versions/{id}/comments", h.allowPublic(h.projectOfVersion("id"),
+			apiAnonGetComments, h.apiMiddleware(h.versionAccess(apiGetComments))))
+		mux.Handle("POST /api/versions/{id}/comments", h.apiMiddleware(h.writeLimit(h.versionWrite(apiCreateComment))))
+		mux.Handle("POST /api/comments/{id}/replies", h.apiMiddleware(h.writeLimit(h.commentWrite(apiCreateReply))))
+		mux.Handle("PATCH /api/comments/{id}/resolve", h.apiMiddleware(h.commentWrite(apiToggleResolve)))
+		mux.Handle("POST /api/versions/{id}/comments/resolve-by-author", h.apiMiddleware(h.versionWrite(apiResolveByAuthor)))
+		mux.Handle("POST /api/versions/{id}/comments/move-page", h.apiMiddleware(h.versionWrite(apiMoveCommentsPage)))
+		mux.Handle("GET /api/comments/{id}", h.apiMiddleware(h.commentAccess(apiGetComment)))
+		mux.Handle("GET /api/comments/{id}/events", h.apiMiddleware(h.commentAccess(apiGetCommentEvents)))
+		mux.Handle("PATCH /api/replies/{id}/resolve", h.apiMiddleware(h.replyWrite(apiToggleReplyResolve)))
+		mux.Handle("PATCH /api/comments/{id}/move", h.apiMiddleware(h.commentWrite(apiMoveComment)))
+		mux.Handle("PATCH /api/comments/{id}/page", h.apiMiddleware(h.commentWrite(apiUpdateCommentPage)))
+		mux.Handle("GET /api/versions/{id}/heatmap", h.apiMiddleware(h.versionAccess(apiGetHeatmap)))
+		mux.Handle("GET /api/versions/{id}/report.html", h.apiMiddleware(h.versionAccess(apiVersionReport)))
+		mux.Handle("GET /api/versions/{id}/pages/{page}/html", h.apiMiddleware(h.versionAccess(apiPageHTML)))
+		mux.Handle("GET /api/versions/{id}/flow", h.allowPublic(h.projectOfVersion("id"),
+			apiGetFlow, h.apiMiddleware(h.versionAccess(apiGetFlow))))
+		mux.Handle("GET /api/versions/{id}/files", h.apiMiddleware(h.versionAccess(apiListVersionFiles)))
+		mux.Handle("POST /api/versions/{id}/embed-url", h.apiMiddleware(h.versionWrite(apiCreateEmbedURL)))
 		// Sharing routes
 		mux.Handle("POST /api/projects/{id}/invites", h.apiMiddleware(h.ownerOnly(apiCreateInvite)))
 		mux.Handle("DELETE /api/projects/{id}/invites/{inviteID}", h.apiMiddleware(h.ownerOnly(apiDeleteInvite)))
 		mux.Handle("GET /api/projects/{id}/members", h.apiMiddleware(h.projectAccess(apiListMembers)))
 		mux.Handle("DELETE /api/projects/{id}/members/{email}", h.apiMiddleware(h.ownerOnly(apiRemoveMember)))
+		mux.Handle("PUT /api/projects/{id}/members/{email}/role", h.apiMiddleware(h.ownerOnly(apiSetMemberRole)))
+		mux.Handle("DELETE /api/projects/{id}/membership", h.apiMiddleware(h.projectAccess(apiLeaveProject)))
+		mux.Handle("POST /api/projects/{id}/public-shares", h.apiMiddleware(h.ownerOnly(apiCreatePublicShare)))
+		mux.Handle("GET /api/projects/{id}/public-shares", h.apiMiddleware(h.ownerOnly(apiListPublicShares)))
+		mux.Handle("PATCH /api/projects/{id}/public-shares/{shareID}", h.apiMiddleware(h.ownerOnly(apiUpdatePublicShare)))
+		mux.Handle("DELETE /api/projects/{id}/public-shares/{shareID}", h.apiMiddleware(h.ownerOnly(apiDeletePublicShare)))
+		mux.Handle("GET /api/projects/{id}/comment-templates", h.apiMiddleware(h.projectAccess(apiListCommentTemplates)))
+		mux.Handle("POST /api/projects/{id}/comment-templates", h.apiMiddleware(h.ownerOnly(apiCreateCommentTemplate)))
+		mux.Handle("DELETE /api/projects/{id}/comment-templates/{templateID}", h.apiMiddleware(h.ownerOnly(apiDeleteCommentTemplate)))
+		mux.Handle("GET /api/projects/{id}/default-assignee", h.apiMiddleware(h.projectAccess(apiGetDefaultAssignee)))
+		mux.Handle("PUT /api/projects/{id}/default-assignee", h.apiMiddleware(h.ownerOnly(apiSetDefaultAssignee)))
+		mux.Handle("GET /api/projects/{id}/visibility", h.apiMiddleware(h.projectAccess(apiGetVisibility)))
+		mux.Handle("PUT /api/projects/{id}/visibility", h.apiMiddleware(h.ownerOnly(apiSetVisibility)))
+		mux.Handle("GET /api/projects/{id}/approval-settings", h.apiMiddleware(h.projectAccess(apiGetApprovalSettings)))
+		mux.Handle("PUT /api/projects/{id}/approval-settings", h.apiMiddleware(h.ownerOnly(apiSetApprovalSettings)))
+		mux.Handle("GET /api/projects/{id}/review-settings", h.apiMiddleware(h.projectAccess(apiGetReviewSettings)))
+		mux.Handle("PUT /api/projects/{id}/review-settings", h.apiMiddleware(h.ownerOnly(apiSetReviewSettings)))
+		mux.Handle("GET /api/projects/{id}/metrics", h.apiMiddleware(h.projectAccess(apiGetMetrics)))
+		// Digest subscription routes
+		mux.Handle("GET /api/projects/{id}/subscription", h.apiMiddleware(h.projectAccess(apiGetSubscription)))
+		mux.Handle("POST /api/projects/{id}/subscription", h.apiMiddleware(h.projectAccess(apiSubscribe)))
+		mux.Handle("DELETE /api/projects/{id}/subscription", h.apiMiddleware(h.projectAccess(apiUnsubscribe)))
+		// Comment watch routes
+		mux.Handle("GET /api/comments/{id}/watch", h.apiMiddleware(h.commentAccess(apiGetWatch)))
+		mux.Handle("POST /api/comments/{id}/watch", h.apiMiddleware(h.commentAccess(apiWatch)))
+		mux.Handle("DELETE /api/comments/{id}/watch", h.apiMiddleware(h.commentAccess(apiUnwatch)))
+		mux.Handle("GET /api/me/notifications", h.apiMiddleware(apiListNotifications))
 	} else {
 		mux.Handle("POST /api/upload", apiUpload)
+		mux.Handle("POST /api/upload/init", apiUploadInit)
+		mux.Handle("PUT /api/upload/{uploadId}/chunk", apiUploadChunk)
+		mux.Handle("POST /api/upload/{uploadId}/complete", apiUploadComplete)
 		mux.Handle("GET /api/projects", apiListProjects)
+		mux.Handle("GET /api/summary", apiGetSummary)
+		// Still gated: with basic auth there is a signed-in user to check.
+		mux.Handle("GET /api/admin/users", h.adminOnly(apiAdminUsers))
+		mux.Handle("POST /api/admin/branding", h.adminOnly(apiAdminSetLogo))
+		mux.Handle("PATCH /api/me/display-name", apiSetDisplayName)
 		mux.Handle("GET /api/projects/{id}/versions", apiListVersions)
+		mux.Handle("PUT /api/projects/{id}/versions/{versionID}/page-order", apiSetPageOrder)
+		mux.Handle("PATCH /api/projects/{id}/pinned-version", apiSetPinnedVersion)
+		mux.Handle("PATCH /api/projects/{id}/keep", apiSetKeep)
+		mux.Handle("GET /api/projects/{id}/versions/{from}/diff/{to}", apiVersionDiff)
+		mux.Handle("GET /api/projects/{id}/archive", apiExportProject)
+		mux.Handle("GET /api/projects/{id}/static-site.zip", apiStaticSite)
+		mux.Handle("POST /api/import", apiImportProject)
 		mux.Handle("PATCH /api/projects/{id}/status", apiUpdateStatus)
+		mux.Handle("POST /api/projects/status", apiBulkUpdateStatus)
 		mux.Handle("GET /api/versions/{id}/comments", apiGetComments)
 		mux.Handle("POST /api/versions/{id}/comments", apiCreateComment)
 		mux.Handle("POST /api/comments/{id}/replies", apiCreateReply)
 		mux.Handle("PATCH /api/comments/{id}/resolve", apiToggleResolve)
+		mux.Handle("POST /api/versions/{id}/comments/resolve-by-author", apiResolveByAuthor)
+		mux.Handle("POST /api/versions/{id}/comments/move-page", apiMoveCommentsPage)
+		mux.Handle("GET /api/comments/{id}", apiGetComment)
+		mux.Handle("GET /api/comments/{id}/events", apiGetCommentEvents)
+		mux.Handle("PATCH /api/replies/{id}/resolve", apiToggleReplyResolve)
 		mux.Handle("PATCH /api/comments/{id}/move", apiMoveComment)
+		mux.Handle("PATCH /api/comments/{id}/page", apiUpdateCommentPage)
+		mux.Handle("GET /api/versions/{id}/heatmap", apiGetHeatmap)
+		mux.Handle("GET /api/versions/{id}/report.html", apiVersionReport)
+		mux.Handle("GET /api/versions/{id}/pages/{page}/html", apiPageHTML)
 		mux.Handle("GET /api/versions/{id}/flow", apiGetFlow)
+		mux.Handle("GET /api/versions/{id}/files", apiListVersionFiles)
 		mux.Handle("POST /api/projects/{id}/invites", apiCreateInvite)
 		mux.Handle("DELETE /api/projects/{id}/invites/{inviteID}", apiDeleteInvite)
 		mux.Handle("GET /api/projects/{id}/members", apiListMembers)
 		mux.Handle("DELETE /api/projects/{id}/members/{email}", apiRemoveMember)
+		mux.Handle("PUT /api/projects/{id}/members/{email}/role", apiSetMemberRole)
+		mux.Handle("DELETE /api/projects/{id}/membership", apiLeaveProject)
+		mux.Handle("POST /api/projects/{id}/public-shares", apiCreatePublicShare)
+		mux.Handle("GET /api/projects/{id}/public-shares", apiListPublicShares)
+		mux.Handle("PATCH /api/projects/{id}/public-shares/{shareID}", apiUpdatePublicShare)
+		mux.Handle("DELETE /api/projects/{id}/public-shares/{shareID}", apiDeletePublicShare)
+		mux.Handle("GET /api/projects/{id}/comment-templates", apiListCommentTemplates)
+		mux.Handle("POST /api/projects/{id}/comment-templates", apiCreateCommentTemplate)
+		mux.Handle("DELETE /api/projects/{id}/comment-templates/{templateID}", apiDeleteCommentTemplate)
+		mux.Handle("GET /api/projects/{id}/default-assignee", apiGetDefaultAssignee)
+		mux.Handle("PUT /api/projects/{id}/default-assignee", apiSetDefaultAssignee)
+		mux.Handle("GET /api/projects/{id}/visibility", apiGetVisibility)
+		mux.Handle("PUT /api/projects/{id}/visibility", apiSetVisibility)
+		mux.Handle("GET /api/projects/{id}/approval-settings", apiGetApprovalSettings)
+		mux.Handle("PUT /api/projects/{id}/approval-settings", apiSetApprovalSettings)
+		mux.Handle("GET /api/projects/{id}/review-settings", apiGetReviewSettings)
+		mux.Handle("PUT /api/projects/{id}/review-settings", apiSetReviewSettings)
+		mux.Handle("GET /api/projects/{id}/metrics", apiGetMetrics)
+		mux.Handle("GET /api/projects/{id}/subscription", apiGetSubscription)
+		mux.Handle("POST /api/projects/{id}/subscription", apiSubscribe)
+		mux.Handle("DELETE /api/projects/{id}/subscription", apiUnsubscribe)
+		mux.Handle("GET /api/comments/{id}/watch", apiGetWatch)
+		mux.Handle("POST /api/comments/{id}/watch", apiWatch)
+		mux.Handle("DELETE /api/comments/{id}/watch", apiUnwatch)
+		mux.Handle("GET /api/me/notifications", apiListNotifications)
 	}
 }
@@ -0,0 +1,455 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ab/design-reviewer/internal/auth"
+	"github.com/ab/design-reviewer/internal/db"
+)
+
+// A project archive is a zip with metadata.json at the root and each
+// version's files under versions/{version_num}/.
+const (
+	archiveMetadataFile  = "metadata.json"
+	archiveVersionsDir   = "versions/"
+	archiveFormatVersion = 1
+	maxArchiveSize       = 200 << 20 // 200 MB; an archive holds every version
+)
+
+type archiveMetadata struct {
+	FormatVersion int              `json:"format_version"`
+	Project       archiveProject   `json:"project"`
+	Versions      []archiveVersion `json:"versions"`
+}
+
+type archiveProject struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type archiveVersion struct {
+	VersionNum     int               `json:"version_num"`
+	CreatedAt      time.Time         `json:"created_at"`
+	CreatedBy      string            `json:"created_by_email"`
+	UploadFilename string            `json:"upload_filename"`
+	UploadSource   string            `json:"upload_source"`
+	UploadSHA256   string            `json:"upload_sha256,omitempty"`
+	PageOrder      []string          `json:"page_order,omitempty"`
+	PageTitles     map[string]string `json:"page_titles,omitempty"`
+	Warnings       []string          `json:"warnings,omitempty"`
+	CanvasWidth    int               `json:"canvas_width,omitempty"`
+	CanvasHeight   int               `json:"canvas_height,omitempty"`
+	Comments       []archiveComment  `json:"comments"`
+}
+
+type archiveComment struct {
+	Page        string         `json:"page"`
+	XPercent    float64        `json:"x_percent"`
+	YPercent    float64        `json:"y_percent"`
+	Anchor      *string        `json:"anchor,omitempty"`
+	AuthorName  string         `json:"author_name"`
+	AuthorEmail string         `json:"author_email"`
+	Assignee    string         `json:"assignee_email,omitempty"`
+	Body        string         `json:"body"`
+	Resolved    bool           `json:"resolved"`
+	CreatedAt   time.Time      `json:"created_at"`
+	Replies     []archiveReply `json:"replies"`
+}
+
+type archiveReply struct {
+	AuthorName  string    `json:"author_name"`
+	AuthorEmail string    `json:"author_email"`
+	Body        string    `json:"body"`
+	Resolved    bool      `json:"resolved"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// handleExportProject downloads a project, with every version's files,
+// comments and replies, as a zip that handleImportProject can recreate.
+func (h *Handler) handleExportProject(w http.ResponseWriter, r *http.Request) {
+	project, err := h.DB.GetProject(r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	versions, err := h.DB.ListVersions(project.ID)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	// Oldest first, so an import recreates them in order.
+	sort.Slice(versions, func(i, j int) bool { return versions[i].VersionNum < versions[j].VersionNum })
+
+	meta := archiveMetadata{
+		FormatVersion: archiveFormatVersion,
+		Project:       archiveProject{Name: project.Name, Status: project.Status, CreatedAt: project.CreatedAt},
+		Versions:      make([]archiveVersion, len(versions)),
+	}
+	for i, v := range versions {
+		av, err := h.archiveVersion(v)
+		if err != nil {
+			serverError(w, "database error", err)
+			return
+		}
+		meta.Versions[i] = av
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": project.Name + ".zip"}))
+	zw := zip.NewWriter(w)
+	if err := h.writeArchive(zw, meta, versions); err != nil {
+		// Headers are already sent; the truncated zip won't open.
+		log.Printf("ERROR: failed to export project %s: %v", project.ID, err)
+		return
+	}
+	zw.Close()
+}
+
+func (h *Handler) archiveVersion(v db.Version) (archiveVersion, error) {
+	order, err := h.DB.GetPageOrder(v.ID)
+	if err != nil {
+		return archiveVersion{}, err
+	}
+	comments, err := h.DB.GetCommentsForVersion(v.ID)
+	if err != nil {
+		return archiveVersion{}, err
+	}
+	av := archiveVersion{
+		VersionNum:     v.VersionNum,
+		CreatedAt:      v.CreatedAt,
+		CreatedBy:      v.CreatedByEmail,
+		UploadFilename: v.UploadFilename,
+		UploadSource:   v.UploadSource,
+		UploadSHA256:   v.UploadSHA256,
+		PageOrder:      order,
+		PageTitles:     v.PageTitles,
+		Warnings:       v.Warnings,
+		CanvasWidth:    v.CanvasWidth,
+		CanvasHeight:   v.CanvasHeight,
+		Comments:       make([]archiveComment, len(comments)),
+	}
+	for i, c := range comments {
+		replies, err := h.DB.GetReplies(c.ID)
+		if err != nil {
+			return archiveVersion{}, err
+		}
+		ac := archiveComment{
+			Page:        c.Page,
+			XPercent:    c.XPercent,
+			YPercent:    c.YPercent,
+			Anchor:      c.Anchor,
+			AuthorName:  c.AuthorName,
+			AuthorEmail: c.AuthorEmail,
+			Assignee:    c.Assignee,
+			Body:        c.Body,
+			Resolved:    c.Resolved,
+			CreatedAt:   c.CreatedAt,
+			Replies:     make([]archiveReply, len(replies)),
+		}
+		for j, rp := range replies {
+			ac.Replies[j] = archiveReply{
+				AuthorName:  rp.AuthorName,
+				AuthorEmail: rp.AuthorEmail,
+				Body:        rp.Body,
+				Resolved:    rp.Resolved,
+				CreatedAt:   rp.CreatedAt,
+			}
+		}
+		av.Comments[i] = ac
+	}
+	return av, nil
+}
+
+func (h *Handler) writeArchive(zw *zip.Writer, meta archiveMetadata, versions []db.Version) error {
+	mw, err := zw.Create(archiveMetadataFile)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(meta); err != nil {
+		return err
+	}
+	for _, v := range versions {
+		if err := h.writeVersionFiles(zw, v.ID, fmt.Sprintf("%s%d/", archiveVersionsDir, v.VersionNum)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeVersionFiles copies every stored file of a version into zw, under
+// prefix.
+func (h *Handler) writeVersionFiles(zw *zip.Writer, versionID, prefix string) error {
+	files, err := h.Storage.ListAllFiles(versionID)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fw, err := zw.Create(prefix + f.Path)
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(h.Storage.GetFilePath(versionID, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fw, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleImportProject recreates a project from an archive made by
+// handleExportProject. The caller becomes the owner. An optional "name"
+// field imports under a different name, e.g. when the original still exists.
+func (h *Handler) handleImportProject(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxArchiveSize)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "archive exceeds 200MB limit", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "missing file field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		serverError(w, "failed to read file", err)
+		return
+	}
+
+	meta, versionZips, err := readArchive(data)
+	if err != nil {
+		http.Error(w, "invalid archive: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := meta.Project.Name
+	if n := strings.TrimSpace(r.FormValue("name")); n != "" {
+		name = n
+	}
+	if name == "" {
+		http.Error(w, "missing name field", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.DB.GetProjectByName(name); err == nil {
+		http.Error(w, "a project with this name already exists", http.StatusConflict)
+		return
+	} else if err != sql.ErrNoRows {
+		serverError(w, "database error", err)
+		return
+	}
+
+	imported := make([]db.ImportedVersion, len(meta.Versions))
+	for i, av := range meta.Versions {
+		iv := db.ImportedVersion{
+			Version: db.Version{
+				VersionNum:     av.VersionNum,
+				UploadFilename: av.UploadFilename,
+				UploadSource:   av.UploadSource,
+				UploadSHA256:   av.UploadSHA256,
+				CreatedByEmail: av.CreatedBy,
+				Warnings:       av.Warnings,
+				PageTitles:     av.PageTitles,
+				CanvasWidth:    av.CanvasWidth,
+				CanvasHeight:   av.CanvasHeight,
+				CreatedAt:      av.CreatedAt,
+			},
+			PageOrder: av.PageOrder,
+			Comments:  make([]db.ImportedComment, len(av.Comments)),
+		}
+		for j, ac := range av.Comments {
+			ic := db.ImportedComment{
+				Comment: db.Comment{
+					Page:        ac.Page,
+					XPercent:    ac.XPercent,
+					YPercent:    ac.YPercent,
+					Anchor:      ac.Anchor,
+					AuthorName:  ac.AuthorName,
+					AuthorEmail: auth.NormalizeEmail(ac.AuthorEmail),
+					Assignee:    ac.Assignee,
+					Body:        ac.Body,
+					Resolved:    ac.Resolved,
+					CreatedAt:   ac.CreatedAt,
+				},
+				Replies: make([]db.Reply, len(ac.Replies)),
+			}
+			for k, ar := range ac.Replies {
+				ic.Replies[k] = db.Reply{
+					AuthorName:  ar.AuthorName,
+					AuthorEmail: auth.NormalizeEmail(ar.AuthorEmail),
+					Body:        ar.Body,
+					Resolved:    ar.Resolved,
+					CreatedAt:   ar.CreatedAt,
+				}
+			}
+			iv.Comments[j] = ic
+		}
+		imported[i] = iv
+	}
+
+	// The files are saved before the import commits, so a storage failure
+	// leaves neither a project without files nor files without a project.
+	_, email := auth.GetUserFromContext(r.Context())
+	var saved []string
+	project, ids, err := h.DB.ImportProject(name, email, meta.Project.Status, imported, func(ids []string) error {
+		for i, av := range meta.Versions {
+			saved = append(saved, ids[i])
+			if err := h.Storage.SaveUpload(ids[i], bytes.NewReader(versionZips[av.VersionNum])); err != nil {
+				return fmt.Errorf("saving version %d files: %w", av.VersionNum, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for _, id := range saved {
+			if err := h.Storage.DeleteUpload(id); err != nil {
+				log.Printf("WARN: failed to remove files of version %s: %v", id, err)
+			}
+		}
+		serverError(w, "failed to import project", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"project_id": project.ID,
+		"versions":   len(ids),
+		"url":        h.link("/projects/" + project.ID),
+	})
+}
+
+// readArchive parses a project archive and repackages each version's files
+// as a zip for storage.SaveUpload, keyed by version number.
+func readArchive(data []byte) (*archiveMetadata, map[int][]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var meta *archiveMetadata
+	writers := map[int]*zip.Writer{}
+	bufs := map[int]*bytes.Buffer{}
+	hasHTML := map[int]bool{}
+	for _, f := range zr.File {
+		if f.Name == archiveMetadataFile {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, nil, err
+			}
+			meta = &archiveMetadata{}
+			err = json.NewDecoder(rc).Decode(meta)
+			rc.Close()
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", archiveMetadataFile, err)
+			}
+			continue
+		}
+		rest, ok := strings.CutPrefix(f.Name, archiveVersionsDir)
+		if !ok || f.FileInfo().IsDir() {
+			continue
+		}
+		numStr, rel, ok := strings.Cut(rest, "/")
+		num, err := strconv.Atoi(numStr)
+		if !ok || err != nil || rel == "" {
+			continue
+		}
+		if writers[num] == nil {
+			bufs[num] = &bytes.Buffer{}
+			writers[num] = zip.NewWriter(bufs[num])
+		}
+		// Copy the compressed entry under its path within the version;
+		// SaveUpload applies the usual size and path checks.
+		hdr := f.FileHeader
+		hdr.Name = rel
+		fw, err := writers[num].CreateRaw(&hdr)
+		if err != nil {
+			return nil, nil, err
+		}
+		raw, err := f.OpenRaw()
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := io.Copy(fw, raw); err != nil {
+			return nil, nil, err
+		}
+		if strings.EqualFold(path.Ext(rel), ".html") {
+			hasHTML[num] = true
+		}
+	}
+	if meta == nil {
+		return nil, nil, fmt.Errorf("missing %s", archiveMetadataFile)
+	}
+	if meta.FormatVersion != archiveFormatVersion {
+		return nil, nil, fmt.Errorf("unsupported format_version %d", meta.FormatVersion)
+	}
+	if len(meta.Versions) == 0 {
+		return nil, nil, fmt.Errorf("no versions")
+	}
+
+	zips := make(map[int][]byte, len(meta.Versions))
+	for _, v := range meta.Versions {
+		if v.VersionNum < 1 {
+			return nil, nil, fmt.Errorf("invalid version_num %d", v.VersionNum)
+		}
+		if v.CanvasWidth < 0 || v.CanvasHeight < 0 {
+			return nil, nil, fmt.Errorf("version %d has an invalid canvas size", v.VersionNum)
+		}
+		for _, c := range v.Comments {
+			if !validArchiveEmail(c.AuthorEmail) {
+				return nil, nil, fmt.Errorf("version %d has a comment with an invalid author_email %q", v.VersionNum, c.AuthorEmail)
+			}
+			for _, rp := range c.Replies {
+				if !validArchiveEmail(rp.AuthorEmail) {
+					return nil, nil, fmt.Errorf("version %d has a reply with an invalid author_email %q", v.VersionNum, rp.AuthorEmail)
+				}
+			}
+		}
+		if _, dup := zips[v.VersionNum]; dup {
+			return nil, nil, fmt.Errorf("duplicate version_num %d", v.VersionNum)
+		}
+		if !hasHTML[v.VersionNum] {
+			return nil, nil, fmt.Errorf("version %d has no .html files", v.VersionNum)
+		}
+		if err := writers[v.VersionNum].Close(); err != nil {
+			return nil, nil, err
+		}
+		zips[v.VersionNum] = bufs[v.VersionNum].Bytes()
+	}
+	return meta, zips, nil
+}
+
+// validArchiveEmail reports whether an author email in an archive can be
+// imported: empty, as for anonymous comments, or a valid address once
+// normalized.
+func validArchiveEmail(email string) bool {
+	email = auth.NormalizeEmail(email)
+	return email == "" || auth.ValidEmail(email)
+}
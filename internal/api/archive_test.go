@@ -0,0 +1,210 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func importRequest(t *testing.T, name string, archive []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if name != "" {
+		mw.WriteField("name", name)
+	}
+	fw, _ := mw.CreateFormFile("file", "archive.zip")
+	fw.Write(archive)
+	mw.Close()
+	req := httptest.NewRequest("POST", "/api/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return withUser(req, "Owner", "owner@test.com")
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	h := setupTestHandler(t)
+
+	for _, html := range []string{"<p>v1</p>", "<p>v2</p>"} {
+		req := createUploadRequest(t, "orig", makeZipForTest(t, map[string]string{"index.html": html, "css/site.css": "p{}"}))
+		w := httptest.NewRecorder()
+		h.handleUpload(w, withUser(req, "Owner", "owner@test.com"))
+		if w.Code != 200 {
+			t.Fatalf("upload: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	orig, _ := h.DB.GetProjectByName("orig")
+	h.DB.UpdateProjectStatus(orig.ID, "in_review")
+	versions, _ := h.DB.ListVersions(orig.ID)
+	v2, v1 := versions[0], versions[1]
+	open, _ := h.DB.CreateComment(v1.ID, "index.html", 10, 20, "Alice", "alice@test.com", "still open")
+	h.DB.CreateReply(open.ID, "Bob", "bob@test.com", "on it")
+	done, _ := h.DB.CreateComment(v2.ID, "index.html", 30, 40, "Alice", "alice@test.com", "done")
+	h.DB.ToggleResolve(done.ID, "alice@test.com")
+	h.DB.SetVersionChecksum(v1.ID, "0123abcd")
+
+	req := httptest.NewRequest("GET", "/api/projects/"+orig.ID+"/archive", nil)
+	req.SetPathValue("id", orig.ID)
+	w := httptest.NewRecorder()
+	h.handleExportProject(w, req)
+	if w.Code != 200 {
+		t.Fatalf("export: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	archive := w.Body.Bytes()
+
+	// The original still exists, so importing under its name conflicts.
+	w = httptest.NewRecorder()
+	h.handleImportProject(w, importRequest(t, "", archive))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("same name: expected 409, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.handleImportProject(w, importRequest(t, "copy", archive))
+	if w.Code != 200 {
+		t.Fatalf("import: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	copied, err := h.DB.GetProjectByName("copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.ID == orig.ID || copied.Status != "in_review" {
+		t.Errorf("unexpected project: %+v", copied)
+	}
+	if owner, _ := h.DB.IsOwner(copied.ID, "owner@test.com"); !owner {
+		t.Error("importer should own the project")
+	}
+	newVersions, _ := h.DB.ListVersions(copied.ID)
+	if len(newVersions) != 2 || newVersions[0].VersionNum != 2 || newVersions[1].VersionNum != 1 {
+		t.Fatalf("unexpected versions: %+v", newVersions)
+	}
+	newV2, newV1 := newVersions[0], newVersions[1]
+	if newV1.ID == v1.ID {
+		t.Error("versions should get new ids")
+	}
+	if newV1.UploadSHA256 != "0123abcd" || newV2.UploadSHA256 != "" {
+		t.Errorf("upload checksums = %q, %q, want 0123abcd and none", newV1.UploadSHA256, newV2.UploadSHA256)
+	}
+	data, err := os.ReadFile(h.Storage.GetFilePath(newV1.ID, "index.html"))
+	if err != nil || string(data) != "<p>v1</p>" {
+		t.Errorf("v1 index.html = %q, %v", data, err)
+	}
+	if _, err := os.Stat(h.Storage.GetFilePath(newV2.ID, "css/site.css")); err != nil {
+		t.Errorf("nested asset missing: %v", err)
+	}
+
+	// The open comment from v1 still carries over to v2; the resolved one doesn't.
+	carried, _ := h.DB.GetUnresolvedCommentsUpTo(newV2.ID)
+	if len(carried) != 1 || carried[0].Body != "still open" || carried[0].VersionID != newV1.ID {
+		t.Fatalf("unexpected carried-over comments: %+v", carried)
+	}
+	if replies, _ := h.DB.GetReplies(carried[0].ID); len(replies) != 1 || replies[0].Body != "on it" {
+		t.Errorf("unexpected replies: %+v", replies)
+	}
+	resolved, _ := h.DB.GetCommentsForVersion(newV2.ID)
+	if len(resolved) != 1 || !resolved[0].Resolved || resolved[0].Body != "done" {
+		t.Errorf("unexpected v2 comments: %+v", resolved)
+	}
+}
+
+func TestImportRejectsBadArchive(t *testing.T) {
+	h := setupTestHandler(t)
+
+	archive := func(files map[string]string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, content := range files {
+			f, _ := zw.Create(name)
+			f.Write([]byte(content))
+		}
+		zw.Close()
+		return buf.Bytes()
+	}
+	meta := `{"format_version":1,"project":{"name":"p"},"versions":[{"version_num":1}]}`
+
+	cases := map[string][]byte{
+		"not a zip":        []byte("nope"),
+		"no metadata":      archive(map[string]string{"versions/1/index.html": "x"}),
+		"wrong format":     archive(map[string]string{"metadata.json": `{"format_version":9}`, "versions/1/index.html": "x"}),
+		"missing files":    archive(map[string]string{"metadata.json": meta}),
+		"duplicate number": archive(map[string]string{"metadata.json": strings.Replace(meta, `{"version_num":1}`, `{"version_num":1},{"version_num":1}`, 1), "versions/1/index.html": "x"}),
+		"bad author email": archive(map[string]string{"metadata.json": strings.Replace(meta, `{"version_num":1}`, `{"version_num":1,"comments":[{"page":"index.html","author_email":"not an email","body":"x"}]}`, 1), "versions/1/index.html": "x"}),
+	}
+	for name, data := range cases {
+		w := httptest.NewRecorder()
+		h.handleImportProject(w, importRequest(t, "", data))
+		if w.Code != 400 {
+			t.Errorf("%s: expected 400, got %d", name, w.Code)
+		}
+	}
+	if _, err := h.DB.GetProjectByName("p"); err == nil {
+		t.Error("no project should have been created")
+	}
+}
+
+func TestImportStorageFailureLeavesNothing(t *testing.T) {
+	h := setupTestHandler(t)
+
+	archive := func(v2File string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for _, f := range []struct{ name, content string }{
+			{"metadata.json", `{"format_version":1,"project":{"name":"p"},"versions":[{"version_num":1},{"version_num":2}]}`},
+			{"versions/1/index.html", "<p>v1</p>"},
+			{"versions/2/" + v2File, "x"},
+			{"versions/2/a/index.html", "<p>v2</p>"},
+		} {
+			fw, _ := zw.Create(f.name)
+			fw.Write([]byte(f.content))
+		}
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	// v2 has a file "a" where its page needs a directory, so v1's files are
+	// saved and v2's fail.
+	w := httptest.NewRecorder()
+	h.handleImportProject(w, importRequest(t, "", archive("a")))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := h.DB.GetProjectByName("p"); err == nil {
+		t.Error("no project should have been created")
+	}
+	entries, _ := os.ReadDir(h.Storage.BasePath)
+	if len(entries) != 0 {
+		t.Errorf("stored files left behind: %v", entries)
+	}
+
+	// Retrying under the same name works.
+	w = httptest.NewRecorder()
+	h.handleImportProject(w, importRequest(t, "", archive("b")))
+	if w.Code != 200 {
+		t.Fatalf("retry: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestExportRequiresOwner(t *testing.T) {
+	h := setupAuthHandler(t)
+	p, _ := h.DB.CreateProject("private", "owner@test.com")
+	h.DB.AddMember(p.ID, "member@test.com")
+	h.DB.CreateToken("member-token", "Member", "member@test.com")
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/projects/"+p.ID+"/archive", nil)
+	req.Header.Set("Authorization", "Bearer member-token")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code == 200 {
+		t.Error("members who aren't owners should not be able to export")
+	}
+}
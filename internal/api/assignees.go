@@ -0,0 +1,71 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// checkAssignee reports whether email may be assigned comments on the
+// project. It writes the error response and returns false otherwise.
+func (h *Handler) checkAssignee(w http.ResponseWriter, projectID, email string) bool {
+	ok, err := h.DB.CanAccessProject(projectID, email)
+	if err != nil {
+		serverError(w, "database error", err)
+		return false
+	}
+	if !ok {
+		http.Error(w, "assignee must be a project member", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) handleGetDefaultAssignee(w http.ResponseWriter, r *http.Request) {
+	email, err := h.DB.GetDefaultAssignee(r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"email": email})
+}
+
+func (h *Handler) handleSetDefaultAssignee(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("id")
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	// An empty email turns auto-assignment off.
+	email := strings.TrimSpace(req.Email)
+	if email != "" && !h.checkAssignee(w, projectID, email) {
+		return
+	}
+
+	err := h.DB.SetDefaultAssignee(projectID, email)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"email": email})
+}
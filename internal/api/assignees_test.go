@@ -0,0 +1,105 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// setupAssigneeProject creates a project owned by alice with bob as a member.
+func setupAssigneeProject(t *testing.T) (h *Handler, projectID, versionID string) {
+	t.Helper()
+	h = setupTestHandler(t)
+	p, err := h.DB.CreateProject("assign-proj", "alice@test.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := h.DB.CreateVersion(p.ID, "")
+	h.Storage.SaveUpload(v.ID, bytes.NewReader(makeZipForTest(t, map[string]string{"index.html": "x"})))
+	h.DB.AddMember(p.ID, "bob@test.com")
+	return h, p.ID, v.ID
+}
+
+func setDefaultAssignee(h *Handler, projectID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PUT", "/api/projects/"+projectID+"/default-assignee", strings.NewReader(body))
+	req.SetPathValue("id", projectID)
+	w := httptest.NewRecorder()
+	h.handleSetDefaultAssignee(w, req)
+	return w
+}
+
+func createCommentAs(h *Handler, versionID, body string) commentJSON {
+	req := httptest.NewRequest("POST", "/api/versions/"+versionID+"/comments", strings.NewReader(body))
+	req.SetPathValue("id", versionID)
+	req = withUser(req, "Alice", "alice@test.com")
+	w := httptest.NewRecorder()
+	h.handleCreateComment(w, req)
+	var c commentJSON
+	json.NewDecoder(w.Body).Decode(&c)
+	return c
+}
+
+func TestCommentInheritsDefaultAssignee(t *testing.T) {
+	h, pid, vid := setupAssigneeProject(t)
+	if w := setDefaultAssignee(h, pid, `{"email":"bob@test.com"}`); w.Code != 200 {
+		t.Fatalf("set default: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	c := createCommentAs(h, vid, `{"page":"index.html","body":"fix"}`)
+	if c.Assignee != "bob@test.com" {
+		t.Errorf("assignee = %q, want default bob@test.com", c.Assignee)
+	}
+	stored, _ := h.DB.GetComment(c.ID)
+	if stored.Assignee != "bob@test.com" {
+		t.Errorf("stored assignee = %q, want bob@test.com", stored.Assignee)
+	}
+
+	// Clearing the default turns auto-assignment off.
+	if w := setDefaultAssignee(h, pid, `{"email":""}`); w.Code != 200 {
+		t.Fatalf("clear default: expected 200, got %d", w.Code)
+	}
+	if c := createCommentAs(h, vid, `{"page":"index.html","body":"fix"}`); c.Assignee != "" {
+		t.Errorf("assignee = %q after clearing default, want none", c.Assignee)
+	}
+}
+
+func TestExplicitAssigneeOverridesDefault(t *testing.T) {
+	h, pid, vid := setupAssigneeProject(t)
+	setDefaultAssignee(h, pid, `{"email":"bob@test.com"}`)
+
+	c := createCommentAs(h, vid, `{"page":"index.html","body":"fix","assignee_email":"alice@test.com"}`)
+	if c.Assignee != "alice@test.com" {
+		t.Errorf("assignee = %q, want explicit alice@test.com", c.Assignee)
+	}
+
+	req := httptest.NewRequest("POST", "/api/versions/"+vid+"/comments",
+		strings.NewReader(`{"page":"index.html","body":"fix","assignee_email":"eve@test.com"}`))
+	req.SetPathValue("id", vid)
+	w := httptest.NewRecorder()
+	h.handleCreateComment(w, req)
+	if w.Code != 400 {
+		t.Errorf("non-member assignee: expected 400, got %d", w.Code)
+	}
+}
+
+func TestSetDefaultAssigneeRequiresMember(t *testing.T) {
+	h, pid, _ := setupAssigneeProject(t)
+	if w := setDefaultAssignee(h, pid, `{"email":"eve@test.com"}`); w.Code != 400 {
+		t.Errorf("non-member: expected 400, got %d", w.Code)
+	}
+	if w := setDefaultAssignee(h, pid, `not json`); w.Code != 400 {
+		t.Errorf("invalid JSON: expected 400, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/api/projects/"+pid+"/default-assignee", nil)
+	req.SetPathValue("id", pid)
+	w := httptest.NewRecorder()
+	h.handleGetDefaultAssignee(w, req)
+	var res map[string]string
+	json.NewDecoder(w.Body).Decode(&res)
+	if w.Code != 200 || res["email"] != "" {
+		t.Errorf("get default: got %d %v, want 200 with no email", w.Code, res)
+	}
+}
@@ -47,7 +47,20 @@ func (h *Handler) handleLoginPage(w http.ResponseWriter, r *http.Request) {
 		serverError(w, "template error", err)
 		return
 	}
-	tmpl.Execute(w, struct{ UserName string }{})
+	tmpl.Execute(w, struct {
+		UserName   string
+		Base       string
+		Brand      Branding
+		Theme      string
+		EmailLogin bool
+		EmailSent  bool
+	}{
+		Base:       h.BasePath,
+		Theme:      themeOf(r),
+		Brand:      h.brand(),
+		EmailLogin: h.Mailer != nil,
+		EmailSent:  r.URL.Query().Get("sent") == "1",
+	})
 }
 
 func (h *Handler) handleGoogleLogin(w http.ResponseWriter, r *http.Request) {
@@ -57,10 +70,10 @@ func (h *Handler) handleGoogleLogin(w http.ResponseWriter, r *http.Request) {
 		Value:    state,
 		Path:     "/",
 		HttpOnly: true,
-		Secure:   strings.HasPrefix(h.Auth.BaseURL, "https://"),
+		Secure:   h.Auth.Secure(),
 		SameSite: http.SameSiteLaxMode,
 	})
-	url := h.OAuthConfig.AuthCodeURL(state)
+	url := h.OAuthConfig.AuthCodeURL(state, h.Auth.AuthCodeOptions()...)
 	http.Redirect(w, r, url, http.StatusFound)
 }
 
@@ -74,6 +87,19 @@ func (h *Handler) handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
 	// Clear state cookie
 	http.SetCookie(w, &http.Cookie{Name: "oauth_state", Value: "", Path: "/", MaxAge: -1})
 
+	// A CLI login state ends in ":port". Anything after the colon other than
+	// a plain port number is rejected rather than put into the redirect.
+	state := stateCookie.Value
+	cliPort := 0
+	if idx := strings.LastIndex(state, ":"); idx > 0 {
+		port, ok := parseCLIPort(state[idx+1:])
+		if !ok {
+			http.Error(w, "invalid state", http.StatusBadRequest)
+			return
+		}
+		cliPort = port
+	}
+
 	code := r.URL.Query().Get("code")
 	token, err := h.OAuthConfig.Exchange(r, code)
 	if err != nil {
@@ -86,22 +112,31 @@ func (h *Handler) handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
 		serverError(w, "failed to get user info", err)
 		return
 	}
+	if !h.Auth.EmailAllowed(email) {
+		http.Error(w, "this account's email domain is not allowed to sign in", http.StatusForbidden)
+		return
+	}
 
-	// Check if this is a CLI flow (state contains ":port")
-	state := stateCookie.Value
-	if idx := strings.LastIndex(state, ":"); idx > 0 {
-		port := state[idx+1:]
+	if cliPort != 0 {
 		apiToken := auth.GenerateAPIToken()
 		if err := h.DB.CreateToken(apiToken, name, email); err != nil {
 			serverError(w, "failed to create token", err)
 			return
 		}
-		redirectURL := fmt.Sprintf("http://localhost:%s/callback?token=%s&name=%s", port, apiToken, url.QueryEscape(name))
+		// Scheme and host are fixed: the token only ever goes to the CLI's
+		// loopback listener.
+		redirectURL := fmt.Sprintf("http://localhost:%d/callback?token=%s&name=%s", cliPort, apiToken, url.QueryEscape(name))
 		http.Redirect(w, r, redirectURL, http.StatusFound)
 		return
 	}
 
-	secure := strings.HasPrefix(h.Auth.BaseURL, "https://")
+	h.startWebSession(w, r, name, email)
+}
+
+// startWebSession creates a server-side session, sets the session cookie and
+// redirects to the page the user originally asked for.
+func (h *Handler) startWebSession(w http.ResponseWriter, r *http.Request, name, email string) {
+	secure := h.Auth.Secure()
 	sessionID := auth.GenerateSessionID()
 	if err := h.DB.CreateSession(sessionID, name, email); err != nil {
 		serverError(w, "session error", err)
@@ -111,7 +146,7 @@ func (h *Handler) handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
 		serverError(w, "session error", err)
 		return
 	}
-	redirectTo := "/"
+	redirectTo := h.link("/")
 	if c, err := r.Cookie("redirect_to"); err == nil && c.Value != "" && strings.HasPrefix(c.Value, "/") {
 		redirectTo = c.Value
 		http.SetCookie(w, &http.Cookie{Name: "redirect_to", Value: "", Path: "/", MaxAge: -1})
@@ -119,27 +154,82 @@ func (h *Handler) handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, redirectTo, http.StatusFound)
 }
 
+// handleEmailLogin emails a magic login link to invited members. The
+// response is the same whether or not the address is known so it can't be
+// used to discover members.
+func (h *Handler) handleEmailLogin(w http.ResponseWriter, r *http.Request) {
+	if h.Mailer == nil {
+		http.Error(w, "email login not configured", http.StatusNotFound)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	email := auth.NormalizeEmail(r.FormValue("email"))
+	if !auth.ValidEmail(email) {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	}
+
+	ok, err := h.DB.IsMemberOfAnyProject(email)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	if ok {
+		token, err := auth.SignMagicLink(h.Auth.SessionSecret, email, auth.MagicLinkTTL)
+		if err != nil {
+			serverError(w, "token error", err)
+			return
+		}
+		link := h.Auth.BaseURL + "/auth/email/verify?token=" + url.QueryEscape(token)
+		body := fmt.Sprintf("Click the link below to sign in to %s:\n\n%s\n\nThis link expires in %s.\n", h.brand().AppName, link, auth.MagicLinkTTL)
+		if err := h.Mailer.Send(email, "Your "+h.brand().AppName+" sign-in link", body); err != nil {
+			serverError(w, "failed to send email", err)
+			return
+		}
+	}
+	http.Redirect(w, r, h.link("/login?sent=1"), http.StatusSeeOther)
+}
+
+func (h *Handler) handleEmailVerify(w http.ResponseWriter, r *http.Request) {
+	email, err := auth.VerifyMagicLink(h.Auth.SessionSecret, r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, "invalid or expired link", http.StatusUnauthorized)
+		return
+	}
+	h.startWebSession(w, r, email, email)
+}
+
+// parseCLIPort parses a CLI callback port. Only plain decimal digits in the
+// range 1-65535 are accepted, so no sign, host or path can slip through.
+func parseCLIPort(s string) (int, bool) {
+	if s == "" || len(s) > 5 || strings.Trim(s, "0123456789") != "" {
+		return 0, false
+	}
+	port, _ := strconv.Atoi(s)
+	return port, port >= 1 && port <= 65535
+}
+
 func (h *Handler) handleCLILogin(w http.ResponseWriter, r *http.Request) {
 	port := r.URL.Query().Get("port")
 	if port == "" {
 		http.Error(w, "missing port parameter", http.StatusBadRequest)
 		return
 	}
-	portNum, err := strconv.Atoi(port)
-	if err != nil || portNum < 1 || portNum > 65535 {
+	portNum, ok := parseCLIPort(port)
+	if !ok {
 		http.Error(w, "invalid port", http.StatusBadRequest)
 		return
 	}
-	state := auth.GenerateState() + ":" + port
+	state := auth.GenerateState() + ":" + strconv.Itoa(portNum)
 	http.SetCookie(w, &http.Cookie{
 		Name:     "oauth_state",
 		Value:    state,
 		Path:     "/",
 		HttpOnly: true,
-		Secure:   strings.HasPrefix(h.Auth.BaseURL, "https://"),
+		Secure:   h.Auth.Secure(),
 		SameSite: http.SameSiteLaxMode,
 	})
-	url := h.OAuthConfig.AuthCodeURL(state)
+	url := h.OAuthConfig.AuthCodeURL(state, h.Auth.AuthCodeOptions()...)
 	http.Redirect(w, r, url, http.StatusFound)
 }
 
@@ -172,6 +262,10 @@ func (h *Handler) handleTokenExchange(w http.ResponseWriter, r *http.Request) {
 		serverError(w, "failed to get user info", err)
 		return
 	}
+	if !h.Auth.EmailAllowed(email) {
+		http.Error(w, "this account's email domain is not allowed to sign in", http.StatusForbidden)
+		return
+	}
 
 	apiToken := auth.GenerateAPIToken()
 	if err := h.DB.CreateToken(apiToken, name, email); err != nil {
@@ -194,5 +288,5 @@ func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	auth.ClearSessionCookie(w)
-	http.Redirect(w, r, "/login", http.StatusFound)
+	http.Redirect(w, r, h.link("/login"), http.StatusFound)
 }
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ab/design-reviewer/internal/auth"
 	"golang.org/x/oauth2"
@@ -114,6 +116,36 @@ func TestHandleGoogleCallbackSuccess(t *testing.T) {
 	}
 }
 
+func TestHandleGoogleCallbackAllowedDomain(t *testing.T) {
+	h := setupAuthHandler(t)
+	h.Auth.AllowedEmailDomains = []string{"example.com"}
+	mock := h.OAuthConfig.(*mockOAuth)
+
+	login := func(email string) *httptest.ResponseRecorder {
+		mock.userEmail = email
+		req := httptest.NewRequest("GET", "/auth/google/callback?code=authcode&state=s", nil)
+		req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "s"})
+		w := httptest.NewRecorder()
+		h.handleGoogleCallback(w, req)
+		return w
+	}
+	hasSession := func(w *httptest.ResponseRecorder) bool {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == "session" && c.Value != "" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if w := login("alice@example.com"); w.Code != http.StatusFound || !hasSession(w) {
+		t.Errorf("allowed domain: expected 302 with session, got %d", w.Code)
+	}
+	if w := login("eve@gmail.com"); w.Code != http.StatusForbidden || hasSession(w) {
+		t.Errorf("other domain: expected 403 without session, got %d", w.Code)
+	}
+}
+
 func TestHandleGoogleCallbackInvalidState(t *testing.T) {
 	h := setupAuthHandler(t)
 	req := httptest.NewRequest("GET", "/auth/google/callback?code=authcode&state=wrong", nil)
@@ -155,6 +187,36 @@ func TestHandleGoogleCallbackCLIFlow(t *testing.T) {
 	}
 }
 
+func TestHandleGoogleCallbackCLIStateCannotChangeHost(t *testing.T) {
+	h := setupAuthHandler(t)
+	for _, state := range []string{"x:9876@evil.com", "x:evil.com", "x:+9876", "x:0", "x:65536", "x:9876/evil"} {
+		req := httptest.NewRequest("GET", "/auth/google/callback?code=authcode&state="+url.QueryEscape(state), nil)
+		req.AddCookie(&http.Cookie{Name: "oauth_state", Value: state})
+		w := httptest.NewRecorder()
+		h.handleGoogleCallback(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("state %q: expected 400, got %d (Location %q)", state, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// A host smuggled in before the port is ignored; only the port is used.
+	state := "https://evil.com:4444"
+	req := httptest.NewRequest("GET", "/auth/google/callback?code=authcode&state="+url.QueryEscape(state), nil)
+	req.AddCookie(&http.Cookie{Name: "oauth_state", Value: state})
+	w := httptest.NewRecorder()
+	h.handleGoogleCallback(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected 302, got %d", w.Code)
+	}
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Scheme != "http" || loc.Host != "localhost:4444" || loc.Path != "/callback" {
+		t.Errorf("redirect = %s, want http://localhost:4444/callback", loc)
+	}
+}
+
 func TestHandleGoogleCallbackExchangeError(t *testing.T) {
 	h := setupAuthHandler(t)
 	h.OAuthConfig = &mockOAuth{exchErr: errDB}
@@ -284,6 +346,21 @@ func TestHandleTokenExchange(t *testing.T) {
 	}
 }
 
+func TestHandleTokenExchangeDisallowedDomain(t *testing.T) {
+	h := setupAuthHandler(t)
+	h.Auth.AllowedEmailDomains = []string{"ourcompany.com"}
+	req := httptest.NewRequest("POST", "/api/auth/token", strings.NewReader(`{"code":"auth-code"}`))
+	w := httptest.NewRecorder()
+	h.handleTokenExchange(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "token") {
+		t.Errorf("no token should be issued: %s", w.Body.String())
+	}
+}
+
 func TestHandleTokenExchangeMissingCode(t *testing.T) {
 	h := setupAuthHandler(t)
 	req := httptest.NewRequest("POST", "/api/auth/token", strings.NewReader(`{}`))
@@ -1000,3 +1077,181 @@ func TestTokenExchangeOversizedBody(t *testing.T) {
 		t.Errorf("expected 413, got %d", w.Code)
 	}
 }
+
+type fakeMailer struct {
+	to, subject, body string
+	err               error
+}
+
+func (f *fakeMailer) Send(to, subject, body string) error {
+	f.to, f.subject, f.body = to, subject, body
+	return f.err
+}
+
+func TestHandleEmailLoginSendsLinkToMember(t *testing.T) {
+	h := setupAuthHandler(t)
+	m := &fakeMailer{}
+	h.Mailer = m
+	p, _ := h.DB.CreateProject("proj", "owner@test.com")
+	h.DB.AddMember(p.ID, "guest@example.com")
+
+	req := httptest.NewRequest("POST", "/auth/email", strings.NewReader("email=guest@example.com"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.handleEmailLogin(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", w.Code)
+	}
+	if m.to != "guest@example.com" {
+		t.Fatalf("expected email to guest, got %q", m.to)
+	}
+	if !strings.Contains(m.body, "http://localhost:8080/auth/email/verify?token=") {
+		t.Errorf("expected verify link in body: %s", m.body)
+	}
+}
+
+func TestHandleEmailLoginNormalizesEmail(t *testing.T) {
+	h := setupAuthHandler(t)
+	m := &fakeMailer{}
+	h.Mailer = m
+	p, _ := h.DB.CreateProject("proj", "owner@test.com")
+	h.DB.AddMember(p.ID, "guest@example.com")
+
+	req := httptest.NewRequest("POST", "/auth/email", strings.NewReader("email=+Guest@Example.COM+"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.handleEmailLogin(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", w.Code)
+	}
+	if m.to != "guest@example.com" {
+		t.Fatalf("expected email to guest@example.com, got %q", m.to)
+	}
+}
+
+func TestHandleEmailLoginRejectsInvalidEmail(t *testing.T) {
+	h := setupAuthHandler(t)
+	h.Mailer = &fakeMailer{}
+	for _, email := range []string{"", "not-an-email", "Guest <guest@example.com>"} {
+		req := httptest.NewRequest("POST", "/auth/email", strings.NewReader("email="+url.QueryEscape(email)))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.handleEmailLogin(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", email, w.Code)
+		}
+	}
+}
+
+func TestHandleEmailLoginIgnoresNonMember(t *testing.T) {
+	h := setupAuthHandler(t)
+	m := &fakeMailer{}
+	h.Mailer = m
+
+	req := httptest.NewRequest("POST", "/auth/email", strings.NewReader("email=stranger@example.com"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.handleEmailLogin(w, req)
+
+	// Same response as for members so addresses can't be probed
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303, got %d", w.Code)
+	}
+	if m.to != "" {
+		t.Errorf("expected no email sent, got one to %q", m.to)
+	}
+}
+
+func TestHandleEmailLoginDisabledWithoutMailer(t *testing.T) {
+	h := setupAuthHandler(t)
+	req := httptest.NewRequest("POST", "/auth/email", strings.NewReader("email=a@b.com"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.handleEmailLogin(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestHandleEmailVerifyCreatesSession(t *testing.T) {
+	h := setupAuthHandler(t)
+	token, _ := auth.SignMagicLink(h.Auth.SessionSecret, "guest@example.com", time.Minute)
+
+	req := httptest.NewRequest("GET", "/auth/email/verify?token="+url.QueryEscape(token), nil)
+	w := httptest.NewRecorder()
+	h.handleEmailVerify(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected 302, got %d: %s", w.Code, w.Body.String())
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session" {
+			u, err := auth.VerifySession(h.Auth.SessionSecret, c.Value)
+			if err != nil {
+				t.Fatalf("invalid session cookie: %v", err)
+			}
+			_, email, err := h.DB.GetSession(u.SessionID)
+			if err != nil || email != "guest@example.com" {
+				t.Fatalf("session not in DB: %q %v", email, err)
+			}
+			return
+		}
+	}
+	t.Error("session cookie not set")
+}
+
+func TestHandleEmailVerifyRejectsBadTokens(t *testing.T) {
+	h := setupAuthHandler(t)
+	expired, _ := auth.SignMagicLink(h.Auth.SessionSecret, "guest@example.com", -time.Minute)
+	forged, _ := auth.SignMagicLink("wrong-secret", "guest@example.com", time.Minute)
+
+	for _, token := range []string{expired, forged, "garbage"} {
+		req := httptest.NewRequest("GET", "/auth/email/verify?token="+url.QueryEscape(token), nil)
+		w := httptest.NewRecorder()
+		h.handleEmailVerify(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", w.Code)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Error("expected no session cookie")
+		}
+	}
+}
+
+func TestFaviconServedWithoutAuth(t *testing.T) {
+	h := setupAuthHandler(t)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	for _, path := range []string{"/favicon.ico", "/site.webmanifest"} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Errorf("%s: expected 200, got %d", path, w.Code)
+		}
+		if loc := w.Header().Get("Location"); strings.Contains(loc, "/login") {
+			t.Errorf("%s: redirected to %s", path, loc)
+		}
+	}
+}
+
+func TestVersionEndpointWithoutAuth(t *testing.T) {
+	h := setupAuthHandler(t)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/version", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var result map[string]string
+	json.NewDecoder(w.Body).Decode(&result)
+	if result["version"] == "" || result["commit"] == "" {
+		t.Errorf("expected non-empty version and commit, got %v", result)
+	}
+}
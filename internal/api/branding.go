@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// The uploaded logo is kept in the settings table, its content type under
+// a key of its own.
+const (
+	settingLogo     = "branding.logo"
+	settingLogoType = "branding.logo_type"
+	maxLogoSize     = 512 << 10
+)
+
+// logoTypes are the image types accepted as a logo, as sniffed by
+// http.DetectContentType. SVG can't be sniffed and is checked separately.
+var logoTypes = map[string]bool{
+	"image/png":                true,
+	"image/jpeg":               true,
+	"image/gif":                true,
+	"image/webp":               true,
+	"image/x-icon":             true,
+	"image/vnd.microsoft.icon": true,
+}
+
+// logoContentType returns the content type to serve an uploaded logo with,
+// or "" if it isn't an image we accept.
+func logoContentType(name string, data []byte) string {
+	if ct := http.DetectContentType(data); logoTypes[ct] {
+		return ct
+	}
+	if strings.EqualFold(filepath.Ext(name), ".svg") && bytes.Contains(data, []byte("<svg")) {
+		return "image/svg+xml"
+	}
+	return ""
+}
+
+// handleAdminSetLogo replaces the instance logo with the image in the
+// "logo" field of a multipart form. Routed behind adminOnly.
+func (h *Handler) handleAdminSetLogo(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxLogoSize+(64<<10))
+	file, header, err := r.FormFile("logo")
+	if err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "logo too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "missing logo file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxLogoSize+1))
+	if err != nil {
+		http.Error(w, "failed to read logo", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxLogoSize {
+		http.Error(w, "logo too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	ct := logoContentType(header.Filename, data)
+	if ct == "" {
+		http.Error(w, "logo must be a PNG, JPEG, GIF, WebP, ICO or SVG image", http.StatusBadRequest)
+		return
+	}
+	if err := h.DB.SetSettings(map[string][]byte{settingLogo: data, settingLogoType: []byte(ct)}); err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"logo_url": h.link("/branding/logo")})
+}
+
+// handleBrandingLogo serves the logo an admin uploaded, or the bundled
+// default when there is none. It is public so the sign-in page can show it.
+func (h *Handler) handleBrandingLogo(w http.ResponseWriter, r *http.Request) {
+	data, updated, err := h.DB.GetSetting(settingLogo)
+	if err == sql.ErrNoRows {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		http.ServeFile(w, r, filepath.Join(h.StaticDir, "images", "logo.svg"))
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	ct, _, err := h.DB.GetSetting(settingLogoType)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", string(ct))
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// An SVG logo opened directly must not run scripts on our origin.
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	http.ServeContent(w, r, "", updated, bytes.NewReader(data))
+}
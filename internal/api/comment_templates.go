@@ -0,0 +1,95 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ab/design-reviewer/internal/auth"
+	"github.com/ab/design-reviewer/internal/db"
+)
+
+// maxTemplateLen bounds a comment template; they are meant to be short,
+// repeated remarks such as "Increase contrast".
+const maxTemplateLen = 500
+
+type commentTemplateJSON struct {
+	ID        string `json:"id"`
+	Body      string `json:"body"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt string `json:"created_at"`
+}
+
+func toCommentTemplateJSON(ct db.CommentTemplate) commentTemplateJSON {
+	return commentTemplateJSON{
+		ID:        ct.ID,
+		Body:      ct.Body,
+		CreatedBy: ct.CreatedBy,
+		CreatedAt: ct.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// handleListCommentTemplates lists a project's canned comments, which the
+// viewer offers for quick insertion into new comments and replies.
+func (h *Handler) handleListCommentTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.DB.ListCommentTemplates(r.PathValue("id"))
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	out := make([]commentTemplateJSON, len(templates))
+	for i, ct := range templates {
+		out[i] = toCommentTemplateJSON(ct)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (h *Handler) handleCreateCommentTemplate(w http.ResponseWriter, r *http.Request) {
+	_, email := auth.GetUserFromContext(r.Context())
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		writeFieldError(w, "body", "body is required")
+		return
+	}
+	if len(body) > maxTemplateLen {
+		writeFieldError(w, "body", "body is too long")
+		return
+	}
+
+	ct, err := h.DB.CreateCommentTemplate(r.PathValue("id"), body, email)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toCommentTemplateJSON(*ct))
+}
+
+func (h *Handler) handleDeleteCommentTemplate(w http.ResponseWriter, r *http.Request) {
+	err := h.DB.DeleteCommentTemplate(r.PathValue("id"), r.PathValue("templateID"))
+	if err == sql.ErrNoRows {
+		http.Error(w, "template not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
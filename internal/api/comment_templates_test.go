@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCommentTemplatesCRUD(t *testing.T) {
+	h := setupAuthHandler(t)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+	other, _ := h.DB.CreateProject("other", "alice@test.com")
+	h.DB.AddMember(p.ID, "bob@test.com")
+
+	do := func(method, path, body, email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(testSessionCookie(t, h.Auth.SessionSecret, "User", email))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	base := "/api/projects/" + p.ID + "/comment-templates"
+
+	w := do("POST", base, `{"body":"  Increase contrast  "}`, "alice@test.com")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created commentTemplateJSON
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.Body != "Increase contrast" || created.CreatedBy != "alice@test.com" {
+		t.Errorf("unexpected template: %+v", created)
+	}
+	do("POST", base, `{"body":"Align to grid"}`, "alice@test.com")
+	do("POST", "/api/projects/"+other.ID+"/comment-templates", `{"body":"Other project"}`, "alice@test.com")
+
+	for name, body := range map[string]string{
+		"empty":    `{"body":"  "}`,
+		"too long": `{"body":"` + strings.Repeat("x", maxTemplateLen+1) + `"}`,
+	} {
+		if w := do("POST", base, body, "alice@test.com"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"field":"body"`) {
+			t.Errorf("%s: expected a 400 naming the field, got %d", name, w.Code)
+		}
+	}
+
+	// Members can list them, scoped to the project, oldest first.
+	w = do("GET", base, "", "bob@test.com")
+	if w.Code != 200 {
+		t.Fatalf("list: expected 200, got %d", w.Code)
+	}
+	var list []commentTemplateJSON
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list) != 2 || list[0].Body != "Increase contrast" || list[1].Body != "Align to grid" {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+
+	// Only owners manage them; outsiders can't see them at all.
+	if w := do("POST", base, `{"body":"Mine"}`, "bob@test.com"); w.Code != http.StatusForbidden {
+		t.Errorf("member create: expected 403, got %d", w.Code)
+	}
+	if w := do("DELETE", base+"/"+created.ID, "", "bob@test.com"); w.Code != http.StatusForbidden {
+		t.Errorf("member delete: expected 403, got %d", w.Code)
+	}
+	if w := do("GET", base, "", "carol@test.com"); w.Code != http.StatusNotFound {
+		t.Errorf("outsider list: expected 404, got %d", w.Code)
+	}
+
+	// Templates can't be deleted through another project's ID.
+	if w := do("DELETE", "/api/projects/"+other.ID+"/comment-templates/"+created.ID, "", "alice@test.com"); w.Code != http.StatusNotFound {
+		t.Errorf("cross-project delete: expected 404, got %d", w.Code)
+	}
+	if w := do("DELETE", base+"/"+created.ID, "", "alice@test.com"); w.Code != http.StatusNoContent {
+		t.Errorf("delete: expected 204, got %d", w.Code)
+	}
+	if templates, _ := h.DB.ListCommentTemplates(p.ID); len(templates) != 1 || templates[0].Body != "Align to grid" {
+		t.Errorf("after delete: %+v", templates)
+	}
+	if templates, _ := h.DB.ListCommentTemplates(other.ID); len(templates) != 1 {
+		t.Errorf("other project's templates changed: %+v", templates)
+	}
+}
@@ -4,10 +4,16 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/ab/design-reviewer/internal/auth"
+	"github.com/ab/design-reviewer/internal/db"
 )
 
 type commentJSON struct {
@@ -20,31 +26,155 @@ type commentJSON struct {
 	AuthorEmail string      `json:"author_email"`
 	Body        string      `json:"body"`
 	Resolved    bool        `json:"resolved"`
+	Anchor      *string     `json:"anchor"`
+	Assignee    string      `json:"assignee_email"`
 	CreatedAt   string      `json:"created_at"`
+	ResolvedAt  string      `json:"resolved_at,omitempty"`
 	Replies     []replyJSON `json:"replies"`
+	// ReplyCount and LastActivityAt let a list show "3 replies · last reply
+	// 2h ago" without reading Replies; LastActivityAt is the newest of the
+	// comment and its replies.
+	ReplyCount     int    `json:"reply_count"`
+	LastActivityAt string `json:"last_activity_at"`
+}
+
+// maxAnchorLen bounds the CSS selector stored with a comment.
+const maxAnchorLen = 1024
+
+// DefaultMaxCommentsPerVersion is far above what a real review leaves on
+// one version; it stops a runaway client from burying the viewer in pins.
+const DefaultMaxCommentsPerVersion = 2000
+
+// checkCommentLimit writes a 409 and returns false once a version holds the
+// maximum number of comments.
+func (h *Handler) checkCommentLimit(w http.ResponseWriter, versionID string) bool {
+	limit := h.MaxCommentsPerVersion
+	if limit <= 0 {
+		limit = DefaultMaxCommentsPerVersion
+	}
+	n, err := h.DB.CountCommentsForVersion(versionID)
+	if err != nil {
+		serverError(w, "database error", err)
+		return false
+	}
+	if n >= limit {
+		http.Error(w, fmt.Sprintf("this version already has the maximum of %d comments", limit), http.StatusConflict)
+		return false
+	}
+	return true
 }
 
 type replyJSON struct {
 	ID         string `json:"id"`
 	AuthorName string `json:"author_name"`
 	Body       string `json:"body"`
+	Resolved   bool   `json:"resolved"`
 	CreatedAt  string `json:"created_at"`
+	// New marks replies posted at or after ?since= on an incremental fetch.
+	New bool `json:"new,omitempty"`
 }
 
 func (h *Handler) handleGetComments(w http.ResponseWriter, r *http.Request) {
-	versionID := r.PathValue("id")
+	h.getComments(w, r, false)
+}
 
-	comments, err := h.DB.GetUnresolvedCommentsUpTo(versionID)
+// handleAnonGetComments serves the comment list to anonymous visitors of a
+// public project. It leaves out reviewers' email addresses and ignores
+// ?author=, which would let anyone test whether an address has commented.
+func (h *Handler) handleAnonGetComments(w http.ResponseWriter, r *http.Request) {
+	h.getComments(w, r, true)
+}
+
+func (h *Handler) getComments(w http.ResponseWriter, r *http.Request, anonymous bool) {
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeFieldError(w, "since", "since must be an RFC 3339 timestamp")
+			return
+		}
+		since = t
+	}
+
+	var out []commentJSON
+	var err error
+	if page := r.URL.Query().Get("page"); page != "" {
+		out, err = h.pageComments(r.PathValue("id"), page)
+	} else {
+		out, err = h.versionComments(r.PathValue("id"))
+	}
 	if err != nil {
 		serverError(w, "database error", err)
 		return
 	}
+	// ?author= keeps one reviewer's comments, including carried-over ones.
+	if author := r.URL.Query().Get("author"); author != "" && !anonymous {
+		out = slices.DeleteFunc(out, func(c commentJSON) bool {
+			return !strings.EqualFold(c.AuthorEmail, author)
+		})
+	}
+	if anonymous {
+		hideEmails(out)
+	}
+	if !since.IsZero() {
+		out = commentsSince(out, since)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// hideEmails blanks reviewers' email addresses before comments are shown
+// to anonymous visitors.
+func hideEmails(comments []commentJSON) {
+	for i := range comments {
+		comments[i].AuthorEmail = ""
+		comments[i].Assignee = ""
+	}
+}
+
+// commentsSince keeps the comments with activity at or after since, for
+// clients polling for changes: those created since then, and older ones
+// with a reply since then, whose new replies are flagged.
+func commentsSince(comments []commentJSON, since time.Time) []commentJSON {
+	isNew := func(created string) bool {
+		t, err := time.Parse(time.RFC3339, created)
+		return err == nil && !t.Before(since)
+	}
+	return slices.DeleteFunc(comments, func(c commentJSON) bool {
+		hasNewReply := false
+		for i := range c.Replies {
+			if isNew(c.Replies[i].CreatedAt) {
+				c.Replies[i].New = true
+				hasNewReply = true
+			}
+		}
+		return !hasNewReply && !isNew(c.CreatedAt)
+	})
+}
+
+// pageComments is versionComments restricted to a single page. An unknown
+// page simply has no comments.
+func (h *Handler) pageComments(versionID, page string) ([]commentJSON, error) {
+	comments, err := h.DB.GetVersionCommentsOnPage(versionID, page)
+	if err != nil {
+		return nil, err
+	}
+	return h.toCommentJSON(comments)
+}
+
+// versionComments returns the comments shown on a version: unresolved ones
+// carried over from earlier versions plus everything left on this one.
+func (h *Handler) versionComments(versionID string) ([]commentJSON, error) {
+	comments, err := h.DB.GetUnresolvedCommentsUpTo(versionID)
+	if err != nil {
+		return nil, err
+	}
 
 	// Also get resolved comments for this specific version
 	allForVersion, err := h.DB.GetCommentsForVersion(versionID)
 	if err != nil {
-		serverError(w, "database error", err)
-		return
+		return nil, err
 	}
 
 	// Merge: unresolved from all versions up to this one + resolved from this version
@@ -58,40 +188,121 @@ func (h *Handler) handleGetComments(w http.ResponseWriter, r *http.Request) {
 			seen[c.ID] = true
 		}
 	}
+	return h.toCommentJSON(comments)
+}
 
+// toCommentJSON attaches each comment's replies and builds the API view.
+func (h *Handler) toCommentJSON(comments []db.Comment) ([]commentJSON, error) {
 	out := make([]commentJSON, 0, len(comments))
 	for _, c := range comments {
 		replies, err := h.DB.GetReplies(c.ID)
 		if err != nil {
-			serverError(w, "database error", err)
-			return
+			return nil, err
 		}
-		rj := make([]replyJSON, len(replies))
-		for i, r := range replies {
-			rj[i] = replyJSON{
-				ID:         r.ID,
-				AuthorName: r.AuthorName,
-				Body:       r.Body,
-				CreatedAt:  r.CreatedAt.Format(time.RFC3339),
-			}
+		out = append(out, commentWithReplies(c, replies))
+	}
+	return out, nil
+}
+
+// commentWithReplies builds the API view of a comment and its replies.
+func commentWithReplies(c db.Comment, replies []db.Reply) commentJSON {
+	rj := make([]replyJSON, len(replies))
+	lastActivity := c.CreatedAt
+	for i, r := range replies {
+		if r.CreatedAt.After(lastActivity) {
+			lastActivity = r.CreatedAt
 		}
-		out = append(out, commentJSON{
-			ID:          c.ID,
-			VersionID:   c.VersionID,
-			Page:        c.Page,
-			XPercent:    c.XPercent,
-			YPercent:    c.YPercent,
-			AuthorName:  c.AuthorName,
-			AuthorEmail: c.AuthorEmail,
-			Body:        c.Body,
-			Resolved:    c.Resolved,
-			CreatedAt:   c.CreatedAt.Format(time.RFC3339),
-			Replies:     rj,
-		})
+		rj[i] = replyJSON{
+			ID:         r.ID,
+			AuthorName: r.AuthorName,
+			Body:       r.Body,
+			Resolved:   r.Resolved,
+			CreatedAt:  r.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	var resolvedAt string
+	if c.ResolvedAt != nil {
+		resolvedAt = c.ResolvedAt.Format(time.RFC3339)
+	}
+	return commentJSON{
+		ID:          c.ID,
+		VersionID:   c.VersionID,
+		Page:        c.Page,
+		XPercent:    c.XPercent,
+		YPercent:    c.YPercent,
+		AuthorName:  c.AuthorName,
+		AuthorEmail: c.AuthorEmail,
+		Body:        c.Body,
+		Resolved:    c.Resolved,
+		Anchor:      c.Anchor,
+		Assignee:    c.Assignee,
+		CreatedAt:   c.CreatedAt.Format(time.RFC3339),
+		ResolvedAt:  resolvedAt,
+		Replies:     rj,
+
+		ReplyCount:     len(rj),
+		LastActivityAt: lastActivity.Format(time.RFC3339),
 	}
+}
 
+// pixelsToPercent converts a pin position in pixels to the percentages
+// comments are stored with. The reference size is the frame the pixels were
+// measured in; each side defaults to the version's canvas size, and the width
+// then to defaultDesignWidth.
+func pixelsToPercent(x, y, refWidth, refHeight float64, v *db.Version) (float64, float64, error) {
+	if refWidth < 0 {
+		return 0, 0, &fieldError{"reference_width", "reference_width must be positive"}
+	}
+	if refHeight < 0 {
+		return 0, 0, &fieldError{"reference_height", "reference_height must be positive"}
+	}
+	if refWidth == 0 {
+		refWidth = float64(v.CanvasWidth)
+	}
+	if refWidth == 0 {
+		refWidth = defaultDesignWidth
+	}
+	if refHeight == 0 {
+		refHeight = float64(v.CanvasHeight)
+	}
+	if refHeight == 0 {
+		return 0, 0, &fieldError{"reference_height", "reference_height is required: the version has no canvas height"}
+	}
+	xPct, yPct := x/refWidth*100, y/refHeight*100
+	if xPct < 0 || xPct > 100 {
+		return 0, 0, &fieldError{"x_px", fmt.Sprintf("x_px %g is outside the %gx%g reference frame", x, refWidth, refHeight)}
+	}
+	if yPct < 0 || yPct > 100 {
+		return 0, 0, &fieldError{"y_px", fmt.Sprintf("y_px %g is outside the %gx%g reference frame", y, refWidth, refHeight)}
+	}
+	return xPct, yPct, nil
+}
+
+// fieldError is a request validation failure caused by one JSON field.
+type fieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e *fieldError) Error() string { return e.Reason }
+
+// writeFieldError responds 400 with a JSON body naming the field that
+// failed validation, so the client can point the user at it.
+func writeFieldError(w http.ResponseWriter, field, reason string) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(out)
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": reason, "field": field})
+}
+
+// checkPercent validates a pin position given as percentages of the page.
+func checkPercent(x, y float64) *fieldError {
+	if x < 0 || x > 100 {
+		return &fieldError{"x_percent", "x_percent out of range"}
+	}
+	if y < 0 || y > 100 {
+		return &fieldError{"y_percent", "y_percent out of range"}
+	}
+	return nil
 }
 
 func (h *Handler) handleCreateComment(w http.ResponseWriter, r *http.Request) {
@@ -105,6 +316,13 @@ func (h *Handler) handleCreateComment(w http.ResponseWriter, r *http.Request) {
 		AuthorName  string  `json:"author_name"`
 		AuthorEmail string  `json:"author_email"`
 		Body        string  `json:"body"`
+		Anchor      string  `json:"anchor"`
+		Assignee    string  `json:"assignee_email"`
+		// A position in pixels, converted to the percentages above.
+		XPx             *float64 `json:"x_px"`
+		YPx             *float64 `json:"y_px"`
+		ReferenceWidth  float64  `json:"reference_width"`
+		ReferenceHeight float64  `json:"reference_height"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		if isMaxBytesError(err) {
@@ -114,22 +332,95 @@ func (h *Handler) handleCreateComment(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid JSON", http.StatusBadRequest)
 		return
 	}
-	if req.Body == "" || req.Page == "" {
-		http.Error(w, "body and page are required", http.StatusBadRequest)
+	if req.Body == "" {
+		writeFieldError(w, "body", "body is required")
+		return
+	}
+	if req.Page == "" {
+		writeFieldError(w, "page", "page is required")
+		return
+	}
+	if req.XPx != nil || req.YPx != nil {
+		if req.XPx == nil {
+			writeFieldError(w, "x_px", "x_px and y_px must be given together")
+			return
+		}
+		if req.YPx == nil {
+			writeFieldError(w, "y_px", "x_px and y_px must be given together")
+			return
+		}
+		v, err := h.DB.GetVersion(versionID)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			serverError(w, "database error", err)
+			return
+		}
+		req.XPercent, req.YPercent, err = pixelsToPercent(*req.XPx, *req.YPx, req.ReferenceWidth, req.ReferenceHeight, v)
+		if fe, ok := err.(*fieldError); ok {
+			writeFieldError(w, fe.Field, fe.Reason)
+			return
+		}
+	}
+	if fe := checkPercent(req.XPercent, req.YPercent); fe != nil {
+		writeFieldError(w, fe.Field, fe.Reason)
+		return
+	}
+	if len(req.Anchor) > maxAnchorLen {
+		writeFieldError(w, "anchor", "anchor is too long")
 		return
 	}
 
-	// Use auth context if available, fall back to request body
-	if name, email := auth.GetUserFromContext(r.Context()); name != "" {
-		req.AuthorName = name
-		req.AuthorEmail = email
+	var ok bool
+	if req.AuthorName, req.AuthorEmail, ok = h.requestAuthor(w, r, req.AuthorName, req.AuthorEmail); !ok {
+		return
 	}
 
-	c, err := h.DB.CreateComment(versionID, req.Page, req.XPercent, req.YPercent, req.AuthorName, req.AuthorEmail, req.Body)
+	// An explicit assignee wins; otherwise the project's default applies.
+	assignee := strings.TrimSpace(req.Assignee)
+	if assignee != "" {
+		v, err := h.DB.GetVersion(versionID)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			serverError(w, "database error", err)
+			return
+		}
+		if !h.checkAssignee(w, v.ProjectID, assignee) {
+			return
+		}
+	} else {
+		var err error
+		if assignee, err = h.DB.GetDefaultAssigneeForVersion(versionID); err != nil {
+			serverError(w, "database error", err)
+			return
+		}
+	}
+
+	if !h.checkCommentLimit(w, versionID) {
+		return
+	}
+
+	c, err := h.DB.CreateCommentWithAnchor(versionID, req.Page, req.XPercent, req.YPercent, req.Anchor, req.AuthorName, req.AuthorEmail, req.Body)
 	if err != nil {
 		serverError(w, "database error", err)
 		return
 	}
+	if assignee != "" {
+		if err := h.DB.SetCommentAssignee(c.ID, assignee); err != nil {
+			serverError(w, "database error", err)
+			return
+		}
+		c.Assignee = assignee
+	}
+	// The comment is saved either way; a failed transition is only logged.
+	if _, err := h.DB.StartReviewOnFirstComment(versionID); err != nil {
+		log.Printf("WARN: failed to move project of version %s to in_review: %v", versionID, err)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -143,8 +434,12 @@ func (h *Handler) handleCreateComment(w http.ResponseWriter, r *http.Request) {
 		AuthorEmail: c.AuthorEmail,
 		Body:        c.Body,
 		Resolved:    c.Resolved,
+		Anchor:      c.Anchor,
+		Assignee:    c.Assignee,
 		CreatedAt:   c.CreatedAt.Format(time.RFC3339),
 		Replies:     []replyJSON{},
+
+		LastActivityAt: c.CreatedAt.Format(time.RFC3339),
 	})
 }
 
@@ -170,10 +465,9 @@ func (h *Handler) handleCreateReply(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Use auth context if available, fall back to request body
-	if name, email := auth.GetUserFromContext(r.Context()); name != "" {
-		req.AuthorName = name
-		req.AuthorEmail = email
+	var ok bool
+	if req.AuthorName, req.AuthorEmail, ok = h.requestAuthor(w, r, req.AuthorName, req.AuthorEmail); !ok {
+		return
 	}
 
 	reply, err := h.DB.CreateReply(commentID, req.AuthorName, req.AuthorEmail, req.Body)
@@ -198,6 +492,7 @@ func (h *Handler) handleMoveComment(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		XPercent float64 `json:"x_percent"`
 		YPercent float64 `json:"y_percent"`
+		Anchor   string  `json:"anchor"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		if isMaxBytesError(err) {
@@ -207,11 +502,15 @@ func (h *Handler) handleMoveComment(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid JSON", http.StatusBadRequest)
 		return
 	}
-	if req.XPercent < 0 || req.XPercent > 100 || req.YPercent < 0 || req.YPercent > 100 {
-		http.Error(w, "x_percent and y_percent must be between 0 and 100", http.StatusBadRequest)
+	if fe := checkPercent(req.XPercent, req.YPercent); fe != nil {
+		writeFieldError(w, fe.Field, fe.Reason)
 		return
 	}
-	if err := h.DB.MoveComment(commentID, req.XPercent, req.YPercent); err != nil {
+	if len(req.Anchor) > maxAnchorLen {
+		writeFieldError(w, "anchor", "anchor is too long")
+		return
+	}
+	if err := h.DB.MoveCommentWithAnchor(commentID, req.XPercent, req.YPercent, req.Anchor); err != nil {
 		serverError(w, "database error", err)
 		return
 	}
@@ -219,10 +518,318 @@ func (h *Handler) handleMoveComment(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
 }
 
+// handleUpdateCommentPage moves a comment to another page, so comments on
+// a page renamed in a later version can be re-homed. The page must exist in
+// the target version: version_id if given, else the project's latest.
+func (h *Handler) handleUpdateCommentPage(w http.ResponseWriter, r *http.Request) {
+	commentID := r.PathValue("id")
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		Page      string `json:"page"`
+		VersionID string `json:"version_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Page == "" {
+		http.Error(w, "page is required", http.StatusBadRequest)
+		return
+	}
+
+	c, err := h.DB.GetComment(commentID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	commentVersion, err := h.DB.GetVersion(c.VersionID)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	var target *db.Version
+	if req.VersionID != "" {
+		target, err = h.DB.GetVersion(req.VersionID)
+		if err == sql.ErrNoRows || (err == nil && target.ProjectID != commentVersion.ProjectID) {
+			http.Error(w, "version is not one of this comment's project", http.StatusBadRequest)
+			return
+		}
+	} else {
+		target, err = h.DB.GetLatestVersion(commentVersion.ProjectID)
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+
+	pages, err := h.Storage.ListHTMLFiles(target.ID)
+	if err != nil {
+		serverError(w, "storage error", err)
+		return
+	}
+	if !slices.Contains(pages, req.Page) {
+		http.Error(w, fmt.Sprintf("unknown page %q", req.Page), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.UpdateCommentPage(commentID, req.Page); err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"page": req.Page})
+}
+
+// handleMoveCommentsPage moves every comment on one page to another, for
+// when pages were merged in a version. Comments carried over from earlier
+// versions move too; the target page must exist in this version.
+func (h *Handler) handleMoveCommentsPage(w http.ResponseWriter, r *http.Request) {
+	versionID := r.PathValue("id")
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.From == "" {
+		writeFieldError(w, "from", "from is required")
+		return
+	}
+	if req.To == "" {
+		writeFieldError(w, "to", "to is required")
+		return
+	}
+
+	_, err := h.DB.GetVersion(versionID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	pages, err := h.Storage.ListHTMLFiles(versionID)
+	if err != nil {
+		serverError(w, "storage error", err)
+		return
+	}
+	if !slices.Contains(pages, req.To) {
+		writeFieldError(w, "to", fmt.Sprintf("unknown page %q", req.To))
+		return
+	}
+
+	n, err := h.DB.MoveCommentsToPage(versionID, req.From, req.To)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"moved": n})
+}
+
+// handleToggleResolve resolves or reopens a comment. An optional JSON
+// "body" resolves it with a closing reply from the acting user, added in
+// the same transaction; the response then also carries the updated comment.
 func (h *Handler) handleToggleResolve(w http.ResponseWriter, r *http.Request) {
 	commentID := r.PathValue("id")
+	name, email := h.authorOf(r)
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		AuthorName  string `json:"author_name"`
+		AuthorEmail string `json:"author_email"`
+		Body        string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Body) != "" {
+		var ok bool
+		if name, email, ok = h.requestAuthor(w, r, req.AuthorName, req.AuthorEmail); !ok {
+			return
+		}
+		h.resolveWithReply(w, r, commentID, name, email, req.Body)
+		return
+	}
+
+	resolved, err := h.DB.ToggleResolve(commentID, email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		serverError(w, "database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"resolved": resolved})
+}
+
+// resolveWithReply resolves an open comment with a closing reply. A
+// resolved comment is a 409: the reply only makes sense when resolving.
+func (h *Handler) resolveWithReply(w http.ResponseWriter, r *http.Request, commentID, name, email, body string) {
+	if _, err := h.DB.ResolveWithReply(commentID, name, email, body); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err == db.ErrAlreadyResolved {
+			http.Error(w, "comment is already resolved; reopen it without a body", http.StatusConflict)
+			return
+		}
+		serverError(w, "database error", err)
+		return
+	}
+	c, err := h.DB.GetComment(commentID)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	out, err := h.toCommentJSON([]db.Comment{*c})
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Resolved bool        `json:"resolved"`
+		Comment  commentJSON `json:"comment"`
+	}{true, out[0]})
+}
+
+// handleResolveByAuthor resolves all of one author's open comments on a
+// version at once, e.g. after their feedback has been addressed. Owners may
+// resolve anyone's comments; other members only their own.
+func (h *Handler) handleResolveByAuthor(w http.ResponseWriter, r *http.Request) {
+	versionID := r.PathValue("id")
+	_, email := auth.GetUserFromContext(r.Context())
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		AuthorEmail string `json:"author_email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	author := strings.TrimSpace(req.AuthorEmail)
+	if author == "" {
+		writeFieldError(w, "author_email", "author_email is required")
+		return
+	}
+
+	v, err := h.DB.GetVersion(versionID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	if email != "" && !strings.EqualFold(author, email) {
+		isOwner, err := h.DB.IsOwner(v.ProjectID, email)
+		if err != nil {
+			serverError(w, "database error", err)
+			return
+		}
+		if !isOwner {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "only owners can resolve other people's comments"})
+			return
+		}
+	}
+
+	n, err := h.DB.ResolveCommentsByAuthor(versionID, author, email)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"resolved": n})
+}
+
+type commentEventJSON struct {
+	Action     string `json:"action"`
+	ActorEmail string `json:"actor_email"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// handleGetComment returns a single comment with its replies, for
+// permalinks and notifications.
+func (h *Handler) handleGetComment(w http.ResponseWriter, r *http.Request) {
+	c, replies, err := h.DB.GetCommentWithReplies(r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(commentWithReplies(*c, replies))
+}
+
+func (h *Handler) handleGetCommentEvents(w http.ResponseWriter, r *http.Request) {
+	commentID := r.PathValue("id")
+	if _, err := h.DB.GetComment(commentID); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		serverError(w, "database error", err)
+		return
+	}
+
+	events, err := h.DB.GetCommentEvents(commentID)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	out := make([]commentEventJSON, len(events))
+	for i, e := range events {
+		out[i] = commentEventJSON{
+			Action:     e.Action,
+			ActorEmail: e.ActorEmail,
+			CreatedAt:  e.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (h *Handler) handleToggleReplyResolve(w http.ResponseWriter, r *http.Request) {
+	replyID := r.PathValue("id")
 
-	resolved, err := h.DB.ToggleResolve(commentID)
+	resolved, err := h.DB.ToggleReplyResolve(replyID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.NotFound(w, r)
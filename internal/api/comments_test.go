@@ -1,12 +1,16 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ab/design-reviewer/internal/auth"
 	"github.com/ab/design-reviewer/internal/db"
@@ -48,6 +52,8 @@ type mockDB struct {
 	createSessionErr           error
 	getSessionErr              error
 	deleteSessionErr           error
+	subscribeErr               error
+	isOwnerErr                 error
 }
 
 func (m *mockDB) GetUnresolvedCommentsUpTo(versionID string) ([]db.Comment, error) {
@@ -78,6 +84,13 @@ func (m *mockDB) CreateComment(versionID, page string, xPct, yPct float64, autho
 	return m.DataStore.CreateComment(versionID, page, xPct, yPct, authorName, authorEmail, body)
 }
 
+func (m *mockDB) CreateCommentWithAnchor(versionID, page string, xPct, yPct float64, anchor, authorName, authorEmail, body string) (*db.Comment, error) {
+	if m.createCommentErr != nil {
+		return nil, m.createCommentErr
+	}
+	return m.DataStore.CreateCommentWithAnchor(versionID, page, xPct, yPct, anchor, authorName, authorEmail, body)
+}
+
 func (m *mockDB) CreateReply(commentID, authorName, authorEmail, body string) (*db.Reply, error) {
 	if m.createReplyErr != nil {
 		return nil, m.createReplyErr
@@ -85,11 +98,11 @@ func (m *mockDB) CreateReply(commentID, authorName, authorEmail, body string) (*
 	return m.DataStore.CreateReply(commentID, authorName, authorEmail, body)
 }
 
-func (m *mockDB) ToggleResolve(commentID string) (bool, error) {
+func (m *mockDB) ToggleResolve(commentID, actorEmail string) (bool, error) {
 	if m.toggleResolveErr != nil {
 		return false, m.toggleResolveErr
 	}
-	return m.DataStore.ToggleResolve(commentID)
+	return m.DataStore.ToggleResolve(commentID, actorEmail)
 }
 
 func (m *mockDB) ListVersions(projectID string) ([]db.Version, error) {
@@ -99,6 +112,13 @@ func (m *mockDB) ListVersions(projectID string) ([]db.Version, error) {
 	return m.DataStore.ListVersions(projectID)
 }
 
+func (m *mockDB) ListVersionsPage(projectID string, limit, offset int) ([]db.Version, int, error) {
+	if m.listVersionsErr != nil {
+		return nil, 0, m.listVersionsErr
+	}
+	return m.DataStore.ListVersionsPage(projectID, limit, offset)
+}
+
 func (m *mockDB) ListProjectsWithVersionCount() ([]db.ProjectWithVersionCount, error) {
 	if m.listProjectsWithVCErr != nil {
 		return nil, m.listProjectsWithVCErr
@@ -134,6 +154,13 @@ func (m *mockDB) CreateVersion(projectID, storagePath string) (*db.Version, erro
 	return m.DataStore.CreateVersion(projectID, storagePath)
 }
 
+func (m *mockDB) CreateVersionBy(projectID, storagePath, createdBy string) (*db.Version, error) {
+	if m.createVersionErr != nil {
+		return nil, m.createVersionErr
+	}
+	return m.DataStore.CreateVersionBy(projectID, storagePath, createdBy)
+}
+
 func (m *mockDB) GetProject(id string) (*db.Project, error) {
 	if m.getProjectErr != nil {
 		return nil, m.getProjectErr
@@ -224,6 +251,20 @@ func (m *mockDB) RemoveMember(projectID, email string) error {
 	return m.DataStore.RemoveMember(projectID, email)
 }
 
+func (m *mockDB) IsOwner(projectID, email string) (bool, error) {
+	if m.isOwnerErr != nil {
+		return false, m.isOwnerErr
+	}
+	return m.DataStore.IsOwner(projectID, email)
+}
+
+func (m *mockDB) Subscribe(projectID, email string) error {
+	if m.subscribeErr != nil {
+		return m.subscribeErr
+	}
+	return m.DataStore.Subscribe(projectID, email)
+}
+
 func (m *mockDB) ListProjectsWithVersionCountForUser(email string) ([]db.ProjectWithVersionCount, error) {
 	if m.listProjectsForUserErr != nil {
 		return nil, m.listProjectsForUserErr
@@ -238,6 +279,13 @@ func (m *mockDB) MoveComment(id string, x, y float64) error {
 	return m.DataStore.MoveComment(id, x, y)
 }
 
+func (m *mockDB) MoveCommentWithAnchor(id string, x, y float64, anchor string) error {
+	if m.moveCommentErr != nil {
+		return m.moveCommentErr
+	}
+	return m.DataStore.MoveCommentWithAnchor(id, x, y, anchor)
+}
+
 func (m *mockDB) GetComment(id string) (*db.Comment, error) {
 	if m.getCommentErr != nil {
 		return nil, m.getCommentErr
@@ -319,6 +367,163 @@ func TestHandleCreateComment(t *testing.T) {
 	}
 }
 
+func TestHandleCreateCommentStartsReview(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+	other, _ := h.DB.CreateProject("manual", "")
+	otherV, _ := h.DB.CreateVersion(other.ID, "/tmp/v")
+
+	req := httptest.NewRequest("PUT", "/api/projects/"+pid+"/review-settings", strings.NewReader(`{"auto_in_review_on_comment":true}`))
+	req.SetPathValue("id", pid)
+	w := httptest.NewRecorder()
+	h.handleSetReviewSettings(w, req)
+	if w.Code != 200 {
+		t.Fatalf("settings: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	comment := func(versionID string) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/versions/"+versionID+"/comments", strings.NewReader(`{"page":"index.html","body":"hi","author_name":"A"}`))
+		req.SetPathValue("id", versionID)
+		w := httptest.NewRecorder()
+		h.handleCreateComment(w, req)
+		if w.Code != 201 {
+			t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	status := func(id string) string {
+		p, _ := h.DB.GetProject(id)
+		return p.Status
+	}
+
+	comment(vid)
+	if got := status(pid); got != "in_review" {
+		t.Fatalf("first comment: status = %q, want in_review", got)
+	}
+	a, _ := h.DB.(*db.DB).GetProjectActivity(pid, time.Time{}, time.Now().Add(time.Minute))
+	if len(a.StatusChanges) != 1 || a.StatusChanges[0].FromStatus != "draft" || a.StatusChanges[0].ToStatus != "in_review" {
+		t.Errorf("expected one draft -> in_review change, got %+v", a.StatusChanges)
+	}
+
+	// Back in draft, later comments don't flip it again.
+	h.DB.UpdateProjectStatus(pid, "draft")
+	comment(vid)
+	if got := status(pid); got != "draft" {
+		t.Errorf("second comment: status = %q, want draft", got)
+	}
+
+	// Off by default.
+	comment(otherV.ID)
+	if got := status(other.ID); got != "draft" {
+		t.Errorf("setting off: status = %q, want draft", got)
+	}
+}
+
+func TestHandleCommentAnchorRoundTrip(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+
+	body := `{"page":"index.html","x_percent":10,"y_percent":20,"author_name":"Alice","body":"hi","anchor":"#hero > h1"}`
+	req := httptest.NewRequest("POST", "/api/versions/"+vid+"/comments", strings.NewReader(body))
+	req.SetPathValue("id", vid)
+	w := httptest.NewRecorder()
+	h.handleCreateComment(w, req)
+	if w.Code != 201 {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created commentJSON
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.Anchor == nil || *created.Anchor != "#hero > h1" {
+		t.Errorf("created anchor = %v", created.Anchor)
+	}
+
+	req = httptest.NewRequest("PATCH", "/api/comments/"+created.ID+"/move", strings.NewReader(`{"x_percent":30,"y_percent":40,"anchor":"main > p"}`))
+	req.SetPathValue("id", created.ID)
+	w = httptest.NewRecorder()
+	h.handleMoveComment(w, req)
+	if w.Code != 200 {
+		t.Fatalf("move: expected 200, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/versions/"+vid+"/comments", nil)
+	req.SetPathValue("id", vid)
+	w = httptest.NewRecorder()
+	h.handleGetComments(w, req)
+	var comments []commentJSON
+	json.NewDecoder(w.Body).Decode(&comments)
+	if len(comments) != 1 || comments[0].Anchor == nil || *comments[0].Anchor != "main > p" {
+		t.Fatalf("unexpected comments: %+v", comments)
+	}
+	if comments[0].XPercent != 30 || comments[0].YPercent != 40 {
+		t.Errorf("coords = (%v, %v), want (30, 40)", comments[0].XPercent, comments[0].YPercent)
+	}
+}
+
+func TestHandleCreateCommentPixels(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+
+	post := func(pos string) *httptest.ResponseRecorder {
+		body := `{"page":"index.html","author_name":"Alice","body":"hi",` + pos + `}`
+		req := httptest.NewRequest("POST", "/api/versions/"+vid+"/comments", strings.NewReader(body))
+		req.SetPathValue("id", vid)
+		w := httptest.NewRecorder()
+		h.handleCreateComment(w, req)
+		return w
+	}
+	check := func(pos string, wantX, wantY float64) {
+		t.Helper()
+		w := post(pos)
+		if w.Code != 201 {
+			t.Fatalf("%s: expected 201, got %d: %s", pos, w.Code, w.Body.String())
+		}
+		var c commentJSON
+		json.NewDecoder(w.Body).Decode(&c)
+		if c.XPercent != wantX || c.YPercent != wantY {
+			t.Errorf("%s: coords = (%v, %v), want (%v, %v)", pos, c.XPercent, c.YPercent, wantX, wantY)
+		}
+	}
+
+	// Without a canvas height there is nothing to measure y against.
+	if w := post(`"x_px":100,"y_px":100`); w.Code != 400 {
+		t.Errorf("no reference height: expected 400, got %d", w.Code)
+	}
+	// The width falls back to the default design width.
+	check(`"x_px":270,"y_px":50,"reference_height":200`, 25, 25)
+
+	h.DB.SetCanvasSize(vid, 400, 800)
+	check(`"x_px":100,"y_px":200`, 25, 25)
+	check(`"x_px":400,"y_px":0`, 100, 0)
+	// An explicit reference frame wins over the canvas.
+	check(`"x_px":50,"y_px":300,"reference_width":200,"reference_height":400`, 25, 75)
+
+	for _, pos := range []string{
+		`"x_px":401,"y_px":10`,
+		`"x_px":10,"y_px":-1`,
+		`"x_px":10,"y_px":500,"reference_height":400`,
+		`"x_px":10`,
+		`"x_px":10,"y_px":10,"reference_width":-5`,
+	} {
+		if w := post(pos); w.Code != 400 {
+			t.Errorf("%s: expected 400, got %d", pos, w.Code)
+		}
+	}
+}
+
+func TestHandleCreateCommentAnchorTooLong(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+
+	body := `{"page":"index.html","author_name":"Alice","body":"hi","anchor":"` + strings.Repeat("a", maxAnchorLen+1) + `"}`
+	req := httptest.NewRequest("POST", "/api/versions/"+vid+"/comments", strings.NewReader(body))
+	req.SetPathValue("id", vid)
+	w := httptest.NewRecorder()
+	h.handleCreateComment(w, req)
+	if w.Code != 400 {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
 func TestHandleCreateCommentMissingBody(t *testing.T) {
 	h := setupTestHandler(t)
 	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
@@ -332,6 +537,31 @@ func TestHandleCreateCommentMissingBody(t *testing.T) {
 	if w.Code != 400 {
 		t.Errorf("expected 400, got %d", w.Code)
 	}
+	var resp map[string]string
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["field"] != "body" || resp["error"] == "" {
+		t.Errorf("expected error naming body, got %v", resp)
+	}
+}
+
+func TestHandleCreateCommentOutOfRange(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+
+	body := `{"page":"index.html","x_percent":120,"y_percent":20,"body":"hi"}`
+	req := httptest.NewRequest("POST", "/api/versions/"+vid+"/comments", strings.NewReader(body))
+	req.SetPathValue("id", vid)
+	w := httptest.NewRecorder()
+	h.handleCreateComment(w, req)
+
+	if w.Code != 400 {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	var resp map[string]string
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["field"] != "x_percent" || resp["error"] != "x_percent out of range" {
+		t.Errorf("unexpected error body: %v", resp)
+	}
 }
 
 func TestHandleCreateCommentInvalidJSON(t *testing.T) {
@@ -373,6 +603,80 @@ func TestHandleGetCommentsWithReplies(t *testing.T) {
 	}
 }
 
+func TestHandleCreateCommentLimit(t *testing.T) {
+	h := setupTestHandler(t)
+	h.MaxCommentsPerVersion = 2
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+
+	create := func() int {
+		body := `{"page":"index.html","x_percent":10,"y_percent":20,"author_name":"Alice","body":"pin"}`
+		req := httptest.NewRequest("POST", "/api/versions/"+vid+"/comments", strings.NewReader(body))
+		req.SetPathValue("id", vid)
+		w := httptest.NewRecorder()
+		h.handleCreateComment(w, req)
+		return w.Code
+	}
+	for i := 0; i < 2; i++ {
+		if code := create(); code != 201 {
+			t.Fatalf("comment %d: expected 201, got %d", i+1, code)
+		}
+	}
+	if code := create(); code != http.StatusConflict {
+		t.Errorf("over the cap: expected 409, got %d", code)
+	}
+	if n, _ := h.DB.CountCommentsForVersion(vid); n != 2 {
+		t.Errorf("expected 2 comments stored, got %d", n)
+	}
+}
+
+func TestHandleGetCommentsReplySummary(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+
+	c, _ := h.DB.CreateComment(vid, "index.html", 10, 20, "Alice", "a@t.com", "hello")
+	r1, _ := h.DB.CreateReply(c.ID, "Bob", "b@t.com", "reply1")
+	r2, _ := h.DB.CreateReply(c.ID, "Carol", "c@t.com", "reply2")
+	h.DB.CreateComment(vid, "index.html", 30, 40, "Alice", "a@t.com", "quiet")
+
+	// Replies created in the same second would tie; spread them out.
+	sqlDB := h.DB.(*db.DB)
+	sqlDB.Exec(`UPDATE replies SET created_at = datetime('now', '+1 hour') WHERE id = ?`, r1.ID)
+	sqlDB.Exec(`UPDATE replies SET created_at = datetime('now', '+2 hours') WHERE id = ?`, r2.ID)
+
+	req := httptest.NewRequest("GET", "/api/versions/"+vid+"/comments", nil)
+	req.SetPathValue("id", vid)
+	w := httptest.NewRecorder()
+	h.handleGetComments(w, req)
+
+	var result []commentJSON
+	json.NewDecoder(w.Body).Decode(&result)
+	if len(result) != 2 {
+		t.Fatalf("expected 2 comments, got %d", len(result))
+	}
+	byBody := map[string]commentJSON{}
+	for _, c := range result {
+		byBody[c.Body] = c
+	}
+
+	got := byBody["hello"]
+	if got.ReplyCount != 2 {
+		t.Errorf("reply_count = %d, want 2", got.ReplyCount)
+	}
+	replies, _ := h.DB.GetReplies(c.ID)
+	latest := replies[len(replies)-1]
+	if latest.ID != r2.ID {
+		t.Fatalf("expected reply2 to be newest, got %+v", latest)
+	}
+	if want := latest.CreatedAt.Format(time.RFC3339); got.LastActivityAt != want {
+		t.Errorf("last_activity_at = %q, want %q", got.LastActivityAt, want)
+	}
+
+	quiet := byBody["quiet"]
+	if quiet.ReplyCount != 0 || quiet.LastActivityAt != quiet.CreatedAt {
+		t.Errorf("comment without replies: %+v", quiet)
+	}
+}
+
 func TestHandleCreateReply(t *testing.T) {
 	h := setupTestHandler(t)
 	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
@@ -444,6 +748,127 @@ func TestHandleToggleResolve(t *testing.T) {
 	}
 }
 
+func TestHandleToggleResolveWithReply(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+	c, _ := h.DB.CreateComment(vid, "index.html", 10, 20, "Alice", "a@t.com", "hello")
+
+	req := httptest.NewRequest("PATCH", "/api/comments/"+c.ID+"/resolve", strings.NewReader(`{"body":"Fixed in v2"}`))
+	req.SetPathValue("id", c.ID)
+	req = withUser(req, "Bob", "bob@t.com")
+	w := httptest.NewRecorder()
+	h.handleToggleResolve(w, req)
+
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var res struct {
+		Resolved bool        `json:"resolved"`
+		Comment  commentJSON `json:"comment"`
+	}
+	json.NewDecoder(w.Body).Decode(&res)
+	if !res.Resolved || !res.Comment.Resolved {
+		t.Errorf("expected resolved comment, got %+v", res)
+	}
+	if len(res.Comment.Replies) != 1 || res.Comment.Replies[0].Body != "Fixed in v2" || res.Comment.Replies[0].AuthorName != "Bob" {
+		t.Errorf("expected one closing reply from Bob, got %+v", res.Comment.Replies)
+	}
+
+	// Resolving again with a body is a conflict and adds no reply.
+	req = httptest.NewRequest("PATCH", "/api/comments/"+c.ID+"/resolve", strings.NewReader(`{"body":"again"}`))
+	req.SetPathValue("id", c.ID)
+	w = httptest.NewRecorder()
+	h.handleToggleResolve(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", w.Code)
+	}
+	if replies, _ := h.DB.GetReplies(c.ID); len(replies) != 1 {
+		t.Errorf("expected 1 reply, got %d", len(replies))
+	}
+
+	req = httptest.NewRequest("PATCH", "/api/comments/"+c.ID+"/resolve", strings.NewReader(`{`))
+	req.SetPathValue("id", c.ID)
+	w = httptest.NewRecorder()
+	h.handleToggleResolve(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid JSON, got %d", w.Code)
+	}
+}
+
+func TestHandleGetCommentEvents(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+	c, _ := h.DB.CreateComment(vid, "index.html", 10, 20, "Alice", "a@t.com", "hello")
+
+	for _, email := range []string{"bob@t.com", "alice@t.com"} {
+		req := httptest.NewRequest("PATCH", "/api/comments/"+c.ID+"/resolve", nil)
+		req.SetPathValue("id", c.ID)
+		req = withUser(req, "User", email)
+		h.handleToggleResolve(httptest.NewRecorder(), req)
+	}
+
+	req := httptest.NewRequest("GET", "/api/comments/"+c.ID+"/events", nil)
+	req.SetPathValue("id", c.ID)
+	w := httptest.NewRecorder()
+	h.handleGetCommentEvents(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var events []commentEventJSON
+	json.NewDecoder(w.Body).Decode(&events)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+	if events[0].Action != "resolve" || events[0].ActorEmail != "bob@t.com" ||
+		events[1].Action != "reopen" || events[1].ActorEmail != "alice@t.com" {
+		t.Errorf("unexpected events: %+v", events)
+	}
+
+	req = httptest.NewRequest("GET", "/api/comments/nonexistent/events", nil)
+	req.SetPathValue("id", "nonexistent")
+	w = httptest.NewRecorder()
+	h.handleGetCommentEvents(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestHandleGetComment(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+	c, _ := h.DB.CreateComment(vid, "index.html", 10, 20, "Alice", "a@t.com", "hello")
+	h.DB.CreateReply(c.ID, "Bob", "b@t.com", "first")
+	h.DB.CreateReply(c.ID, "Carol", "c@t.com", "second")
+	lonely, _ := h.DB.CreateComment(vid, "index.html", 30, 40, "Alice", "a@t.com", "no replies")
+
+	get := func(id string) (*httptest.ResponseRecorder, commentJSON) {
+		req := httptest.NewRequest("GET", "/api/comments/"+id, nil)
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		h.handleGetComment(w, req)
+		var got commentJSON
+		json.NewDecoder(w.Body).Decode(&got)
+		return w, got
+	}
+
+	w, got := get(c.ID)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got.ID != c.ID || got.Body != "hello" || got.ReplyCount != 2 || got.Replies[0].Body != "first" || got.Replies[1].Body != "second" {
+		t.Errorf("unexpected comment: %+v", got)
+	}
+
+	w, got = get(lonely.ID)
+	if w.Code != 200 || got.Body != "no replies" || got.ReplyCount != 0 || got.Replies == nil {
+		t.Errorf("comment without replies: got %d %+v", w.Code, got)
+	}
+
+	if w, _ := get("nonexistent"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
 func TestHandleToggleResolveNotFound(t *testing.T) {
 	h := setupTestHandler(t)
 
@@ -467,7 +892,7 @@ func TestHandleGetCommentsCarryOver(t *testing.T) {
 	h.DB.CreateComment(v1.ID, "index.html", 10, 20, "Alice", "a@t.com", "unresolved on v1")
 	// Create resolved comment on v1
 	resolved, _ := h.DB.CreateComment(v1.ID, "index.html", 30, 40, "Bob", "b@t.com", "resolved on v1")
-	h.DB.ToggleResolve(resolved.ID)
+	h.DB.ToggleResolve(resolved.ID, "")
 
 	// GET comments for v2 should include unresolved from v1 but NOT resolved from v1
 	req := httptest.NewRequest("GET", "/api/versions/"+v2.ID+"/comments", nil)
@@ -485,6 +910,97 @@ func TestHandleGetCommentsCarryOver(t *testing.T) {
 	}
 }
 
+func TestHandleGetCommentsAuthorFilter(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("author-filter-proj", "")
+	v1, _ := h.DB.CreateVersion(p.ID, "/tmp/v1")
+	v2, _ := h.DB.CreateVersion(p.ID, "/tmp/v2")
+
+	h.DB.CreateComment(v1.ID, "index.html", 10, 20, "Alice", "a@t.com", "carried from v1")
+	h.DB.CreateComment(v1.ID, "index.html", 10, 20, "Bob", "b@t.com", "bob on v1")
+	h.DB.CreateComment(v2.ID, "about.html", 10, 20, "Alice", "a@t.com", "alice on about")
+	h.DB.CreateComment(v2.ID, "index.html", 30, 40, "Bob", "b@t.com", "bob on v2")
+
+	get := func(query string) []string {
+		req := httptest.NewRequest("GET", "/api/versions/"+v2.ID+"/comments?"+query, nil)
+		req.SetPathValue("id", v2.ID)
+		w := httptest.NewRecorder()
+		h.handleGetComments(w, req)
+		if w.Code != 200 {
+			t.Fatalf("%s: expected 200, got %d", query, w.Code)
+		}
+		if strings.TrimSpace(w.Body.String()) == "null" {
+			t.Fatalf("%s: expected an array, got null", query)
+		}
+		var result []commentJSON
+		json.NewDecoder(w.Body).Decode(&result)
+		var bodies []string
+		for _, c := range result {
+			bodies = append(bodies, c.Body)
+		}
+		return bodies
+	}
+
+	if got := get("author=A@T.com"); len(got) != 2 || !slices.Contains(got, "carried from v1") || !slices.Contains(got, "alice on about") {
+		t.Errorf("author only: got %v", got)
+	}
+	if got := get("author=a@t.com&page=index.html"); len(got) != 1 || got[0] != "carried from v1" {
+		t.Errorf("author and page: got %v", got)
+	}
+	if got := get("author=nobody@t.com"); len(got) != 0 {
+		t.Errorf("unknown author: got %v", got)
+	}
+}
+
+func TestHandleGetCommentsPageFilter(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("page-filter-proj", "")
+	v1, _ := h.DB.CreateVersion(p.ID, "/tmp/v1")
+	v2, _ := h.DB.CreateVersion(p.ID, "/tmp/v2")
+
+	h.DB.CreateComment(v1.ID, "index.html", 10, 20, "Alice", "a@t.com", "carried home")
+	old, _ := h.DB.CreateComment(v1.ID, "index.html", 10, 20, "Alice", "a@t.com", "resolved on v1")
+	h.DB.ToggleResolve(old.ID, "")
+	h.DB.CreateComment(v2.ID, "about.html", 10, 20, "Bob", "b@t.com", "about")
+	done, _ := h.DB.CreateComment(v2.ID, "index.html", 30, 40, "Bob", "b@t.com", "resolved home")
+	h.DB.ToggleResolve(done.ID, "")
+
+	get := func(page string) []string {
+		req := httptest.NewRequest("GET", "/api/versions/"+v2.ID+"/comments?page="+page, nil)
+		req.SetPathValue("id", v2.ID)
+		w := httptest.NewRecorder()
+		h.handleGetComments(w, req)
+		if w.Code != 200 {
+			t.Fatalf("page %q: expected 200, got %d", page, w.Code)
+		}
+		var result []commentJSON
+		json.NewDecoder(w.Body).Decode(&result)
+		var bodies []string
+		for _, c := range result {
+			if c.Page != page {
+				t.Errorf("page %q: got comment on %q", page, c.Page)
+			}
+			bodies = append(bodies, c.Body)
+		}
+		return bodies
+	}
+
+	if got := get("index.html"); strings.Join(got, ",") != "carried home,resolved home" {
+		t.Errorf("index.html comments = %v", got)
+	}
+	if got := get("about.html"); strings.Join(got, ",") != "about" {
+		t.Errorf("about.html comments = %v", got)
+	}
+
+	req := httptest.NewRequest("GET", "/api/versions/"+v2.ID+"/comments?page=missing.html", nil)
+	req.SetPathValue("id", v2.ID)
+	w := httptest.NewRecorder()
+	h.handleGetComments(w, req)
+	if w.Code != 200 || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("unknown page: got %d %q, want 200 []", w.Code, w.Body.String())
+	}
+}
+
 func TestHandleGetCommentsResolvedOnCurrentVersion(t *testing.T) {
 	h := setupTestHandler(t)
 	p, _ := h.DB.CreateProject("resolved-proj", "")
@@ -492,7 +1008,7 @@ func TestHandleGetCommentsResolvedOnCurrentVersion(t *testing.T) {
 
 	// Create and resolve a comment on v1
 	c, _ := h.DB.CreateComment(v1.ID, "index.html", 10, 20, "Alice", "a@t.com", "resolved here")
-	h.DB.ToggleResolve(c.ID)
+	h.DB.ToggleResolve(c.ID, "")
 
 	// GET comments for v1 should include the resolved comment
 	req := httptest.NewRequest("GET", "/api/versions/"+v1.ID+"/comments", nil)
@@ -548,7 +1064,7 @@ func TestHandleGetCommentsMultipleWithFilter(t *testing.T) {
 	h.DB.CreateComment(vid, "index.html", 10, 20, "Alice", "a@t.com", "on index")
 	h.DB.CreateComment(vid, "about.html", 30, 40, "Bob", "b@t.com", "on about")
 	c3, _ := h.DB.CreateComment(vid, "index.html", 50, 60, "Carol", "c@t.com", "resolved one")
-	h.DB.ToggleResolve(c3.ID)
+	h.DB.ToggleResolve(c3.ID, "")
 
 	req := httptest.NewRequest("GET", "/api/versions/"+vid+"/comments", nil)
 	req.SetPathValue("id", vid)
@@ -734,13 +1250,14 @@ func TestHandleMoveCommentInvalidJSON(t *testing.T) {
 func TestHandleMoveCommentOutOfRange(t *testing.T) {
 	h := setupTestHandler(t)
 	tests := []struct {
-		name string
-		body string
+		name  string
+		body  string
+		field string
 	}{
-		{"x too high", `{"x_percent":101,"y_percent":50}`},
-		{"y too high", `{"x_percent":50,"y_percent":101}`},
-		{"x negative", `{"x_percent":-1,"y_percent":50}`},
-		{"y negative", `{"x_percent":50,"y_percent":-1}`},
+		{"x too high", `{"x_percent":101,"y_percent":50}`, "x_percent"},
+		{"y too high", `{"x_percent":50,"y_percent":101}`, "y_percent"},
+		{"x negative", `{"x_percent":-1,"y_percent":50}`, "x_percent"},
+		{"y negative", `{"x_percent":50,"y_percent":-1}`, "y_percent"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -751,6 +1268,11 @@ func TestHandleMoveCommentOutOfRange(t *testing.T) {
 			if w.Code != 400 {
 				t.Errorf("expected 400, got %d", w.Code)
 			}
+			var resp map[string]string
+			json.NewDecoder(w.Body).Decode(&resp)
+			if resp["field"] != tt.field || resp["error"] != tt.field+" out of range" {
+				t.Errorf("unexpected error body: %v", resp)
+			}
 		})
 	}
 }
@@ -861,6 +1383,79 @@ func TestCommentAccessGetCommentDBError(t *testing.T) {
 	}
 }
 
+// --- Reply resolution ---
+
+func TestHandleToggleReplyResolve(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+	c, _ := h.DB.CreateComment(vid, "index.html", 10, 20, "Alice", "a@t.com", "hello")
+	rp, _ := h.DB.CreateReply(c.ID, "Bob", "b@t.com", "part one done")
+
+	req := httptest.NewRequest("PATCH", "/api/replies/"+rp.ID+"/resolve", nil)
+	req.SetPathValue("id", rp.ID)
+	w := httptest.NewRecorder()
+	h.handleToggleReplyResolve(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var res map[string]bool
+	json.NewDecoder(w.Body).Decode(&res)
+	if !res["resolved"] {
+		t.Error("expected resolved=true")
+	}
+
+	// Parent comment stays unresolved and the reply shows as resolved
+	req = httptest.NewRequest("GET", "/api/versions/"+vid+"/comments", nil)
+	req.SetPathValue("id", vid)
+	w = httptest.NewRecorder()
+	h.handleGetComments(w, req)
+	var comments []commentJSON
+	json.NewDecoder(w.Body).Decode(&comments)
+	if len(comments) != 1 || comments[0].Resolved {
+		t.Fatalf("expected one unresolved comment, got %+v", comments)
+	}
+	if len(comments[0].Replies) != 1 || !comments[0].Replies[0].Resolved {
+		t.Errorf("expected resolved reply, got %+v", comments[0].Replies)
+	}
+}
+
+func TestHandleToggleReplyResolveNotFound(t *testing.T) {
+	h := setupTestHandler(t)
+	req := httptest.NewRequest("PATCH", "/api/replies/nonexistent/resolve", nil)
+	req.SetPathValue("id", "nonexistent")
+	w := httptest.NewRecorder()
+	h.handleToggleReplyResolve(w, req)
+	if w.Code != 404 {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestReplyAccessNoProjectAccess(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("priv", "owner@test.com")
+	v, _ := h.DB.CreateVersion(p.ID, "/tmp/v")
+	c, _ := h.DB.CreateComment(v.ID, "index.html", 10, 20, "A", "a@t.com", "hi")
+	rp, _ := h.DB.CreateReply(c.ID, "A", "a@t.com", "re")
+
+	called := false
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+	req := httptest.NewRequest("PATCH", "/api/replies/"+rp.ID+"/resolve", nil)
+	req.SetPathValue("id", rp.ID)
+	req = withUser(req, "Stranger", "stranger@test.com")
+	w := httptest.NewRecorder()
+	h.replyAccess(inner).ServeHTTP(w, req)
+	if w.Code != 404 || called {
+		t.Errorf("expected 404, got %d called=%v", w.Code, called)
+	}
+
+	req = withUser(req, "Owner", "owner@test.com")
+	w = httptest.NewRecorder()
+	h.replyAccess(inner).ServeHTTP(w, req)
+	if !called {
+		t.Error("expected owner to be granted access")
+	}
+}
+
 // --- Phase 29: Request Body Size Limits ---
 
 func TestCreateCommentOversizedBody(t *testing.T) {
@@ -907,3 +1502,261 @@ func TestMoveCommentOversizedBody(t *testing.T) {
 		t.Errorf("expected 413, got %d", w.Code)
 	}
 }
+
+func TestHandleUpdateCommentPage(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, oldVID := seedProject(t, h, map[string]string{"index.html": "x", "about.html": "a"})
+	c, _ := h.DB.CreateComment(oldVID, "about.html", 10, 20, "Alice", "a@t.com", "hello")
+	// about.html was renamed to company.html in the next version.
+	newV, _ := h.DB.CreateVersion(pid, "")
+	h.Storage.SaveUpload(newV.ID, bytes.NewReader(makeZipForTest(t, map[string]string{"index.html": "x", "company.html": "a"})))
+
+	move := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/api/comments/"+c.ID+"/page", strings.NewReader(body))
+		req.SetPathValue("id", c.ID)
+		w := httptest.NewRecorder()
+		h.handleUpdateCommentPage(w, req)
+		return w
+	}
+
+	if w := move(`{"page":"company.html"}`); w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got, _ := h.DB.GetComment(c.ID); got.Page != "company.html" {
+		t.Errorf("page = %q, want company.html", got.Page)
+	}
+
+	for name, body := range map[string]string{
+		"unknown page":             `{"page":"missing.html"}`,
+		"page only in old version": `{"page":"about.html"}`,
+		"empty page":               `{"page":""}`,
+		"other project's version":  `{"page":"index.html","version_id":"nonexistent"}`,
+		"invalid JSON":             `{`,
+	} {
+		if w := move(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, w.Code)
+		}
+	}
+	if got, _ := h.DB.GetComment(c.ID); got.Page != "company.html" {
+		t.Errorf("rejected moves should leave the page alone, got %q", got.Page)
+	}
+
+	// An explicit version validates against that version's pages.
+	if w := move(`{"page":"about.html","version_id":"` + oldVID + `"}`); w.Code != 200 {
+		t.Errorf("page in the given version: expected 200, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("PATCH", "/api/comments/nonexistent/page", strings.NewReader(`{"page":"index.html"}`))
+	req.SetPathValue("id", "nonexistent")
+	w := httptest.NewRecorder()
+	h.handleUpdateCommentPage(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown comment: expected 404, got %d", w.Code)
+	}
+}
+
+func TestHandleResolveByAuthor(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+	h.DB.AddMember(p.ID, "bob@test.com")
+	v1, _ := h.DB.CreateVersion(p.ID, "")
+	carried, _ := h.DB.CreateComment(v1.ID, "index.html", 10, 10, "Bob", "bob@test.com", "old")
+	v2, _ := h.DB.CreateVersion(p.ID, "")
+	bob, _ := h.DB.CreateComment(v2.ID, "index.html", 20, 20, "Bob", "Bob@Test.com", "new")
+	carol, _ := h.DB.CreateComment(v2.ID, "index.html", 30, 30, "Carol", "carol@test.com", "other")
+
+	resolve := func(user, author string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/versions/"+v2.ID+"/comments/resolve-by-author", strings.NewReader(`{"author_email":"`+author+`"}`))
+		req.SetPathValue("id", v2.ID)
+		req = withUser(req, "User", user)
+		w := httptest.NewRecorder()
+		h.handleResolveByAuthor(w, req)
+		return w
+	}
+
+	// Members can't resolve other people's comments.
+	if w := resolve("bob@test.com", "carol@test.com"); w.Code != http.StatusForbidden {
+		t.Fatalf("member: expected 403, got %d", w.Code)
+	}
+
+	w := resolve("alice@test.com", "bob@test.com")
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]int
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["resolved"] != 2 {
+		t.Errorf("resolved = %d, want 2", resp["resolved"])
+	}
+	for _, c := range []struct {
+		id   string
+		want bool
+	}{{carried.ID, true}, {bob.ID, true}, {carol.ID, false}} {
+		got, _ := h.DB.GetComment(c.id)
+		if got.Resolved != c.want {
+			t.Errorf("comment %q resolved = %v, want %v", got.Body, got.Resolved, c.want)
+		}
+	}
+
+	// Nothing left to resolve; authors may always target their own.
+	w = resolve("bob@test.com", "bob@test.com")
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != 200 || resp["resolved"] != 0 {
+		t.Errorf("second run: got %d, resolved %d", w.Code, resp["resolved"])
+	}
+
+	if w := resolve("alice@test.com", ""); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"field":"author_email"`) {
+		t.Errorf("missing author: got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleMoveCommentsPage(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, v1 := seedProject(t, h, map[string]string{"index.html": "x", "a.html": "a", "b.html": "b"})
+	carried, _ := h.DB.CreateComment(v1, "a.html", 10, 10, "Alice", "a@t.com", "old")
+	// a.html was folded into b.html in the next version.
+	v2, _ := h.DB.CreateVersion(pid, "")
+	h.Storage.SaveUpload(v2.ID, bytes.NewReader(makeZipForTest(t, map[string]string{"index.html": "x", "b.html": "ab"})))
+	onA, _ := h.DB.CreateComment(v2.ID, "a.html", 20, 20, "Bob", "b@t.com", "new")
+	onIndex, _ := h.DB.CreateComment(v2.ID, "index.html", 30, 30, "Bob", "b@t.com", "stays")
+
+	move := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/versions/"+v2.ID+"/comments/move-page", strings.NewReader(body))
+		req.SetPathValue("id", v2.ID)
+		w := httptest.NewRecorder()
+		h.handleMoveCommentsPage(w, req)
+		return w
+	}
+
+	w := move(`{"from":"a.html","to":"b.html"}`)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]int
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["moved"] != 2 {
+		t.Errorf("moved = %d, want 2", resp["moved"])
+	}
+	for id, want := range map[string]string{carried.ID: "b.html", onA.ID: "b.html", onIndex.ID: "index.html"} {
+		if got, _ := h.DB.GetComment(id); got.Page != want {
+			t.Errorf("comment %q page = %q, want %q", got.Body, got.Page, want)
+		}
+	}
+
+	for name, body := range map[string]string{
+		"page only in old version": `{"from":"b.html","to":"a.html"}`,
+		"unknown page":             `{"from":"b.html","to":"missing.html"}`,
+		"missing from":             `{"to":"b.html"}`,
+		"invalid JSON":             `{`,
+	} {
+		if w := move(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, w.Code)
+		}
+	}
+	if got, _ := h.DB.GetComment(onA.ID); got.Page != "b.html" {
+		t.Errorf("rejected move changed the page to %q", got.Page)
+	}
+}
+
+func TestHandleGetCommentsSince(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("since-proj", "")
+	v1, _ := h.DB.CreateVersion(p.ID, "/tmp/v1")
+	v2, _ := h.DB.CreateVersion(p.ID, "/tmp/v2")
+	sqlDB := h.DB.(*db.DB)
+
+	old, _ := h.DB.CreateComment(v2.ID, "index.html", 10, 20, "Alice", "a@t.com", "old")
+	carried, _ := h.DB.CreateComment(v1.ID, "index.html", 10, 20, "Alice", "a@t.com", "carried, new reply")
+	h.DB.CreateComment(v2.ID, "index.html", 10, 20, "Bob", "b@t.com", "new")
+	oldReply, _ := h.DB.CreateReply(carried.ID, "Bob", "b@t.com", "old reply")
+	h.DB.CreateReply(carried.ID, "Bob", "b@t.com", "new reply")
+	for _, id := range []string{old.ID, carried.ID} {
+		sqlDB.Exec(`UPDATE comments SET created_at = datetime('now', '-2 hours') WHERE id = ?`, id)
+	}
+	sqlDB.Exec(`UPDATE replies SET created_at = datetime('now', '-2 hours') WHERE id = ?`, oldReply.ID)
+
+	get := func(since string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/versions/"+v2.ID+"/comments?since="+url.QueryEscape(since), nil)
+		req.SetPathValue("id", v2.ID)
+		w := httptest.NewRecorder()
+		h.handleGetComments(w, req)
+		return w
+	}
+
+	w := get(time.Now().Add(-time.Hour).UTC().Format(time.RFC3339))
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result []commentJSON
+	json.NewDecoder(w.Body).Decode(&result)
+	got := map[string]commentJSON{}
+	for _, c := range result {
+		got[c.Body] = c
+	}
+	if len(got) != 2 || got["new"].ID == "" || got["carried, new reply"].ID == "" {
+		t.Fatalf("expected the new comment and the one with a new reply, got %v", got)
+	}
+	replies := got["carried, new reply"].Replies
+	if len(replies) != 2 || replies[0].New || !replies[1].New {
+		t.Errorf("expected only the new reply flagged, got %+v", replies)
+	}
+
+	// A time in the future returns an empty array, not null.
+	if w := get(time.Now().Add(time.Hour).Format(time.RFC3339)); strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("future since: got %s", w.Body.String())
+	}
+	for _, bad := range []string{"yesterday", "2026-01-02", "2026-01-02 10:00:00"} {
+		if w := get(bad); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"field":"since"`) {
+			t.Errorf("since=%q: expected a 400 naming the field, got %d: %s", bad, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestCommentAuthorEmailNormalized(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+
+	post := func(email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/versions/"+vid+"/comments",
+			strings.NewReader(`{"page":"index.html","x_percent":10,"y_percent":10,"author_name":"Alice","author_email":"`+email+`","body":"hi"}`))
+		req.SetPathValue("id", vid)
+		w := httptest.NewRecorder()
+		h.handleCreateComment(w, req)
+		return w
+	}
+	if w := post(" Alice@Example.COM "); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	// A signed-in author's email is normalized too.
+	req := httptest.NewRequest("POST", "/api/versions/"+vid+"/comments",
+		strings.NewReader(`{"page":"index.html","x_percent":20,"y_percent":20,"body":"signed in"}`))
+	req.SetPathValue("id", vid)
+	w := httptest.NewRecorder()
+	h.handleCreateComment(w, withUser(req, "Alice", "alice@example.com"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, author := range []string{"Alice@Example.COM", "alice@example.com"} {
+		req := httptest.NewRequest("GET", "/api/versions/"+vid+"/comments?author="+url.QueryEscape(author), nil)
+		req.SetPathValue("id", vid)
+		w := httptest.NewRecorder()
+		h.handleGetComments(w, req)
+		var result []commentJSON
+		json.NewDecoder(w.Body).Decode(&result)
+		if len(result) != 2 {
+			t.Fatalf("author=%s: expected both comments, got %d", author, len(result))
+		}
+		for _, c := range result {
+			if c.AuthorEmail != "alice@example.com" {
+				t.Errorf("stored author_email = %q, want it normalized", c.AuthorEmail)
+			}
+		}
+	}
+
+	for _, bad := range []string{"alice", "Alice <alice@example.com>", "alice@@example.com"} {
+		if w := post(bad); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"field":"author_email"`) {
+			t.Errorf("%q: expected a 400 naming the field, got %d: %s", bad, w.Code, w.Body.String())
+		}
+	}
+}
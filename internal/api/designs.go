@@ -4,9 +4,15 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+
+	"github.com/ab/design-reviewer/internal/storage"
 )
 
+// handleDesignFile serves one file from an uploaded version. GET routes also
+// match HEAD, and ServeContent answers Range requests with 206 so large
+// assets such as videos can be seeked.
 func (h *Handler) handleDesignFile(w http.ResponseWriter, r *http.Request) {
 	versionID := r.PathValue("version_id")
 	filePath := r.PathValue("filepath")
@@ -30,5 +36,45 @@ func (h *Handler) handleDesignFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Set the type explicitly; ServeContent only sniffs when it is unset.
+	if ct := storage.ContentType(filePath); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
 	http.ServeContent(w, r, filePath, stat.ModTime(), f)
 }
+
+// handlePageHTML returns the stored HTML of one page of a version, for
+// tools that extract its text rather than render it. Only the version's
+// pages are served, never other files. The page is sandboxed so a browser
+// that opens the URL doesn't run its scripts against the app's origin.
+func (h *Handler) handlePageHTML(w http.ResponseWriter, r *http.Request) {
+	versionID := r.PathValue("id")
+	page := r.PathValue("page")
+
+	fullPath := h.Storage.GetFilePath(versionID, page)
+	baseDir := filepath.Clean(h.Storage.GetFilePath(versionID, "")) + string(os.PathSeparator)
+	if !strings.HasPrefix(fullPath, baseDir) {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
+	pages, err := h.Storage.ListHTMLFiles(versionID)
+	if err != nil || !slices.Contains(pages, page) {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	http.ServeContent(w, r, page, stat.ModTime(), f)
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ab/design-reviewer/internal/auth"
+)
+
+// Embed URLs default to a week and can be requested for up to 30 days.
+const (
+	defaultEmbedTTL = 7 * 24 * time.Hour
+	maxEmbedTTL     = 30 * 24 * time.Hour
+)
+
+// handleCreateEmbedURL returns a signed, expiring URL for one page of a
+// version that can be iframed elsewhere without signing in. The signature
+// is in the path rather than the query so the page's relative asset URLs
+// stay covered by it.
+func (h *Handler) handleCreateEmbedURL(w http.ResponseWriter, r *http.Request) {
+	if h.DisablePublic {
+		http.Error(w, errPublicDisabled, http.StatusForbidden)
+		return
+	}
+	versionID := r.PathValue("id")
+	if _, err := h.DB.GetVersion(versionID); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		serverError(w, "database error", err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		Page     string `json:"page"`
+		TTLHours int    `json:"ttl_hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	ttl := defaultEmbedTTL
+	if req.TTLHours != 0 {
+		ttl = time.Duration(req.TTLHours) * time.Hour
+		if ttl <= 0 || ttl > maxEmbedTTL {
+			http.Error(w, "ttl_hours must be between 1 and 720", http.StatusBadRequest)
+			return
+		}
+	}
+
+	pages, err := h.Storage.ListHTMLFiles(versionID)
+	if err != nil {
+		serverError(w, "storage error", err)
+		return
+	}
+	order, err := h.DB.GetPageOrder(versionID)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	pages = orderPages(pages, order)
+	page := req.Page
+	if page == "" && len(pages) > 0 {
+		page = pages[0]
+	}
+	if !slices.Contains(pages, page) {
+		http.Error(w, "unknown page", http.StatusBadRequest)
+		return
+	}
+
+	expiresAt := time.Now().Add(ttl).Unix()
+	sig := auth.SignEmbed(h.Auth.SessionSecret, versionID, expiresAt)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"url":        h.Auth.BaseURL + "/embed/" + versionID + "/" + strconv.FormatInt(expiresAt, 10) + "/" + sig + "/" + url.PathEscape(page),
+		"expires_at": time.Unix(expiresAt, 0).UTC().Format(time.RFC3339),
+	})
+}
+
+// handleEmbedFile serves a design file to anyone holding a valid, unexpired
+// embed signature for its version.
+func (h *Handler) handleEmbedFile(w http.ResponseWriter, r *http.Request) {
+	if h.DisablePublic {
+		http.NotFound(w, r)
+		return
+	}
+	exp, err := strconv.ParseInt(r.PathValue("exp"), 10, 64)
+	if err != nil || auth.VerifyEmbed(h.Auth.SessionSecret, r.PathValue("version_id"), exp, r.PathValue("sig")) != nil {
+		http.Error(w, "invalid or expired link", http.StatusForbidden)
+		return
+	}
+	h.handleDesignFile(w, r)
+}
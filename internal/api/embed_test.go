@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func createEmbedURL(t *testing.T, h *Handler, vid, body string) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/versions/"+vid+"/embed-url", strings.NewReader(body))
+	req.SetPathValue("id", vid)
+	w := httptest.NewRecorder()
+	h.handleCreateEmbedURL(w, req)
+	var res map[string]string
+	json.NewDecoder(strings.NewReader(w.Body.String())).Decode(&res)
+	return w, res["url"]
+}
+
+func TestEmbedURLServesDesign(t *testing.T) {
+	h := setupAuthHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "<h1>embedded</h1>", "style.css": "h1{}"})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	w, raw := createEmbedURL(t, h, vid, `{"page":"index.html","ttl_hours":1}`)
+	if w.Code != 200 {
+		t.Fatalf("create: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	u, err := url.Parse(raw)
+	if err != nil || !strings.HasPrefix(u.Path, "/embed/"+vid+"/") {
+		t.Fatalf("unexpected embed url %q", raw)
+	}
+
+	// No session is needed, and relative assets are covered by the signature.
+	for _, path := range []string{u.Path, strings.TrimSuffix(u.Path, "index.html") + "style.css"} {
+		w = servePublic(mux, "GET", path, "")
+		if w.Code != 200 {
+			t.Errorf("%s: expected 200, got %d", path, w.Code)
+		}
+	}
+	if !strings.Contains(servePublic(mux, "GET", u.Path, "").Body.String(), "embedded") {
+		t.Error("embed should serve the design page")
+	}
+}
+
+func TestEmbedURLTamperedOrExpired(t *testing.T) {
+	h := setupAuthHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	_, raw := createEmbedURL(t, h, vid, `{}`)
+	u, _ := url.Parse(raw)
+	parts := strings.Split(strings.TrimPrefix(u.Path, "/embed/"), "/") // vid, exp, sig, page
+
+	tampered := []string{
+		"/embed/" + vid + "/" + parts[1] + "/" + parts[2] + "x/index.html",
+		"/embed/" + vid + "/9999999999/" + parts[2] + "/index.html",
+		"/embed/other-version/" + parts[1] + "/" + parts[2] + "/index.html",
+		"/embed/" + vid + "/not-a-number/" + parts[2] + "/index.html",
+	}
+	for _, path := range tampered {
+		if w := servePublic(mux, "GET", path, ""); w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d", path, w.Code)
+		}
+	}
+
+	if w, _ := createEmbedURL(t, h, vid, `{"page":"missing.html"}`); w.Code != 400 {
+		t.Errorf("unknown page: expected 400, got %d", w.Code)
+	}
+	if w, _ := createEmbedURL(t, h, vid, `{"ttl_hours":10000}`); w.Code != 400 {
+		t.Errorf("ttl too long: expected 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/ab/design-reviewer/internal/auth"
+)
+
+// wantsErrorPage reports whether an error on this path should be shown as
+// the styled error page. API calls (including those under a public share)
+// and design files, which load inside the viewer's iframe, keep plain
+// errors.
+func wantsErrorPage(path string) bool {
+	if strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/designs/") || strings.HasPrefix(path, "/embed/") {
+		return false
+	}
+	if rest, ok := strings.CutPrefix(path, "/p/"); ok {
+		// Only the share page itself, /p/{token}, is a web page.
+		return !strings.Contains(strings.Trim(rest, "/"), "/")
+	}
+	return true
+}
+
+// errorPage writes status with the styled error page, falling back to a
+// plain-text error if the template can't be loaded.
+func (h *Handler) errorPage(w http.ResponseWriter, r *http.Request, status int, message string) {
+	tmpl, err := template.ParseFiles(
+		filepath.Join(h.TemplatesDir, "layout.html"),
+		filepath.Join(h.TemplatesDir, "error.html"),
+	)
+	if err != nil {
+		http.Error(w, message, status)
+		return
+	}
+	name, _ := auth.GetUserFromContext(r.Context())
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	tmpl.Execute(w, struct {
+		Status   int
+		Title    string
+		Message  string
+		UserName string
+		Base     string
+		Brand    Branding
+		Theme    string
+	}{status, http.StatusText(status), message, name, h.BasePath, h.brand(), themeOf(r)})
+}
+
+// notFound is http.NotFound with the styled page for web paths.
+func (h *Handler) notFound(w http.ResponseWriter, r *http.Request) {
+	if !wantsErrorPage(r.URL.Path) {
+		http.NotFound(w, r)
+		return
+	}
+	h.errorPage(w, r, http.StatusNotFound, "This page doesn't exist, or you don't have access to it.")
+}
+
+// webServerError is serverError with the styled page for web paths.
+func (h *Handler) webServerError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	if !wantsErrorPage(r.URL.Path) {
+		serverError(w, msg, err)
+		return
+	}
+	log.Printf("ERROR: %s: %v", msg, err)
+	h.errorPage(w, r, http.StatusInternalServerError, "Something went wrong on our side. Please try again in a moment.")
+}
+
+// handleNotFound catches GET requests that match no other route.
+func (h *Handler) handleNotFound(w http.ResponseWriter, r *http.Request) {
+	h.notFound(w, r)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUnknownWebPathRendersErrorPage(t *testing.T) {
+	h := setupTestHandler(t)
+	h.Branding = Branding{AppName: "Acme Review"}
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/no/such/page", nil))
+	if w.Code != 404 {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"<title>Acme Review</title>", "error-page", "Not Found", "/static/style.css"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in error page", want)
+		}
+	}
+}
+
+func TestUnknownAPIPathKeepsPlainError(t *testing.T) {
+	h := setupTestHandler(t)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/nope", nil))
+	if w.Code != 404 {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "<html") {
+		t.Errorf("API 404 should not be an HTML page: %s", w.Body.String())
+	}
+
+	// Wrong methods on known routes still get 405, not the catch-all.
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/api/projects", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", w.Code)
+	}
+}
+
+func TestViewerNotFoundRendersErrorPage(t *testing.T) {
+	h := setupTestHandler(t)
+	req := httptest.NewRequest("GET", "/projects/missing", nil)
+	req.SetPathValue("id", "missing")
+	w := httptest.NewRecorder()
+	h.handleViewer(w, req)
+
+	if w.Code != 404 {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "error-page") {
+		t.Error("expected the styled error page")
+	}
+}
+
+func TestWantsErrorPage(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/":                               true,
+		"/projects/abc":                   true,
+		"/invite/tok":                     true,
+		"/p/tok":                          true,
+		"/api/projects":                   false,
+		"/designs/v1/index.html":          false,
+		"/embed/v1/1/sig/a.html":          false,
+		"/p/tok/api/versions/v1/comments": false,
+		"/p/tok/designs/v1/index.html":    false,
+	} {
+		if got := wantsErrorPage(path); got != want {
+			t.Errorf("wantsErrorPage(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// heatmapGridSize is the number of rows and columns the page is divided
+// into, so each cell covers 10% of the width and height.
+const heatmapGridSize = 10
+
+// heatmapCell returns the grid cell a percentage coordinate falls in.
+// 100% belongs to the last cell.
+func heatmapCell(percent float64) int {
+	cell := int(percent * heatmapGridSize / 100)
+	return min(max(cell, 0), heatmapGridSize-1)
+}
+
+// handleGetHeatmap counts a version's comment pins per grid cell so the
+// viewer can shade the regions that draw the most feedback. ?page= limits
+// it to one page; resolved comments are left out unless
+// ?include_resolved=true.
+func (h *Handler) handleGetHeatmap(w http.ResponseWriter, r *http.Request) {
+	page := r.URL.Query().Get("page")
+	includeResolved := false
+	if v := r.URL.Query().Get("include_resolved"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid include_resolved", http.StatusBadRequest)
+			return
+		}
+		includeResolved = b
+	}
+
+	comments, err := h.DB.GetCommentsForVersion(r.PathValue("id"))
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+
+	cells := make([][]int, heatmapGridSize)
+	for i := range cells {
+		cells[i] = make([]int, heatmapGridSize)
+	}
+	total, maxCount := 0, 0
+	for _, c := range comments {
+		if (page != "" && c.Page != page) || (c.Resolved && !includeResolved) {
+			continue
+		}
+		row, col := heatmapCell(c.YPercent), heatmapCell(c.XPercent)
+		cells[row][col]++
+		total++
+		maxCount = max(maxCount, cells[row][col])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Page  string  `json:"page,omitempty"`
+		Rows  int     `json:"rows"`
+		Cols  int     `json:"cols"`
+		Cells [][]int `json:"cells"`
+		Total int     `json:"total"`
+		Max   int     `json:"max"`
+	}{page, heatmapGridSize, heatmapGridSize, cells, total, maxCount})
+}
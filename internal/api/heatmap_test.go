@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleGetHeatmap(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x", "about.html": "y"})
+	// Three pins clustered near the top-left, one far away, one on another page.
+	for _, pos := range [][2]float64{{2, 3}, {5, 8}, {9.9, 1}, {95, 100}} {
+		h.DB.CreateComment(vid, "index.html", pos[0], pos[1], "A", "a@test.com", "here")
+	}
+	h.DB.CreateComment(vid, "about.html", 50, 50, "A", "a@test.com", "elsewhere")
+	resolved, _ := h.DB.CreateComment(vid, "index.html", 55, 55, "A", "a@test.com", "done")
+	h.DB.ToggleResolve(resolved.ID, "a@test.com")
+
+	get := func(query string) (resp struct {
+		Cells [][]int `json:"cells"`
+		Total int     `json:"total"`
+		Max   int     `json:"max"`
+	}) {
+		req := httptest.NewRequest("GET", "/api/versions/"+vid+"/heatmap"+query, nil)
+		req.SetPathValue("id", vid)
+		w := httptest.NewRecorder()
+		h.handleGetHeatmap(w, req)
+		if w.Code != 200 {
+			t.Fatalf("%s: expected 200, got %d", query, w.Code)
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	resp := get("?page=index.html")
+	if len(resp.Cells) != 10 || len(resp.Cells[0]) != 10 {
+		t.Fatalf("expected a 10x10 grid, got %d rows", len(resp.Cells))
+	}
+	if resp.Cells[0][0] != 3 || resp.Max != 3 {
+		t.Errorf("dense cell = %d, max = %d; want 3", resp.Cells[0][0], resp.Max)
+	}
+	if resp.Cells[9][9] != 1 {
+		t.Errorf("edge cell = %d, want 1", resp.Cells[9][9])
+	}
+	if resp.Cells[5][5] != 0 || resp.Total != 4 {
+		t.Errorf("resolved comment counted by default: cell %d, total %d", resp.Cells[5][5], resp.Total)
+	}
+
+	if resp := get("?page=index.html&include_resolved=true"); resp.Cells[5][5] != 1 || resp.Total != 5 {
+		t.Errorf("include_resolved: cell %d, total %d", resp.Cells[5][5], resp.Total)
+	}
+	if resp := get(""); resp.Total != 5 {
+		t.Errorf("all pages: total = %d, want 5", resp.Total)
+	}
+
+	req := httptest.NewRequest("GET", "/api/versions/"+vid+"/heatmap?include_resolved=maybe", nil)
+	req.SetPathValue("id", vid)
+	w := httptest.NewRecorder()
+	h.handleGetHeatmap(w, req)
+	if w.Code != 400 {
+		t.Errorf("invalid include_resolved: expected 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ab/design-reviewer/internal/auth"
+)
+
+// handleSetDisplayName sets the name the signed-in user is shown as on the
+// comments and replies they post from now on. The email stays their
+// identity; an empty name goes back to the name from sign-in.
+func (h *Handler) handleSetDisplayName(w http.ResponseWriter, r *http.Request) {
+	_, email := auth.GetUserFromContext(r.Context())
+	if email == "" {
+		http.Error(w, "sign in to set a display name", http.StatusUnauthorized)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		DisplayName string `json:"display_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(req.DisplayName)
+	if len(name) > maxDisplayNameLen {
+		writeFieldError(w, "display_name", "display_name is too long")
+		return
+	}
+	if err := h.DB.SetDisplayName(email, name); err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"display_name": name})
+}
+
+// authorOf returns the name and normalized email to stamp on a comment or
+// reply by the signed-in user: their chosen display name if they set one,
+// otherwise the name from sign-in. Both are empty when no one is signed in.
+func (h *Handler) authorOf(r *http.Request) (name, email string) {
+	name, email = auth.GetUserFromContext(r.Context())
+	email = auth.NormalizeEmail(email)
+	if email == "" {
+		return name, email
+	}
+	display, err := h.DB.GetDisplayName(email)
+	if err != nil {
+		log.Printf("WARN: failed to look up display name of %s: %v", email, err)
+		return name, email
+	}
+	if display != "" {
+		name = display
+	}
+	return name, email
+}
+
+// requestAuthor returns who a comment or reply is by: the signed-in user, or
+// else the name and email given in the request, as when auth is disabled.
+// A given email is normalized; if it isn't a valid address, requestAuthor
+// writes a 400 and returns ok false.
+func (h *Handler) requestAuthor(w http.ResponseWriter, r *http.Request, name, email string) (string, string, bool) {
+	if n, e := h.authorOf(r); n != "" {
+		return n, e, true
+	}
+	email = auth.NormalizeEmail(email)
+	if email != "" && !auth.ValidEmail(email) {
+		writeFieldError(w, "author_email", "author_email is not a valid email address")
+		return "", "", false
+	}
+	return name, email, true
+}
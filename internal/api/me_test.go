@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleSetDisplayName(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+
+	setName := func(body string) *httptest.ResponseRecorder {
+		req := withUser(httptest.NewRequest("PATCH", "/api/me/display-name", strings.NewReader(body)), "alice.g", "alice@test.com")
+		w := httptest.NewRecorder()
+		h.handleSetDisplayName(w, req)
+		return w
+	}
+	comment := func() commentJSON {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/versions/"+vid+"/comments", strings.NewReader(`{"page":"index.html","body":"hi"}`))
+		req.SetPathValue("id", vid)
+		w := httptest.NewRecorder()
+		h.handleCreateComment(w, withUser(req, "alice.g", "alice@test.com"))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("comment: expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var c commentJSON
+		json.NewDecoder(w.Body).Decode(&c)
+		return c
+	}
+
+	if c := comment(); c.AuthorName != "alice.g" {
+		t.Errorf("without a display name, author = %q", c.AuthorName)
+	}
+
+	w := setName(`{"display_name":"  Alice Smith "}`)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"display_name":"Alice Smith"`) {
+		t.Fatalf("set: got %d %s", w.Code, w.Body.String())
+	}
+	c := comment()
+	if c.AuthorName != "Alice Smith" || c.AuthorEmail != "alice@test.com" {
+		t.Errorf("comment author = %q <%s>, want Alice Smith <alice@test.com>", c.AuthorName, c.AuthorEmail)
+	}
+
+	req := httptest.NewRequest("POST", "/api/comments/"+c.ID+"/replies", strings.NewReader(`{"body":"re"}`))
+	req.SetPathValue("id", c.ID)
+	w = httptest.NewRecorder()
+	h.handleCreateReply(w, withUser(req, "Alice (work)", "alice@test.com"))
+	var out replyJSON
+	json.NewDecoder(w.Body).Decode(&out)
+	reply, err := h.DB.GetReply(out.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.AuthorName != "Alice Smith" || reply.AuthorEmail != "alice@test.com" {
+		t.Errorf("reply author = %q <%s>", reply.AuthorName, reply.AuthorEmail)
+	}
+
+	// Clearing it goes back to the sign-in name.
+	setName(`{"display_name":""}`)
+	if c := comment(); c.AuthorName != "alice.g" {
+		t.Errorf("after clearing, author = %q", c.AuthorName)
+	}
+
+	if w := setName(`{"display_name":"` + strings.Repeat("x", maxDisplayNameLen+1) + `"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("too long: expected 400, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.handleSetDisplayName(w, httptest.NewRequest("PATCH", "/api/me/display-name", strings.NewReader(`{"display_name":"X"}`)))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("signed out: expected 401, got %d", w.Code)
+	}
+}
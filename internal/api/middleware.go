@@ -1,9 +1,13 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -11,6 +15,7 @@ import (
 	"golang.org/x/time/rate"
 
 	"github.com/ab/design-reviewer/internal/auth"
+	"github.com/ab/design-reviewer/internal/db"
 )
 
 // webMiddleware checks for a valid session cookie; redirects to login if missing.
@@ -20,23 +25,23 @@ func (h *Handler) webMiddleware(next http.Handler) http.Handler {
 		if err != nil || cookie.Value == "" {
 			http.SetCookie(w, &http.Cookie{
 				Name:     "redirect_to",
-				Value:    r.URL.RequestURI(),
+				Value:    h.link(r.URL.RequestURI()),
 				Path:     "/",
 				HttpOnly: true,
 				SameSite: http.SameSiteLaxMode,
 				MaxAge:   300,
 			})
-			http.Redirect(w, r, "/login", http.StatusFound)
+			http.Redirect(w, r, h.link("/login"), http.StatusFound)
 			return
 		}
 		u, err := auth.VerifySession(h.Auth.SessionSecret, cookie.Value)
 		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusFound)
+			http.Redirect(w, r, h.link("/login"), http.StatusFound)
 			return
 		}
 		if u.SessionID != "" {
 			if _, _, err := h.DB.GetSession(u.SessionID); err != nil {
-				http.Redirect(w, r, "/login", http.StatusFound)
+				http.Redirect(w, r, h.link("/login"), http.StatusFound)
 				return
 			}
 		}
@@ -48,7 +53,9 @@ func (h *Handler) webMiddleware(next http.Handler) http.Handler {
 // apiMiddleware checks for Bearer token or session cookie; returns 401 if missing.
 func (h *Handler) apiMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Try Bearer token first
+		// Try Bearer token first. If it's rejected, code tells the client
+		// whether logging in again will help.
+		code := ""
 		if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
 			token := strings.TrimPrefix(authHeader, "Bearer ")
 			name, email, err := h.DB.GetUserByToken(token)
@@ -57,6 +64,10 @@ func (h *Handler) apiMiddleware(next http.Handler) http.Handler {
 				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
+			code = tokenInvalid
+			if err == db.ErrTokenExpired {
+				code = tokenExpired
+			}
 		}
 		// Try session cookie
 		if cookie, err := r.Cookie("session"); err == nil && cookie.Value != "" {
@@ -74,24 +85,146 @@ func (h *Handler) apiMiddleware(next http.Handler) http.Handler {
 				return
 			}
 		}
+		resp := map[string]string{"error": "unauthorized"}
+		if code != "" {
+			resp["code"] = code
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// Codes in the 401 body when a Bearer token is rejected.
+const (
+	tokenExpired = "token_expired" // the token was issued but has expired
+	tokenInvalid = "token_invalid" // the token is unknown or revoked
+)
+
+// Reasons an access middleware turned a request away. Every denial looks
+// like a 404 to the client so ids can't be probed; the reason is only logged.
+const (
+	denyNoUser   = "no_user"   // request carried no signed-in user
+	denyNotFound = "not_found" // the resource (or its parent) doesn't exist
+	denyNoAccess = "no_access" // it exists but the user can't see the project
+	denyError    = "error"     // a lookup failed
+	// denyReadOnly is the exception: the user can see the project through
+	// its visibility but isn't a member, so a write is a 403.
+	denyReadOnly = "read_only"
+)
+
+// denyAccess logs why a request was refused and responds 404.
+func (h *Handler) denyAccess(w http.ResponseWriter, r *http.Request, resource, id, email, reason string, err error) {
+	msg := fmt.Sprintf("INFO: access denied reason=%s resource=%s id=%q actor=%q path=%q", reason, resource, id, email, r.URL.Path)
+	if err != nil {
+		msg += fmt.Sprintf(" err=%q", err)
+	}
+	h.logger().Print(msg)
+	h.notFound(w, r)
+}
+
+// lookupReason classifies a failed resource lookup.
+func lookupReason(err error) string {
+	if err == sql.ErrNoRows {
+		return denyNotFound
+	}
+	return denyError
+}
+
+// checkProjectAccess reports whether email can see the project, logging and
+// responding 404 if not. resource and id name what was asked for.
+func (h *Handler) checkProjectAccess(w http.ResponseWriter, r *http.Request, resource, id, projectID, email string) bool {
+	ok, err := h.DB.CanAccessProject(projectID, email)
+	if err != nil {
+		h.denyAccess(w, r, resource, id, email, denyError, err)
+		return false
+	}
+	if !ok {
+		// CanAccessProject doesn't tell a missing project from a private one.
+		reason := denyNoAccess
+		if _, err := h.DB.GetProject(projectID); err != nil {
+			reason = lookupReason(err)
+		}
+		h.denyAccess(w, r, resource, id, email, reason, nil)
+		return false
+	}
+	return true
+}
+
+// checkProjectWrite is checkProjectAccess for requests that change the
+// project. A user who can read it only through its visibility gets a 403.
+func (h *Handler) checkProjectWrite(w http.ResponseWriter, r *http.Request, resource, id, projectID, email string) bool {
+	if !h.checkProjectAccess(w, r, resource, id, projectID, email) {
+		return false
+	}
+	ok, err := h.DB.CanWriteProject(projectID, email)
+	if err != nil {
+		h.denyAccess(w, r, resource, id, email, denyError, err)
+		return false
+	}
+	if !ok {
+		h.logger().Printf("INFO: access denied reason=%s resource=%s id=%q actor=%q path=%q", denyReadOnly, resource, id, email, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "members only"})
+		return false
+	}
+	return true
+}
+
+// allowPublic serves anon to requests that carry no credentials when the
+// project found by projectOf is public. Everything else goes to authed,
+// which applies the usual sign-in and access checks.
+func (h *Handler) allowPublic(projectOf func(*http.Request) string, anon, authed http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.DisablePublic && !hasCredentials(r) {
+			if id := projectOf(r); id != "" {
+				if visibility, err := h.DB.GetProjectVisibility(id); err == nil && visibility == db.VisibilityPublic {
+					anon.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		authed.ServeHTTP(w, r)
 	})
 }
 
+// hasCredentials reports whether r carries a bearer token or session cookie.
+func hasCredentials(r *http.Request) bool {
+	if r.Header.Get("Authorization") != "" {
+		return true
+	}
+	cookie, err := r.Cookie("session")
+	return err == nil && cookie.Value != ""
+}
+
+// projectOfPath returns the {id} path value as a project ID, for allowPublic.
+func projectOfPath(r *http.Request) string {
+	return r.PathValue("id")
+}
+
+// projectOfVersion returns, for allowPublic, the project of the version
+// named by the given path value, or "" if there is no such version.
+func (h *Handler) projectOfVersion(name string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		v, err := h.DB.GetVersion(r.PathValue(name))
+		if err != nil {
+			return ""
+		}
+		return v.ProjectID
+	}
+}
+
 // projectAccess checks that the authenticated user can access the project identified by {id}.
 func (h *Handler) projectAccess(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, email := auth.GetUserFromContext(r.Context())
+		projectID := r.PathValue("id")
 		if email == "" {
-			http.NotFound(w, r)
+			h.denyAccess(w, r, "project", projectID, email, denyNoUser, nil)
 			return
 		}
-		projectID := r.PathValue("id")
-		ok, err := h.DB.CanAccessProject(projectID, email)
-		if err != nil || !ok {
-			http.NotFound(w, r)
+		if !h.checkProjectAccess(w, r, "project", projectID, projectID, email) {
 			return
 		}
 		next.ServeHTTP(w, r)
@@ -100,24 +233,36 @@ func (h *Handler) projectAccess(next http.Handler) http.Handler {
 
 // versionAccess checks access via version_id → project lookup.
 func (h *Handler) versionAccess(next http.Handler) http.Handler {
+	return h.versionCheck(next, false)
+}
+
+// versionWrite is versionAccess for routes that change the project, which
+// need the user to be an owner or member.
+func (h *Handler) versionWrite(next http.Handler) http.Handler {
+	return h.versionCheck(next, true)
+}
+
+func (h *Handler) versionCheck(next http.Handler, write bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, email := auth.GetUserFromContext(r.Context())
-		if email == "" {
-			http.NotFound(w, r)
-			return
-		}
 		versionID := r.PathValue("id")
 		if versionID == "" {
 			versionID = r.PathValue("version_id")
 		}
+		if email == "" {
+			h.denyAccess(w, r, "version", versionID, email, denyNoUser, nil)
+			return
+		}
 		v, err := h.DB.GetVersion(versionID)
 		if err != nil {
-			http.NotFound(w, r)
+			h.denyAccess(w, r, "version", versionID, email, lookupReason(err), err)
 			return
 		}
-		ok, err := h.DB.CanAccessProject(v.ProjectID, email)
-		if err != nil || !ok {
-			http.NotFound(w, r)
+		check := h.checkProjectAccess
+		if write {
+			check = h.checkProjectWrite
+		}
+		if !check(w, r, "version", versionID, v.ProjectID, email) {
 			return
 		}
 		next.ServeHTTP(w, r)
@@ -126,32 +271,91 @@ func (h *Handler) versionAccess(next http.Handler) http.Handler {
 
 // commentAccess checks access via comment_id → version → project lookup.
 func (h *Handler) commentAccess(next http.Handler) http.Handler {
+	return h.commentCheck(next, false)
+}
+
+// commentWrite is commentAccess for routes that change the project, which
+// need the user to be an owner or member.
+func (h *Handler) commentWrite(next http.Handler) http.Handler {
+	return h.commentCheck(next, true)
+}
+
+func (h *Handler) commentCheck(next http.Handler, write bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, email := auth.GetUserFromContext(r.Context())
+		commentID := r.PathValue("id")
 		if email == "" {
-			http.NotFound(w, r)
+			h.denyAccess(w, r, "comment", commentID, email, denyNoUser, nil)
 			return
 		}
-		c, err := h.DB.GetComment(r.PathValue("id"))
+		c, err := h.DB.GetComment(commentID)
 		if err != nil {
-			http.NotFound(w, r)
+			h.denyAccess(w, r, "comment", commentID, email, lookupReason(err), err)
 			return
 		}
 		v, err := h.DB.GetVersion(c.VersionID)
 		if err != nil {
-			http.NotFound(w, r)
+			h.denyAccess(w, r, "comment", commentID, email, lookupReason(err), err)
 			return
 		}
-		ok, err := h.DB.CanAccessProject(v.ProjectID, email)
-		if err != nil || !ok {
-			http.NotFound(w, r)
+		check := h.checkProjectAccess
+		if write {
+			check = h.checkProjectWrite
+		}
+		if !check(w, r, "comment", commentID, v.ProjectID, email) {
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-// ownerOnly checks that the authenticated user is the project owner.
+// replyAccess checks access via reply_id → comment → version → project lookup.
+func (h *Handler) replyAccess(next http.Handler) http.Handler {
+	return h.replyCheck(next, false)
+}
+
+// replyWrite is replyAccess for routes that change the project, which
+// need the user to be an owner or member.
+func (h *Handler) replyWrite(next http.Handler) http.Handler {
+	return h.replyCheck(next, true)
+}
+
+func (h *Handler) replyCheck(next http.Handler, write bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, email := auth.GetUserFromContext(r.Context())
+		replyID := r.PathValue("id")
+		if email == "" {
+			h.denyAccess(w, r, "reply", replyID, email, denyNoUser, nil)
+			return
+		}
+		rp, err := h.DB.GetReply(replyID)
+		if err != nil {
+			h.denyAccess(w, r, "reply", replyID, email, lookupReason(err), err)
+			return
+		}
+		c, err := h.DB.GetComment(rp.CommentID)
+		if err != nil {
+			h.denyAccess(w, r, "reply", replyID, email, lookupReason(err), err)
+			return
+		}
+		v, err := h.DB.GetVersion(c.VersionID)
+		if err != nil {
+			h.denyAccess(w, r, "reply", replyID, email, lookupReason(err), err)
+			return
+		}
+		check := h.checkProjectAccess
+		if write {
+			check = h.checkProjectWrite
+		}
+		if !check(w, r, "reply", replyID, v.ProjectID, email) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ownerOnly checks that the authenticated user is an owner or co-owner of
+// the project.
 func (h *Handler) ownerOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, email := auth.GetUserFromContext(r.Context())
@@ -160,12 +364,12 @@ func (h *Handler) ownerOnly(next http.Handler) http.Handler {
 			return
 		}
 		projectID := r.PathValue("id")
-		owner, err := h.DB.GetProjectOwner(projectID)
+		isOwner, err := h.DB.IsOwner(projectID, email)
 		if err != nil {
 			http.NotFound(w, r)
 			return
 		}
-		if owner != email {
+		if !isOwner {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusForbidden)
 			json.NewEncoder(w).Encode(map[string]string{"error": "owner only"})
@@ -175,29 +379,102 @@ func (h *Handler) ownerOnly(next http.Handler) http.Handler {
 	})
 }
 
+// adminOnly checks that the authenticated user is one of the configured
+// instance admins.
+func (h *Handler) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, email := auth.GetUserFromContext(r.Context())
+		if email == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if !h.isAdmin(email) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "admin only"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAdmin reports whether email is in h.Admins, ignoring case.
+func (h *Handler) isAdmin(email string) bool {
+	for _, a := range h.Admins {
+		if strings.EqualFold(a, email) {
+			return true
+		}
+	}
+	return false
+}
+
 // RateLimiter provides per-IP rate limiting with separate limits for
-// sensitive endpoints (auth/invite) and general endpoints.
+// sensitive endpoints (auth/invite) and general endpoints, plus a per-user
+// limit for comment writes (see UserWriteMiddleware).
 type RateLimiter struct {
 	general sync.Map // IP -> *rate.Limiter
 	strict  sync.Map // IP -> *rate.Limiter
+	user    sync.Map // email -> *rate.Limiter
 
-	generalRate rate.Limit
+	generalRate  rate.Limit
 	generalBurst int
 	strictRate   rate.Limit
 	strictBurst  int
+	userRate     rate.Limit
+	userBurst    int
+
+	// warnFraction is how much of a bucket may be left before responses
+	// carry rateLimitWarningHeader; 0 turns the warning off.
+	warnFraction float64
 }
 
+// rateLimitWarningHeader tells clients they are close to a rate limit, so
+// they can slow down before getting a 429.
+const rateLimitWarningHeader = "X-RateLimit-Warning"
+
+// DefaultRateLimitWarnFraction warns once less than a fifth of a bucket is
+// left.
+const DefaultRateLimitWarnFraction = 0.2
+
 // NewRateLimiter creates a RateLimiter with default rates:
-// general = 60 req/min, strict (auth/invite) = 10 req/min.
+// general = 60 req/min, strict (auth/invite) = 10 req/min,
+// user writes = 20 comments/replies per min.
 func NewRateLimiter() *RateLimiter {
 	return &RateLimiter{
-		generalRate:  rate.Every(time.Second),     // 1 req/s ≈ 60/min
+		generalRate:  rate.Every(time.Second), // 1 req/s ≈ 60/min
 		generalBurst: 30,
 		strictRate:   rate.Every(6 * time.Second), // ~10/min
 		strictBurst:  5,
+		userRate:     rate.Every(3 * time.Second), // 20/min
+		userBurst:    10,
+		warnFraction: DefaultRateLimitWarnFraction,
+	}
+}
+
+// SetWarnFraction changes how much of a bucket may be left before
+// responses warn that the limit is near. 0 turns the warning off.
+func (rl *RateLimiter) SetWarnFraction(f float64) {
+	rl.warnFraction = f
+}
+
+// warnIfLow sets rateLimitWarningHeader when lim has less than the warning
+// fraction of its burst left.
+func (rl *RateLimiter) warnIfLow(w http.ResponseWriter, lim *rate.Limiter, burst int) {
+	if rl.warnFraction > 0 && lim.Tokens() < rl.warnFraction*float64(burst) {
+		w.Header().Set(rateLimitWarningHeader, "true")
 	}
 }
 
+// SetUserWriteRate changes the per-user write limit to perMinute requests
+// per minute with the given burst (at least 1).
+func (rl *RateLimiter) SetUserWriteRate(perMinute, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	rl.userRate = rate.Limit(float64(perMinute) / 60)
+	rl.userBurst = burst
+}
+
 func (rl *RateLimiter) limiterFor(store *sync.Map, r rate.Limit, burst int, ip string) *rate.Limiter {
 	if v, ok := store.Load(ip); ok {
 		return v.(*rate.Limiter)
@@ -231,20 +508,120 @@ func clientIP(r *http.Request) string {
 // Middleware returns an http.Handler that enforces rate limits.
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" || r.URL.Path == "/ping" {
+			// Crawlers and open viewers fetch these often, and they cost
+			// nothing to serve.
+			next.ServeHTTP(w, r)
+			return
+		}
 		ip := clientIP(r)
 		var lim *rate.Limiter
+		var burst int
 		if isStrictPath(r.URL.Path) {
-			lim = rl.limiterFor(&rl.strict, rl.strictRate, rl.strictBurst, ip)
+			lim, burst = rl.limiterFor(&rl.strict, rl.strictRate, rl.strictBurst, ip), rl.strictBurst
 		} else {
-			lim = rl.limiterFor(&rl.general, rl.generalRate, rl.generalBurst, ip)
+			lim, burst = rl.limiterFor(&rl.general, rl.generalRate, rl.generalBurst, ip), rl.generalBurst
 		}
 		if !lim.Allow() {
-			w.Header().Set("Content-Type", "application/json")
-			w.Header().Set("Retry-After", "1")
-			w.WriteHeader(http.StatusTooManyRequests)
-			json.NewEncoder(w).Encode(map[string]string{"error": "rate limit exceeded"})
+			writeRateLimited(w, 1)
+			return
+		}
+		rl.warnIfLow(w, lim, burst)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UserWriteMiddleware limits write requests per authenticated user, so one
+// account can't flood comments even when it shares an IP with others. It
+// must run after apiMiddleware; reads and requests without a user pass.
+func (rl *RateLimiter) UserWriteMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, email := auth.GetUserFromContext(r.Context())
+		if email == "" || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		lim := rl.limiterFor(&rl.user, rl.userRate, rl.userBurst, email)
+		res := lim.Reserve()
+		if delay := res.Delay(); delay > 0 {
+			res.Cancel()
+			writeRateLimited(w, int(math.Ceil(delay.Seconds())))
 			return
 		}
+		rl.warnIfLow(w, lim, rl.userBurst)
 		next.ServeHTTP(w, r)
 	})
 }
+
+func writeRateLimited(w http.ResponseWriter, retryAfter int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]string{"error": "rate limit exceeded"})
+}
+
+// writeLimit applies the per-user write limit when one is configured.
+func (h *Handler) writeLimit(next http.Handler) http.Handler {
+	if h.WriteLimiter == nil {
+		return next
+	}
+	return h.WriteLimiter.UserWriteMiddleware(next)
+}
+
+// ReadOnly blocks every request that could change data with a 503, for
+// use during maintenance. Reads, HEAD and OPTIONS pass, as do the login
+// endpoints so people can still sign in to view designs.
+func ReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/auth/") || strings.HasPrefix(r.URL.Path, "/api/auth/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "300")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "the server is in read-only mode for maintenance; changes are disabled until it ends",
+		})
+	})
+}
+
+// CleanBasePath normalizes a configured base path to "" or a path with a
+// leading slash and no trailing one, so "design-reviewer/" becomes
+// "/design-reviewer".
+func CleanBasePath(p string) string {
+	p = strings.Trim(strings.TrimSpace(p), "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// WithBasePath serves next under base, stripping the prefix so routes and
+// path-based middleware see the same paths as at the root. The bare base is
+// redirected to base + "/" and anything outside it is a 404, except
+// /robots.txt, which crawlers only look for at the root. An empty base
+// returns next unchanged.
+func WithBasePath(base string, next http.Handler) http.Handler {
+	if base == "" {
+		return next
+	}
+	stripped := http.StripPrefix(base, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == base:
+			http.Redirect(w, r, base+"/", http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, base+"/"):
+			stripped.ServeHTTP(w, r)
+		case r.URL.Path == "/robots.txt":
+			next.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
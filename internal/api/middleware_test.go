@@ -1,10 +1,15 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/ab/design-reviewer/internal/db"
 )
 
 func TestClientIP(t *testing.T) {
@@ -111,6 +116,46 @@ func TestRateLimiterMiddleware_BlocksOverLimit(t *testing.T) {
 	}
 }
 
+func TestRateLimiterMiddleware_WarnsBeforeBlocking(t *testing.T) {
+	rl := NewRateLimiter()
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/projects", nil)
+		req.RemoteAddr = "4.4.4.4:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// With the general burst of 30 and the default fraction, the warning
+	// starts once fewer than 6 requests are left.
+	for i := 1; i <= 30; i++ {
+		w := get()
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: got %d, want 200", i, w.Code)
+		}
+		if warned := w.Header().Get("X-RateLimit-Warning") == "true"; warned != (i >= 25) {
+			t.Errorf("request %d: warning = %v, want %v", i, warned, i >= 25)
+		}
+	}
+	if w := get(); w.Code != http.StatusTooManyRequests {
+		t.Errorf("exhausted: got %d, want 429", w.Code)
+	}
+
+	rl.SetWarnFraction(0)
+	req := httptest.NewRequest("GET", "/api/projects", nil)
+	req.RemoteAddr = "3.3.3.3:1234"
+	for i := 0; i < 30; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Header().Get("X-RateLimit-Warning") != "" {
+			t.Fatalf("request %d: warning sent with warnings off", i+1)
+		}
+	}
+}
+
 func TestRateLimiterMiddleware_StrictLowerBurst(t *testing.T) {
 	rl := NewRateLimiter()
 	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -182,3 +227,227 @@ func TestRateLimiterMiddleware_SeparateStoresForStrictAndGeneral(t *testing.T) {
 		t.Errorf("general after strict exhausted: got %d, want 200", w.Code)
 	}
 }
+
+func TestUserWriteLimitPerUser(t *testing.T) {
+	h := setupAuthHandler(t)
+	rl := NewRateLimiter()
+	rl.SetUserWriteRate(1, 3)
+	h.WriteLimiter = rl
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+	h.DB.CreateToken("alice-token", "Alice", "alice@test.com")
+	h.DB.CreateToken("bob-token", "Bob", "bob@test.com")
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	post := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/versions/"+vid+"/comments", strings.NewReader(`{"page":"index.html","body":"spam"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := post("alice-token"); w.Code != http.StatusCreated {
+			t.Fatalf("request %d: got %d, want 201", i+1, w.Code)
+		}
+	}
+	w := post("alice-token")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("over-limit request: got %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+
+	// Another user on the same IP is unaffected.
+	if w := post("bob-token"); w.Code != http.StatusCreated {
+		t.Errorf("other user: got %d, want 201", w.Code)
+	}
+
+	// Reads are never limited.
+	req := httptest.NewRequest("GET", "/api/versions/"+vid+"/comments", nil)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("read: got %d, want 200", w.Code)
+	}
+}
+
+func TestReadOnlyBlocksWrites(t *testing.T) {
+	h := setupAuthHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+	h.DB.CreateToken("alice-token", "Alice", "alice@test.com")
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	handler := ReadOnly(mux)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer alice-token")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve("GET", "/api/versions/"+vid+"/comments", ""); w.Code != http.StatusOK {
+		t.Errorf("read: got %d, want 200", w.Code)
+	}
+	w := serve("POST", "/api/versions/"+vid+"/comments", `{"page":"index.html","body":"hi"}`)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("write: got %d, want 503", w.Code)
+	}
+	var res map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil || !strings.Contains(res["error"], "read-only") {
+		t.Errorf("expected JSON read-only error, got %q", w.Body.String())
+	}
+	if comments, _ := h.DB.GetCommentsForVersion(vid); len(comments) != 0 {
+		t.Error("comment should not have been stored")
+	}
+
+	// Signing in still works.
+	if w := serve("POST", "/api/auth/token", `{"code":"nope"}`); w.Code == http.StatusServiceUnavailable {
+		t.Error("auth endpoints should stay available")
+	}
+}
+
+func TestAccessDeniedLogsReason(t *testing.T) {
+	h := setupAuthHandler(t)
+	var logs bytes.Buffer
+	h.Logger = log.New(&logs, "", 0)
+	p, _ := h.DB.CreateProject("private", "bob@test.com")
+	v, _ := h.DB.CreateVersion(p.ID, "")
+	h.DB.CreateToken("alice-token", "Alice", "alice@test.com")
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	get := func(versionID string) string {
+		logs.Reset()
+		req := httptest.NewRequest("GET", "/api/versions/"+versionID+"/comments", nil)
+		req.Header.Set("Authorization", "Bearer alice-token")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", versionID, w.Code)
+		}
+		return logs.String()
+	}
+
+	missing := get("no-such-version")
+	if !strings.Contains(missing, "reason=not_found") || !strings.Contains(missing, `id="no-such-version"`) {
+		t.Errorf("missing version: unexpected log %q", missing)
+	}
+	denied := get(v.ID)
+	if !strings.Contains(denied, "reason=no_access") || !strings.Contains(denied, `actor="alice@test.com"`) {
+		t.Errorf("inaccessible version: unexpected log %q", denied)
+	}
+}
+
+func TestAPIMiddlewareTokenErrorCodes(t *testing.T) {
+	h := setupAuthHandler(t)
+	h.DB.CreateToken("old-token", "Alice", "alice@test.com")
+	h.DB.(*db.DB).Exec(`UPDATE tokens SET expires_at = datetime('now', '-1 hour')`)
+	handler := h.apiMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for token, want := range map[string]string{"old-token": "token_expired", "no-such-token": "token_invalid"} {
+		req := httptest.NewRequest("GET", "/api/projects", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got %d, want 401", token, w.Code)
+			continue
+		}
+		var resp map[string]string
+		json.NewDecoder(w.Body).Decode(&resp)
+		if resp["code"] != want {
+			t.Errorf("%s: code = %q, want %q", token, resp["code"], want)
+		}
+	}
+
+	// Without a token there is nothing to re-login for, so no code.
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/projects", nil))
+	if strings.Contains(w.Body.String(), "code") {
+		t.Errorf("unexpected code in %s", w.Body.String())
+	}
+}
+
+func TestWithBasePath(t *testing.T) {
+	h := setupTestHandler(t)
+	h.BasePath = CleanBasePath("design-reviewer/")
+	pid, vid := seedProject(t, h, map[string]string{"index.html": "<p>hi</p>"})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	handler := WithBasePath(h.BasePath, mux)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := get("/design-reviewer/")
+	if w.Code != http.StatusOK {
+		t.Fatalf("home: got %d", w.Code)
+	}
+	for _, want := range []string{`href="/design-reviewer/projects/` + pid + `"`, `href="/design-reviewer/static/style.css"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("home page missing %s", want)
+		}
+	}
+
+	w = get("/design-reviewer/projects/" + pid)
+	if w.Code != http.StatusOK {
+		t.Fatalf("viewer: got %d", w.Code)
+	}
+	for _, want := range []string{`src="/design-reviewer/designs/` + vid + `/index.html"`, `data-base-path="/design-reviewer"`, `src="/design-reviewer/static/viewer.js"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("viewer page missing %s", want)
+		}
+	}
+
+	for _, path := range []string{"/design-reviewer/static/style.css", "/design-reviewer/designs/" + vid + "/index.html"} {
+		if w := get(path); w.Code != http.StatusOK {
+			t.Errorf("%s: got %d", path, w.Code)
+		}
+	}
+	if w := get("/design-reviewer"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/design-reviewer/" {
+		t.Errorf("bare base path: got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := get("/projects/" + pid); w.Code != http.StatusNotFound {
+		t.Errorf("unprefixed path: got %d, want 404", w.Code)
+	}
+
+	// The project link in the upload response carries the base path too.
+	req := createUploadRequest(t, "test-proj", makeZipForTest(t, map[string]string{"index.html": "<p>v2</p>"}))
+	req.URL.Path = "/design-reviewer/api/upload"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var res map[string]any
+	json.NewDecoder(w.Body).Decode(&res)
+	if w.Code != http.StatusOK || res["url"] != "/design-reviewer/projects/"+pid {
+		t.Errorf("upload: got %d with url %v", w.Code, res["url"])
+	}
+}
+
+func TestWithBasePathLoginRedirect(t *testing.T) {
+	h := setupAuthHandler(t)
+	h.BasePath = "/dr"
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	w := httptest.NewRecorder()
+	WithBasePath(h.BasePath, mux).ServeHTTP(w, httptest.NewRequest("GET", "/dr/projects/abc?version=1", nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/dr/login" {
+		t.Errorf("got %d to %q, want 302 to /dr/login", w.Code, w.Header().Get("Location"))
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "redirect_to" && c.Value != "/dr/projects/abc?version=1" {
+			t.Errorf("redirect_to = %q", c.Value)
+		}
+	}
+}
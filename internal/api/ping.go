@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// DefaultKeepAliveInterval is how often an open viewer pings the server.
+// It is shorter than the few idle minutes after which hosts such as Fly.io
+// stop a machine, so it stays warm while someone is reviewing.
+const DefaultKeepAliveInterval = 2 * time.Minute
+
+// keepAliveSeconds is the interval the viewer pings /ping at, or 0 when
+// keep-alive pings are disabled.
+func (h *Handler) keepAliveSeconds() int {
+	switch {
+	case h.KeepAliveInterval < 0:
+		return 0
+	case h.KeepAliveInterval == 0:
+		return int(DefaultKeepAliveInterval / time.Second)
+	}
+	return max(1, int(h.KeepAliveInterval/time.Second))
+}
+
+// handlePing answers the viewer's keep-alive pings. It touches neither the
+// database nor storage, and needs no auth.
+func (h *Handler) handlePing(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("ok"))
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPing(t *testing.T) {
+	h := setupAuthHandler(t)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/ping", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Fatalf("expected 200 ok without auth, got %d: %s", w.Code, w.Body.String())
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("ping took %s", d)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q, a cached ping wouldn't reach the server", cc)
+	}
+}
+
+func TestPingNotRateLimited(t *testing.T) {
+	rl := NewRateLimiter()
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for i := 0; i < 40; i++ {
+		req := httptest.NewRequest("GET", "/ping", nil)
+		req.RemoteAddr = "6.6.6.6:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: got %d", i, w.Code)
+		}
+	}
+}
+
+func TestKeepAliveSeconds(t *testing.T) {
+	for _, tc := range []struct {
+		interval time.Duration
+		want     int
+	}{{0, 120}, {30 * time.Second, 30}, {-1, 0}, {time.Millisecond, 1}} {
+		h := &Handler{KeepAliveInterval: tc.interval}
+		if got := h.keepAliveSeconds(); got != tc.want {
+			t.Errorf("KeepAliveInterval %s: got %d, want %d", tc.interval, got, tc.want)
+		}
+	}
+}
+
+func TestViewerKeepAliveConfig(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, _ := seedProject(t, h, map[string]string{"index.html": "<h1>hi</h1>"})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	view := func() string {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/projects/"+pid, nil))
+		return w.Body.String()
+	}
+	if body := view(); !strings.Contains(body, `data-keep-alive="120"`) {
+		t.Errorf("expected the default keep-alive interval in the viewer config")
+	}
+	h.KeepAliveInterval = -1
+	if body := view(); !strings.Contains(body, `data-keep-alive="0"`) {
+		t.Errorf("expected keep-alive disabled in the viewer config")
+	}
+}
@@ -28,6 +28,7 @@ type projectView struct {
 	VersionCount int
 	TimeAgo      string
 	UpdatedAt    time.Time
+	Archived     bool
 }
 
 func toProjectViews(projects []db.ProjectWithVersionCount) []projectView {
@@ -41,11 +42,33 @@ func toProjectViews(projects []db.ProjectWithVersionCount) []projectView {
 			VersionCount: p.VersionCount,
 			TimeAgo:      relativeTime(p.UpdatedAt),
 			UpdatedAt:    p.UpdatedAt,
+			Archived:     p.Archived,
 		}
 	}
 	return views
 }
 
+// filterByRole keeps the projects matching ?filter=: "owned" for those the
+// caller owns, "shared" for the rest they can see (shared with them, org-wide
+// or public), and "all" (the default) for everything. ok is false for any
+// other value.
+func filterByRole(r *http.Request, projects []db.ProjectWithVersionCount) (filtered []db.ProjectWithVersionCount, filter string, ok bool) {
+	filter = r.URL.Query().Get("filter")
+	switch filter {
+	case "", "all":
+		return projects, "all", true
+	case "owned", "shared":
+	default:
+		return nil, "", false
+	}
+	for _, p := range projects {
+		if p.IsOwner == (filter == "owned") {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered, filter, true
+}
+
 func relativeTime(t time.Time) string {
 	d := time.Since(t)
 	switch {
@@ -85,6 +108,11 @@ func (h *Handler) handleListProjects(w http.ResponseWriter, r *http.Request) {
 		serverError(w, "database error", err)
 		return
 	}
+	projects, _, ok := filterByRole(r, projects)
+	if !ok {
+		http.Error(w, "invalid filter: must be owned, shared or all", http.StatusBadRequest)
+		return
+	}
 	if projects == nil {
 		projects = []db.ProjectWithVersionCount{}
 	}
@@ -95,6 +123,10 @@ func (h *Handler) handleListProjects(w http.ResponseWriter, r *http.Request) {
 		Status       string `json:"status"`
 		VersionCount int    `json:"version_count"`
 		UpdatedAt    string `json:"updated_at"`
+		IsOwner      bool   `json:"is_owner"`
+		Archived     bool   `json:"archived"`
+		// OwnerEmail is only filled in for projects the caller owns.
+		OwnerEmail string `json:"owner_email,omitempty"`
 	}
 	out := make([]apiProject, len(projects))
 	for i, p := range projects {
@@ -104,12 +136,71 @@ func (h *Handler) handleListProjects(w http.ResponseWriter, r *http.Request) {
 			Status:       p.Status,
 			VersionCount: p.VersionCount,
 			UpdatedAt:    p.UpdatedAt.Format(time.RFC3339),
+			Archived:     p.Archived,
+		}
+		if p.IsOwner {
+			out[i].IsOwner = true
+			out[i].OwnerEmail = p.OwnerEmail
 		}
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(out)
 }
 
+// handleGetSummary returns counts of the caller's projects, for the home
+// page and nav badges that don't need the full list.
+func (h *Handler) handleGetSummary(w http.ResponseWriter, r *http.Request) {
+	_, email := auth.GetUserFromContext(r.Context())
+	s, err := h.DB.GetProjectSummary(email)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"projects":           s.Projects,
+		"owned":              s.Owned,
+		"with_open_comments": s.WithOpenComments,
+	})
+}
+
+// handleSetKeep sets the project's keep flag, which opts it out of the
+// retention job's auto-archiving. Keeping an archived project restores it.
+func (h *Handler) handleSetKeep(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		Keep *bool `json:"keep"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Keep == nil {
+		http.Error(w, "keep is required", http.StatusBadRequest)
+		return
+	}
+	if err := h.DB.SetProjectKeep(id, *req.Keep); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		serverError(w, "database error", err)
+		return
+	}
+	keep, archived, err := h.DB.GetProjectRetention(id)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"keep": keep, "archived": archived})
+}
+
 func (h *Handler) handleUpdateStatus(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
@@ -124,6 +215,9 @@ func (h *Handler) handleUpdateStatus(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid JSON", http.StatusBadRequest)
 		return
 	}
+	if req.Status == "approved" && !h.checkApprovalGate(w, r, id) {
+		return
+	}
 	if err := h.DB.UpdateProjectStatus(id, req.Status); err != nil {
 		if err == sql.ErrNoRows {
 			http.NotFound(w, r)
@@ -140,6 +234,299 @@ func (h *Handler) handleUpdateStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"id": id, "status": req.Status})
 }
 
+// checkApprovalGate blocks approval while the latest version has open
+// comments, if the project asks for that. It writes the error response and
+// returns false when approval is not allowed.
+func (h *Handler) checkApprovalGate(w http.ResponseWriter, r *http.Request, projectID string) bool {
+	open, err := h.approvalBlockers(projectID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return false
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return false
+	}
+	if open > 0 {
+		http.Error(w, fmt.Sprintf("cannot approve: %d unresolved comment(s) on the latest version", open), http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// approvalBlockers counts the open comments on the latest version that keep
+// the project from being approved: zero unless the project requires
+// resolved comments for approval.
+func (h *Handler) approvalBlockers(projectID string) (int, error) {
+	required, err := h.DB.GetRequireResolvedForApproval(projectID)
+	if err != nil || !required {
+		return 0, err
+	}
+	latest, err := h.DB.GetLatestVersion(projectID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	open, err := h.DB.GetUnresolvedCommentsUpTo(latest.ID)
+	return len(open), err
+}
+
+// Per-project outcomes of a bulk status update.
+const (
+	bulkUpdated  = "updated"
+	bulkDenied   = "denied"    // the caller doesn't own the project
+	bulkNotFound = "not_found" // no such project
+	bulkBlocked  = "blocked"   // approval is blocked by open comments
+)
+
+// handleBulkUpdateStatus sets one status on several projects at once. Each
+// project is checked like PATCH /api/projects/{id}/status would check it;
+// the ones that pass are updated together in one transaction and the
+// response reports what happened to every id.
+func (h *Handler) handleBulkUpdateStatus(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		IDs    []string `json:"ids"`
+		Status string   `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if _, ok := statusLabels[req.Status]; !ok {
+		http.Error(w, fmt.Sprintf("invalid status %q: must be one of draft, in_review, approved, handed_off", req.Status), http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 {
+		http.Error(w, "ids must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	_, email := auth.GetUserFromContext(r.Context())
+	type result struct {
+		ID     string `json:"id"`
+		Result string `json:"result"`
+		Error  string `json:"error,omitempty"`
+	}
+	results := make([]result, 0, len(req.IDs))
+	var toUpdate []string
+	seen := map[string]bool{}
+	for _, id := range req.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		res := result{ID: id, Result: bulkUpdated}
+		_, err := h.DB.GetProject(id)
+		if err == sql.ErrNoRows {
+			res.Result = bulkNotFound
+			results = append(results, res)
+			continue
+		}
+		if err != nil {
+			serverError(w, "database error", err)
+			return
+		}
+		if h.Auth != nil {
+			owner, err := h.DB.IsOwner(id, email)
+			if err != nil {
+				serverError(w, "database error", err)
+				return
+			}
+			if !owner {
+				res.Result = bulkDenied
+				results = append(results, res)
+				continue
+			}
+		}
+		if req.Status == "approved" {
+			open, err := h.approvalBlockers(id)
+			if err != nil {
+				serverError(w, "database error", err)
+				return
+			}
+			if open > 0 {
+				res.Result = bulkBlocked
+				res.Error = fmt.Sprintf("%d unresolved comment(s) on the latest version", open)
+				results = append(results, res)
+				continue
+			}
+		}
+		results = append(results, res)
+		toUpdate = append(toUpdate, id)
+	}
+
+	if len(toUpdate) > 0 {
+		if err := h.DB.UpdateProjectStatuses(toUpdate, req.Status); err != nil {
+			serverError(w, "database error", err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"status": req.Status, "results": results})
+}
+
+func (h *Handler) handleGetVisibility(w http.ResponseWriter, r *http.Request) {
+	visibility, err := h.DB.GetProjectVisibility(r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"visibility": visibility})
+}
+
+func (h *Handler) handleSetVisibility(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		Visibility string `json:"visibility"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Visibility != db.VisibilityPrivate && req.Visibility != db.VisibilityOrg && req.Visibility != db.VisibilityPublic {
+		http.Error(w, "visibility must be private, org or public", http.StatusBadRequest)
+		return
+	}
+	if h.DisablePublic && req.Visibility != db.VisibilityPrivate {
+		http.Error(w, errPublicDisabled, http.StatusForbidden)
+		return
+	}
+	err := h.DB.SetProjectVisibility(r.PathValue("id"), req.Visibility)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"visibility": req.Visibility})
+}
+
+func (h *Handler) handleGetApprovalSettings(w http.ResponseWriter, r *http.Request) {
+	required, err := h.DB.GetRequireResolvedForApproval(r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"require_resolved_for_approval": required})
+}
+
+func (h *Handler) handleSetApprovalSettings(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		RequireResolved bool `json:"require_resolved_for_approval"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	err := h.DB.SetRequireResolvedForApproval(r.PathValue("id"), req.RequireResolved)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"require_resolved_for_approval": req.RequireResolved})
+}
+
+func (h *Handler) handleGetReviewSettings(w http.ResponseWriter, r *http.Request) {
+	enabled, err := h.DB.GetAutoInReviewOnComment(r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"auto_in_review_on_comment": enabled})
+}
+
+func (h *Handler) handleSetReviewSettings(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		AutoInReview bool `json:"auto_in_review_on_comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	err := h.DB.SetAutoInReviewOnComment(r.PathValue("id"), req.AutoInReview)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"auto_in_review_on_comment": req.AutoInReview})
+}
+
+// handleGetMetrics reports how long the project's comments take to resolve.
+// The times are in seconds and null until a comment has been resolved.
+func (h *Handler) handleGetMetrics(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	_, err := h.DB.GetProject(id)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	m, err := h.DB.GetCommentMetrics(id)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		OpenCount            int      `json:"open_count"`
+		ResolvedCount        int      `json:"resolved_count"`
+		AvgResolveSeconds    *float64 `json:"avg_resolve_seconds"`
+		MedianResolveSeconds *float64 `json:"median_resolve_seconds"`
+	}{m.Open, m.Resolved, m.AvgResolveSeconds, m.MedianResolveSeconds})
+}
+
 func (h *Handler) handleHome(w http.ResponseWriter, r *http.Request) {
 	_, email := auth.GetUserFromContext(r.Context())
 	var projects []db.ProjectWithVersionCount
@@ -150,21 +537,34 @@ func (h *Handler) handleHome(w http.ResponseWriter, r *http.Request) {
 		projects, err = h.DB.ListProjectsWithVersionCount()
 	}
 	if err != nil {
-		serverError(w, "database error", err)
+		h.webServerError(w, r, "database error", err)
 		return
 	}
+	// An unknown filter from a hand-edited URL just shows everything.
+	filter := "all"
+	if filtered, f, ok := filterByRole(r, projects); ok {
+		projects, filter = filtered, f
+	}
 
 	tmpl, err := template.ParseFiles(h.TemplatesDir+"/layout.html", h.TemplatesDir+"/home.html")
 	if err != nil {
-		serverError(w, "template error", err)
+		h.webServerError(w, r, "template error", err)
 		return
 	}
 
 	data := struct {
 		Projects []projectView
+		Filter   string
 		UserName string
+		Base     string
+		Brand    Branding
+		Theme    string
 	}{
 		Projects: toProjectViews(projects),
+		Filter:   filter,
+		Base:     h.BasePath,
+		Brand:    h.brand(),
+		Theme:    themeOf(r),
 		UserName: func() string { n, _ := auth.GetUserFromContext(r.Context()); return n }(),
 	}
 	tmpl.Execute(w, data)
@@ -1,14 +1,18 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/ab/design-reviewer/internal/auth"
 	"github.com/ab/design-reviewer/internal/db"
 	"github.com/ab/design-reviewer/internal/storage"
 )
@@ -16,7 +20,7 @@ import (
 func setupTestHandler(t *testing.T) *Handler {
 	t.Helper()
 	tmp := t.TempDir()
-	database, err := db.New(filepath.Join(tmp, "test.db"))
+	database, err := db.NewInMemory()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -77,6 +81,97 @@ func TestHandleListProjectsWithData(t *testing.T) {
 	}
 }
 
+func TestHandleListProjectsOwnerFlag(t *testing.T) {
+	h := setupTestHandler(t)
+	mine, _ := h.DB.CreateProject("mine", "alice@test.com")
+	shared, _ := h.DB.CreateProject("shared", "bob@test.com")
+	h.DB.AddMember(shared.ID, "alice@test.com")
+	coOwned, _ := h.DB.CreateProject("co-owned", "bob@test.com")
+	h.DB.AddMember(coOwned.ID, "alice@test.com")
+	h.DB.SetMemberRole(coOwned.ID, "alice@test.com", db.RoleOwner)
+	h.DB.CreateProject("seed", "")
+
+	req := withUser(httptest.NewRequest("GET", "/api/projects", nil), "Alice", "alice@test.com")
+	w := httptest.NewRecorder()
+	h.handleListProjects(w, req)
+
+	var result []map[string]any
+	json.NewDecoder(w.Body).Decode(&result)
+	if len(result) != 4 {
+		t.Fatalf("expected 4 projects, got %d", len(result))
+	}
+	for _, p := range result {
+		wantOwner := p["id"] == mine.ID || p["id"] == coOwned.ID
+		if p["is_owner"] != wantOwner {
+			t.Errorf("%v: is_owner = %v, want %v", p["name"], p["is_owner"], wantOwner)
+		}
+		_, hasEmail := p["owner_email"]
+		if hasEmail != wantOwner {
+			t.Errorf("%v: owner_email present = %v, want %v", p["name"], hasEmail, wantOwner)
+		}
+	}
+}
+
+func TestHandleListProjectsFilter(t *testing.T) {
+	h := setupTestHandler(t)
+	h.DB.CreateProject("mine", "alice@test.com")
+	shared, _ := h.DB.CreateProject("shared", "bob@test.com")
+	h.DB.AddMember(shared.ID, "alice@test.com")
+	h.DB.CreateProject("seed", "")
+
+	list := func(filter string) (int, []string) {
+		req := withUser(httptest.NewRequest("GET", "/api/projects?filter="+filter, nil), "Alice", "alice@test.com")
+		w := httptest.NewRecorder()
+		h.handleListProjects(w, req)
+		var result []map[string]any
+		json.NewDecoder(w.Body).Decode(&result)
+		var names []string
+		for _, p := range result {
+			names = append(names, p["name"].(string))
+		}
+		slices.Sort(names)
+		return w.Code, names
+	}
+
+	if _, names := list("owned"); !slices.Equal(names, []string{"mine"}) {
+		t.Errorf("owned: got %v", names)
+	}
+	if _, names := list("shared"); !slices.Equal(names, []string{"seed", "shared"}) {
+		t.Errorf("shared: got %v", names)
+	}
+	if _, names := list("all"); len(names) != 3 {
+		t.Errorf("all: got %v", names)
+	}
+	if code, _ := list("mine"); code != 400 {
+		t.Errorf("unknown filter: expected 400, got %d", code)
+	}
+}
+
+func TestHandleSetKeep(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("idle", "alice@test.com")
+	h.DB.(*db.DB).ArchiveStaleProjects(time.Now().Add(time.Hour))
+
+	keep := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/api/projects/"+id+"/keep", strings.NewReader(body))
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		h.handleSetKeep(w, req)
+		return w
+	}
+
+	w := keep(p.ID, `{"keep":true}`)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"archived":false`) || !strings.Contains(w.Body.String(), `"keep":true`) {
+		t.Fatalf("keeping should restore the project, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := keep(p.ID, `{}`); w.Code != 400 {
+		t.Errorf("missing keep: expected 400, got %d", w.Code)
+	}
+	if w := keep("nonexistent", `{"keep":false}`); w.Code != 404 {
+		t.Errorf("unknown project: expected 404, got %d", w.Code)
+	}
+}
+
 func TestHandleHomeEmpty(t *testing.T) {
 	h := setupTestHandler(t)
 	req := httptest.NewRequest("GET", "/", nil)
@@ -95,6 +190,25 @@ func TestHandleHomeEmpty(t *testing.T) {
 	}
 }
 
+func TestHandleHomeCustomBranding(t *testing.T) {
+	h := setupTestHandler(t)
+	h.Branding = Branding{AppName: "Acme Review", LogoURL: "https://acme.test/logo.png"}
+	req := withUser(httptest.NewRequest("GET", "/", nil), "Alice", "alice@test.com")
+	w := httptest.NewRecorder()
+	h.handleHome(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "<title>Acme Review</title>") {
+		t.Error("missing custom app name in title")
+	}
+	if !strings.Contains(body, `src="https://acme.test/logo.png"`) {
+		t.Error("missing custom logo")
+	}
+	if strings.Contains(body, "Design Reviewer") {
+		t.Error("default app name should be replaced")
+	}
+}
+
 func TestHandleHomeWithProjects(t *testing.T) {
 	h := setupTestHandler(t)
 	p, _ := h.DB.CreateProject("my-design", "")
@@ -119,6 +233,25 @@ func TestHandleHomeWithProjects(t *testing.T) {
 	}
 }
 
+func TestHandleHomeFilterTabs(t *testing.T) {
+	h := setupTestHandler(t)
+	h.DB.CreateProject("mine", "alice@test.com")
+	shared, _ := h.DB.CreateProject("theirs", "bob@test.com")
+	h.DB.AddMember(shared.ID, "alice@test.com")
+
+	req := withUser(httptest.NewRequest("GET", "/?filter=shared", nil), "Alice", "alice@test.com")
+	w := httptest.NewRecorder()
+	h.handleHome(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "theirs") || strings.Contains(body, ">mine<") {
+		t.Error("shared tab should list only the project shared with alice")
+	}
+	if !strings.Contains(body, `href="/?filter=shared" class="filter-btn active"`) {
+		t.Error("shared tab should be marked active")
+	}
+}
+
 func TestHandleHomeTemplateMissing(t *testing.T) {
 	h := setupTestHandler(t)
 	h.TemplatesDir = "/nonexistent"
@@ -240,6 +373,333 @@ func TestHandleUpdateStatusBadJSON(t *testing.T) {
 	}
 }
 
+func TestHandleUpdateStatusApprovalGate(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+	c, _ := h.DB.CreateComment(vid, "index.html", 10, 10, "A", "a@test.com", "fix me")
+
+	setStatus := func(status string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/api/projects/"+pid+"/status", strings.NewReader(`{"status":"`+status+`"}`))
+		req.SetPathValue("id", pid)
+		w := httptest.NewRecorder()
+		h.handleUpdateStatus(w, req)
+		return w
+	}
+
+	// Off by default: open comments don't matter.
+	if w := setStatus("approved"); w.Code != 200 {
+		t.Fatalf("gate off: expected 200, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("PUT", "/api/projects/"+pid+"/approval-settings", strings.NewReader(`{"require_resolved_for_approval":true}`))
+	req.SetPathValue("id", pid)
+	w := httptest.NewRecorder()
+	h.handleSetApprovalSettings(w, req)
+	if w.Code != 200 {
+		t.Fatalf("enable gate: expected 200, got %d", w.Code)
+	}
+
+	if w := setStatus("in_review"); w.Code != 200 {
+		t.Errorf("other transitions should be unaffected, got %d", w.Code)
+	}
+	w = setStatus("approved")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("open comments: expected 409, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "1 unresolved") {
+		t.Errorf("unexpected message: %q", w.Body.String())
+	}
+	if p, _ := h.DB.GetProject(pid); p.Status != "in_review" {
+		t.Errorf("status should be unchanged, got %s", p.Status)
+	}
+
+	h.DB.ToggleResolve(c.ID, "a@test.com")
+	if w := setStatus("approved"); w.Code != 200 {
+		t.Errorf("all resolved: expected 200, got %d", w.Code)
+	}
+}
+
+func TestHandleApprovalSettingsNotFound(t *testing.T) {
+	h := setupTestHandler(t)
+	req := httptest.NewRequest("GET", "/api/projects/nope/approval-settings", nil)
+	req.SetPathValue("id", "nope")
+	w := httptest.NewRecorder()
+	h.handleGetApprovalSettings(w, req)
+	if w.Code != 404 {
+		t.Errorf("get: expected 404, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("PUT", "/api/projects/nope/approval-settings", strings.NewReader(`{"require_resolved_for_approval":true}`))
+	req.SetPathValue("id", "nope")
+	w = httptest.NewRecorder()
+	h.handleSetApprovalSettings(w, req)
+	if w.Code != 404 {
+		t.Errorf("set: expected 404, got %d", w.Code)
+	}
+}
+
+func TestHandleVisibility(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, _ := seedProject(t, h, map[string]string{"index.html": "x"})
+
+	set := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/api/projects/"+pid+"/visibility", strings.NewReader(body))
+		req.SetPathValue("id", pid)
+		w := httptest.NewRecorder()
+		h.handleSetVisibility(w, req)
+		return w
+	}
+	if w := set(`{"visibility":"everyone"}`); w.Code != 400 {
+		t.Errorf("invalid value: expected 400, got %d", w.Code)
+	}
+	if w := set(`{"visibility":"org"}`); w.Code != 200 {
+		t.Fatalf("set: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest("GET", "/api/projects/"+pid+"/visibility", nil)
+	req.SetPathValue("id", pid)
+	w := httptest.NewRecorder()
+	h.handleGetVisibility(w, req)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"org"`) {
+		t.Errorf("get: %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/projects/nope/visibility", nil)
+	req.SetPathValue("id", "nope")
+	w = httptest.NewRecorder()
+	h.handleGetVisibility(w, req)
+	if w.Code != 404 {
+		t.Errorf("missing project: expected 404, got %d", w.Code)
+	}
+}
+
+func TestHandleGetMetrics(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+
+	get := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/projects/"+id+"/metrics", nil)
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		h.handleGetMetrics(w, req)
+		return w
+	}
+
+	w := get(pid)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var empty map[string]any
+	json.NewDecoder(w.Body).Decode(&empty)
+	for _, key := range []string{"open_count", "resolved_count", "avg_resolve_seconds", "median_resolve_seconds"} {
+		if _, ok := empty[key]; !ok {
+			t.Errorf("missing %q in %v", key, empty)
+		}
+	}
+	if empty["avg_resolve_seconds"] != nil || empty["median_resolve_seconds"] != nil {
+		t.Errorf("expected null times with nothing resolved, got %v", empty)
+	}
+
+	c, _ := h.DB.CreateComment(vid, "index.html", 10, 20, "Alice", "a@t.com", "fix")
+	h.DB.ToggleResolve(c.ID, "")
+	h.DB.(*db.DB).Exec(`UPDATE comments SET resolved_at = datetime(created_at, '+90 seconds') WHERE id = ?`, c.ID)
+	h.DB.CreateComment(vid, "index.html", 10, 20, "Alice", "a@t.com", "open")
+
+	var got struct {
+		OpenCount            int      `json:"open_count"`
+		ResolvedCount        int      `json:"resolved_count"`
+		AvgResolveSeconds    *float64 `json:"avg_resolve_seconds"`
+		MedianResolveSeconds *float64 `json:"median_resolve_seconds"`
+	}
+	json.NewDecoder(get(pid).Body).Decode(&got)
+	if got.OpenCount != 1 || got.ResolvedCount != 1 {
+		t.Errorf("counts = %d open, %d resolved, want 1, 1", got.OpenCount, got.ResolvedCount)
+	}
+	if got.AvgResolveSeconds == nil || *got.AvgResolveSeconds < 89 || *got.AvgResolveSeconds > 91 {
+		t.Errorf("avg_resolve_seconds = %v, want 90", got.AvgResolveSeconds)
+	}
+	if got.MedianResolveSeconds == nil || *got.MedianResolveSeconds < 89 || *got.MedianResolveSeconds > 91 {
+		t.Errorf("median_resolve_seconds = %v, want 90", got.MedianResolveSeconds)
+	}
+
+	if w := get("nope"); w.Code != 404 {
+		t.Errorf("missing project: expected 404, got %d", w.Code)
+	}
+}
+
+func TestOrgVisibleProjectAccess(t *testing.T) {
+	h := setupAuthHandler(t)
+	p, _ := h.DB.CreateProject("shared", "owner@test.com")
+	h.DB.CreateToken("bob-token", "Bob", "bob@test.com")
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	get := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer bob-token")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := get("/api/projects/" + p.ID + "/versions"); code != 404 {
+		t.Errorf("private project: expected 404, got %d", code)
+	}
+	h.DB.SetProjectVisibility(p.ID, "org")
+	if code := get("/api/projects/" + p.ID + "/versions"); code != 200 {
+		t.Errorf("org project: expected 200, got %d", code)
+	}
+	if code := get("/api/projects/" + p.ID + "/archive"); code == 200 {
+		t.Error("org visibility should not grant owner-only endpoints")
+	}
+}
+
+func TestOrgVisibleProjectIsReadOnlyForNonMembers(t *testing.T) {
+	h := setupAuthHandler(t)
+	p, _ := h.DB.CreateProject("shared", "owner@test.com")
+	v, _ := h.DB.CreateVersion(p.ID, "")
+	c, _ := h.DB.CreateComment(v.ID, "index.html", 10, 20, "Owner", "owner@test.com", "hi")
+	h.DB.SetProjectVisibility(p.ID, db.VisibilityOrg)
+	h.DB.CreateToken("bob-token", "Bob", "bob@test.com")
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		req.Header.Set("Authorization", "Bearer bob-token")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// Pushing by name or by project ID doesn't add a version.
+	zipData := makeZipForTest(t, map[string]string{"index.html": "x"})
+	if w := do(createUploadRequest(t, "shared", zipData)); w.Code != 404 {
+		t.Errorf("push by name: expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("project_id", p.ID)
+	fw, _ := mw.CreateFormFile("file", "upload.zip")
+	fw.Write(zipData)
+	mw.Close()
+	req := httptest.NewRequest("POST", "/api/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if w := do(req); w.Code != 404 {
+		t.Errorf("push by project_id: expected 404, got %d: %s", w.Code, w.Body.String())
+	}
+	if versions, _ := h.DB.ListVersions(p.ID); len(versions) != 1 {
+		t.Errorf("non-member push added a version: %d versions", len(versions))
+	}
+
+	// Reading works; commenting and changing comments don't.
+	if w := do(httptest.NewRequest("GET", "/api/versions/"+v.ID+"/comments", nil)); w.Code != 200 {
+		t.Errorf("read comments: expected 200, got %d", w.Code)
+	}
+	for _, r := range []struct{ method, path, body string }{
+		{"POST", "/api/versions/" + v.ID + "/comments", `{"page":"index.html","x_percent":1,"y_percent":1,"body":"hi"}`},
+		{"POST", "/api/versions/" + v.ID + "/comments/resolve-by-author", `{"author_email":"owner@test.com"}`},
+		{"POST", "/api/versions/" + v.ID + "/comments/move-page", `{"from":"index.html","to":"index.html"}`},
+		{"POST", "/api/comments/" + c.ID + "/replies", `{"body":"re"}`},
+		{"PATCH", "/api/comments/" + c.ID + "/resolve", ``},
+	} {
+		if w := do(httptest.NewRequest(r.method, r.path, strings.NewReader(r.body))); w.Code != http.StatusForbidden {
+			t.Errorf("%s %s: expected 403, got %d", r.method, r.path, w.Code)
+		}
+	}
+	if got, _ := h.DB.GetComment(c.ID); got.Resolved {
+		t.Error("non-member resolved a comment")
+	}
+}
+
+func TestPublicProjectAnonymousAccess(t *testing.T) {
+	h := setupAuthHandler(t)
+	pid, vid := seedProject(t, h, map[string]string{"index.html": "<h1>hi</h1>"})
+	h.DB.(*db.DB).Exec(`UPDATE projects SET owner_email = 'owner@test.com' WHERE id = ?`, pid)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"body":"hi","page":"index.html"}`))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// Private: the viewer asks for a login and the API refuses.
+	if w := do("GET", "/projects/"+pid); w.Code != http.StatusFound || w.Header().Get("Location") != "/login" {
+		t.Errorf("private viewer: expected redirect to /login, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := do("GET", "/api/versions/"+vid+"/comments"); w.Code != 401 {
+		t.Errorf("private comments: expected 401, got %d", w.Code)
+	}
+
+	h.DB.SetProjectVisibility(pid, db.VisibilityPublic)
+	w := do("GET", "/projects/"+pid)
+	if w.Code != 200 {
+		t.Fatalf("public viewer: expected 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `data-comment-mode="readonly"`) {
+		t.Error("anonymous viewer should have read-only comments")
+	}
+	if strings.Contains(body, `id="status-select"`) || strings.Contains(body, `id="share-btn"`) {
+		t.Error("anonymous viewer should not show member controls")
+	}
+	for _, path := range []string{
+		"/api/projects/" + pid + "/versions",
+		"/api/versions/" + vid + "/comments",
+		"/api/versions/" + vid + "/flow",
+		"/designs/" + vid + "/index.html",
+	} {
+		if w := do("GET", path); w.Code != 200 {
+			t.Errorf("public %s: expected 200, got %d", path, w.Code)
+		}
+	}
+	if w := do("POST", "/api/versions/"+vid+"/comments"); w.Code != 401 {
+		t.Errorf("anonymous comment: expected 401, got %d", w.Code)
+	}
+	if w := do("GET", "/api/projects/"+pid+"/members"); w.Code != 401 {
+		t.Errorf("anonymous members list: expected 401, got %d", w.Code)
+	}
+}
+
+func TestPublicProjectHidesEmailsFromAnonymous(t *testing.T) {
+	h := setupAuthHandler(t)
+	pid, vid := seedProject(t, h, map[string]string{"index.html": "<h1>hi</h1>"})
+	h.DB.SetProjectVisibility(pid, db.VisibilityPublic)
+	c, _ := h.DB.CreateComment(vid, "index.html", 10, 20, "Alice", "alice@test.com", "hello")
+	h.DB.SetCommentAssignee(c.ID, "bob@test.com")
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	for _, path := range []string{
+		"/api/versions/" + vid + "/comments",
+		"/api/versions/" + vid + "/comments?author=alice@test.com",
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 200 {
+			t.Fatalf("%s: expected 200, got %d", path, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "@test.com") {
+			t.Errorf("%s: anonymous response has email addresses: %s", path, w.Body.String())
+		}
+		var out []commentJSON
+		json.NewDecoder(w.Body).Decode(&out)
+		if len(out) != 1 || out[0].ID != c.ID {
+			t.Errorf("%s: comments = %+v", path, out)
+		}
+	}
+
+	// A bogus ?author= doesn't reveal who hasn't commented either.
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/versions/"+vid+"/comments?author=nobody@test.com", nil))
+	var out []commentJSON
+	json.NewDecoder(w.Body).Decode(&out)
+	if len(out) != 1 {
+		t.Errorf("?author= should be ignored for anonymous visitors, got %d comments", len(out))
+	}
+}
+
 // --- DB error path tests ---
 
 func TestHandleListProjectsDBError(t *testing.T) {
@@ -262,6 +722,83 @@ func TestHandleHomeDBError(t *testing.T) {
 	}
 }
 
+func TestHandleBulkUpdateStatus(t *testing.T) {
+	h := setupTestHandler(t)
+	h.Auth = &auth.Config{BaseURL: "http://localhost:8080"}
+	mine, _ := h.DB.CreateProject("mine", "alice@test.com")
+	coOwned, _ := h.DB.CreateProject("co-owned", "carol@test.com")
+	h.DB.AddMember(coOwned.ID, "alice@test.com")
+	h.DB.SetMemberRole(coOwned.ID, "alice@test.com", db.RoleOwner)
+	member, _ := h.DB.CreateProject("member", "bob@test.com")
+	h.DB.AddMember(member.ID, "alice@test.com")
+	others, _ := h.DB.CreateProject("others", "bob@test.com")
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := withUser(httptest.NewRequest("POST", "/api/projects/status", strings.NewReader(body)), "Alice", "alice@test.com")
+		w := httptest.NewRecorder()
+		h.handleBulkUpdateStatus(w, req)
+		return w
+	}
+
+	ids, _ := json.Marshal([]string{mine.ID, member.ID, "missing", coOwned.ID, others.ID})
+	w := post(`{"ids":` + string(ids) + `,"status":"in_review"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Results []struct {
+			ID     string `json:"id"`
+			Result string `json:"result"`
+		} `json:"results"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	var got []string
+	for _, r := range resp.Results {
+		got = append(got, r.Result)
+	}
+	if s := strings.Join(got, ","); s != "updated,denied,not_found,updated,denied" {
+		t.Errorf("results = %s", s)
+	}
+	for id, want := range map[string]string{mine.ID: "in_review", coOwned.ID: "in_review", member.ID: "draft", others.ID: "draft"} {
+		if p, _ := h.DB.GetProject(id); p.Status != want {
+			t.Errorf("%s: status = %s, want %s", p.Name, p.Status, want)
+		}
+	}
+
+	// An invalid status rejects the whole batch.
+	if w := post(`{"ids":["` + mine.ID + `"],"status":"shipped"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid status: expected 400, got %d", w.Code)
+	}
+	if p, _ := h.DB.GetProject(mine.ID); p.Status != "in_review" {
+		t.Errorf("status changed by a rejected batch: %s", p.Status)
+	}
+	if w := post(`{"ids":[],"status":"draft"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("no ids: expected 400, got %d", w.Code)
+	}
+}
+
+func TestHandleBulkUpdateStatusApprovalGate(t *testing.T) {
+	h := setupTestHandler(t)
+	gated, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+	h.DB.CreateComment(vid, "index.html", 10, 10, "A", "a@test.com", "fix me")
+	h.DB.SetRequireResolvedForApproval(gated, true)
+	other, _ := h.DB.CreateProject("other", "")
+	open := other.ID
+
+	req := httptest.NewRequest("POST", "/api/projects/status", strings.NewReader(`{"ids":["`+gated+`","`+open+`"],"status":"approved"}`))
+	w := httptest.NewRecorder()
+	h.handleBulkUpdateStatus(w, req)
+	if !strings.Contains(w.Body.String(), `"result":"blocked"`) {
+		t.Errorf("expected gated project to be blocked: %s", w.Body.String())
+	}
+	if p, _ := h.DB.GetProject(gated); p.Status == "approved" {
+		t.Error("gated project should not be approved")
+	}
+	if p, _ := h.DB.GetProject(open); p.Status != "approved" {
+		t.Errorf("ungated project: status = %s, want approved", p.Status)
+	}
+}
+
 func TestHandleUpdateStatusDBError(t *testing.T) {
 	h := mockHandler(t, func(m *mockDB) { m.updateProjectStatusErr = errDB })
 	req := httptest.NewRequest("PATCH", "/api/projects/x/status", strings.NewReader(`{"status":"draft"}`))
@@ -288,3 +825,59 @@ func TestUpdateStatusOversizedBody(t *testing.T) {
 		t.Errorf("expected 413, got %d", w.Code)
 	}
 }
+
+func TestHandleGetSummary(t *testing.T) {
+	h := setupTestHandler(t)
+	d := h.DB
+	project := func(name, owner string, comments ...bool) string {
+		p, err := d.CreateProject(name, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, _ := d.CreateVersion(p.ID, "")
+		for _, resolved := range comments {
+			c, _ := d.CreateComment(v.ID, "index.html", 10, 10, "X", "x@test.com", "note")
+			if resolved {
+				d.ToggleResolve(c.ID, "x@test.com")
+			}
+		}
+		return p.ID
+	}
+	project("mine", "alice@test.com", false, true)        // owned, open
+	shared := project("shared", "bob@test.com", true)     // member, all resolved
+	coOwned := project("co-owned", "bob@test.com", false) // co-owner, open
+	project("private", "bob@test.com", false)             // no access
+	org := project("org", "carol@test.com")               // visible to the org
+	d.AddMember(shared, "alice@test.com")
+	d.AddMember(coOwned, "alice@test.com")
+	d.SetMemberRole(coOwned, "alice@test.com", db.RoleOwner)
+	d.SetProjectVisibility(org, db.VisibilityOrg)
+
+	summary := func(req *http.Request) map[string]int {
+		w := httptest.NewRecorder()
+		h.handleGetSummary(w, req)
+		if w.Code != 200 {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		var got map[string]int
+		json.NewDecoder(w.Body).Decode(&got)
+		return got
+	}
+
+	got := summary(withUser(httptest.NewRequest("GET", "/api/summary", nil), "Alice", "alice@test.com"))
+	want := map[string]int{"projects": 4, "owned": 2, "with_open_comments": 2}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("alice: %s = %d, want %d", k, got[k], v)
+		}
+	}
+
+	// Without auth every project counts and none is owned.
+	got = summary(httptest.NewRequest("GET", "/api/summary", nil))
+	want = map[string]int{"projects": 5, "owned": 0, "with_open_comments": 3}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("no auth: %s = %d, want %d", k, got[k], v)
+		}
+	}
+}
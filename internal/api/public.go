@@ -0,0 +1,265 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ab/design-reviewer/internal/db"
+)
+
+// maxDisplayNameLen bounds the name anonymous commenters post under, and
+// the display name signed-in users choose.
+const maxDisplayNameLen = 100
+
+// publicShare looks up the share named by the {token} path value. It writes
+// a 404 and returns false if there is no such share, or if public access
+// is disabled.
+func (h *Handler) publicShare(w http.ResponseWriter, r *http.Request) (*db.PublicShare, bool) {
+	if h.DisablePublic {
+		h.notFound(w, r)
+		return nil, false
+	}
+	share, err := h.DB.GetPublicShareByToken(r.PathValue("token"))
+	if err == sql.ErrNoRows {
+		h.notFound(w, r)
+		return nil, false
+	}
+	if err != nil {
+		h.webServerError(w, r, "database error", err)
+		return nil, false
+	}
+	return share, true
+}
+
+// publicVersion checks that versionID belongs to the shared project so a
+// share token can never be used to reach another project's versions.
+func (h *Handler) publicVersion(w http.ResponseWriter, r *http.Request, share *db.PublicShare, versionID string) bool {
+	v, err := h.DB.GetVersion(versionID)
+	if err == sql.ErrNoRows || (err == nil && v.ProjectID != share.ProjectID) {
+		http.NotFound(w, r)
+		return false
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) handlePublicViewer(w http.ResponseWriter, r *http.Request) {
+	share, ok := h.publicShare(w, r)
+	if !ok {
+		return
+	}
+	h.renderViewer(w, r, share.ProjectID, &anonymousView{APIBase: "/p/" + share.Token, CommentMode: share.CommentMode})
+}
+
+func (h *Handler) handlePublicDesignFile(w http.ResponseWriter, r *http.Request) {
+	share, ok := h.publicShare(w, r)
+	if !ok || !h.publicVersion(w, r, share, r.PathValue("version_id")) {
+		return
+	}
+	h.handleDesignFile(w, r)
+}
+
+func (h *Handler) handlePublicListVersions(w http.ResponseWriter, r *http.Request) {
+	share, ok := h.publicShare(w, r)
+	if !ok {
+		return
+	}
+	if r.PathValue("id") != share.ProjectID {
+		http.NotFound(w, r)
+		return
+	}
+	h.handleListVersions(w, r)
+}
+
+func (h *Handler) handlePublicGetFlow(w http.ResponseWriter, r *http.Request) {
+	share, ok := h.publicShare(w, r)
+	if !ok || !h.publicVersion(w, r, share, r.PathValue("id")) {
+		return
+	}
+	h.handleGetFlow(w, r)
+}
+
+func (h *Handler) handlePublicGetComments(w http.ResponseWriter, r *http.Request) {
+	share, ok := h.publicShare(w, r)
+	if !ok {
+		return
+	}
+	if share.CommentMode == db.CommentModeHidden {
+		http.NotFound(w, r)
+		return
+	}
+	versionID := r.PathValue("id")
+	if !h.publicVersion(w, r, share, versionID) {
+		return
+	}
+
+	out, err := h.versionComments(versionID)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	hideEmails(out)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// openShareForPosting checks that the share allows anonymous comments.
+func (h *Handler) openShareForPosting(w http.ResponseWriter, r *http.Request) (*db.PublicShare, bool) {
+	share, ok := h.publicShare(w, r)
+	if !ok {
+		return nil, false
+	}
+	if share.CommentMode != db.CommentModeOpen {
+		http.Error(w, "commenting is not allowed on this link", http.StatusForbidden)
+		return nil, false
+	}
+	return share, true
+}
+
+// validDisplayName trims name and reports whether it can be posted under.
+func validDisplayName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	return name, name != "" && len(name) <= maxDisplayNameLen
+}
+
+func (h *Handler) handlePublicCreateComment(w http.ResponseWriter, r *http.Request) {
+	share, ok := h.openShareForPosting(w, r)
+	if !ok {
+		return
+	}
+	versionID := r.PathValue("id")
+	if !h.publicVersion(w, r, share, versionID) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		Page       string  `json:"page"`
+		XPercent   float64 `json:"x_percent"`
+		YPercent   float64 `json:"y_percent"`
+		AuthorName string  `json:"author_name"`
+		Body       string  `json:"body"`
+		Anchor     string  `json:"anchor"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Body == "" {
+		writeFieldError(w, "body", "body is required")
+		return
+	}
+	if req.Page == "" {
+		writeFieldError(w, "page", "page is required")
+		return
+	}
+	if fe := checkPercent(req.XPercent, req.YPercent); fe != nil {
+		writeFieldError(w, fe.Field, fe.Reason)
+		return
+	}
+	if len(req.Anchor) > maxAnchorLen {
+		writeFieldError(w, "anchor", "anchor is too long")
+		return
+	}
+	name, ok := validDisplayName(req.AuthorName)
+	if !ok {
+		writeFieldError(w, "author_name", "author_name is required")
+		return
+	}
+	if !h.checkCommentLimit(w, versionID) {
+		return
+	}
+
+	// Anonymous comments have no email; it is never taken from the request.
+	c, err := h.DB.CreateCommentWithAnchor(versionID, req.Page, req.XPercent, req.YPercent, req.Anchor, name, "", req.Body)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(commentJSON{
+		ID:         c.ID,
+		VersionID:  c.VersionID,
+		Page:       c.Page,
+		XPercent:   c.XPercent,
+		YPercent:   c.YPercent,
+		AuthorName: c.AuthorName,
+		Body:       c.Body,
+		Resolved:   c.Resolved,
+		Anchor:     c.Anchor,
+		CreatedAt:  c.CreatedAt.Format(time.RFC3339),
+		Replies:    []replyJSON{},
+
+		LastActivityAt: c.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+func (h *Handler) handlePublicCreateReply(w http.ResponseWriter, r *http.Request) {
+	share, ok := h.openShareForPosting(w, r)
+	if !ok {
+		return
+	}
+	c, err := h.DB.GetComment(r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	if !h.publicVersion(w, r, share, c.VersionID) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		AuthorName string `json:"author_name"`
+		Body       string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Body == "" {
+		http.Error(w, "body is required", http.StatusBadRequest)
+		return
+	}
+	name, ok := validDisplayName(req.AuthorName)
+	if !ok {
+		http.Error(w, "author_name is required", http.StatusBadRequest)
+		return
+	}
+
+	reply, err := h.DB.CreateReply(c.ID, name, "", req.Body)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(replyJSON{
+		ID:         reply.ID,
+		AuthorName: reply.AuthorName,
+		Body:       reply.Body,
+		CreatedAt:  reply.CreatedAt.Format(time.RFC3339),
+	})
+}
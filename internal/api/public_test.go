@@ -0,0 +1,339 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ab/design-reviewer/internal/db"
+)
+
+// setupPublicShare seeds a project with one comment and returns an auth-
+// enabled mux plus a share token for it in the given comment mode.
+func setupPublicShare(t *testing.T, mode string) (h *Handler, mux *http.ServeMux, token, projectID, versionID string) {
+	t.Helper()
+	h = setupAuthHandler(t)
+	projectID, versionID = seedProject(t, h, map[string]string{"index.html": "<h1>hi</h1>"})
+	h.DB.CreateComment(versionID, "index.html", 10, 20, "Alice", "alice@test.com", "Looks good")
+	ps, err := h.DB.CreatePublicShare(projectID, "alice@test.com", mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux = http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return h, mux, ps.Token, projectID, versionID
+}
+
+func servePublic(mux *http.ServeMux, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestPublicShareHiddenMode(t *testing.T) {
+	_, mux, token, _, vid := setupPublicShare(t, db.CommentModeHidden)
+
+	w := servePublic(mux, "GET", "/p/"+token, "")
+	if w.Code != 200 {
+		t.Fatalf("viewer: expected 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, `data-mode="comment"`) {
+		t.Error("comment mode button should be hidden")
+	}
+	if strings.Contains(body, "status-select") || strings.Contains(body, "share-btn") {
+		t.Error("owner controls should not be shown on a public link")
+	}
+	if !strings.Contains(body, "/p/"+token+"/designs/"+vid+"/index.html") {
+		t.Error("design iframe should load through the share link")
+	}
+
+	if w := servePublic(mux, "GET", "/p/"+token+"/designs/"+vid+"/index.html", ""); w.Code != 200 {
+		t.Errorf("design file: expected 200, got %d", w.Code)
+	}
+	if w := servePublic(mux, "GET", "/p/"+token+"/api/versions/"+vid+"/comments", ""); w.Code != 404 {
+		t.Errorf("comments: expected 404, got %d", w.Code)
+	}
+	w = servePublic(mux, "POST", "/p/"+token+"/api/versions/"+vid+"/comments", `{"page":"index.html","author_name":"Guest","body":"hi"}`)
+	if w.Code != 403 {
+		t.Errorf("post comment: expected 403, got %d", w.Code)
+	}
+}
+
+func TestPublicShareReadOnlyMode(t *testing.T) {
+	h, mux, token, _, vid := setupPublicShare(t, db.CommentModeReadOnly)
+
+	w := servePublic(mux, "GET", "/p/"+token+"/api/versions/"+vid+"/comments", "")
+	if w.Code != 200 {
+		t.Fatalf("comments: expected 200, got %d", w.Code)
+	}
+	var comments []commentJSON
+	json.NewDecoder(w.Body).Decode(&comments)
+	if len(comments) != 1 || comments[0].Body != "Looks good" {
+		t.Fatalf("unexpected comments: %+v", comments)
+	}
+	if comments[0].AuthorEmail != "" {
+		t.Error("author email should not be exposed on a public link")
+	}
+
+	w = servePublic(mux, "POST", "/p/"+token+"/api/versions/"+vid+"/comments", `{"page":"index.html","author_name":"Guest","body":"hi"}`)
+	if w.Code != 403 {
+		t.Errorf("post comment: expected 403, got %d", w.Code)
+	}
+	w = servePublic(mux, "POST", "/p/"+token+"/api/comments/"+comments[0].ID+"/replies", `{"author_name":"Guest","body":"hi"}`)
+	if w.Code != 403 {
+		t.Errorf("post reply: expected 403, got %d", w.Code)
+	}
+	if replies, _ := h.DB.GetReplies(comments[0].ID); len(replies) != 0 {
+		t.Error("reply should not have been stored")
+	}
+}
+
+func TestPublicShareOpenMode(t *testing.T) {
+	h, mux, token, _, vid := setupPublicShare(t, db.CommentModeOpen)
+
+	w := servePublic(mux, "POST", "/p/"+token+"/api/versions/"+vid+"/comments",
+		`{"page":"index.html","x_percent":5,"y_percent":6,"author_name":" Guest ","author_email":"spoof@test.com","body":"Nice"}`)
+	if w.Code != 201 {
+		t.Fatalf("post comment: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var c commentJSON
+	json.NewDecoder(w.Body).Decode(&c)
+	stored, err := h.DB.GetComment(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.AuthorName != "Guest" || stored.AuthorEmail != "" {
+		t.Errorf("stored author = %q <%q>, want Guest with no email", stored.AuthorName, stored.AuthorEmail)
+	}
+
+	w = servePublic(mux, "POST", "/p/"+token+"/api/comments/"+c.ID+"/replies", `{"author_name":"Guest","body":"Also this"}`)
+	if w.Code != 201 {
+		t.Fatalf("post reply: expected 201, got %d", w.Code)
+	}
+	if replies, _ := h.DB.GetReplies(c.ID); len(replies) != 1 || replies[0].AuthorEmail != "" {
+		t.Errorf("unexpected replies: %+v", replies)
+	}
+
+	// A display name is required.
+	w = servePublic(mux, "POST", "/p/"+token+"/api/versions/"+vid+"/comments", `{"page":"index.html","author_name":"  ","body":"Nice"}`)
+	if w.Code != 400 {
+		t.Errorf("missing name: expected 400, got %d", w.Code)
+	}
+	w = servePublic(mux, "POST", "/p/"+token+"/api/versions/"+vid+"/comments",
+		`{"page":"index.html","author_name":"`+strings.Repeat("x", maxDisplayNameLen+1)+`","body":"Nice"}`)
+	if w.Code != 400 {
+		t.Errorf("long name: expected 400, got %d", w.Code)
+	}
+}
+
+func TestPublicShareCommentFieldErrors(t *testing.T) {
+	h, mux, token, _, vid := setupPublicShare(t, db.CommentModeOpen)
+	before, _ := h.DB.CountCommentsForVersion(vid)
+
+	for _, tc := range []struct{ body, field string }{
+		{`{"page":"index.html","x_percent":-5,"y_percent":6,"author_name":"Guest","body":"x"}`, "x_percent"},
+		{`{"page":"index.html","x_percent":5,"y_percent":1e9,"author_name":"Guest","body":"x"}`, "y_percent"},
+		{`{"page":"index.html","author_name":"Guest"}`, "body"},
+		{`{"author_name":"Guest","body":"x"}`, "page"},
+		{`{"page":"index.html","author_name":"Guest","body":"x","anchor":"` + strings.Repeat("a", maxAnchorLen+1) + `"}`, "anchor"},
+		{`{"page":"index.html","body":"x"}`, "author_name"},
+	} {
+		w := servePublic(mux, "POST", "/p/"+token+"/api/versions/"+vid+"/comments", tc.body)
+		var got map[string]string
+		json.NewDecoder(w.Body).Decode(&got)
+		if w.Code != 400 || got["field"] != tc.field {
+			t.Errorf("%s: got %d %v, want 400 naming %s", tc.body, w.Code, got, tc.field)
+		}
+	}
+	if after, _ := h.DB.CountCommentsForVersion(vid); after != before {
+		t.Errorf("invalid comments were stored: %d -> %d", before, after)
+	}
+}
+
+func TestPublicShareScopedToProject(t *testing.T) {
+	h, mux, token, _, _ := setupPublicShare(t, db.CommentModeOpen)
+	otherProject, _ := h.DB.CreateProject("other-proj", "bob@test.com")
+	otherVersion, _ := h.DB.CreateVersion(otherProject.ID, "")
+	h.Storage.SaveUpload(otherVersion.ID, bytes.NewReader(makeZipForTest(t, map[string]string{"index.html": "<h1>secret</h1>"})))
+	otherPID, otherVID := otherProject.ID, otherVersion.ID
+	other, _ := h.DB.CreateComment(otherVID, "index.html", 1, 1, "Bob", "bob@test.com", "private")
+
+	paths := []struct{ method, path, body string }{
+		{"GET", "/p/" + token + "?version=" + otherVID, ""},
+		{"GET", "/p/" + token + "/designs/" + otherVID + "/index.html", ""},
+		{"GET", "/p/" + token + "/api/projects/" + otherPID + "/versions", ""},
+		{"GET", "/p/" + token + "/api/versions/" + otherVID + "/flow", ""},
+		{"GET", "/p/" + token + "/api/versions/" + otherVID + "/comments", ""},
+		{"POST", "/p/" + token + "/api/versions/" + otherVID + "/comments", `{"page":"index.html","author_name":"Guest","body":"x"}`},
+		{"POST", "/p/" + token + "/api/comments/" + other.ID + "/replies", `{"author_name":"Guest","body":"x"}`},
+	}
+	for _, p := range paths {
+		if w := servePublic(mux, p.method, p.path, p.body); w.Code != 404 {
+			t.Errorf("%s %s: expected 404, got %d", p.method, p.path, w.Code)
+		}
+	}
+	if replies, _ := h.DB.GetReplies(other.ID); len(replies) != 0 {
+		t.Error("reply should not reach another project")
+	}
+}
+
+func TestPublicShareUnknownToken(t *testing.T) {
+	_, mux, _, _, vid := setupPublicShare(t, db.CommentModeOpen)
+	for _, path := range []string{"/p/nope", "/p/nope/api/versions/" + vid + "/comments"} {
+		if w := servePublic(mux, "GET", path, ""); w.Code != 404 {
+			t.Errorf("%s: expected 404, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestHandlePublicShareManagement(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+
+	req := httptest.NewRequest("POST", "/api/projects/"+p.ID+"/public-shares", strings.NewReader(`{"comment_mode":"bogus"}`))
+	req.SetPathValue("id", p.ID)
+	w := httptest.NewRecorder()
+	h.handleCreatePublicShare(w, req)
+	if w.Code != 400 {
+		t.Errorf("invalid mode: expected 400, got %d", w.Code)
+	}
+
+	// Comment mode defaults to hidden.
+	req = httptest.NewRequest("POST", "/api/projects/"+p.ID+"/public-shares", nil)
+	req.SetPathValue("id", p.ID)
+	req = withUser(req, "Alice", "alice@test.com")
+	w = httptest.NewRecorder()
+	h.handleCreatePublicShare(w, req)
+	if w.Code != 201 {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created publicShareJSON
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.CommentMode != db.CommentModeHidden || !strings.Contains(created.URL, "/p/") {
+		t.Errorf("unexpected share: %+v", created)
+	}
+
+	req = httptest.NewRequest("PATCH", "/api/projects/"+p.ID+"/public-shares/"+created.ID, strings.NewReader(`{"comment_mode":"open"}`))
+	req.SetPathValue("id", p.ID)
+	req.SetPathValue("shareID", created.ID)
+	w = httptest.NewRecorder()
+	h.handleUpdatePublicShare(w, req)
+	if w.Code != 200 {
+		t.Fatalf("update: expected 200, got %d", w.Code)
+	}
+
+	// Shares can't be changed through another project's ID.
+	other, _ := h.DB.CreateProject("other", "alice@test.com")
+	req = httptest.NewRequest("PATCH", "/api/projects/"+other.ID+"/public-shares/"+created.ID, strings.NewReader(`{"comment_mode":"hidden"}`))
+	req.SetPathValue("id", other.ID)
+	req.SetPathValue("shareID", created.ID)
+	w = httptest.NewRecorder()
+	h.handleUpdatePublicShare(w, req)
+	if w.Code != 404 {
+		t.Errorf("cross-project update: expected 404, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/projects/"+p.ID+"/public-shares", nil)
+	req.SetPathValue("id", p.ID)
+	w = httptest.NewRecorder()
+	h.handleListPublicShares(w, req)
+	var list []publicShareJSON
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list) != 1 || list[0].CommentMode != db.CommentModeOpen {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+
+	req = httptest.NewRequest("DELETE", "/api/projects/"+p.ID+"/public-shares/"+created.ID, nil)
+	req.SetPathValue("id", p.ID)
+	req.SetPathValue("shareID", created.ID)
+	w = httptest.NewRecorder()
+	h.handleDeletePublicShare(w, req)
+	if w.Code != 204 {
+		t.Errorf("delete: expected 204, got %d", w.Code)
+	}
+	if shares, _ := h.DB.ListPublicShares(p.ID); len(shares) != 0 {
+		t.Error("share should be deleted")
+	}
+}
+
+func TestDisablePublic(t *testing.T) {
+	h, mux, token, pid, vid := setupPublicShare(t, db.CommentModeOpen)
+	h.DB.SetProjectVisibility(pid, db.VisibilityPublic)
+	_, embedURL := createEmbedURL(t, h, vid, `{}`)
+	embedPath := strings.TrimPrefix(embedURL, "http://example.com")
+	h.DisablePublic = true
+	h.DB.(*db.DB).PrivateOnly = true
+
+	// Share links are gone.
+	for _, path := range []string{
+		"/p/" + token,
+		"/p/" + token + "/designs/" + vid + "/index.html",
+		"/p/" + token + "/api/versions/" + vid + "/comments",
+	} {
+		if w := servePublic(mux, "GET", path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, w.Code)
+		}
+	}
+	w := servePublic(mux, "POST", "/p/"+token+"/api/versions/"+vid+"/comments", `{"page":"index.html","author_name":"Guest","body":"hi"}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("share comment: expected 404, got %d", w.Code)
+	}
+
+	// The public project asks for a login like a private one.
+	if w := servePublic(mux, "GET", "/projects/"+pid, ""); w.Code != http.StatusFound {
+		t.Errorf("public viewer: expected redirect to login, got %d", w.Code)
+	}
+	if w := servePublic(mux, "GET", "/api/versions/"+vid+"/comments", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("public comments: expected 401, got %d", w.Code)
+	}
+
+	if w := servePublic(mux, "GET", embedPath, ""); w.Code != http.StatusNotFound {
+		t.Errorf("embed %s: expected 404, got %d", embedPath, w.Code)
+	}
+
+	// Org visibility no longer opens a project to other users.
+	org, _ := h.DB.CreateProject("org-wide", "alice@test.com")
+	h.DB.SetProjectVisibility(org.ID, db.VisibilityOrg)
+	if ok, _ := h.DB.CanAccessProject(org.ID, "stranger@test.com"); ok {
+		t.Error("org project should be private to non-members")
+	}
+}
+
+func TestDisablePublicRejectsSetup(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+	h.DisablePublic = true
+
+	req := httptest.NewRequest("PUT", "/api/projects/"+pid+"/visibility", strings.NewReader(`{"visibility":"org"}`))
+	req.SetPathValue("id", pid)
+	w := httptest.NewRecorder()
+	h.handleSetVisibility(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("org visibility: expected 403, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/projects/"+pid+"/public-shares", strings.NewReader(`{}`))
+	req.SetPathValue("id", pid)
+	w = httptest.NewRecorder()
+	h.handleCreatePublicShare(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("public share: expected 403, got %d", w.Code)
+	}
+
+	if w, _ := createEmbedURL(t, h, vid, `{}`); w.Code != http.StatusForbidden {
+		t.Errorf("embed url: expected 403, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("PUT", "/api/projects/"+pid+"/visibility", strings.NewReader(`{"visibility":"private"}`))
+	req.SetPathValue("id", pid)
+	w = httptest.NewRecorder()
+	h.handleSetVisibility(w, req)
+	if w.Code != 200 {
+		t.Errorf("private visibility: expected 200, got %d", w.Code)
+	}
+}
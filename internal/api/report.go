@@ -0,0 +1,213 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/ab/design-reviewer/internal/storage"
+)
+
+// reportPin is a numbered pin drawn over the report's page.
+type reportPin struct {
+	Num      int
+	X, Y     float64
+	Resolved bool
+}
+
+// reportComment is a comment in the report's sidebar. Num matches its pin,
+// or is 0 for comments on other pages, which have no pin.
+type reportComment struct {
+	commentJSON
+	Num int
+}
+
+// handleVersionReport renders a self-contained HTML report of a version:
+// its default page, with local stylesheets and images inlined, the comment
+// pins drawn over it, and every comment and reply in a sidebar. It downloads
+// as a file meant to be opened offline.
+func (h *Handler) handleVersionReport(w http.ResponseWriter, r *http.Request) {
+	versionID := r.PathValue("id")
+	version, err := h.DB.GetVersion(versionID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	project, err := h.DB.GetProject(version.ProjectID)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+
+	pages, err := h.Storage.ListHTMLFiles(versionID)
+	if err != nil || len(pages) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	order, err := h.DB.GetPageOrder(versionID)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	page := orderPages(pages, order)[0]
+	content, err := os.ReadFile(h.Storage.GetFilePath(versionID, page))
+	if err != nil {
+		serverError(w, "storage error", err)
+		return
+	}
+
+	comments, err := h.DB.GetCommentsForVersion(versionID)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	list, err := h.toCommentJSON(comments)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	// Pins are numbered in the order the viewer numbers them on the page.
+	var pins []reportPin
+	sidebar := make([]reportComment, len(list))
+	for i, c := range list {
+		sidebar[i] = reportComment{commentJSON: c}
+		if c.Page == page {
+			pins = append(pins, reportPin{Num: len(pins) + 1, X: c.XPercent, Y: c.YPercent, Resolved: c.Resolved})
+			sidebar[i].Num = len(pins)
+		}
+	}
+
+	tmpl, err := template.ParseFiles(filepath.Join(h.TemplatesDir, "report.html"))
+	if err != nil {
+		serverError(w, "template error", err)
+		return
+	}
+	width := version.CanvasWidth
+	if width == 0 {
+		width = defaultDesignWidth
+	}
+	height := version.CanvasHeight
+	if height == 0 {
+		height = 900
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		ProjectName string
+		VersionNum  int
+		Page        string
+		Content     string
+		Width       int
+		Height      int
+		Pins        []reportPin
+		Comments    []reportComment
+	}{project.Name, version.VersionNum, page, string(h.inlineAssets(versionID, content)), width, height, pins, sidebar})
+	if err != nil {
+		serverError(w, "template error", err)
+		return
+	}
+	filename := fmt.Sprintf("%s-v%d-report.html", project.Name, version.VersionNum)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Write(buf.Bytes())
+}
+
+// inlineAssets replaces a page's local stylesheets with <style> elements and
+// its local images with data URLs, so the page renders without the server.
+// Remote URLs, and anything that can't be read, are left alone.
+func (h *Handler) inlineAssets(versionID string, page []byte) []byte {
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return page
+	}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		// Take the next sibling first: walk may replace c.
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			walk(c)
+			c = next
+		}
+		if n.Type != html.ElementNode {
+			return
+		}
+		switch {
+		case n.DataAtom == atom.Link && strings.EqualFold(htmlAttr(n, "rel"), "stylesheet"):
+			if css, ok := h.readAsset(versionID, htmlAttr(n, "href")); ok {
+				style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+				style.AppendChild(&html.Node{Type: html.TextNode, Data: string(css)})
+				n.Parent.InsertBefore(style, n)
+				n.Parent.RemoveChild(n)
+			}
+		case n.DataAtom == atom.Img:
+			src := htmlAttr(n, "src")
+			if data, ok := h.readAsset(versionID, src); ok {
+				ct := storage.ContentType(src)
+				if ct == "" {
+					ct = http.DetectContentType(data)
+				}
+				setHTMLAttr(n, "src", "data:"+ct+";base64,"+base64.StdEncoding.EncodeToString(data))
+			}
+		}
+	}
+	walk(doc)
+	var out bytes.Buffer
+	if err := html.Render(&out, doc); err != nil {
+		return page
+	}
+	return out.Bytes()
+}
+
+// readAsset reads a file of the version referenced by a relative URL in
+// one of its root-level pages.
+func (h *Handler) readAsset(versionID, ref string) ([]byte, bool) {
+	u, err := url.Parse(ref)
+	if err != nil || ref == "" || u.Scheme != "" || u.Host != "" || strings.HasPrefix(u.Path, "/") {
+		return nil, false
+	}
+	rel := path.Clean(u.Path)
+	if rel == "." || strings.HasPrefix(rel, "../") || rel == ".." {
+		return nil, false
+	}
+	fullPath := h.Storage.GetFilePath(versionID, rel)
+	baseDir := filepath.Clean(h.Storage.GetFilePath(versionID, "")) + string(os.PathSeparator)
+	if !strings.HasPrefix(fullPath, baseDir) {
+		return nil, false
+	}
+	data, err := os.ReadFile(fullPath)
+	return data, err == nil
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func setHTMLAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleVersionReport(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{
+		"index.html": `<html><head><link rel="stylesheet" href="style.css"></head><body><h1>Home</h1><img src="logo.png"></body></html>`,
+		"about.html": "<p>about</p>",
+		"style.css":  "h1 { color: tomato; }",
+		"logo.png":   "\x89PNG\r\n\x1a\n",
+	})
+	c, _ := h.DB.CreateComment(vid, "index.html", 12.5, 40, "Alice", "a@t.com", "tighten the <b>heading</b>")
+	h.DB.CreateReply(c.ID, "Bob", "b@t.com", "done in v2")
+	h.DB.CreateComment(vid, "about.html", 50, 50, "Carol", "c@t.com", "about page copy")
+
+	req := httptest.NewRequest("GET", "/api/versions/"+vid+"/report.html", nil)
+	req.SetPathValue("id", vid)
+	w := httptest.NewRecorder()
+	h.handleVersionReport(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") || !strings.Contains(cd, "test-proj-v1-report.html") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"tighten the &lt;b&gt;heading&lt;/b&gt;", "done in v2", "about page copy", "on about.html"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("report missing %q", want)
+		}
+	}
+	if strings.Contains(body, "<b>heading</b>") {
+		t.Error("comment text should be escaped")
+	}
+	if !strings.Contains(body, `style="left: 12.5%; top: 40%"`) {
+		t.Error("missing the pin at the comment's coordinates")
+	}
+	if strings.Count(body, `class="pin`) != 1 {
+		t.Error("only comments on the default page should get a pin")
+	}
+	// The page is inlined, with its stylesheet and image, in the frame's srcdoc.
+	for _, want := range []string{"h1 { color: tomato; }", "data:image/png;base64,", "&lt;h1&gt;Home&lt;/h1&gt;"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("inlined page missing %q", want)
+		}
+	}
+}
+
+func TestHandleVersionReportNotFound(t *testing.T) {
+	h := setupTestHandler(t)
+	req := httptest.NewRequest("GET", "/api/versions/nonexistent/report.html", nil)
+	req.SetPathValue("id", "nonexistent")
+	w := httptest.NewRecorder()
+	h.handleVersionReport(w, req)
+	if w.Code != 404 {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// robotsDisallowed are the paths crawlers are kept out of: project pages,
+// design files and the API all expose design content.
+var robotsDisallowed = []string{"/projects/", "/designs/", "/api/"}
+
+// handleRobots serves robots.txt. Public share links (/p/) are disallowed
+// too unless RobotsAllowShares is set.
+func (h *Handler) handleRobots(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	paths := robotsDisallowed
+	if !h.RobotsAllowShares {
+		paths = append(paths[:len(paths):len(paths)], "/p/")
+	}
+	for _, p := range paths {
+		fmt.Fprintf(&b, "Disallow: %s\n", h.link(p))
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
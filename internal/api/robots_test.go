@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRobots(t *testing.T) {
+	h := setupAuthHandler(t)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/robots.txt", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 without auth, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"User-agent: *", "Disallow: /projects/", "Disallow: /designs/", "Disallow: /api/", "Disallow: /p/"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("robots.txt missing %q:\n%s", want, body)
+		}
+	}
+
+	h.RobotsAllowShares = true
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/robots.txt", nil))
+	if strings.Contains(w.Body.String(), "/p/") {
+		t.Errorf("share links should be allowed:\n%s", w.Body.String())
+	}
+}
+
+func TestRobotsUnderBasePath(t *testing.T) {
+	h := setupTestHandler(t)
+	h.BasePath = "/dr"
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	// Crawlers only look at the host root, so it is served there too.
+	for _, path := range []string{"/robots.txt", "/dr/robots.txt"} {
+		w := httptest.NewRecorder()
+		WithBasePath(h.BasePath, mux).ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d", path, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "Disallow: /dr/projects/") {
+			t.Errorf("%s: rules should carry the base path:\n%s", path, w.Body.String())
+		}
+	}
+}
+
+func TestRobotsNotRateLimited(t *testing.T) {
+	rl := NewRateLimiter()
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 40; i++ {
+		req := httptest.NewRequest("GET", "/robots.txt", nil)
+		req.RemoteAddr = "6.6.6.6:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: got %d", i, w.Code)
+		}
+	}
+}
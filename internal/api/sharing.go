@@ -3,25 +3,42 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
-	"html/template"
+	"io"
 	"net/http"
-	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ab/design-reviewer/internal/auth"
+	"github.com/ab/design-reviewer/internal/db"
 )
 
+// handleCreateInvite creates an invite link; ?short=true gives it a
+// shorter token that is easier to paste into chat.
 func (h *Handler) handleCreateInvite(w http.ResponseWriter, r *http.Request) {
 	projectID := r.PathValue("id")
 	_, email := auth.GetUserFromContext(r.Context())
+	short := false
+	if v := r.URL.Query().Get("short"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid short", http.StatusBadRequest)
+			return
+		}
+		short = b
+	}
 
-	inv, err := h.DB.CreateInvite(projectID, email)
+	createInvite := h.DB.CreateInvite
+	if short {
+		createInvite = h.DB.CreateShortInvite
+	}
+	inv, err := createInvite(projectID, email)
 	if err != nil {
 		serverError(w, "database error", err)
 		return
 	}
 
-	baseURL := ""
+	baseURL := h.BasePath
 	if h.Auth != nil {
 		baseURL = h.Auth.BaseURL
 	}
@@ -42,8 +59,19 @@ func (h *Handler) handleDeleteInvite(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handleListMembers lists everyone with access to the project: the owner
+// first, marked primary, then the members table in the order they joined.
 func (h *Handler) handleListMembers(w http.ResponseWriter, r *http.Request) {
 	projectID := r.PathValue("id")
+	project, err := h.DB.GetProject(projectID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
 	members, err := h.DB.ListMembers(projectID)
 	if err != nil {
 		serverError(w, "database error", err)
@@ -51,11 +79,23 @@ func (h *Handler) handleListMembers(w http.ResponseWriter, r *http.Request) {
 	}
 	type memberJSON struct {
 		Email   string `json:"email"`
+		Role    string `json:"role"`
+		Primary bool   `json:"primary,omitempty"`
 		AddedAt string `json:"added_at"`
 	}
-	out := make([]memberJSON, len(members))
-	for i, m := range members {
-		out[i] = memberJSON{Email: m.UserEmail, AddedAt: m.AddedAt.Format(time.RFC3339)}
+	out := make([]memberJSON, 0, len(members)+1)
+	owner := ""
+	if project.OwnerEmail != nil {
+		owner = *project.OwnerEmail
+	}
+	if owner != "" {
+		out = append(out, memberJSON{Email: owner, Role: db.RoleOwner, Primary: true, AddedAt: project.CreatedAt.Format(time.RFC3339)})
+	}
+	for _, m := range members {
+		if owner != "" && strings.EqualFold(m.UserEmail, owner) {
+			continue
+		}
+		out = append(out, memberJSON{Email: m.UserEmail, Role: m.Role, AddedAt: m.AddedAt.Format(time.RFC3339)})
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(out)
@@ -83,36 +123,205 @@ func (h *Handler) handleRemoveMember(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handleLeaveProject removes the caller's own membership. The owner has to
+// hand the project to someone else before leaving it.
+func (h *Handler) handleLeaveProject(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("id")
+	_, email := auth.GetUserFromContext(r.Context())
+	if email == "" {
+		http.Error(w, "not signed in", http.StatusBadRequest)
+		return
+	}
+
+	owner, err := h.DB.GetProjectOwner(projectID)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	if email == owner {
+		http.Error(w, "the owner cannot leave; transfer ownership first", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.RemoveMember(projectID, email); err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleSetMemberRole(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("id")
+	email := r.PathValue("email")
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Role != db.RoleMember && req.Role != db.RoleOwner {
+		http.Error(w, "invalid role", http.StatusBadRequest)
+		return
+	}
+
+	err := h.DB.SetMemberRole(projectID, email, req.Role)
+	if err == sql.ErrNoRows {
+		http.Error(w, "member not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"email": email, "role": req.Role})
+}
+
 func (h *Handler) handleAcceptInvite(w http.ResponseWriter, r *http.Request) {
 	token := r.PathValue("token")
 
 	inv, err := h.DB.GetInviteByToken(token)
 	if err == sql.ErrNoRows {
-		tmpl, tErr := template.ParseFiles(
-			filepath.Join(h.TemplatesDir, "layout.html"),
-			filepath.Join(h.TemplatesDir, "invite.html"),
-		)
-		if tErr != nil {
-			http.Error(w, "invalid or expired invite", http.StatusNotFound)
-			return
-		}
-		name, _ := auth.GetUserFromContext(r.Context())
-		tmpl.Execute(w, struct {
-			Error    string
-			UserName string
-		}{"This invite link is invalid or has expired.", name})
+		h.errorPage(w, r, http.StatusNotFound, "This invite link is invalid or has expired.")
 		return
 	}
 	if err != nil {
-		serverError(w, "database error", err)
+		h.webServerError(w, r, "database error", err)
 		return
 	}
 
 	_, email := auth.GetUserFromContext(r.Context())
 	if err := h.DB.AddMember(inv.ProjectID, email); err != nil {
+		h.webServerError(w, r, "database error", err)
+		return
+	}
+
+	http.Redirect(w, r, h.link("/projects/"+inv.ProjectID), http.StatusFound)
+}
+
+type publicShareJSON struct {
+	ID          string `json:"id"`
+	URL         string `json:"url"`
+	CommentMode string `json:"comment_mode"`
+	CreatedAt   string `json:"created_at"`
+}
+
+func (h *Handler) publicShareJSON(ps db.PublicShare) publicShareJSON {
+	baseURL := h.BasePath
+	if h.Auth != nil {
+		baseURL = h.Auth.BaseURL
+	}
+	return publicShareJSON{
+		ID:          ps.ID,
+		URL:         baseURL + "/p/" + ps.Token,
+		CommentMode: ps.CommentMode,
+		CreatedAt:   ps.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func validCommentMode(mode string) bool {
+	return mode == db.CommentModeHidden || mode == db.CommentModeReadOnly || mode == db.CommentModeOpen
+}
+
+// decodeCommentMode reads {"comment_mode": ...} from the request body. An
+// empty body or mode is returned as "".
+func decodeCommentMode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		CommentMode string `json:"comment_mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return "", false
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return "", false
+	}
+	if req.CommentMode != "" && !validCommentMode(req.CommentMode) {
+		http.Error(w, "invalid comment_mode", http.StatusBadRequest)
+		return "", false
+	}
+	return req.CommentMode, true
+}
+
+func (h *Handler) handleCreatePublicShare(w http.ResponseWriter, r *http.Request) {
+	if h.DisablePublic {
+		http.Error(w, errPublicDisabled, http.StatusForbidden)
+		return
+	}
+	projectID := r.PathValue("id")
+	_, email := auth.GetUserFromContext(r.Context())
+
+	mode, ok := decodeCommentMode(w, r)
+	if !ok {
+		return
+	}
+	if mode == "" {
+		mode = db.CommentModeHidden
+	}
+
+	ps, err := h.DB.CreatePublicShare(projectID, email, mode)
+	if err != nil {
 		serverError(w, "database error", err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(h.publicShareJSON(*ps))
+}
 
-	http.Redirect(w, r, "/projects/"+inv.ProjectID, http.StatusFound)
+func (h *Handler) handleListPublicShares(w http.ResponseWriter, r *http.Request) {
+	shares, err := h.DB.ListPublicShares(r.PathValue("id"))
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	out := make([]publicShareJSON, len(shares))
+	for i, ps := range shares {
+		out[i] = h.publicShareJSON(ps)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (h *Handler) handleUpdatePublicShare(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("id")
+	shareID := r.PathValue("shareID")
+
+	mode, ok := decodeCommentMode(w, r)
+	if !ok {
+		return
+	}
+	if mode == "" {
+		http.Error(w, "comment_mode is required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.DB.SetPublicShareCommentMode(projectID, shareID, mode)
+	if err == sql.ErrNoRows {
+		http.Error(w, "share not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": shareID, "comment_mode": mode})
+}
+
+func (h *Handler) handleDeletePublicShare(w http.ResponseWriter, r *http.Request) {
+	if err := h.DB.DeletePublicShare(r.PathValue("id"), r.PathValue("shareID")); err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
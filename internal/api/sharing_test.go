@@ -9,6 +9,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/ab/design-reviewer/internal/auth"
@@ -43,6 +44,30 @@ func TestHandleCreateInvite(t *testing.T) {
 	}
 }
 
+func TestHandleCreateInviteShort(t *testing.T) {
+	h := setupTestHandler(t)
+	h.Auth = &auth.Config{BaseURL: "http://localhost:8080"}
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+
+	req := httptest.NewRequest("POST", "/api/projects/"+p.ID+"/invites?short=true", nil)
+	req.SetPathValue("id", p.ID)
+	req = withUser(req, "Alice", "alice@test.com")
+	w := httptest.NewRecorder()
+	h.handleCreateInvite(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result map[string]string
+	json.NewDecoder(w.Body).Decode(&result)
+	token := strings.TrimPrefix(result["invite_url"], "http://localhost:8080/invite/")
+	if len(token) != 22 {
+		t.Errorf("invite_url = %q, want a 22-character token", result["invite_url"])
+	}
+	if inv, err := h.DB.GetInviteByToken(token); err != nil || inv.ProjectID != p.ID {
+		t.Errorf("short token doesn't resolve: %v", err)
+	}
+}
+
 func TestHandleCreateInviteDBError(t *testing.T) {
 	h := mockHandler(t, func(m *mockDB) { m.createInviteErr = errDB })
 	p, _ := h.DB.CreateProject("proj", "a@t.com")
@@ -85,13 +110,58 @@ func TestHandleListMembers(t *testing.T) {
 	if w.Code != 200 {
 		t.Fatalf("expected 200, got %d", w.Code)
 	}
-	var members []map[string]string
+	var members []map[string]any
 	json.NewDecoder(w.Body).Decode(&members)
-	if len(members) != 1 {
-		t.Fatalf("expected 1 member, got %d", len(members))
+	if len(members) != 2 {
+		t.Fatalf("expected owner and 1 member, got %d", len(members))
 	}
-	if members[0]["email"] != "bob@test.com" {
-		t.Errorf("email = %q, want bob@test.com", members[0]["email"])
+	if members[1]["email"] != "bob@test.com" || members[1]["role"] != "member" {
+		t.Errorf("member = %v, want bob@test.com", members[1])
+	}
+}
+
+func TestHandleListMembersIncludesOwner(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+	h.DB.AddMember(p.ID, "bob@test.com")
+	// The owner may also have a row in the members table.
+	h.DB.AddMember(p.ID, "alice@test.com")
+	h.DB.AddMember(p.ID, "carol@test.com")
+	h.DB.SetMemberRole(p.ID, "carol@test.com", "owner")
+
+	req := httptest.NewRequest("GET", "/api/projects/"+p.ID+"/members", nil)
+	req.SetPathValue("id", p.ID)
+	w := httptest.NewRecorder()
+	h.handleListMembers(w, req)
+
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var members []struct {
+		Email   string `json:"email"`
+		Role    string `json:"role"`
+		Primary bool   `json:"primary"`
+	}
+	json.NewDecoder(w.Body).Decode(&members)
+	owners := 0
+	for _, m := range members {
+		if m.Email == "alice@test.com" {
+			owners++
+			if m.Role != "owner" || !m.Primary {
+				t.Errorf("owner entry = %+v, want primary owner", m)
+			}
+		} else if m.Primary {
+			t.Errorf("%s should not be primary", m.Email)
+		}
+	}
+	if owners != 1 {
+		t.Errorf("owner listed %d times, want once", owners)
+	}
+	if len(members) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", members)
+	}
+	if members[2].Email != "carol@test.com" || members[2].Role != "owner" {
+		t.Errorf("co-owner = %+v", members[2])
 	}
 }
 
@@ -107,17 +177,18 @@ func TestHandleListMembersEmpty(t *testing.T) {
 	if w.Code != 200 {
 		t.Fatalf("expected 200, got %d", w.Code)
 	}
-	var members []map[string]string
+	var members []map[string]any
 	json.NewDecoder(w.Body).Decode(&members)
-	if len(members) != 0 {
-		t.Errorf("expected 0 members, got %d", len(members))
+	if len(members) != 1 || members[0]["email"] != "alice@test.com" {
+		t.Errorf("expected only the owner, got %v", members)
 	}
 }
 
 func TestHandleListMembersDBError(t *testing.T) {
 	h := mockHandler(t, func(m *mockDB) { m.listMembersErr = errDB })
-	req := httptest.NewRequest("GET", "/api/projects/x/members", nil)
-	req.SetPathValue("id", "x")
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+	req := httptest.NewRequest("GET", "/api/projects/"+p.ID+"/members", nil)
+	req.SetPathValue("id", p.ID)
 	w := httptest.NewRecorder()
 	h.handleListMembers(w, req)
 	if w.Code != 500 {
@@ -162,6 +233,51 @@ func TestHandleRemoveMemberCannotRemoveOwner(t *testing.T) {
 	}
 }
 
+func TestHandleLeaveProject(t *testing.T) {
+	h := setupAuthHandler(t)
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+	h.DB.AddMember(p.ID, "bob@test.com")
+	h.DB.CreateToken("bob-token", "Bob", "bob@test.com")
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	leave := func() int {
+		req := httptest.NewRequest("DELETE", "/api/projects/"+p.ID+"/membership", nil)
+		req.Header.Set("Authorization", "Bearer bob-token")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := leave(); code != 204 {
+		t.Fatalf("expected 204, got %d", code)
+	}
+	if members, _ := h.DB.ListMembers(p.ID); len(members) != 0 {
+		t.Errorf("expected 0 members after leaving, got %d", len(members))
+	}
+	// Having left, Bob can no longer reach the project at all.
+	if code := leave(); code != 404 {
+		t.Errorf("after leaving: expected 404, got %d", code)
+	}
+}
+
+func TestHandleLeaveProjectOwnerBlocked(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+
+	req := httptest.NewRequest("DELETE", "/api/projects/"+p.ID+"/membership", nil)
+	req.SetPathValue("id", p.ID)
+	req = withUser(req, "Alice", "alice@test.com")
+	w := httptest.NewRecorder()
+	h.handleLeaveProject(w, req)
+
+	if w.Code != 400 {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+	if owner, _ := h.DB.GetProjectOwner(p.ID); owner != "alice@test.com" {
+		t.Errorf("owner changed to %q", owner)
+	}
+}
+
 func TestHandleAcceptInvite(t *testing.T) {
 	h := setupTestHandler(t)
 	p, _ := h.DB.CreateProject("proj", "alice@test.com")
@@ -196,8 +312,11 @@ func TestHandleAcceptInviteInvalidToken(t *testing.T) {
 	w := httptest.NewRecorder()
 	h.handleAcceptInvite(w, req)
 
-	if w.Code != 200 {
-		t.Fatalf("expected 200 (error page), got %d", w.Code)
+	if w.Code != 404 {
+		t.Fatalf("expected 404 error page, got %d", w.Code)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("invalid or has expired")) {
+		t.Errorf("missing invite message: %s", w.Body.String())
 	}
 }
 
@@ -488,7 +607,7 @@ func TestVersionAccessMiddlewareVersionNotFound(t *testing.T) {
 // --- ownerOnly error path ---
 
 func TestOwnerOnlyMiddlewareDBError(t *testing.T) {
-	h := mockHandler(t, func(m *mockDB) { m.getProjectOwnerErr = errDB })
+	h := mockHandler(t, func(m *mockDB) { m.isOwnerErr = errDB })
 	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200) })
 	handler := h.ownerOnly(inner)
 	req := httptest.NewRequest("POST", "/api/projects/x/invites", nil)
@@ -618,16 +737,111 @@ func TestHandleListMembersHTMLInEmail(t *testing.T) {
 	if w.Code != 200 {
 		t.Fatalf("expected 200, got %d", w.Code)
 	}
-	var members []map[string]string
+	var members []map[string]any
 	json.NewDecoder(w.Body).Decode(&members)
-	if len(members) != 1 {
-		t.Fatalf("expected 1 member, got %d", len(members))
+	if len(members) != 2 {
+		t.Fatalf("expected owner and 1 member, got %d", len(members))
 	}
 	// API returns raw email in JSON — escaping is client-side
-	if members[0]["email"] != xss {
-		t.Errorf("email = %q, want %q", members[0]["email"], xss)
+	if members[1]["email"] != xss {
+		t.Errorf("email = %q, want %q", members[1]["email"], xss)
 	}
 }
 
 // Unused import guard
 var _ = context.Background
+
+// --- Co-owners ---
+
+func TestCoOwnerCanCreateInviteAndChangeStatus(t *testing.T) {
+	h := setupTestHandler(t)
+	h.Auth = &auth.Config{BaseURL: "http://localhost:8080"}
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+	h.DB.AddMember(p.ID, "carol@test.com")
+	if err := h.DB.SetMemberRole(p.ID, "carol@test.com", "owner"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/projects/"+p.ID+"/invites", nil)
+	req.SetPathValue("id", p.ID)
+	req = withUser(req, "Carol", "carol@test.com")
+	w := httptest.NewRecorder()
+	h.ownerOnly(http.HandlerFunc(h.handleCreateInvite)).ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("invite: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("PATCH", "/api/projects/"+p.ID+"/status", bytes.NewBufferString(`{"status":"approved"}`))
+	req.SetPathValue("id", p.ID)
+	req = withUser(req, "Carol", "carol@test.com")
+	w = httptest.NewRecorder()
+	h.ownerOnly(http.HandlerFunc(h.handleUpdateStatus)).ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("status: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPlainMemberCannotCreateInviteOrChangeStatus(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+	h.DB.AddMember(p.ID, "bob@test.com")
+
+	req := httptest.NewRequest("POST", "/api/projects/"+p.ID+"/invites", nil)
+	req.SetPathValue("id", p.ID)
+	req = withUser(req, "Bob", "bob@test.com")
+	w := httptest.NewRecorder()
+	h.ownerOnly(http.HandlerFunc(h.handleCreateInvite)).ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("invite: expected 403, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("PATCH", "/api/projects/"+p.ID+"/status", bytes.NewBufferString(`{"status":"approved"}`))
+	req.SetPathValue("id", p.ID)
+	req = withUser(req, "Bob", "bob@test.com")
+	w = httptest.NewRecorder()
+	h.ownerOnly(http.HandlerFunc(h.handleUpdateStatus)).ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("status: expected 403, got %d", w.Code)
+	}
+}
+
+func TestHandleSetMemberRole(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+	h.DB.AddMember(p.ID, "bob@test.com")
+
+	req := httptest.NewRequest("PUT", "/api/projects/"+p.ID+"/members/bob@test.com/role", bytes.NewBufferString(`{"role":"owner"}`))
+	req.SetPathValue("id", p.ID)
+	req.SetPathValue("email", "bob@test.com")
+	w := httptest.NewRecorder()
+	h.handleSetMemberRole(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ok, _ := h.DB.IsOwner(p.ID, "bob@test.com"); !ok {
+		t.Error("expected bob to be a co-owner")
+	}
+}
+
+func TestHandleSetMemberRoleInvalid(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+
+	for _, tc := range []struct {
+		email, body string
+		want        int
+	}{
+		{"bob@test.com", `{"role":"admin"}`, 400},
+		{"bob@test.com", `not json`, 400},
+		{"nobody@test.com", `{"role":"owner"}`, 404},
+	} {
+		req := httptest.NewRequest("PUT", "/api/projects/"+p.ID+"/members/"+tc.email+"/role", bytes.NewBufferString(tc.body))
+		req.SetPathValue("id", p.ID)
+		req.SetPathValue("email", tc.email)
+		w := httptest.NewRecorder()
+		h.handleSetMemberRole(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s %s: expected %d, got %d", tc.email, tc.body, tc.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"archive/zip"
+	"database/sql"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// siteIndexNames are the names tried, in order, for the landing page of a
+// static-site export; the design's own pages keep their names.
+var siteIndexNames = []string{"index.html", "site-index.html", "pages.html"}
+
+var siteIndexTmpl = template.Must(template.New("site-index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Project}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 40rem; margin: 3rem auto; padding: 0 1rem; color: #18181b; }
+h1 { font-size: 1.5rem; margin-bottom: 0.25rem; }
+p { color: #52525b; margin-top: 0; }
+li { margin: 0.4rem 0; }
+</style>
+</head>
+<body>
+<h1>{{.Project}}</h1>
+<p>Version {{.VersionNum}}</p>
+<ul>
+{{- range .Pages}}
+<li><a href="{{.Href}}">{{.Title}}</a></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+type siteIndexPage struct {
+	Href  string
+	Title string
+}
+
+// handleStaticSite downloads the latest version as a zip that can be
+// hosted anywhere: its files as uploaded, plus a generated landing page
+// linking every page in tab order.
+func (h *Handler) handleStaticSite(w http.ResponseWriter, r *http.Request) {
+	project, err := h.DB.GetProject(r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	version, err := h.DB.GetLatestVersion(project.ID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "project has no versions", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	pages, err := h.Storage.ListHTMLFiles(version.ID)
+	if err != nil {
+		serverError(w, "storage error", err)
+		return
+	}
+	order, err := h.DB.GetPageOrder(version.ID)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	pages = orderPages(pages, order)
+
+	indexName := ""
+	for _, name := range siteIndexNames {
+		if !slices.Contains(pages, name) {
+			indexName = name
+			break
+		}
+	}
+	if indexName == "" {
+		http.Error(w, "the design already uses every landing page name", http.StatusConflict)
+		return
+	}
+	links := make([]siteIndexPage, len(pages))
+	for i, p := range pages {
+		links[i] = siteIndexPage{Href: (&url.URL{Path: p}).String(), Title: p}
+		if title := version.PageTitles[p]; title != "" {
+			links[i].Title = title
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": project.Name + "-site.zip"}))
+	zw := zip.NewWriter(w)
+	err = h.writeVersionFiles(zw, version.ID, "")
+	if err == nil {
+		err = writeSiteIndex(zw, indexName, project.Name, version.VersionNum, links)
+	}
+	if err != nil {
+		// Headers are already sent; the truncated zip won't open.
+		log.Printf("ERROR: failed to export static site of project %s: %v", project.ID, err)
+		return
+	}
+	zw.Close()
+}
+
+func writeSiteIndex(zw *zip.Writer, name, project string, versionNum int, pages []siteIndexPage) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	return siteIndexTmpl.Execute(fw, struct {
+		Project    string
+		VersionNum int
+		Pages      []siteIndexPage
+	}{project, versionNum, pages})
+}
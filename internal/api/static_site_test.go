@@ -0,0 +1,99 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func staticSiteFiles(t *testing.T, h *Handler, projectID string) map[string]string {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/api/projects/"+projectID+"/static-site.zip", nil)
+	req.SetPathValue("id", projectID)
+	w := httptest.NewRecorder()
+	h.handleStaticSite(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+	}
+	return files
+}
+
+func TestHandleStaticSite(t *testing.T) {
+	h := setupTestHandler(t)
+	upload := func(files map[string]string) {
+		req := createUploadRequest(t, "site", makeZipForTest(t, files))
+		w := httptest.NewRecorder()
+		h.handleUpload(w, withUser(req, "Owner", "owner@test.com"))
+		if w.Code != 200 {
+			t.Fatalf("upload: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	upload(map[string]string{
+		"home.html":     "<html><head><title>Home</title></head><body>home</body></html>",
+		"about us.html": "<p>about</p>",
+		"css/site.css":  "p{}",
+	})
+	p, _ := h.DB.GetProjectByName("site")
+
+	files := staticSiteFiles(t, h, p.ID)
+	for _, name := range []string{"home.html", "about us.html", "css/site.css"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing %s in %v", name, files)
+		}
+	}
+	index := files["index.html"]
+	for _, want := range []string{`href="about%20us.html"`, `href="home.html"`, "Version 1"} {
+		if !strings.Contains(index, want) {
+			t.Errorf("generated index missing %q:\n%s", want, index)
+		}
+	}
+
+	// A design with its own index.html keeps it; the landing page moves aside.
+	upload(map[string]string{"index.html": "<p>design index</p>", "other.html": "<p>other</p>"})
+	files = staticSiteFiles(t, h, p.ID)
+	if files["index.html"] != "<p>design index</p>" {
+		t.Errorf("design's index.html was replaced: %q", files["index.html"])
+	}
+	if _, ok := files["home.html"]; ok {
+		t.Error("only the latest version's files should be exported")
+	}
+	landing := files["site-index.html"]
+	if !strings.Contains(landing, `href="index.html"`) || !strings.Contains(landing, `href="other.html"`) || !strings.Contains(landing, "Version 2") {
+		t.Errorf("landing page doesn't link the pages:\n%s", landing)
+	}
+}
+
+func TestHandleStaticSiteRequiresOwner(t *testing.T) {
+	h := setupAuthHandler(t)
+	p, _ := h.DB.CreateProject("private", "owner@test.com")
+	h.DB.AddMember(p.ID, "member@test.com")
+	h.DB.CreateToken("member-token", "Member", "member@test.com")
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	req := httptest.NewRequest("GET", "/api/projects/"+p.ID+"/static-site.zip", nil)
+	req.Header.Set("Authorization", "Bearer member-token")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("member: expected 403, got %d", w.Code)
+	}
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ab/design-reviewer/internal/auth"
+)
+
+func (h *Handler) handleGetSubscription(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("id")
+	_, email := auth.GetUserFromContext(r.Context())
+	subscribed, err := h.DB.IsSubscribed(projectID, email)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"subscribed": subscribed})
+}
+
+func (h *Handler) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("id")
+	_, email := auth.GetUserFromContext(r.Context())
+	if email == "" {
+		http.Error(w, "login required", http.StatusUnauthorized)
+		return
+	}
+	if err := h.DB.Subscribe(projectID, email); err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"subscribed": true})
+}
+
+func (h *Handler) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("id")
+	_, email := auth.GetUserFromContext(r.Context())
+	if err := h.DB.Unsubscribe(projectID, email); err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleSubscribe(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+
+	req := httptest.NewRequest("POST", "/api/projects/"+p.ID+"/subscription", nil)
+	req.SetPathValue("id", p.ID)
+	req = withUser(req, "Bob", "bob@test.com")
+	w := httptest.NewRecorder()
+	h.handleSubscribe(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/projects/"+p.ID+"/subscription", nil)
+	req.SetPathValue("id", p.ID)
+	req = withUser(req, "Bob", "bob@test.com")
+	w = httptest.NewRecorder()
+	h.handleGetSubscription(w, req)
+	var result map[string]bool
+	json.NewDecoder(w.Body).Decode(&result)
+	if !result["subscribed"] {
+		t.Error("expected subscribed=true")
+	}
+}
+
+func TestHandleSubscribeRequiresUser(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("proj", "")
+	req := httptest.NewRequest("POST", "/api/projects/"+p.ID+"/subscription", nil)
+	req.SetPathValue("id", p.ID)
+	w := httptest.NewRecorder()
+	h.handleSubscribe(w, req)
+	if w.Code != 401 {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
+
+func TestHandleSubscribeDBError(t *testing.T) {
+	h := mockHandler(t, func(m *mockDB) { m.subscribeErr = errDB })
+	p, _ := h.DB.CreateProject("proj", "a@t.com")
+	req := httptest.NewRequest("POST", "/api/projects/"+p.ID+"/subscription", nil)
+	req.SetPathValue("id", p.ID)
+	req = withUser(req, "A", "a@t.com")
+	w := httptest.NewRecorder()
+	h.handleSubscribe(w, req)
+	if w.Code != 500 {
+		t.Errorf("expected 500, got %d", w.Code)
+	}
+}
+
+func TestHandleUnsubscribe(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+	h.DB.Subscribe(p.ID, "bob@test.com")
+
+	req := httptest.NewRequest("DELETE", "/api/projects/"+p.ID+"/subscription", nil)
+	req.SetPathValue("id", p.ID)
+	req = withUser(req, "Bob", "bob@test.com")
+	w := httptest.NewRecorder()
+	h.handleUnsubscribe(w, req)
+	if w.Code != 204 {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if ok, _ := h.DB.IsSubscribed(p.ID, "bob@test.com"); ok {
+		t.Error("expected unsubscribed")
+	}
+}
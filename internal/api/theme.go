@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// themeCookie holds the visitor's explicit theme choice. Without it the
+// pages follow the system preference (see static/theme.js).
+const themeCookie = "theme"
+
+// themeOf returns the theme chosen in the request's cookie, "dark" or
+// "light", or "" when there is no valid choice.
+func themeOf(r *http.Request) string {
+	c, err := r.Cookie(themeCookie)
+	if err != nil {
+		return ""
+	}
+	switch c.Value {
+	case "dark", "light":
+		return c.Value
+	}
+	return ""
+}
+
+// handleSetTheme stores the theme posted by the toggle and sends the
+// visitor back to the page they came from. "system" clears the choice.
+func (h *Handler) handleSetTheme(w http.ResponseWriter, r *http.Request) {
+	switch theme := r.FormValue("theme"); theme {
+	case "dark", "light":
+		http.SetCookie(w, &http.Cookie{
+			Name:     themeCookie,
+			Value:    theme,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+			MaxAge:   365 * 24 * 60 * 60,
+		})
+	case "system":
+		http.SetCookie(w, &http.Cookie{Name: themeCookie, Value: "", Path: "/", MaxAge: -1})
+	default:
+		http.Error(w, "invalid theme", http.StatusBadRequest)
+		return
+	}
+
+	back := h.link("/")
+	if ref, err := url.Parse(r.Referer()); err == nil && ref.Host == r.Host && ref.Path != "" {
+		back = ref.RequestURI()
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestThemeCookieRendersDataTheme(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, _ := seedProject(t, h, map[string]string{"index.html": "x"})
+
+	render := func(path string, handler http.HandlerFunc, cookie string) string {
+		req := httptest.NewRequest("GET", path, nil)
+		req.SetPathValue("id", pid)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: themeCookie, Value: cookie})
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Body.String()
+	}
+
+	for _, page := range []struct {
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"/", h.handleHome},
+		{"/projects/" + pid, h.handleViewer},
+		{"/login", h.handleLoginPage},
+	} {
+		for cookie, want := range map[string]string{
+			"dark":  `<html lang="en" data-theme="dark">`,
+			"light": `<html lang="en" data-theme="light">`,
+			"":      `<html lang="en">`,
+			"pink":  `<html lang="en">`,
+		} {
+			if body := render(page.path, page.handler, cookie); !strings.Contains(body, want) {
+				t.Errorf("%s with theme %q: missing %s", page.path, cookie, want)
+			}
+		}
+	}
+}
+
+func TestHandleSetTheme(t *testing.T) {
+	h := setupTestHandler(t)
+	post := func(theme, referer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/theme", strings.NewReader(url.Values{"theme": {theme}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if referer != "" {
+			req.Header.Set("Referer", referer)
+		}
+		w := httptest.NewRecorder()
+		h.handleSetTheme(w, req)
+		return w
+	}
+
+	w := post("light", "http://example.com/projects/abc?version=2")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/projects/abc?version=2" {
+		t.Errorf("got %d to %q, want 303 back to the page", w.Code, w.Header().Get("Location"))
+	}
+	c := w.Result().Cookies()
+	if len(c) != 1 || c[0].Name != themeCookie || c[0].Value != "light" {
+		t.Errorf("cookies = %v", c)
+	}
+
+	// Other sites' referers aren't followed.
+	if w := post("dark", "http://evil.test/x"); w.Header().Get("Location") != "/" {
+		t.Errorf("foreign referer: redirected to %q", w.Header().Get("Location"))
+	}
+
+	w = post("system", "")
+	if c := w.Result().Cookies(); len(c) != 1 || c[0].MaxAge >= 0 {
+		t.Errorf("system should clear the cookie, got %v", c)
+	}
+
+	if w := post("pink", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid theme: got %d", w.Code)
+	}
+}
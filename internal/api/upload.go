@@ -1,21 +1,58 @@
 package api
 
 import (
+	"archive/zip"
 	"bytes"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
+	"mime"
 	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/ab/design-reviewer/internal/auth"
+	"github.com/ab/design-reviewer/internal/db"
+	"github.com/ab/design-reviewer/internal/storage"
 )
 
+const maxUploadSize = 50 << 20 // 50 MB
+
+// checksumHeader carries the hex SHA-256 of the uploaded file, so an upload
+// corrupted in transit is rejected rather than stored.
+const checksumHeader = "X-Upload-SHA256"
+
+// verifyChecksum checks data against the checksumHeader, when the client
+// sent one, and returns the verified checksum ("" without the header). On a
+// malformed header or a mismatch it writes a 400 and returns false.
+func verifyChecksum(w http.ResponseWriter, r *http.Request, data []byte) (string, bool) {
+	want := strings.ToLower(strings.TrimSpace(r.Header.Get(checksumHeader)))
+	if want == "" {
+		return "", true
+	}
+	if b, err := hex.DecodeString(want); err != nil || len(b) != sha256.Size {
+		http.Error(w, "invalid "+checksumHeader+": must be a hex SHA-256", http.StatusBadRequest)
+		return "", false
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		http.Error(w, fmt.Sprintf("upload checksum mismatch: got %s, expected %s; the file was corrupted in transit, try again", got, want), http.StatusBadRequest)
+		return "", false
+	}
+	return want, true
+}
+
 func (h *Handler) handleUpload(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, 50<<20) // 50 MB
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
 
-	file, _, err := r.FormFile("file")
+	file, fileHeader, err := r.FormFile("file")
 	if err != nil {
 		var maxErr *http.MaxBytesError
 		if errors.As(err, &maxErr) {
@@ -28,7 +65,8 @@ func (h *Handler) handleUpload(w http.ResponseWriter, r *http.Request) {
 	defer file.Close()
 
 	name := r.FormValue("name")
-	if name == "" {
+	projectID := r.FormValue("project_id")
+	if name == "" && projectID == "" {
 		http.Error(w, "missing name field", http.StatusBadRequest)
 		return
 	}
@@ -39,16 +77,162 @@ func (h *Handler) handleUpload(w http.ResponseWriter, r *http.Request) {
 		serverError(w, "failed to read file", err)
 		return
 	}
+	checksum, ok := verifyChecksum(w, r, buf.Bytes())
+	if !ok {
+		return
+	}
+	design, err := designZip(fileHeader.Filename, fileHeader.Header.Get("Content-Type"), buf.Bytes())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	canvas, err := parseCanvasSize(r.FormValue("width"), r.FormValue("height"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Record where the upload came from for debugging bad pushes
+	source := r.FormValue("source")
+	if source == "" {
+		source = r.UserAgent()
+	}
+	h.createVersionFromZip(w, r, name, projectID, fileHeader.Filename, source, checksum, canvas, design)
+}
+
+// designZip returns the zip to store for an uploaded file. Zips are used
+// as they are; a single HTML page, recognized by its extension or content
+// type, is wrapped into a zip holding just index.html. Anything else is an
+// error for the uploader.
+func designZip(filename, contentType string, data []byte) (*bytes.Buffer, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if ext == ".html" || ext == ".htm" || mediaType == "text/html" {
+		return zipSinglePage(data)
+	}
+	if !bytes.HasPrefix(data, []byte("PK")) {
+		return nil, errors.New("upload must be a .zip of the design or a single .html file")
+	}
+	return bytes.NewBuffer(data), nil
+}
+
+// zipSinglePage wraps one HTML page in a zip as index.html, after checking
+// that the content really is HTML.
+func zipSinglePage(page []byte) (*bytes.Buffer, error) {
+	if !strings.HasPrefix(http.DetectContentType(page), "text/html") {
+		return nil, errors.New("file is not HTML; upload a .zip for other content")
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, err := zw.Create("index.html")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(page); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// DefaultMaxPagesPerUpload is well above any hand-made design; exports
+// with more pages make the viewer's tab bar too slow to use.
+const DefaultMaxPagesPerUpload = 300
+
+// countZipPages counts the pages in a design zip: the .html and .htm files
+// at its root, as the viewer lists them. An unreadable zip counts as none
+// and is rejected when it is stored.
+func countZipPages(data []byte) int {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, f := range zr.File {
+		ext := strings.ToLower(path.Ext(f.Name))
+		if !strings.Contains(f.Name, "/") && (ext == ".html" || ext == ".htm") {
+			n++
+		}
+	}
+	return n
+}
+
+// canvasSize is the frame size, in CSS pixels, a design was made for.
+// Zero leaves a dimension unspecified.
+type canvasSize struct {
+	Width, Height int
+}
+
+// maxCanvasSize bounds the width and height an upload may ask for.
+const maxCanvasSize = 10000
+
+// parseCanvasSize reads the optional width and height upload fields.
+func parseCanvasSize(width, height string) (canvasSize, error) {
+	var c canvasSize
+	for _, f := range []struct {
+		name, value string
+		dst         *int
+	}{{"width", width, &c.Width}, {"height", height, &c.Height}} {
+		if f.value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(f.value)
+		if err != nil || n < 1 || n > maxCanvasSize {
+			return canvasSize{}, fmt.Errorf("%s must be between 1 and %d", f.name, maxCanvasSize)
+		}
+		*f.dst = n
+	}
+	return c, nil
+}
 
+// createVersionFromZip stores an uploaded zip as a new version of the named
+// project, creating the project if needed, and writes the JSON response.
+// A non-empty projectID targets that project directly and name is ignored.
+// A canvas size given with the upload overrides the one in design.json, and
+// a non-empty checksum is the verified SHA-256 of the upload.
+func (h *Handler) createVersionFromZip(w http.ResponseWriter, r *http.Request, name, projectID, filename, source, checksum string, canvas canvasSize, buf *bytes.Buffer) {
 	_, email := auth.GetUserFromContext(r.Context())
 
+	limit := h.MaxPagesPerUpload
+	if limit <= 0 {
+		limit = DefaultMaxPagesPerUpload
+	}
+	if n := countZipPages(buf.Bytes()); n > limit {
+		http.Error(w, fmt.Sprintf("upload has %d pages, more than the limit of %d; split the design into several projects", n, limit), http.StatusBadRequest)
+		return
+	}
+
+	if projectID != "" {
+		project, err := h.DB.GetProject(projectID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			serverError(w, "database error", err)
+			return
+		}
+		if email != "" {
+			if ok, err := h.DB.CanWriteProject(project.ID, email); err != nil || !ok {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+		}
+		h.saveVersion(w, project, email, filename, source, checksum, canvas, buf)
+		return
+	}
+
 	// Get or create project
 	project, err := h.DB.GetProjectByName(name)
 	if err == sql.ErrNoRows {
 		project, err = h.DB.CreateProject(name, email)
 	} else if err == nil && email != "" {
-		// Check access for existing project
-		ok, aErr := h.DB.CanAccessProject(project.ID, email)
+		// Only owners and members push to an existing project; seeing it
+		// through its visibility isn't enough.
+		ok, aErr := h.DB.CanWriteProject(project.ID, email)
 		if aErr != nil || !ok {
 			http.Error(w, "not found", http.StatusNotFound)
 			return
@@ -58,28 +242,135 @@ func (h *Handler) handleUpload(w http.ResponseWriter, r *http.Request) {
 		serverError(w, "database error", err)
 		return
 	}
+	h.saveVersion(w, project, email, filename, source, checksum, canvas, buf)
+}
+
+// maxVersionAttempts bounds how many times createVersion retries when
+// parallel pushes to one project race for the same version number.
+const maxVersionAttempts = 5
+
+// createVersion creates the next version of a project, retrying if a
+// concurrent push takes the number first.
+func (h *Handler) createVersion(projectID, email string) (*db.Version, error) {
+	for attempt := 1; ; attempt++ {
+		v, err := h.DB.CreateVersionBy(projectID, "", email)
+		if !errors.Is(err, db.ErrVersionConflict) || attempt == maxVersionAttempts {
+			return v, err
+		}
+	}
+}
 
+// saveVersion adds the zip as a new version of project and writes the
+// upload response.
+func (h *Handler) saveVersion(w http.ResponseWriter, project *db.Project, email, filename, source, checksum string, canvas canvasSize, buf *bytes.Buffer) {
 	// Create version
-	version, err := h.DB.CreateVersion(project.ID, "")
+	version, err := h.createVersion(project.ID, email)
+	if errors.Is(err, db.ErrVersionConflict) {
+		http.Error(w, "too many simultaneous pushes to this project, try again", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		serverError(w, "failed to create version", err)
 		return
 	}
 
 	// Save zip to storage
-	if err := h.Storage.SaveUpload(version.ID, &buf); err != nil {
+	if err := h.Storage.SaveUpload(version.ID, buf); err != nil {
+		var noHTML *storage.NoHTMLError
+		if errors.As(err, &noHTML) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error":       noHTML.Error(),
+				"required":    ".html",
+				"found_types": noHTML.Found,
+			})
+			return
+		}
 		http.Error(w, fmt.Sprintf("failed to save upload: %v", err), http.StatusBadRequest)
 		return
 	}
 
+	if err := h.DB.SetVersionUploadInfo(version.ID, filename, source); err != nil {
+		log.Printf("WARN: failed to record upload info for version %s: %v", version.ID, err)
+	}
+	if checksum != "" {
+		if err := h.DB.SetVersionChecksum(version.ID, checksum); err != nil {
+			log.Printf("WARN: failed to record checksum for version %s: %v", version.ID, err)
+		}
+	}
+
+	// Uploads using JavaScript are accepted, but the uploader is told.
+	warnings, err := h.Storage.ScriptWarnings(version.ID)
+	if err != nil {
+		log.Printf("WARN: failed to scan version %s for scripts: %v", version.ID, err)
+	}
+	// So are pages that would render blank.
+	if markup, err := h.Storage.MarkupWarnings(version.ID); err != nil {
+		log.Printf("WARN: failed to scan version %s for broken pages: %v", version.ID, err)
+	} else {
+		warnings = append(warnings, markup...)
+	}
+	if warning := h.applyManifest(version.ID, canvas); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	if len(warnings) > 0 {
+		if err := h.DB.SetVersionWarnings(version.ID, warnings); err != nil {
+			log.Printf("WARN: failed to record warnings for version %s: %v", version.ID, err)
+		}
+	} else {
+		warnings = []string{}
+	}
+
 	// Update project's updated_at
 	h.DB.UpdateProjectStatus(project.ID, project.Status)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{
+	res := map[string]any{
 		"project_id":  project.ID,
 		"version_id":  version.ID,
 		"version_num": version.VersionNum,
-		"url":         fmt.Sprintf("/projects/%s", project.ID),
-	})
+		"url":         h.link("/projects/" + project.ID),
+		"warnings":    warnings,
+	}
+	// Unresolved comments carry over, so CI can gate on what is still open.
+	// The version is already saved, so a failed count only drops the field.
+	if open, err := h.DB.GetUnresolvedCommentsUpTo(version.ID); err != nil {
+		log.Printf("WARN: failed to count open comments for version %s: %v", version.ID, err)
+	} else {
+		res["open_comment_count"] = len(open)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// applyManifest stores the page order, titles and canvas size from the
+// upload's design.json, if there is one, with any dimension in canvas taking
+// precedence. A bad manifest doesn't fail the upload; it is skipped and the
+// returned warning tells the uploader why.
+func (h *Handler) applyManifest(versionID string, canvas canvasSize) string {
+	m, err := h.Storage.ReadManifest(versionID)
+	warning := ""
+	if err != nil {
+		warning = fmt.Sprintf("%s was ignored: %v", storage.ManifestFile, err)
+	} else if m != nil {
+		if err := h.DB.SetPageOrder(versionID, m.Order()); err != nil {
+			log.Printf("WARN: failed to record page order for version %s: %v", versionID, err)
+		}
+		if err := h.DB.SetPageTitles(versionID, m.Titles()); err != nil {
+			log.Printf("WARN: failed to record page titles for version %s: %v", versionID, err)
+		}
+		if canvas.Width == 0 {
+			canvas.Width = m.Width
+		}
+		if canvas.Height == 0 {
+			canvas.Height = m.Height
+		}
+	}
+	if canvas != (canvasSize{}) {
+		if err := h.DB.SetCanvasSize(versionID, canvas.Width, canvas.Height); err != nil {
+			log.Printf("WARN: failed to record canvas size for version %s: %v", versionID, err)
+		}
+	}
+	return warning
 }
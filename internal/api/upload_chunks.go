@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ab/design-reviewer/internal/auth"
+	"github.com/ab/design-reviewer/internal/storage"
+)
+
+// partialUploadTTL is how long an abandoned chunked upload is kept before
+// being swept on the next init.
+const partialUploadTTL = 24 * time.Hour
+
+func (h *Handler) handleUploadInit(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		Name      string `json:"name"`
+		ProjectID string `json:"project_id"`
+		Filename  string `json:"filename"`
+		Source    string `json:"source"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" && req.ProjectID == "" {
+		http.Error(w, "missing name field", http.StatusBadRequest)
+		return
+	}
+	if req.Width < 0 || req.Width > maxCanvasSize || req.Height < 0 || req.Height > maxCanvasSize {
+		http.Error(w, "width and height must be between 1 and "+strconv.Itoa(maxCanvasSize), http.StatusBadRequest)
+		return
+	}
+	if req.Source == "" {
+		req.Source = r.UserAgent()
+	}
+
+	h.Storage.CleanupPartialUploads(partialUploadTTL)
+
+	_, email := auth.GetUserFromContext(r.Context())
+	p, err := h.Storage.CreatePartialUpload(storage.PartialUpload{
+		Name:      req.Name,
+		ProjectID: req.ProjectID,
+		Filename:  req.Filename,
+		Source:    req.Source,
+		Width:     req.Width,
+		Height:    req.Height,
+		Owner:     email,
+	})
+	if err != nil {
+		serverError(w, "failed to start upload", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"upload_id": p.ID,
+		"max_size":  maxUploadSize,
+	})
+}
+
+// partialUploadForRequest loads the upload named in the path and checks it
+// belongs to the caller. It writes a 404 and returns nil otherwise.
+func (h *Handler) partialUploadForRequest(w http.ResponseWriter, r *http.Request) (*storage.PartialUpload, int64) {
+	p, size, err := h.Storage.GetPartialUpload(r.PathValue("uploadId"))
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, 0
+	}
+	_, email := auth.GetUserFromContext(r.Context())
+	if p.Owner != email {
+		http.NotFound(w, r)
+		return nil, 0
+	}
+	return p, size
+}
+
+func (h *Handler) handleUploadChunk(w http.ResponseWriter, r *http.Request) {
+	p, _ := h.partialUploadForRequest(w, r)
+	if p == nil {
+		return
+	}
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	received, err := h.Storage.AppendChunk(p.ID, offset, r.Body, maxUploadSize)
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case errors.Is(err, storage.ErrOffsetMismatch):
+		// Tell the client where to resume from
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), "received": received})
+		return
+	case errors.Is(err, storage.ErrUploadTooLarge):
+		h.Storage.DeletePartialUpload(p.ID)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(map[string]string{"error": "upload exceeds 50MB limit"})
+		return
+	case err != nil:
+		serverError(w, "failed to write chunk", err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"received": received})
+}
+
+func (h *Handler) handleUploadComplete(w http.ResponseWriter, r *http.Request) {
+	p, _ := h.partialUploadForRequest(w, r)
+	if p == nil {
+		return
+	}
+	data, err := h.Storage.ReadPartialUpload(p.ID)
+	if err != nil {
+		serverError(w, "failed to read upload", err)
+		return
+	}
+	// The assembled zip goes through the normal path; a bad zip won't get
+	// better by retrying, so the partial data is dropped either way.
+	defer h.Storage.DeletePartialUpload(p.ID)
+	checksum, ok := verifyChecksum(w, r, data)
+	if !ok {
+		return
+	}
+	design, err := designZip(p.Filename, "", data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.createVersionFromZip(w, r, p.Name, p.ProjectID, p.Filename, p.Source, checksum, canvasSize{p.Width, p.Height}, design)
+}
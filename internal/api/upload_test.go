@@ -3,14 +3,22 @@ package api
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/ab/design-reviewer/internal/auth"
+	"github.com/ab/design-reviewer/internal/db"
+	"github.com/ab/design-reviewer/internal/storage"
 )
 
 func TestHandleUploadSuccess(t *testing.T) {
@@ -47,6 +55,149 @@ func TestHandleUploadSuccess(t *testing.T) {
 	}
 }
 
+func TestHandleUploadSingleHTML(t *testing.T) {
+	h := setupTestHandler(t)
+	upload := func(filename, content string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("name", "one-pager")
+		fw, _ := mw.CreateFormFile("file", filename)
+		fw.Write([]byte(content))
+		mw.Close()
+		req := httptest.NewRequest("POST", "/api/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		h.handleUpload(w, req)
+		return w
+	}
+
+	w := upload("landing.html", "<!DOCTYPE html><html><body><h1>Launch</h1></body></html>")
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var res map[string]any
+	json.NewDecoder(w.Body).Decode(&res)
+	vid := res["version_id"].(string)
+	pages, _ := h.Storage.ListHTMLFiles(vid)
+	if strings.Join(pages, ",") != "index.html" {
+		t.Errorf("pages = %v, want [index.html]", pages)
+	}
+	req := httptest.NewRequest("GET", "/designs/"+vid+"/index.html", nil)
+	req.SetPathValue("version_id", vid)
+	req.SetPathValue("filepath", "index.html")
+	rec := httptest.NewRecorder()
+	h.handleDesignFile(rec, req)
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), "Launch") {
+		t.Errorf("design file: got %d %q", rec.Code, rec.Body.String())
+	}
+
+	// Files that aren't HTML (or a zip) are rejected without creating a version.
+	for filename, content := range map[string]string{
+		"fake.html": "\x89PNG\r\n\x1a\n\x00\x00",
+		"notes.txt": "just some notes",
+	} {
+		if w := upload(filename, content); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", filename, w.Code)
+		}
+	}
+	project, _ := h.DB.GetProjectByName("one-pager")
+	if versions, _ := h.DB.ListVersions(project.ID); len(versions) != 1 {
+		t.Errorf("rejected uploads created versions: %d", len(versions))
+	}
+}
+
+// conflictDB fails CreateVersionBy with a version-number conflict the given
+// number of times, as if a parallel push had won the race.
+type conflictDB struct {
+	DataStore
+	conflicts int
+}
+
+func (c *conflictDB) CreateVersionBy(projectID, storagePath, createdBy string) (*db.Version, error) {
+	if c.conflicts > 0 {
+		c.conflicts--
+		return nil, db.ErrVersionConflict
+	}
+	return c.DataStore.CreateVersionBy(projectID, storagePath, createdBy)
+}
+
+func TestHandleUploadRetriesVersionConflict(t *testing.T) {
+	h := setupTestHandler(t)
+	cdb := &conflictDB{DataStore: h.DB, conflicts: maxVersionAttempts - 1}
+	h.DB = cdb
+	zipData := makeZipForTest(t, map[string]string{"index.html": "x"})
+
+	w := httptest.NewRecorder()
+	h.handleUpload(w, createUploadRequest(t, "retry", zipData))
+	if w.Code != 200 {
+		t.Fatalf("expected 200 after retrying, got %d: %s", w.Code, w.Body.String())
+	}
+
+	cdb.conflicts = maxVersionAttempts
+	w = httptest.NewRecorder()
+	h.handleUpload(w, createUploadRequest(t, "retry", zipData))
+	if w.Code != 409 {
+		t.Errorf("expected 409 once retries run out, got %d", w.Code)
+	}
+}
+
+func TestHandleUploadConcurrentVersionNumbers(t *testing.T) {
+	tmp := t.TempDir()
+	// A file database, so the uploads really run on separate connections.
+	database, err := db.New(filepath.Join(tmp, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	h := &Handler{DB: database, Storage: storage.New(filepath.Join(tmp, "uploads"))}
+	p, _ := database.CreateProject("busy", "")
+	zipData := makeZipForTest(t, map[string]string{"index.html": "x"})
+
+	const n = 8
+	var wg sync.WaitGroup
+	nums := make(chan int, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			mw.WriteField("project_id", p.ID)
+			fw, _ := mw.CreateFormFile("file", "upload.zip")
+			fw.Write(zipData)
+			mw.Close()
+			req := httptest.NewRequest("POST", "/api/upload", &body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			w := httptest.NewRecorder()
+			h.handleUpload(w, req)
+			if w.Code != 200 {
+				t.Errorf("upload failed: %d %s", w.Code, w.Body.String())
+				return
+			}
+			var res struct {
+				VersionNum int `json:"version_num"`
+			}
+			json.NewDecoder(w.Body).Decode(&res)
+			nums <- res.VersionNum
+		}()
+	}
+	wg.Wait()
+	close(nums)
+
+	seen := map[int]bool{}
+	for num := range nums {
+		if seen[num] {
+			t.Errorf("version number %d handed out twice", num)
+		}
+		seen[num] = true
+	}
+	for i := 1; i <= n; i++ {
+		if !seen[i] {
+			t.Errorf("version number %d missing; got %v", i, seen)
+		}
+	}
+}
+
 func TestHandleUploadMissingFile(t *testing.T) {
 	h := setupTestHandler(t)
 	var body bytes.Buffer
@@ -185,6 +336,49 @@ func TestHandleDesignFileNotFound(t *testing.T) {
 	}
 }
 
+func TestHandlePageHTML(t *testing.T) {
+	h := setupTestHandler(t)
+	page := "<!DOCTYPE html>\n<html><body><h1>About  us</h1><script>x()</script></body></html>\n"
+	_, vid := seedProject(t, h, map[string]string{
+		"about.html":      page,
+		"style.css":       "body{}",
+		"docs/inner.html": "<p>nested</p>",
+	})
+
+	get := func(p string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/versions/"+vid+"/pages/x/html", nil)
+		req.SetPathValue("id", vid)
+		req.SetPathValue("page", p)
+		w := httptest.NewRecorder()
+		h.handlePageHTML(w, req)
+		return w
+	}
+
+	w := get("about.html")
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if w.Body.String() != page {
+		t.Errorf("body = %q, want the stored HTML", w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if csp := w.Header().Get("Content-Security-Policy"); csp != "sandbox" {
+		t.Errorf("Content-Security-Policy = %q, want sandbox", csp)
+	}
+
+	// Unknown pages, and files that aren't pages, are not found.
+	for _, p := range []string{"missing.html", "style.css", "docs/inner.html"} {
+		if w := get(p); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", p, w.Code)
+		}
+	}
+	if w := get("../../etc/passwd"); w.Code != http.StatusBadRequest {
+		t.Errorf("traversal: expected 400, got %d", w.Code)
+	}
+}
+
 func TestHandleDesignFilePathTraversal(t *testing.T) {
 	h := setupTestHandler(t)
 	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
@@ -322,6 +516,37 @@ func TestHandleUploadJustUnderLimit(t *testing.T) {
 	}
 }
 
+func TestHandleUploadPageLimit(t *testing.T) {
+	h := setupTestHandler(t)
+	h.MaxPagesPerUpload = 3
+
+	pages := func(n int) map[string]string {
+		files := map[string]string{"assets/nested.html": "not a page", "style.css": "body{}"}
+		for i := 0; i < n; i++ {
+			files[fmt.Sprintf("page%d.html", i)] = "<h1>page</h1>"
+		}
+		return files
+	}
+
+	w := httptest.NewRecorder()
+	h.handleUpload(w, createUploadRequest(t, "many-pages", makeZipForTest(t, pages(4))))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("over the limit: expected 400, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "4 pages, more than the limit of 3") {
+		t.Errorf("unclear error: %q", w.Body.String())
+	}
+	if _, err := h.DB.GetProjectByName("many-pages"); err == nil {
+		t.Error("a rejected upload shouldn't create the project")
+	}
+
+	w = httptest.NewRecorder()
+	h.handleUpload(w, createUploadRequest(t, "many-pages", makeZipForTest(t, pages(3))))
+	if w.Code != 200 {
+		t.Errorf("at the limit: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
 // --- DB error path tests for upload ---
 
 func TestHandleUploadCreateProjectDBError(t *testing.T) {
@@ -399,3 +624,409 @@ func TestHandleUploadExistingProjectAccessDBError(t *testing.T) {
 		t.Errorf("expected 404, got %d: %s", w.Code, w.Body.String())
 	}
 }
+
+// --- Chunked uploads ---
+
+func TestChunkedUploadTwoChunks(t *testing.T) {
+	h := setupTestHandler(t)
+	zipData := makeZipForTest(t, map[string]string{"index.html": "<h1>chunked</h1>", "about.html": "<p>about</p>"})
+
+	req := httptest.NewRequest("POST", "/api/upload/init", strings.NewReader(`{"name":"chunky","filename":"chunky.zip"}`))
+	req = withUser(req, "Alice", "alice@test.com")
+	w := httptest.NewRecorder()
+	h.handleUploadInit(w, req)
+	if w.Code != 200 {
+		t.Fatalf("init: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var initResp map[string]any
+	json.NewDecoder(w.Body).Decode(&initResp)
+	uploadID := initResp["upload_id"].(string)
+
+	half := len(zipData) / 2
+	for _, chunk := range []struct {
+		offset int
+		data   []byte
+	}{{0, zipData[:half]}, {half, zipData[half:]}} {
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/api/upload/%s/chunk?offset=%d", uploadID, chunk.offset), bytes.NewReader(chunk.data))
+		req.SetPathValue("uploadId", uploadID)
+		req = withUser(req, "Alice", "alice@test.com")
+		w := httptest.NewRecorder()
+		h.handleUploadChunk(w, req)
+		if w.Code != 200 {
+			t.Fatalf("chunk at %d: expected 200, got %d: %s", chunk.offset, w.Code, w.Body.String())
+		}
+	}
+
+	req = httptest.NewRequest("POST", "/api/upload/"+uploadID+"/complete", nil)
+	req.SetPathValue("uploadId", uploadID)
+	req = withUser(req, "Alice", "alice@test.com")
+	w = httptest.NewRecorder()
+	h.handleUploadComplete(w, req)
+	if w.Code != 200 {
+		t.Fatalf("complete: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]any
+	json.NewDecoder(w.Body).Decode(&resp)
+	vid := resp["version_id"].(string)
+	pages, _ := h.Storage.ListHTMLFiles(vid)
+	if len(pages) != 2 {
+		t.Errorf("expected 2 pages, got %v", pages)
+	}
+	v, _ := h.DB.GetVersion(vid)
+	if v.UploadFilename != "chunky.zip" || v.CreatedByEmail != "alice@test.com" {
+		t.Errorf("unexpected version info: %+v", v)
+	}
+	if _, _, err := h.Storage.GetPartialUpload(uploadID); err == nil {
+		t.Error("partial upload should be removed after completion")
+	}
+}
+
+func TestChunkedUploadOffsetMismatch(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.Storage.CreatePartialUpload(storage.PartialUpload{Name: "x"})
+
+	req := httptest.NewRequest("PUT", "/api/upload/"+p.ID+"/chunk?offset=5", strings.NewReader("abc"))
+	req.SetPathValue("uploadId", p.ID)
+	w := httptest.NewRecorder()
+	h.handleUploadChunk(w, req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", w.Code)
+	}
+	var resp map[string]any
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["received"] != float64(0) {
+		t.Errorf("expected received=0, got %v", resp["received"])
+	}
+}
+
+func TestChunkedUploadOtherUserNotFound(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.Storage.CreatePartialUpload(storage.PartialUpload{Name: "x", Owner: "alice@test.com"})
+
+	req := httptest.NewRequest("PUT", "/api/upload/"+p.ID+"/chunk?offset=0", strings.NewReader("abc"))
+	req.SetPathValue("uploadId", p.ID)
+	req = withUser(req, "Mallory", "mallory@test.com")
+	w := httptest.NewRecorder()
+	h.handleUploadChunk(w, req)
+	if w.Code != 404 {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestChunkedUploadInitMissingName(t *testing.T) {
+	h := setupTestHandler(t)
+	req := httptest.NewRequest("POST", "/api/upload/init", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	h.handleUploadInit(w, req)
+	if w.Code != 400 {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestHandleUploadScriptWarnings(t *testing.T) {
+	h := setupTestHandler(t)
+
+	upload := func(name string, files map[string]string) map[string]any {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("name", name)
+		fw, _ := mw.CreateFormFile("file", "upload.zip")
+		fw.Write(makeZipForTest(t, files))
+		mw.Close()
+		req := httptest.NewRequest("POST", "/api/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		h.handleUpload(w, req)
+		if w.Code != 200 {
+			t.Fatalf("%s: expected 200, got %d: %s", name, w.Code, w.Body.String())
+		}
+		var res map[string]any
+		json.NewDecoder(w.Body).Decode(&res)
+		return res
+	}
+
+	res := upload("scripted", map[string]string{"index.html": `<h1>hi</h1><script src="app.js"></script>`})
+	warnings, _ := res["warnings"].([]any)
+	if len(warnings) != 1 || !strings.Contains(warnings[0].(string), "<script>") {
+		t.Fatalf("expected a script warning, got %v", res["warnings"])
+	}
+	v, _ := h.DB.GetVersion(res["version_id"].(string))
+	if len(v.Warnings) != 1 {
+		t.Errorf("warnings should be stored on the version, got %v", v.Warnings)
+	}
+
+	res = upload("clean", map[string]string{"index.html": "<h1>hi</h1>"})
+	if warnings, ok := res["warnings"].([]any); !ok || len(warnings) != 0 {
+		t.Errorf("clean upload: expected empty warnings, got %v", res["warnings"])
+	}
+}
+
+func TestHandleUploadMarkupWarnings(t *testing.T) {
+	h := setupTestHandler(t)
+	upload := func(name string, files map[string]string) []any {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("name", name)
+		fw, _ := mw.CreateFormFile("file", "upload.zip")
+		fw.Write(makeZipForTest(t, files))
+		mw.Close()
+		req := httptest.NewRequest("POST", "/api/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		h.handleUpload(w, req)
+		if w.Code != 200 {
+			t.Fatalf("%s: expected 200, got %d: %s", name, w.Code, w.Body.String())
+		}
+		var res map[string]any
+		json.NewDecoder(w.Body).Decode(&res)
+		warnings, _ := res["warnings"].([]any)
+		return warnings
+	}
+
+	warnings := upload("broken", map[string]string{
+		"index.html": "<h1>hi</h1>",
+		"empty.html": "",
+		"image.html": "\x89PNG\r\n\x1a\n\x00",
+	})
+	if len(warnings) != 2 || !strings.HasPrefix(warnings[0].(string), "empty.html ") || !strings.HasPrefix(warnings[1].(string), "image.html ") {
+		t.Errorf("expected warnings for the empty and binary pages, got %v", warnings)
+	}
+
+	if warnings := upload("valid", map[string]string{"index.html": "<!DOCTYPE html><html><body><h1>hi</h1></body></html>", "about.html": "<p>about"}); len(warnings) != 0 {
+		t.Errorf("valid pages: expected no warnings, got %v", warnings)
+	}
+}
+
+func TestHandleUploadByProjectID(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("renamed", "owner@test.com")
+	h.DB.CreateProject("someone-elses", "other@test.com")
+
+	upload := func(projectID string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("project_id", projectID)
+		fw, _ := mw.CreateFormFile("file", "upload.zip")
+		fw.Write(makeZipForTest(t, map[string]string{"index.html": "x"}))
+		mw.Close()
+		req := httptest.NewRequest("POST", "/api/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req = withUser(req, "Owner", "owner@test.com")
+		w := httptest.NewRecorder()
+		h.handleUpload(w, req)
+		return w
+	}
+
+	w := upload(p.ID)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var res map[string]any
+	json.NewDecoder(w.Body).Decode(&res)
+	if res["project_id"] != p.ID || res["version_num"].(float64) != 1 {
+		t.Errorf("unexpected response: %v", res)
+	}
+	if versions, _ := h.DB.ListVersions(p.ID); len(versions) != 1 {
+		t.Errorf("expected 1 version on project, got %d", len(versions))
+	}
+
+	other, _ := h.DB.GetProjectByName("someone-elses")
+	for _, id := range []string{other.ID, "no-such-project"} {
+		if w := upload(id); w.Code != 404 {
+			t.Errorf("%s: expected 404, got %d", id, w.Code)
+		}
+	}
+	if versions, _ := h.DB.ListVersions(other.ID); len(versions) != 0 {
+		t.Error("inaccessible project should not get a version")
+	}
+}
+
+func TestHandleUploadCanvasSize(t *testing.T) {
+	h := setupTestHandler(t)
+
+	upload := func(name string, fields map[string]string, files map[string]string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("name", name)
+		for k, v := range fields {
+			mw.WriteField(k, v)
+		}
+		fw, _ := mw.CreateFormFile("file", "upload.zip")
+		fw.Write(makeZipForTest(t, files))
+		mw.Close()
+		req := httptest.NewRequest("POST", "/api/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		h.handleUpload(w, req)
+		return w
+	}
+	viewer := func(w *httptest.ResponseRecorder) string {
+		var res map[string]any
+		json.NewDecoder(w.Body).Decode(&res)
+		pid := res["project_id"].(string)
+		req := httptest.NewRequest("GET", "/projects/"+pid, nil)
+		req.SetPathValue("id", pid)
+		rec := httptest.NewRecorder()
+		h.handleViewer(rec, req)
+		return rec.Body.String()
+	}
+
+	// From the form fields.
+	w := upload("fields", map[string]string{"width": "390", "height": "844"}, map[string]string{"index.html": "x"})
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if body := viewer(w); !strings.Contains(body, `style="width: 390px; min-width: 390px; min-height: 844px"`) {
+		t.Errorf("viewer frame not sized from upload fields")
+	}
+
+	// From design.json, with the width field taking precedence.
+	files := map[string]string{"index.html": "x", "design.json": `{"width":1440,"height":900}`}
+	w = upload("manifest", map[string]string{"width": "1280"}, files)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if body := viewer(w); !strings.Contains(body, `style="width: 1280px; min-width: 1280px; min-height: 900px"`) {
+		t.Errorf("expected upload width with manifest height")
+	}
+	p, _ := h.DB.GetProjectByName("manifest")
+	if v, _ := h.DB.GetLatestVersion(p.ID); v.CanvasWidth != 1280 || v.CanvasHeight != 900 {
+		t.Errorf("stored canvas = %dx%d", v.CanvasWidth, v.CanvasHeight)
+	}
+
+	// Unset falls back to the default width.
+	w = upload("plain", nil, map[string]string{"index.html": "x"})
+	if body := viewer(w); !strings.Contains(body, `style="width: 1080px; min-width: 1080px"`) {
+		t.Errorf("expected the default width")
+	}
+
+	for _, bad := range []string{"0", "-5", "wide", "99999"} {
+		if w := upload("bad", map[string]string{"width": bad}, map[string]string{"index.html": "x"}); w.Code != 400 {
+			t.Errorf("width %q: expected 400, got %d", bad, w.Code)
+		}
+	}
+}
+
+func TestHandleUploadManifest(t *testing.T) {
+	h := setupTestHandler(t)
+
+	upload := func(name string, files map[string]string) (projectID string, warnings []any) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("name", name)
+		fw, _ := mw.CreateFormFile("file", "upload.zip")
+		fw.Write(makeZipForTest(t, files))
+		mw.Close()
+		req := httptest.NewRequest("POST", "/api/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		h.handleUpload(w, req)
+		if w.Code != 200 {
+			t.Fatalf("%s: expected 200, got %d: %s", name, w.Code, w.Body.String())
+		}
+		var res map[string]any
+		json.NewDecoder(w.Body).Decode(&res)
+		warnings, _ = res["warnings"].([]any)
+		return res["project_id"].(string), warnings
+	}
+	tabs := func(projectID string) string {
+		req := httptest.NewRequest("GET", "/projects/"+projectID, nil)
+		req.SetPathValue("id", projectID)
+		w := httptest.NewRecorder()
+		h.handleViewer(w, req)
+		body := w.Body.String()
+		start := strings.Index(body, `id="page-tabs"`)
+		end := strings.Index(body[start:], "</div>")
+		return body[start : start+end]
+	}
+	pages := map[string]string{"index.html": "i", "Frame_12.html": "f12", "Frame_3.html": "f3"}
+
+	withManifest := map[string]string{"design.json": `{"pages":[{"file":"Frame_3.html","title":"Checkout"},{"file":"Frame_12.html","title":"Home"}]}`}
+	for k, v := range pages {
+		withManifest[k] = v
+	}
+	pid, warnings := upload("manifest", withManifest)
+	if len(warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+	got := tabs(pid)
+	checkout := strings.Index(got, `data-page="Frame_3.html">Checkout<`)
+	home := strings.Index(got, `data-page="Frame_12.html">Home<`)
+	index := strings.Index(got, `data-page="index.html">index.html<`)
+	if checkout < 0 || home < 0 || index < 0 || !(checkout < home && home < index) {
+		t.Errorf("tabs should follow the manifest with titles, got:\n%s", got)
+	}
+	if !strings.Contains(got, `page-tab active" data-page="Frame_3.html"`) {
+		t.Error("first manifest page should be shown on load")
+	}
+
+	pid, _ = upload("no-manifest", pages)
+	got = tabs(pid)
+	if !strings.Contains(got, `data-page="index.html">index.html<`) || !strings.Contains(got, `data-page="Frame_12.html">Frame_12.html<`) {
+		t.Errorf("without a manifest tabs should show file names, got:\n%s", got)
+	}
+
+	bad := map[string]string{"design.json": `{"pages":[`}
+	for k, v := range pages {
+		bad[k] = v
+	}
+	pid, warnings = upload("bad-manifest", bad)
+	if len(warnings) != 1 || !strings.Contains(warnings[0].(string), "design.json was ignored") {
+		t.Errorf("expected a manifest warning, got %v", warnings)
+	}
+	if got := tabs(pid); !strings.Contains(got, `data-page="index.html">index.html<`) {
+		t.Errorf("bad manifest should fall back to file names, got:\n%s", got)
+	}
+}
+
+func TestHandleUploadChecksum(t *testing.T) {
+	h := setupTestHandler(t)
+	zipData := makeZipForTest(t, map[string]string{"index.html": "<h1>sum</h1>"})
+	sum := sha256.Sum256(zipData)
+	good := hex.EncodeToString(sum[:])
+
+	for _, tc := range []struct {
+		name, header string
+		want         int
+	}{
+		{"matching", strings.ToUpper(good), 200},
+		{"mismatch", strings.Repeat("0", 64), 400},
+		{"malformed", "not-a-sum", 400},
+	} {
+		req := createUploadRequest(t, tc.name, zipData)
+		req.Header.Set("X-Upload-SHA256", tc.header)
+		w := httptest.NewRecorder()
+		h.handleUpload(w, req)
+		if w.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.name, tc.want, w.Code, w.Body.String())
+		}
+		if tc.want != 200 {
+			if _, err := h.DB.GetProjectByName(tc.name); err == nil {
+				t.Errorf("%s: rejected upload should not create a project", tc.name)
+			}
+			continue
+		}
+		var resp map[string]any
+		json.NewDecoder(w.Body).Decode(&resp)
+		v, _ := h.DB.GetVersion(resp["version_id"].(string))
+		if v.UploadSHA256 != good {
+			t.Errorf("%s: stored checksum = %q, want %q", tc.name, v.UploadSHA256, good)
+		}
+	}
+}
+
+func TestChunkedUploadChecksumMismatch(t *testing.T) {
+	h := setupTestHandler(t)
+	zipData := makeZipForTest(t, map[string]string{"index.html": "<h1>chunked</h1>"})
+	p, _ := h.Storage.CreatePartialUpload(storage.PartialUpload{Name: "chunky"})
+	h.Storage.AppendChunk(p.ID, 0, bytes.NewReader(zipData), maxUploadSize)
+
+	req := httptest.NewRequest("POST", "/api/upload/"+p.ID+"/complete", nil)
+	req.SetPathValue("uploadId", p.ID)
+	req.Header.Set("X-Upload-SHA256", strings.Repeat("0", 64))
+	w := httptest.NewRecorder()
+	h.handleUploadComplete(w, req)
+	if w.Code != 400 || !strings.Contains(w.Body.String(), "checksum mismatch") {
+		t.Errorf("expected 400 checksum mismatch, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,14 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ab/design-reviewer/internal/version"
+)
+
+func (h *Handler) handleVersion(w http.ResponseWriter, r *http.Request) {
+	v, commit := version.Info()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"version": v, "commit": commit})
+}
@@ -1,43 +1,372 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/ab/design-reviewer/internal/auth"
+	"github.com/ab/design-reviewer/internal/db"
 )
 
+// queryInt parses a non-negative integer query parameter, returning def
+// when it is absent.
+func queryInt(r *http.Request, name string, def int) (int, bool) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil && n >= 0
+}
+
+// handleListVersions lists a project's versions, newest first. ?limit and
+// ?offset page through them (the total is in X-Total-Count), and
+// ?include_pages=false leaves out each version's page list.
 func (h *Handler) handleListVersions(w http.ResponseWriter, r *http.Request) {
 	projectID := r.PathValue("id")
+	_, email := auth.GetUserFromContext(r.Context())
 
-	versions, err := h.DB.ListVersions(projectID)
+	limit, ok := queryInt(r, "limit", 0)
+	if !ok {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	offset, ok := queryInt(r, "offset", 0)
+	if !ok {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return
+	}
+	includePages := true
+	if v := r.URL.Query().Get("include_pages"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid include_pages", http.StatusBadRequest)
+			return
+		}
+		includePages = b
+	}
+
+	versions, total, err := h.DB.ListVersionsPage(projectID, limit, offset)
 	if err != nil {
 		serverError(w, "database error", err)
 		return
 	}
 
 	type versionJSON struct {
-		ID         string   `json:"id"`
-		VersionNum int      `json:"version_num"`
-		CreatedAt  string   `json:"created_at"`
-		Pages      []string `json:"pages"`
+		ID             string            `json:"id"`
+		VersionNum     int               `json:"version_num"`
+		CreatedAt      string            `json:"created_at"`
+		Pages          *[]string         `json:"pages,omitempty"`
+		UploadFilename string            `json:"upload_filename,omitempty"`
+		UploadSource   string            `json:"upload_source,omitempty"`
+		UploadSHA256   string            `json:"upload_sha256,omitempty"`
+		CreatedBy      string            `json:"created_by_email,omitempty"`
+		Warnings       []string          `json:"warnings,omitempty"`
+		PageTitles     map[string]string `json:"page_titles,omitempty"`
+		CanvasWidth    int               `json:"canvas_width,omitempty"`
+		CanvasHeight   int               `json:"canvas_height,omitempty"`
+		Pinned         bool              `json:"pinned,omitempty"`
+	}
+
+	// Upload details are only shown to project owners, and who pushed a
+	// version only to signed-in users who can access the project.
+	isOwner, _ := h.DB.IsOwner(projectID, email)
+	showUploader := email != "" && h.Auth == nil
+	if email != "" && h.Auth != nil {
+		showUploader, _ = h.DB.CanAccessProject(projectID, email)
 	}
+	pinned, _ := h.DB.GetPinnedVersion(projectID)
 
 	out := make([]versionJSON, len(versions))
 	for i, v := range versions {
-		pages, _ := h.Storage.ListHTMLFiles(v.ID)
-		sort.Strings(pages)
-		if pages == nil {
-			pages = []string{}
-		}
 		out[i] = versionJSON{
-			ID:         v.ID,
-			VersionNum: v.VersionNum,
-			CreatedAt:  v.CreatedAt.Format(time.RFC3339),
-			Pages:      pages,
+			ID:           v.ID,
+			VersionNum:   v.VersionNum,
+			CreatedAt:    v.CreatedAt.Format(time.RFC3339),
+			Warnings:     v.Warnings,
+			PageTitles:   v.PageTitles,
+			CanvasWidth:  v.CanvasWidth,
+			CanvasHeight: v.CanvasHeight,
+			Pinned:       v.ID == pinned,
+		}
+		if showUploader {
+			out[i].CreatedBy = v.CreatedByEmail
+		}
+		if includePages {
+			pages, _ := h.Storage.ListHTMLFiles(v.ID)
+			order, _ := h.DB.GetPageOrder(v.ID)
+			pages = orderPages(pages, order)
+			if pages == nil {
+				pages = []string{}
+			}
+			out[i].Pages = &pages
+		}
+		if isOwner {
+			out[i].UploadFilename = v.UploadFilename
+			out[i].UploadSource = v.UploadSource
+			out[i].UploadSHA256 = v.UploadSHA256
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	json.NewEncoder(w).Encode(out)
+}
+
+// orderPages returns pages in tab order: those named in order first, in that
+// order, then the rest with the index page leading and the others sorted.
+// Names in order that aren't in pages are skipped.
+func orderPages(pages, order []string) []string {
+	rest := make(map[string]bool, len(pages))
+	for _, p := range pages {
+		rest[p] = true
+	}
+	out := make([]string, 0, len(pages))
+	for _, p := range order {
+		if rest[p] {
+			out = append(out, p)
+			delete(rest, p)
+		}
+	}
+	tail := make([]string, 0, len(rest))
+	for p := range rest {
+		tail = append(tail, p)
+	}
+	sort.Slice(tail, func(i, j int) bool {
+		if ri, rj := indexRank(tail[i]), indexRank(tail[j]); ri != rj {
+			return ri < rj
+		}
+		return tail[i] < tail[j]
+	})
+	if len(out) == 0 && len(tail) == 0 {
+		return nil
+	}
+	return append(out, tail...)
+}
+
+// projectVersion looks up a version of projectID, writing a 404 if it
+// doesn't exist or belongs to another project.
+func (h *Handler) projectVersion(w http.ResponseWriter, r *http.Request, projectID, versionID string) (*db.Version, bool) {
+	v, err := h.DB.GetVersion(versionID)
+	if err == sql.ErrNoRows || (err == nil && v.ProjectID != projectID) {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return nil, false
+	}
+	return v, true
+}
+
+// handleVersionDiff summarises how comments changed from one version to a
+// later one: comments left on the versions after from, comments that were
+// open at from and have since been resolved, and those still open.
+func (h *Handler) handleVersionDiff(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("id")
+	from, ok := h.projectVersion(w, r, projectID, r.PathValue("from"))
+	if !ok {
+		return
+	}
+	to, ok := h.projectVersion(w, r, projectID, r.PathValue("to"))
+	if !ok {
+		return
+	}
+	if from.VersionNum > to.VersionNum {
+		http.Error(w, "from must not be newer than to", http.StatusBadRequest)
+		return
+	}
+
+	versions, err := h.DB.ListVersions(projectID)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	// Unresolved comments up to from carry over, so they are still open.
+	open, err := h.DB.GetUnresolvedCommentsUpTo(from.ID)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	var added, resolved []db.Comment
+	for _, v := range versions {
+		if v.VersionNum > to.VersionNum {
+			continue
+		}
+		comments, err := h.DB.GetCommentsForVersion(v.ID)
+		if err != nil {
+			serverError(w, "database error", err)
+			return
+		}
+		for _, c := range comments {
+			switch {
+			case v.VersionNum > from.VersionNum:
+				added = append(added, c)
+			// Comments resolved before from was pushed were already closed
+			// there. Without a recorded time, count the resolution as new.
+			case c.Resolved && (c.ResolvedAt == nil || !c.ResolvedAt.Before(from.CreatedAt)):
+				resolved = append(resolved, c)
+			}
 		}
 	}
 
+	var out struct {
+		From      string        `json:"from"`
+		To        string        `json:"to"`
+		New       []commentJSON `json:"new"`
+		Resolved  []commentJSON `json:"resolved"`
+		StillOpen []commentJSON `json:"still_open"`
+	}
+	out.From, out.To = from.ID, to.ID
+	if out.New, err = h.toCommentJSON(added); err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	if out.Resolved, err = h.toCommentJSON(resolved); err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	if out.StillOpen, err = h.toCommentJSON(open); err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// indexRank ranks a page as the default: index.html itself, then other
+// spellings exports produce such as Index.HTML or index.htm, then the rest.
+func indexRank(page string) int {
+	switch {
+	case page == "index.html":
+		return 0
+	case strings.EqualFold(page, "index.html"), strings.EqualFold(page, "index.htm"):
+		return 1
+	}
+	return 2
+}
+
+func (h *Handler) handleSetPageOrder(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("id")
+	versionID := r.PathValue("versionID")
+
+	v, err := h.DB.GetVersion(versionID)
+	if err == sql.ErrNoRows || (err == nil && v.ProjectID != projectID) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		Pages []string `json:"pages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	pages, err := h.Storage.ListHTMLFiles(versionID)
+	if err != nil {
+		serverError(w, "storage error", err)
+		return
+	}
+	known := make(map[string]bool, len(pages))
+	for _, p := range pages {
+		known[p] = true
+	}
+	seen := make(map[string]bool, len(req.Pages))
+	for _, p := range req.Pages {
+		if !known[p] {
+			http.Error(w, fmt.Sprintf("unknown page %q", p), http.StatusBadRequest)
+			return
+		}
+		if seen[p] {
+			http.Error(w, fmt.Sprintf("page %q listed twice", p), http.StatusBadRequest)
+			return
+		}
+		seen[p] = true
+	}
+
+	if err := h.DB.SetPageOrder(versionID, req.Pages); err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"pages": orderPages(pages, req.Pages)})
+}
+
+// handleSetPinnedVersion pins the version the project's viewer opens by
+// default. An empty version_id unpins, so the viewer opens the latest.
+func (h *Handler) handleSetPinnedVersion(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("id")
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		VersionID string `json:"version_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	err := h.DB.SetPinnedVersion(projectID, req.VersionID)
+	if err == db.ErrVersionNotInProject {
+		http.Error(w, "version is not one of this project's", http.StatusBadRequest)
+		return
+	}
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"version_id": req.VersionID})
+}
+
+func (h *Handler) handleListVersionFiles(w http.ResponseWriter, r *http.Request) {
+	versionID := r.PathValue("id")
+	if _, err := h.DB.GetVersion(versionID); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	files, err := h.Storage.ListAllFiles(versionID)
+	if err != nil {
+		serverError(w, "failed to list files", err)
+		return
+	}
+
+	type fileJSON struct {
+		Path        string `json:"path"`
+		Size        int64  `json:"size"`
+		ContentType string `json:"content_type"`
+	}
+	out := make([]fileJSON, len(files))
+	for i, f := range files {
+		out[i] = fileJSON{Path: f.Path, Size: f.Size, ContentType: f.ContentType}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(out)
 }
@@ -1,9 +1,14 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"mime/multipart"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/ab/design-reviewer/internal/db"
 )
 
 func TestHandleListVersionsEmpty(t *testing.T) {
@@ -54,6 +59,65 @@ func TestHandleListVersionsOrdered(t *testing.T) {
 	}
 }
 
+func TestHandleListVersionsPaging(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("ver-page", "")
+	for i := 0; i < 5; i++ {
+		h.DB.CreateVersion(p.ID, "")
+	}
+
+	list := func(query string) ([]map[string]any, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest("GET", "/api/projects/"+p.ID+"/versions"+query, nil)
+		req.SetPathValue("id", p.ID)
+		w := httptest.NewRecorder()
+		h.handleListVersions(w, req)
+		var versions []map[string]any
+		json.NewDecoder(w.Body).Decode(&versions)
+		return versions, w
+	}
+
+	versions, w := list("?limit=2&offset=1")
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if len(versions) != 2 || versions[0]["version_num"].(float64) != 4 || versions[1]["version_num"].(float64) != 3 {
+		t.Errorf("unexpected page: %v", versions)
+	}
+	if got := w.Header().Get("X-Total-Count"); got != "5" {
+		t.Errorf("X-Total-Count = %q, want 5", got)
+	}
+
+	if versions, _ := list("?offset=4"); len(versions) != 1 || versions[0]["version_num"].(float64) != 1 {
+		t.Errorf("offset only: unexpected page: %v", versions)
+	}
+
+	for _, q := range []string{"?limit=-1", "?offset=x", "?include_pages=maybe"} {
+		if _, w := list(q); w.Code != 400 {
+			t.Errorf("%s: expected 400, got %d", q, w.Code)
+		}
+	}
+}
+
+func TestHandleListVersionsOmitPages(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, _ := seedProject(t, h, map[string]string{"index.html": "x"})
+
+	for query, wantPages := range map[string]bool{"": true, "?include_pages=false": false} {
+		req := httptest.NewRequest("GET", "/api/projects/"+pid+"/versions"+query, nil)
+		req.SetPathValue("id", pid)
+		w := httptest.NewRecorder()
+		h.handleListVersions(w, req)
+		var versions []map[string]any
+		json.NewDecoder(w.Body).Decode(&versions)
+		if len(versions) != 1 {
+			t.Fatalf("%q: expected 1 version, got %d", query, len(versions))
+		}
+		if _, ok := versions[0]["pages"]; ok != wantPages {
+			t.Errorf("%q: pages present = %v, want %v", query, ok, wantPages)
+		}
+	}
+}
+
 func TestHandleListVersionsResponseFormat(t *testing.T) {
 	h := setupTestHandler(t)
 	p, _ := h.DB.CreateProject("ver-fmt", "")
@@ -89,3 +153,238 @@ func TestHandleListVersionsDBError(t *testing.T) {
 		t.Errorf("expected 500, got %d", w.Code)
 	}
 }
+
+func TestHandleListVersionsUploadInfoForOwner(t *testing.T) {
+	h := setupTestHandler(t)
+	z := makeZipForTest(t, map[string]string{"index.html": "x"})
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("name", "upinfo")
+	mw.WriteField("source", "ci-bot")
+	fw, _ := mw.CreateFormFile("file", "homepage.zip")
+	fw.Write(z)
+	mw.Close()
+	req := httptest.NewRequest("POST", "/api/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req = withUser(req, "Owner", "owner@test.com")
+	w := httptest.NewRecorder()
+	h.handleUpload(w, req)
+	if w.Code != 200 {
+		t.Fatalf("upload: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var up map[string]any
+	json.NewDecoder(w.Body).Decode(&up)
+	pid := up["project_id"].(string)
+
+	list := func(email string) map[string]any {
+		req := httptest.NewRequest("GET", "/api/projects/"+pid+"/versions", nil)
+		req.SetPathValue("id", pid)
+		req = withUser(req, "U", email)
+		w := httptest.NewRecorder()
+		h.handleListVersions(w, req)
+		var versions []map[string]any
+		json.NewDecoder(w.Body).Decode(&versions)
+		if len(versions) != 1 {
+			t.Fatalf("expected 1 version, got %d", len(versions))
+		}
+		return versions[0]
+	}
+
+	v := list("owner@test.com")
+	if v["upload_filename"] != "homepage.zip" {
+		t.Errorf("upload_filename = %v, want homepage.zip", v["upload_filename"])
+	}
+	if v["upload_source"] != "ci-bot" {
+		t.Errorf("upload_source = %v, want ci-bot", v["upload_source"])
+	}
+
+	h.DB.AddMember(pid, "member@test.com")
+	v = list("member@test.com")
+	if _, ok := v["upload_filename"]; ok {
+		t.Error("upload_filename should be hidden from non-owners")
+	}
+}
+
+func TestHandleListVersionsCreatedBy(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("shared", "owner@test.com")
+	h.DB.AddMember(p.ID, "member@test.com")
+
+	req := createUploadRequest(t, "shared", makeZipForTest(t, map[string]string{"index.html": "x"}))
+	req = withUser(req, "Member", "member@test.com")
+	w := httptest.NewRecorder()
+	h.handleUpload(w, req)
+	if w.Code != 200 {
+		t.Fatalf("upload: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/projects/"+p.ID+"/versions", nil)
+	req.SetPathValue("id", p.ID)
+	req = withUser(req, "Owner", "owner@test.com")
+	w = httptest.NewRecorder()
+	h.handleListVersions(w, req)
+	var versions []map[string]any
+	json.NewDecoder(w.Body).Decode(&versions)
+	if len(versions) != 1 {
+		t.Fatalf("expected 1 version, got %d", len(versions))
+	}
+	if versions[0]["created_by_email"] != "member@test.com" {
+		t.Errorf("created_by_email = %v, want member@test.com", versions[0]["created_by_email"])
+	}
+
+	// Anonymous visitors, e.g. through a share link, don't see who pushed.
+	req = httptest.NewRequest("GET", "/api/projects/"+p.ID+"/versions", nil)
+	req.SetPathValue("id", p.ID)
+	w = httptest.NewRecorder()
+	h.handleListVersions(w, req)
+	versions = nil
+	json.NewDecoder(w.Body).Decode(&versions)
+	if len(versions) != 1 {
+		t.Fatalf("anonymous: expected 1 version, got %d", len(versions))
+	}
+	if _, ok := versions[0]["created_by_email"]; ok {
+		t.Errorf("anonymous visitor sees created_by_email %v", versions[0]["created_by_email"])
+	}
+}
+
+func TestHandleListVersionFiles(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "<p>x</p>", "img/a.svg": "<svg/>"})
+
+	req := httptest.NewRequest("GET", "/api/versions/"+vid+"/files", nil)
+	req.SetPathValue("id", vid)
+	w := httptest.NewRecorder()
+	h.handleListVersionFiles(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var files []map[string]any
+	json.NewDecoder(w.Body).Decode(&files)
+	got := map[string]float64{}
+	for _, f := range files {
+		got[f["path"].(string)] = f["size"].(float64)
+	}
+	if got["index.html"] != 8 || got["img/a.svg"] != 6 {
+		t.Errorf("unexpected files: %+v", files)
+	}
+}
+
+func TestHandleListVersionFilesNotFound(t *testing.T) {
+	h := setupTestHandler(t)
+	req := httptest.NewRequest("GET", "/api/versions/nope/files", nil)
+	req.SetPathValue("id", "nope")
+	w := httptest.NewRecorder()
+	h.handleListVersionFiles(w, req)
+	if w.Code != 404 {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestOrderPages(t *testing.T) {
+	pages := []string{"b.html", "index.html", "a.html"}
+	cases := []struct {
+		order []string
+		want  string
+	}{
+		{nil, "index.html,a.html,b.html"},
+		{[]string{"b.html"}, "b.html,index.html,a.html"},
+		{[]string{"gone.html", "a.html", "b.html"}, "a.html,b.html,index.html"},
+	}
+	for _, c := range cases {
+		if got := strings.Join(orderPages(pages, c.order), ","); got != c.want {
+			t.Errorf("orderPages(%v) = %s, want %s", c.order, got, c.want)
+		}
+	}
+
+	got := strings.Join(orderPages([]string{"b.html", "Index.HTML", "a.html", "index.htm", "index.html"}, nil), ",")
+	if want := "index.html,Index.HTML,index.htm,a.html,b.html"; got != want {
+		t.Errorf("index variants = %s, want %s", got, want)
+	}
+}
+
+func TestHandleSetPageOrderValidation(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, vid := seedProject(t, h, map[string]string{"index.html": "i", "about.html": "a"})
+	other, _ := h.DB.CreateProject("other", "")
+
+	cases := []struct {
+		projectID, body string
+		want            int
+	}{
+		{pid, `{"pages":["missing.html"]}`, 400},
+		{pid, `{"pages":["about.html","about.html"]}`, 400},
+		{pid, `not json`, 400},
+		{other.ID, `{"pages":["about.html"]}`, 404},
+		{pid, `{"pages":[]}`, 200},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("PUT", "/api/projects/"+c.projectID+"/versions/"+vid+"/page-order", strings.NewReader(c.body))
+		req.SetPathValue("id", c.projectID)
+		req.SetPathValue("versionID", vid)
+		w := httptest.NewRecorder()
+		h.handleSetPageOrder(w, req)
+		if w.Code != c.want {
+			t.Errorf("%s: expected %d, got %d", c.body, c.want, w.Code)
+		}
+	}
+	if order, _ := h.DB.GetPageOrder(vid); order != nil {
+		t.Errorf("empty list should clear the order, got %v", order)
+	}
+}
+
+func TestHandleVersionDiff(t *testing.T) {
+	h := setupTestHandler(t)
+	p, _ := h.DB.CreateProject("diff-proj", "")
+	v1, _ := h.DB.CreateVersion(p.ID, "/tmp/v1")
+	h.DB.CreateComment(v1.ID, "index.html", 10, 10, "Alice", "a@t.com", "still open")
+	fixed, _ := h.DB.CreateComment(v1.ID, "index.html", 20, 20, "Alice", "a@t.com", "fixed in v2")
+	old, _ := h.DB.CreateComment(v1.ID, "index.html", 30, 30, "Alice", "a@t.com", "closed before v1")
+	h.DB.ToggleResolve(old.ID, "")
+	h.DB.(*db.DB).Exec(`UPDATE comments SET resolved_at = datetime('now', '-1 day') WHERE id = ?`, old.ID)
+	v2, _ := h.DB.CreateVersion(p.ID, "/tmp/v2")
+	h.DB.ToggleResolve(fixed.ID, "")
+	h.DB.CreateComment(v2.ID, "index.html", 40, 40, "Bob", "b@t.com", "new on v2")
+	other, _ := h.DB.CreateProject("other", "")
+	ov, _ := h.DB.CreateVersion(other.ID, "/tmp/o1")
+
+	diff := func(from, to string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/projects/"+p.ID+"/versions/"+from+"/diff/"+to, nil)
+		req.SetPathValue("id", p.ID)
+		req.SetPathValue("from", from)
+		req.SetPathValue("to", to)
+		w := httptest.NewRecorder()
+		h.handleVersionDiff(w, req)
+		return w
+	}
+
+	w := diff(v1.ID, v2.ID)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var got map[string][]commentJSON
+	json.NewDecoder(w.Body).Decode(&got)
+	bodies := func(cs []commentJSON) string {
+		var b []string
+		for _, c := range cs {
+			b = append(b, c.Body)
+		}
+		return strings.Join(b, ",")
+	}
+	if b := bodies(got["new"]); b != "new on v2" {
+		t.Errorf("new = %q", b)
+	}
+	if b := bodies(got["resolved"]); b != "fixed in v2" {
+		t.Errorf("resolved = %q", b)
+	}
+	if b := bodies(got["still_open"]); b != "still open" {
+		t.Errorf("still_open = %q", b)
+	}
+
+	if w := diff(v2.ID, v1.ID); w.Code != 400 {
+		t.Errorf("reversed range: expected 400, got %d", w.Code)
+	}
+	if w := diff(v1.ID, ov.ID); w.Code != 404 {
+		t.Errorf("other project's version: expected 404, got %d", w.Code)
+	}
+}
@@ -4,108 +4,244 @@ import (
 	"database/sql"
 	"html/template"
 	"net/http"
-	"sort"
 
 	"github.com/ab/design-reviewer/internal/auth"
+	"github.com/ab/design-reviewer/internal/db"
 )
 
+// pageTab is a page tab in the viewer. Title is the file name unless the
+// upload's manifest gave the page a title.
+type pageTab struct {
+	File  string
+	Title string
+}
+
+// defaultDesignWidth is the frame width designs are authored for unless the
+// version records its own canvas width (see the CLI's design guidelines).
+const defaultDesignWidth = 1080
+
+// viewportPreset is a device-size button in the viewer.
+type viewportPreset struct {
+	Name   string
+	Label  string
+	Width  int
+	Active bool
+}
+
+// viewportPresets returns the desktop, tablet and mobile frame sizes. The
+// design's own width replaces the preset for its device class and is
+// selected, so a 390px design opens at 390px under "Mobile".
+func viewportPresets(designWidth int) []viewportPreset {
+	presets := []viewportPreset{
+		{Name: "desktop", Label: "Desktop", Width: defaultDesignWidth},
+		{Name: "tablet", Label: "Tablet", Width: 768},
+		{Name: "mobile", Label: "Mobile", Width: 375},
+	}
+	i := 0
+	switch {
+	case designWidth < 600:
+		i = 2
+	case designWidth < 1024:
+		i = 1
+	}
+	presets[i].Width = designWidth
+	presets[i].Active = true
+	return presets
+}
+
 func (h *Handler) handleViewer(w http.ResponseWriter, r *http.Request) {
-	projectID := r.PathValue("id")
+	h.renderViewer(w, r, r.PathValue("id"), nil)
+}
+
+// handlePublicProjectViewer shows a public project to a visitor who isn't
+// signed in. Comments are read-only.
+func (h *Handler) handlePublicProjectViewer(w http.ResponseWriter, r *http.Request) {
+	h.renderViewer(w, r, r.PathValue("id"), &anonymousView{CommentMode: db.CommentModeReadOnly})
+}
+
+// anonymousView describes a viewer page for someone who isn't signed in:
+// a visitor of a public share link or of a public project.
+type anonymousView struct {
+	APIBase     string // prefix for API and design URLs; "" uses the normal routes
+	CommentMode string // one of the db.CommentMode values
+}
 
+// renderViewer renders the design viewer for a project. When anon is
+// non-nil the page is rendered for an anonymous visitor: API and design URLs
+// use anon.APIBase and owner controls are left out.
+func (h *Handler) renderViewer(w http.ResponseWriter, r *http.Request, projectID string, anon *anonymousView) {
 	project, err := h.DB.GetProject(projectID)
 	if err == sql.ErrNoRows {
-		http.NotFound(w, r)
+		h.notFound(w, r)
 		return
 	}
 	if err != nil {
-		serverError(w, "database error", err)
+		h.webServerError(w, r, "database error", err)
 		return
 	}
 
-	var version *struct {
-		ID         string
-		VersionNum int
+	latest, err := h.DB.GetLatestVersion(projectID)
+	if err == sql.ErrNoRows {
+		h.notFound(w, r)
+		return
+	}
+	if err != nil {
+		h.webServerError(w, r, "database error", err)
+		return
 	}
 
-	if vID := r.URL.Query().Get("version"); vID != "" {
+	// Without ?version= the viewer opens the owner's pinned version, if any.
+	pinned, err := h.DB.GetPinnedVersion(projectID)
+	if err != nil {
+		h.webServerError(w, r, "database error", err)
+		return
+	}
+	version := latest
+	vID := r.URL.Query().Get("version")
+	if vID == "" && pinned != "" {
+		vID = pinned
+	}
+	if vID != "" {
 		v, err := h.DB.GetVersion(vID)
-		if err == sql.ErrNoRows {
-			http.NotFound(w, r)
+		if err == sql.ErrNoRows || (err == nil && v.ProjectID != projectID) {
+			h.notFound(w, r)
 			return
 		}
 		if err != nil {
-			serverError(w, "database error", err)
+			h.webServerError(w, r, "database error", err)
 			return
 		}
-		version = &struct {
-			ID         string
-			VersionNum int
-		}{v.ID, v.VersionNum}
-	} else {
-		v, err := h.DB.GetLatestVersion(projectID)
-		if err == sql.ErrNoRows {
-			http.NotFound(w, r)
+		version = v
+	}
+
+	// ?comments_from= overlays another version's comments, e.g. an earlier
+	// version's open comments while checking the fixes for them.
+	commentsFrom := version
+	if cID := r.URL.Query().Get("comments_from"); cID != "" && cID != version.ID {
+		v, err := h.DB.GetVersion(cID)
+		if err == sql.ErrNoRows || (err == nil && v.ProjectID != projectID) {
+			h.notFound(w, r)
 			return
 		}
 		if err != nil {
-			serverError(w, "database error", err)
+			h.webServerError(w, r, "database error", err)
 			return
 		}
-		version = &struct {
-			ID         string
-			VersionNum int
-		}{v.ID, v.VersionNum}
+		commentsFrom = v
 	}
 
 	pages, err := h.Storage.ListHTMLFiles(version.ID)
 	if err != nil {
-		serverError(w, "storage error", err)
+		h.webServerError(w, r, "storage error", err)
 		return
 	}
-	sort.Strings(pages)
+	order, err := h.DB.GetPageOrder(version.ID)
+	if err != nil {
+		h.webServerError(w, r, "database error", err)
+		return
+	}
+	pages = orderPages(pages, order)
 
+	// The first tab is the page shown on load.
 	defaultPage := ""
 	if len(pages) > 0 {
 		defaultPage = pages[0]
-		for _, p := range pages {
-			if p == "index.html" {
-				defaultPage = "index.html"
-				break
-			}
+	}
+	tabs := make([]pageTab, len(pages))
+	for i, p := range pages {
+		tabs[i] = pageTab{File: p, Title: p}
+		if title := version.PageTitles[p]; title != "" {
+			tabs[i].Title = title
 		}
 	}
 
+	designWidth := version.CanvasWidth
+	if designWidth == 0 {
+		designWidth = defaultDesignWidth
+	}
+
 	tmpl, err := template.ParseFiles(h.TemplatesDir+"/layout.html", h.TemplatesDir+"/viewer.html")
 	if err != nil {
-		serverError(w, "template error", err)
+		h.webServerError(w, r, "template error", err)
 		return
 	}
 
+	apiBase, commentMode := h.BasePath, ""
+	viewerURL := h.link("/projects/" + project.ID)
+	if anon != nil {
+		apiBase, commentMode = h.link(anon.APIBase), anon.CommentMode
+		if anon.APIBase != "" {
+			viewerURL = apiBase
+		}
+	} else if h.Auth != nil {
+		// A signed-in user who sees the project only through its
+		// visibility can read the comments but not add to them.
+		_, email := auth.GetUserFromContext(r.Context())
+		if ok, _ := h.DB.CanWriteProject(project.ID, email); !ok {
+			commentMode = db.CommentModeReadOnly
+		}
+	}
+
 	data := struct {
-		ProjectName string
-		ProjectID   string
-		Status      string
-		StatusLabel string
-		VersionID   string
-		VersionNum  int
-		Pages       []string
-		DefaultPage string
-		UserName    string
-		IsOwner     bool
+		ProjectName  string
+		ProjectID    string
+		Status       string
+		StatusLabel  string
+		VersionID    string
+		VersionNum   int
+		CommentsFrom *db.Version
+		IsLatest     bool
+		IsPinned     bool
+		LatestID     string
+		LatestNum    int
+		Warnings     []string
+		Pages        []pageTab
+		DefaultPage  string
+		DesignWidth  int
+		DesignHeight int
+		Viewports    []viewportPreset
+		UserName     string
+		IsOwner      bool
+		Base         string
+		Brand        Branding
+		Theme        string
+		Public       bool
+		APIBase      string
+		ViewerURL    string
+		CommentMode  string
+		KeepAlive    int
 	}{
-		ProjectName: project.Name,
-		ProjectID:   project.ID,
-		Status:      project.Status,
-		StatusLabel: statusLabels[project.Status],
-		VersionID:   version.ID,
-		VersionNum:  version.VersionNum,
-		Pages:       pages,
-		DefaultPage: defaultPage,
-		UserName:    func() string { n, _ := auth.GetUserFromContext(r.Context()); return n }(),
+		ProjectName:  project.Name,
+		ProjectID:    project.ID,
+		Status:       project.Status,
+		StatusLabel:  statusLabels[project.Status],
+		VersionID:    version.ID,
+		VersionNum:   version.VersionNum,
+		CommentsFrom: commentsFrom,
+		IsLatest:     version.ID == latest.ID,
+		IsPinned:     version.ID == pinned,
+		LatestID:     latest.ID,
+		LatestNum:    latest.VersionNum,
+		Warnings:     version.Warnings,
+		Pages:        tabs,
+		DefaultPage:  defaultPage,
+		DesignWidth:  designWidth,
+		DesignHeight: version.CanvasHeight,
+		Viewports:    viewportPresets(designWidth),
+		UserName:     func() string { n, _ := auth.GetUserFromContext(r.Context()); return n }(),
 		IsOwner: func() bool {
 			_, e := auth.GetUserFromContext(r.Context())
-			return e != "" && project.OwnerEmail != nil && *project.OwnerEmail == e
+			ok, _ := h.DB.IsOwner(project.ID, e)
+			return anon == nil && ok
 		}(),
+		Base:        h.BasePath,
+		Brand:       h.brand(),
+		Theme:       themeOf(r),
+		Public:      anon != nil,
+		APIBase:     apiBase,
+		ViewerURL:   viewerURL,
+		CommentMode: commentMode,
+		KeepAlive:   h.keepAliveSeconds(),
 	}
 	tmpl.Execute(w, data)
 }
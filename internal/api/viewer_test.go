@@ -78,6 +78,33 @@ func TestHandleViewerDefaultPageFallback(t *testing.T) {
 	}
 }
 
+func TestHandleViewerIndexCaseInsensitive(t *testing.T) {
+	cases := []struct {
+		files map[string]string
+		want  string
+	}{
+		{map[string]string{"about.html": "a", "Index.HTML": "i"}, "Index.HTML"},
+		{map[string]string{"about.html": "a", "index.htm": "i"}, "index.htm"},
+		{map[string]string{"Index.html": "a", "index.html": "i"}, "index.html"},
+	}
+	for _, c := range cases {
+		h := setupTestHandler(t)
+		pid, vid := seedProject(t, h, c.files)
+
+		req := httptest.NewRequest("GET", "/projects/"+pid, nil)
+		req.SetPathValue("id", pid)
+		w := httptest.NewRecorder()
+		h.handleViewer(w, req)
+
+		if w.Code != 200 {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		if want := `src="/designs/` + vid + `/` + c.want + `"`; !strings.Contains(w.Body.String(), want) {
+			t.Errorf("files %v: expected default page %s", c.files, c.want)
+		}
+	}
+}
+
 func TestHandleViewerWithVersionParam(t *testing.T) {
 	h := setupTestHandler(t)
 	pid, vid := seedProject(t, h, map[string]string{"index.html": "v1"})
@@ -95,6 +122,215 @@ func TestHandleViewerWithVersionParam(t *testing.T) {
 	}
 }
 
+func TestHandleViewerMarksOlderVersion(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, oldVID := seedProject(t, h, map[string]string{"index.html": "v1"})
+	newV, _ := h.DB.CreateVersion(pid, "")
+	h.Storage.SaveUpload(newV.ID, bytes.NewReader(makeZipForTest(t, map[string]string{"index.html": "v2"})))
+
+	render := func(query string) string {
+		req := httptest.NewRequest("GET", "/projects/"+pid+query, nil)
+		req.SetPathValue("id", pid)
+		w := httptest.NewRecorder()
+		h.handleViewer(w, req)
+		if w.Code != 200 {
+			t.Fatalf("%s: expected 200, got %d", query, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	old := render("?version=" + oldVID)
+	if !strings.Contains(old, `class="older-version-banner">`) {
+		t.Error("older version should show the banner")
+	}
+	if !strings.Contains(old, `href="?version=`+newV.ID+`"`) {
+		t.Error("banner should link to the latest version")
+	}
+
+	for _, query := range []string{"", "?version=" + newV.ID} {
+		if !strings.Contains(render(query), `class="older-version-banner" hidden>`) {
+			t.Errorf("%q: latest version should hide the banner", query)
+		}
+	}
+}
+
+func TestHandleViewerCommentsFrom(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, oldVID := seedProject(t, h, map[string]string{"index.html": "v1"})
+	newV, _ := h.DB.CreateVersion(pid, "")
+	h.Storage.SaveUpload(newV.ID, bytes.NewReader(makeZipForTest(t, map[string]string{"index.html": "v2"})))
+	other, _ := h.DB.CreateProject("other-proj", "")
+	otherV, _ := h.DB.CreateVersion(other.ID, "")
+
+	render := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/projects/"+pid+query, nil)
+		req.SetPathValue("id", pid)
+		w := httptest.NewRecorder()
+		h.handleViewer(w, req)
+		return w
+	}
+
+	// The overlay loads v1's comments over the latest version's design.
+	w := render("?comments_from=" + oldVID)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `data-version-id="`+newV.ID+`" data-comments-version-id="`+oldVID+`"`) {
+		t.Error("viewer should request the chosen version's comments")
+	}
+	if !strings.Contains(body, `id="comments-from-banner"`) || !strings.Contains(body, "Showing comments from v1") {
+		t.Error("missing comments overlay banner")
+	}
+
+	// Without the parameter the comments are the version's own.
+	body = render("").Body.String()
+	if !strings.Contains(body, `data-comments-version-id="`+newV.ID+`"`) || strings.Contains(body, "comments-from-banner") {
+		t.Error("default viewer should load the shown version's comments")
+	}
+
+	// Versions of other projects, or unknown ones, are not found.
+	for _, id := range []string{otherV.ID, "bad-id"} {
+		if w := render("?comments_from=" + id); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", id, w.Code)
+		}
+	}
+}
+
+func TestHandleViewerPinnedVersion(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, oldVID := seedProject(t, h, map[string]string{"index.html": "v1"})
+	newV, _ := h.DB.CreateVersion(pid, "")
+	h.Storage.SaveUpload(newV.ID, bytes.NewReader(makeZipForTest(t, map[string]string{"index.html": "v2"})))
+	if err := h.DB.SetPinnedVersion(pid, oldVID); err != nil {
+		t.Fatal(err)
+	}
+
+	render := func(query string) string {
+		req := httptest.NewRequest("GET", "/projects/"+pid+query, nil)
+		req.SetPathValue("id", pid)
+		w := httptest.NewRecorder()
+		h.handleViewer(w, req)
+		if w.Code != 200 {
+			t.Fatalf("%q: expected 200, got %d", query, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	body := render("")
+	if !strings.Contains(body, `data-version-id="`+oldVID+`"`) {
+		t.Error("without ?version= the pinned version should be served")
+	}
+	if !strings.Contains(body, `title="The version this project opens on">Pinned</span>`) {
+		t.Error("pinned version should show the pinned badge")
+	}
+
+	body = render("?version=" + newV.ID)
+	if !strings.Contains(body, `data-version-id="`+newV.ID+`"`) {
+		t.Error("?version= should override the pinned version")
+	}
+	if !strings.Contains(body, `id="pinned-badge" class="badge badge-pinned" title="The version this project opens on" hidden>`) {
+		t.Error("an unpinned version should hide the pinned badge")
+	}
+
+	h.DB.SetPinnedVersion(pid, "")
+	if body := render(""); !strings.Contains(body, `data-version-id="`+newV.ID+`"`) {
+		t.Error("after unpinning the latest version should be served")
+	}
+}
+
+func TestHandleSetPinnedVersion(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+	other, _ := h.DB.CreateProject("other", "")
+	otherV, _ := h.DB.CreateVersion(other.ID, "")
+
+	pin := func(projectID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/api/projects/"+projectID+"/pinned-version", strings.NewReader(body))
+		req.SetPathValue("id", projectID)
+		w := httptest.NewRecorder()
+		h.handleSetPinnedVersion(w, req)
+		return w
+	}
+
+	if w := pin(pid, `{"version_id":"`+vid+`"}`); w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got, _ := h.DB.GetPinnedVersion(pid); got != vid {
+		t.Errorf("pinned = %q, want %q", got, vid)
+	}
+	req := httptest.NewRequest("GET", "/api/projects/"+pid+"/versions", nil)
+	req.SetPathValue("id", pid)
+	w := httptest.NewRecorder()
+	h.handleListVersions(w, req)
+	if !strings.Contains(w.Body.String(), `"pinned":true`) {
+		t.Errorf("version list should mark the pinned version: %s", w.Body.String())
+	}
+
+	for _, id := range []string{otherV.ID, "nonexistent"} {
+		if w := pin(pid, `{"version_id":"`+id+`"}`); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", id, w.Code)
+		}
+	}
+	if got, _ := h.DB.GetPinnedVersion(pid); got != vid {
+		t.Errorf("a rejected pin should leave %q pinned, got %q", vid, got)
+	}
+
+	if w := pin(pid, `{"version_id":""}`); w.Code != 200 {
+		t.Errorf("unpin: expected 200, got %d", w.Code)
+	}
+	if got, _ := h.DB.GetPinnedVersion(pid); got != "" {
+		t.Errorf("expected unpinned, got %q", got)
+	}
+	if w := pin(pid, `{`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid JSON: expected 400, got %d", w.Code)
+	}
+	if w := pin("nonexistent", `{"version_id":""}`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown project: expected 404, got %d", w.Code)
+	}
+}
+
+func TestHandleViewerCustomPageOrder(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, vid := seedProject(t, h, map[string]string{
+		"index.html": "i", "about.html": "a", "contact.html": "c", "pricing.html": "p",
+	})
+
+	tabOrder := func() []string {
+		req := httptest.NewRequest("GET", "/projects/"+pid, nil)
+		req.SetPathValue("id", pid)
+		w := httptest.NewRecorder()
+		h.handleViewer(w, req)
+		var tabs []string
+		for _, part := range strings.Split(w.Body.String(), `data-page="`)[1:] {
+			if name := part[:strings.Index(part, `"`)]; name != "__flow__" {
+				tabs = append(tabs, name)
+			}
+		}
+		return tabs
+	}
+
+	// Default: index first, then alphabetical.
+	if got := strings.Join(tabOrder(), ","); got != "index.html,about.html,contact.html,pricing.html" {
+		t.Errorf("default order = %s", got)
+	}
+
+	req := httptest.NewRequest("PUT", "/api/projects/"+pid+"/versions/"+vid+"/page-order",
+		strings.NewReader(`{"pages":["pricing.html","index.html"]}`))
+	req.SetPathValue("id", pid)
+	req.SetPathValue("versionID", vid)
+	w := httptest.NewRecorder()
+	h.handleSetPageOrder(w, req)
+	if w.Code != 200 {
+		t.Fatalf("set order: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Listed pages first, unlisted ones appended.
+	if got := strings.Join(tabOrder(), ","); got != "pricing.html,index.html,about.html,contact.html" {
+		t.Errorf("custom order = %s", got)
+	}
+}
+
 func TestHandleViewerProjectNotFound(t *testing.T) {
 	h := setupTestHandler(t)
 	req := httptest.NewRequest("GET", "/projects/nonexistent", nil)
@@ -172,6 +408,53 @@ func TestHandleViewerPageTabs(t *testing.T) {
 	}
 }
 
+func TestHandleViewerViewportPresets(t *testing.T) {
+	h := setupTestHandler(t)
+	pid, _ := seedProject(t, h, map[string]string{"index.html": "x"})
+
+	req := httptest.NewRequest("GET", "/projects/"+pid, nil)
+	req.SetPathValue("id", pid)
+	w := httptest.NewRecorder()
+	h.handleViewer(w, req)
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`class="viewport-btn active" data-width="1080"`,
+		`data-width="768"`,
+		`data-width="375"`,
+		"Tablet",
+		`style="width: 1080px; min-width: 1080px"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
+
+func TestViewportPresets(t *testing.T) {
+	cases := []struct {
+		width      int
+		wantWidths []int
+		wantActive string
+	}{
+		{1080, []int{1080, 768, 375}, "desktop"},
+		{1440, []int{1440, 768, 375}, "desktop"},
+		{834, []int{1080, 834, 375}, "tablet"},
+		{390, []int{1080, 768, 390}, "mobile"},
+	}
+	for _, c := range cases {
+		presets := viewportPresets(c.width)
+		for i, p := range presets {
+			if p.Width != c.wantWidths[i] {
+				t.Errorf("width %d: %s = %d, want %d", c.width, p.Name, p.Width, c.wantWidths[i])
+			}
+			if p.Active != (p.Name == c.wantActive) {
+				t.Errorf("width %d: %s active = %v", c.width, p.Name, p.Active)
+			}
+		}
+	}
+}
+
 // --- DB error path tests for viewer ---
 
 func TestHandleViewerGetProjectDBError(t *testing.T) {
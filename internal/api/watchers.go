@@ -0,0 +1,118 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ab/design-reviewer/internal/auth"
+)
+
+// maxNotifications is how many reply notifications the feed returns.
+const maxNotifications = 50
+
+func (h *Handler) handleGetWatch(w http.ResponseWriter, r *http.Request) {
+	commentID := r.PathValue("id")
+	_, email := auth.GetUserFromContext(r.Context())
+	watching, err := h.DB.IsWatchingComment(commentID, auth.NormalizeEmail(email))
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"watching": watching})
+}
+
+// handleWatch subscribes the signed-in user to replies on one comment,
+// without subscribing them to the whole project.
+func (h *Handler) handleWatch(w http.ResponseWriter, r *http.Request) {
+	commentID := r.PathValue("id")
+	_, email := auth.GetUserFromContext(r.Context())
+	if email == "" {
+		http.Error(w, "login required", http.StatusUnauthorized)
+		return
+	}
+	if _, err := h.DB.GetComment(commentID); err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		serverError(w, "database error", err)
+		return
+	}
+	if err := h.DB.WatchComment(commentID, auth.NormalizeEmail(email)); err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"watching": true})
+}
+
+func (h *Handler) handleUnwatch(w http.ResponseWriter, r *http.Request) {
+	commentID := r.PathValue("id")
+	_, email := auth.GetUserFromContext(r.Context())
+	if err := h.DB.UnwatchComment(commentID, auth.NormalizeEmail(email)); err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type notificationJSON struct {
+	ID              int64  `json:"id"`
+	CommentID       string `json:"comment_id"`
+	ReplyID         string `json:"reply_id"`
+	ProjectID       string `json:"project_id"`
+	VersionID       string `json:"version_id"`
+	Page            string `json:"page"`
+	ReplyAuthorName string `json:"reply_author_name"`
+	ReplyBody       string `json:"reply_body"`
+	CreatedAt       string `json:"created_at"`
+}
+
+// handleListNotifications lists the newest replies to comments the
+// signed-in user watches. With auth enabled, replies on projects they can
+// no longer access are left out.
+func (h *Handler) handleListNotifications(w http.ResponseWriter, r *http.Request) {
+	_, email := auth.GetUserFromContext(r.Context())
+	if email == "" {
+		http.Error(w, "login required", http.StatusUnauthorized)
+		return
+	}
+	notes, err := h.DB.ListReplyNotifications(auth.NormalizeEmail(email), maxNotifications)
+	if err != nil {
+		serverError(w, "database error", err)
+		return
+	}
+	access := map[string]bool{}
+	out := []notificationJSON{}
+	for _, n := range notes {
+		ok, checked := access[n.ProjectID]
+		if h.Auth == nil {
+			ok = true
+		} else if !checked {
+			if ok, err = h.DB.CanAccessProject(n.ProjectID, email); err != nil {
+				serverError(w, "database error", err)
+				return
+			}
+			access[n.ProjectID] = ok
+		}
+		if !ok {
+			continue
+		}
+		out = append(out, notificationJSON{
+			ID:              n.ID,
+			CommentID:       n.CommentID,
+			ReplyID:         n.ReplyID,
+			ProjectID:       n.ProjectID,
+			VersionID:       n.VersionID,
+			Page:            n.Page,
+			ReplyAuthorName: n.ReplyAuthorName,
+			ReplyBody:       n.ReplyBody,
+			CreatedAt:       n.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
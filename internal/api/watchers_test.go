@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ab/design-reviewer/internal/auth"
+)
+
+func listNotifications(t *testing.T, h *Handler, email string) []notificationJSON {
+	t.Helper()
+	req := withUser(httptest.NewRequest("GET", "/api/me/notifications", nil), "U", email)
+	w := httptest.NewRecorder()
+	h.handleListNotifications(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var notes []notificationJSON
+	json.NewDecoder(w.Body).Decode(&notes)
+	return notes
+}
+
+func TestCommentAuthorWatchesAndGetsReplyNotifications(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+
+	body := `{"page":"index.html","x_percent":10,"y_percent":20,"body":"hello"}`
+	req := httptest.NewRequest("POST", "/api/versions/"+vid+"/comments", strings.NewReader(body))
+	req.SetPathValue("id", vid)
+	req = withUser(req, "Alice", "Alice@Test.com")
+	w := httptest.NewRecorder()
+	h.handleCreateComment(w, req)
+	if w.Code != 201 {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var c commentJSON
+	json.NewDecoder(w.Body).Decode(&c)
+	if watching, _ := h.DB.IsWatchingComment(c.ID, "alice@test.com"); !watching {
+		t.Fatal("comment author should watch their comment")
+	}
+
+	req = httptest.NewRequest("POST", "/api/comments/"+c.ID+"/replies", strings.NewReader(`{"body":"on it"}`))
+	req.SetPathValue("id", c.ID)
+	req = withUser(req, "Bob", "bob@test.com")
+	w = httptest.NewRecorder()
+	h.handleCreateReply(w, req)
+	if w.Code != 201 {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var reply replyJSON
+	json.NewDecoder(w.Body).Decode(&reply)
+
+	notes := listNotifications(t, h, "alice@test.com")
+	if len(notes) != 1 || notes[0].ReplyID != reply.ID || notes[0].CommentID != c.ID ||
+		notes[0].ReplyAuthorName != "Bob" || notes[0].ReplyBody != "on it" || notes[0].VersionID != vid {
+		t.Errorf("alice's notifications = %+v", notes)
+	}
+	if notes := listNotifications(t, h, "bob@test.com"); len(notes) != 0 {
+		t.Errorf("bob doesn't watch the comment but got %+v", notes)
+	}
+}
+
+func TestHandleWatchAndUnwatch(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+	c, _ := h.DB.CreateComment(vid, "index.html", 10, 20, "Alice", "a@t.com", "hello")
+
+	watching := func() bool {
+		req := httptest.NewRequest("GET", "/api/comments/"+c.ID+"/watch", nil)
+		req.SetPathValue("id", c.ID)
+		req = withUser(req, "Bob", "bob@test.com")
+		w := httptest.NewRecorder()
+		h.handleGetWatch(w, req)
+		var result map[string]bool
+		json.NewDecoder(w.Body).Decode(&result)
+		return result["watching"]
+	}
+
+	req := httptest.NewRequest("POST", "/api/comments/"+c.ID+"/watch", nil)
+	req.SetPathValue("id", c.ID)
+	req = withUser(req, "Bob", "bob@test.com")
+	w := httptest.NewRecorder()
+	h.handleWatch(w, req)
+	if w.Code != 200 || !watching() {
+		t.Fatalf("watch: %d %s", w.Code, w.Body.String())
+	}
+
+	// Carol's reply notifies Bob as well as the author, but not Carol.
+	h.DB.CreateReply(c.ID, "Carol", "carol@test.com", "done")
+	if notes := listNotifications(t, h, "bob@test.com"); len(notes) != 1 {
+		t.Errorf("bob's notifications = %+v", notes)
+	}
+	if notes := listNotifications(t, h, "a@t.com"); len(notes) != 1 {
+		t.Errorf("author's notifications = %+v", notes)
+	}
+
+	req = httptest.NewRequest("DELETE", "/api/comments/"+c.ID+"/watch", nil)
+	req.SetPathValue("id", c.ID)
+	req = withUser(req, "Bob", "bob@test.com")
+	w = httptest.NewRecorder()
+	h.handleUnwatch(w, req)
+	if w.Code != 204 || watching() {
+		t.Fatalf("unwatch: %d %s", w.Code, w.Body.String())
+	}
+	h.DB.CreateReply(c.ID, "Carol", "carol@test.com", "again")
+	if notes := listNotifications(t, h, "bob@test.com"); len(notes) != 1 {
+		t.Errorf("bob was notified after unwatching: %+v", notes)
+	}
+}
+
+func TestHandleWatchErrors(t *testing.T) {
+	h := setupTestHandler(t)
+	_, vid := seedProject(t, h, map[string]string{"index.html": "x"})
+	c, _ := h.DB.CreateComment(vid, "index.html", 10, 20, "Alice", "a@t.com", "hello")
+
+	req := httptest.NewRequest("POST", "/api/comments/"+c.ID+"/watch", nil)
+	req.SetPathValue("id", c.ID)
+	w := httptest.NewRecorder()
+	h.handleWatch(w, req)
+	if w.Code != 401 {
+		t.Errorf("signed out: expected 401, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/comments/nope/watch", nil)
+	req.SetPathValue("id", "nope")
+	req = withUser(req, "Bob", "bob@test.com")
+	w = httptest.NewRecorder()
+	h.handleWatch(w, req)
+	if w.Code != 404 {
+		t.Errorf("unknown comment: expected 404, got %d", w.Code)
+	}
+}
+
+func TestHandleListNotificationsSkipsLostAccess(t *testing.T) {
+	h := setupTestHandler(t)
+	h.Auth = &auth.Config{BaseURL: "http://localhost:8080"}
+	p, _ := h.DB.CreateProject("proj", "alice@test.com")
+	v, _ := h.DB.CreateVersion(p.ID, "")
+	h.DB.AddMember(p.ID, "bob@test.com")
+	c, _ := h.DB.CreateComment(v.ID, "index.html", 10, 20, "Bob", "bob@test.com", "hello")
+	h.DB.CreateReply(c.ID, "Alice", "alice@test.com", "thanks")
+	if notes := listNotifications(t, h, "bob@test.com"); len(notes) != 1 {
+		t.Fatalf("bob's notifications = %+v", notes)
+	}
+
+	h.DB.RemoveMember(p.ID, "bob@test.com")
+	if notes := listNotifications(t, h, "bob@test.com"); len(notes) != 0 {
+		t.Errorf("removed member still sees %+v", notes)
+	}
+}
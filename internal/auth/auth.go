@@ -12,6 +12,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/mail"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,6 +29,71 @@ type Config struct {
 	CLIRedirectURL string
 	SessionSecret  string
 	BaseURL        string
+	// AllowedEmailDomains limits Google sign-in to accounts in these
+	// domains (e.g. "example.com"). Empty allows any account.
+	AllowedEmailDomains []string
+	// SecureCookies marks cookies Secure even when BaseURL is plain HTTP,
+	// e.g. when the server terminates TLS itself.
+	SecureCookies bool
+}
+
+// Secure reports whether cookies should carry the Secure attribute.
+func (c *Config) Secure() bool {
+	return c.SecureCookies || strings.HasPrefix(c.BaseURL, "https://")
+}
+
+// ParseEmailDomains splits a comma-separated domain list such as
+// "example.com, example.org", dropping blanks and any leading "@".
+func ParseEmailDomains(s string) []string {
+	var domains []string
+	for _, d := range strings.Split(s, ",") {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@"))
+		if d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// EmailAllowed reports whether email may sign in with Google.
+func (c *Config) EmailAllowed(email string) bool {
+	if len(c.AllowedEmailDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, d := range c.AllowedEmailDomains {
+		if strings.EqualFold(domain, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeEmail trims and lowercases an email, the form author emails are
+// stored in so that filters and avatars match however it was typed.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ValidEmail reports whether email is a bare address such as
+// "alice@example.com", without a display name or surrounding text.
+func ValidEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// AuthCodeOptions returns extra options for the Google consent URL. With a
+// single allowed domain, Google's hd parameter preselects accounts from it;
+// the callback still checks the email, since hd is only a hint.
+func (c *Config) AuthCodeOptions() []oauth2.AuthCodeOption {
+	if len(c.AllowedEmailDomains) != 1 {
+		return nil
+	}
+	return []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("hd", c.AllowedEmailDomains[0])}
 }
 
 type contextKey string
@@ -131,6 +198,89 @@ func VerifySession(secret, cookie string) (User, error) {
 	return u, nil
 }
 
+// MagicLinkTTL is how long an emailed login link stays valid.
+const MagicLinkTTL = 15 * time.Minute
+
+type magicLink struct {
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// magicLinkKey derives a separate signing key so a magic-link token can
+// never be replayed as a session cookie (and vice versa).
+func magicLinkKey(secret string) string {
+	return secret + ":magic-link"
+}
+
+// SignMagicLink creates a signed, short-lived login token for email.
+func SignMagicLink(secret, email string, ttl time.Duration) (string, error) {
+	data, err := json.Marshal(magicLink{Email: email, ExpiresAt: time.Now().Add(ttl).Unix()})
+	if err != nil {
+		return "", err
+	}
+	sig := hmacSign(magicLinkKey(secret), data)
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// VerifyMagicLink verifies a magic-link token and returns its email.
+func VerifyMagicLink(secret, token string) (string, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return "", errors.New("invalid token format")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("decode data: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("decode sig: %w", err)
+	}
+	if !hmac.Equal(sig, hmacSign(magicLinkKey(secret), data)) {
+		return "", errors.New("invalid signature")
+	}
+	var m magicLink
+	if err := json.Unmarshal(data, &m); err != nil {
+		return "", err
+	}
+	if m.Email == "" || time.Now().Unix() > m.ExpiresAt {
+		return "", errors.New("token expired")
+	}
+	return m.Email, nil
+}
+
+// embedKey derives the key for embed URL signatures, kept apart from the
+// session and magic-link keys.
+func embedKey(secret string) string {
+	return secret + ":embed"
+}
+
+func embedData(versionID string, expiresAt int64) []byte {
+	return []byte(versionID + "\n" + strconv.FormatInt(expiresAt, 10))
+}
+
+// SignEmbed returns a signature that lets anyone read versionID's design
+// files until expiresAt (Unix seconds).
+func SignEmbed(secret, versionID string, expiresAt int64) string {
+	return base64.RawURLEncoding.EncodeToString(hmacSign(embedKey(secret), embedData(versionID, expiresAt)))
+}
+
+// VerifyEmbed checks a signature made by SignEmbed and that it has not
+// expired.
+func VerifyEmbed(secret, versionID string, expiresAt int64, sig string) error {
+	b, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("decode sig: %w", err)
+	}
+	if !hmac.Equal(b, hmacSign(embedKey(secret), embedData(versionID, expiresAt))) {
+		return errors.New("invalid signature")
+	}
+	if time.Now().Unix() > expiresAt {
+		return errors.New("embed link expired")
+	}
+	return nil
+}
+
 func hmacSign(secret string, data []byte) []byte {
 	h := hmac.New(sha256.New, []byte(secret))
 	h.Write(data)
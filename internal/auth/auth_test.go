@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -155,6 +156,42 @@ func TestNewGoogleOAuthConfig(t *testing.T) {
 	}
 }
 
+func TestEmailAllowed(t *testing.T) {
+	open := &Config{}
+	if !open.EmailAllowed("anyone@gmail.com") {
+		t.Error("no restriction should allow any email")
+	}
+
+	cfg := &Config{AllowedEmailDomains: ParseEmailDomains(" Example.com, @example.org ,")}
+	if len(cfg.AllowedEmailDomains) != 2 {
+		t.Fatalf("parsed domains = %q", cfg.AllowedEmailDomains)
+	}
+	for email, want := range map[string]bool{
+		"alice@example.com":    true,
+		"Bob@EXAMPLE.ORG":      true,
+		"eve@gmail.com":        false,
+		"eve@sub.example.com":  false,
+		"eve@example.com.evil": false,
+		"no-at-sign":           false,
+	} {
+		if got := cfg.EmailAllowed(email); got != want {
+			t.Errorf("EmailAllowed(%q) = %v, want %v", email, got, want)
+		}
+	}
+}
+
+func TestAuthCodeOptionsHostedDomain(t *testing.T) {
+	oc := NewGoogleOAuthConfig(Config{ClientID: "id"})
+	single := &Config{AllowedEmailDomains: []string{"example.com"}}
+	if u := oc.AuthCodeURL("s", single.AuthCodeOptions()...); !strings.Contains(u, "hd=example.com") {
+		t.Errorf("single domain should set hd: %s", u)
+	}
+	multi := &Config{AllowedEmailDomains: []string{"example.com", "example.org"}}
+	if u := oc.AuthCodeURL("s", multi.AuthCodeOptions()...); strings.Contains(u, "hd=") {
+		t.Errorf("hd only takes one domain: %s", u)
+	}
+}
+
 func TestSetSessionCookieOnRealRequest(t *testing.T) {
 	// Test that the cookie works in a real HTTP flow
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -338,3 +375,90 @@ func TestSignSessionPreservesSessionID(t *testing.T) {
 		t.Errorf("SessionID = %q, want my-session-id", got.SessionID)
 	}
 }
+
+func TestSignAndVerifyMagicLink(t *testing.T) {
+	token, err := SignMagicLink("secret", "rev@example.com", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	email, err := VerifyMagicLink("secret", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email != "rev@example.com" {
+		t.Errorf("email = %q", email)
+	}
+}
+
+func TestVerifyMagicLinkRejectsExpired(t *testing.T) {
+	token, _ := SignMagicLink("secret", "rev@example.com", -time.Minute)
+	if _, err := VerifyMagicLink("secret", token); err == nil {
+		t.Error("expected error for expired token")
+	}
+}
+
+func TestVerifyMagicLinkRejectsTampered(t *testing.T) {
+	token, _ := SignMagicLink("secret", "rev@example.com", time.Minute)
+	if _, err := VerifyMagicLink("other-secret", token); err == nil {
+		t.Error("expected error for wrong secret")
+	}
+	if _, err := VerifyMagicLink("secret", "x"+token); err == nil {
+		t.Error("expected error for tampered token")
+	}
+}
+
+func TestMagicLinkNotAcceptedAsSession(t *testing.T) {
+	token, _ := SignMagicLink("secret", "rev@example.com", time.Minute)
+	if _, err := VerifySession("secret", token); err == nil {
+		t.Error("magic-link token must not verify as a session")
+	}
+}
+
+func TestSignAndVerifyEmbed(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	sig := SignEmbed("secret", "v1", exp)
+	if err := VerifyEmbed("secret", "v1", exp, sig); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	if err := VerifyEmbed("secret", "v2", exp, sig); err == nil {
+		t.Error("signature must not verify for another version")
+	}
+	if err := VerifyEmbed("secret", "v1", exp+1, sig); err == nil {
+		t.Error("signature must not verify with a changed expiry")
+	}
+	past := time.Now().Add(-time.Minute).Unix()
+	if err := VerifyEmbed("secret", "v1", past, SignEmbed("secret", "v1", past)); err == nil {
+		t.Error("expired signature must be rejected")
+	}
+}
+
+func TestConfigSecure(t *testing.T) {
+	if (&Config{BaseURL: "http://localhost:8080"}).Secure() {
+		t.Error("plain HTTP shouldn't be Secure")
+	}
+	if !(&Config{BaseURL: "https://example.com"}).Secure() {
+		t.Error("https BaseURL should be Secure")
+	}
+	if !(&Config{BaseURL: "http://localhost:8080", SecureCookies: true}).Secure() {
+		t.Error("SecureCookies should force Secure")
+	}
+}
+
+func TestNormalizeAndValidEmail(t *testing.T) {
+	if got := NormalizeEmail("  Alice@Example.COM "); got != "alice@example.com" {
+		t.Errorf("NormalizeEmail = %q", got)
+	}
+	for email, want := range map[string]bool{
+		"alice@example.com":         true,
+		"a.b+c@sub.example.org":     true,
+		"":                          false,
+		"alice":                     false,
+		"alice@":                    false,
+		"Alice <alice@example.com>": false,
+		" alice@example.com":        false,
+	} {
+		if got := ValidEmail(email); got != want {
+			t.Errorf("ValidEmail(%q) = %v, want %v", email, got, want)
+		}
+	}
+}
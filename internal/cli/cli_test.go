@@ -3,15 +3,20 @@ package cli
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // --- Config Tests ---
@@ -78,6 +83,103 @@ func TestSaveConfigOverwrites(t *testing.T) {
 	}
 }
 
+func TestSaveConfigNormalizesTrailingSlash(t *testing.T) {
+	setTestConfig(t)
+	if err := SaveConfig(&Config{Server: "https://example.com/reviews//", Token: "tok"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _ := LoadConfig()
+	if cfg.Server != "https://example.com/reviews" {
+		t.Errorf("server = %q, want https://example.com/reviews", cfg.Server)
+	}
+}
+
+func TestSaveConfigRejectsInvalidServer(t *testing.T) {
+	path := setTestConfig(t)
+	for _, server := range []string{"ftp://example.com", "example.com", "http://", "http://exa mple.com", "http://example.com?x=1"} {
+		if err := SaveConfig(&Config{Server: server, Token: "tok"}); err == nil {
+			t.Errorf("SaveConfig(%q): expected error", server)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("config should not be written for an invalid server")
+	}
+}
+
+func TestSaveAndLoadProfiles(t *testing.T) {
+	path := setTestConfig(t)
+	cfg := &Config{Server: "http://main.example.com", Token: "main-tok"}
+	cfg.SetProfile("client", Profile{Server: "https://client.example.com/", Token: "client-tok"})
+	cfg.Current = "client"
+	if err := SaveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Profile(DefaultProfile); got.Server != "http://main.example.com" || got.Token != "main-tok" {
+		t.Errorf("default profile = %+v", got)
+	}
+	if got := loaded.Profile("client"); got.Server != "https://client.example.com" || got.Token != "client-tok" {
+		t.Errorf("client profile = %+v", got)
+	}
+	if got := loaded.Profile(""); got.Token != "client-tok" {
+		t.Errorf("current profile token = %q, want client-tok", got.Token)
+	}
+	if names := strings.Join(loaded.ProfileNames(), ","); names != "client,default" {
+		t.Errorf("ProfileNames = %q", names)
+	}
+
+	// The default profile stays at the top level, where older CLIs look.
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "server: http://main.example.com\ntoken: main-tok\n") {
+		t.Errorf("unexpected config layout:\n%s", data)
+	}
+}
+
+func TestUseProfile(t *testing.T) {
+	setTestConfig(t)
+	cfg := &Config{Server: "http://main.example.com", Token: "a"}
+	cfg.SetProfile("client", Profile{Server: "http://client.example.com", Token: "b"})
+	SaveConfig(cfg)
+
+	if err := UseProfile("missing"); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+	if err := UseProfile("client"); err != nil {
+		t.Fatal(err)
+	}
+	loaded, _ := LoadConfig()
+	if loaded.Current != "client" {
+		t.Errorf("Current = %q, want client", loaded.Current)
+	}
+	var out strings.Builder
+	ListProfiles(&out)
+	if !strings.Contains(out.String(), "* client") || !strings.Contains(out.String(), "  default") {
+		t.Errorf("ListProfiles output:\n%s", out.String())
+	}
+	if err := UseProfile(DefaultProfile); err != nil {
+		t.Fatal(err)
+	}
+	loaded, _ = LoadConfig()
+	if loaded.Current != "" {
+		t.Errorf("Current = %q, want empty", loaded.Current)
+	}
+}
+
+func TestPushRejectsInvalidServerFlag(t *testing.T) {
+	setTestConfig(t)
+	SaveConfig(&Config{Token: "tok"})
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html></html>"), 0644)
+	err := Push(dir, "test", "ftp://example.com", "")
+	if err == nil || !strings.Contains(err.Error(), "scheme") {
+		t.Errorf("expected scheme error, got %v", err)
+	}
+}
+
 // --- ZipDirectory Tests ---
 
 func TestZipDirectoryBasic(t *testing.T) {
@@ -166,7 +268,7 @@ func TestZipDirectoryNonexistent(t *testing.T) {
 
 func TestPushNotLoggedIn(t *testing.T) {
 	setTestConfig(t)
-	err := Push(t.TempDir(), "test", "")
+	err := Push(t.TempDir(), "test", "", "")
 	if err == nil || !strings.Contains(err.Error(), "Not logged in") {
 		t.Errorf("expected 'Not logged in' error, got: %v", err)
 	}
@@ -175,7 +277,7 @@ func TestPushNotLoggedIn(t *testing.T) {
 func TestPushDirNotExist(t *testing.T) {
 	setTestConfig(t)
 	SaveConfig(&Config{Token: "tok", Server: "http://localhost"})
-	err := Push("/nonexistent", "test", "")
+	err := Push("/nonexistent", "test", "", "")
 	if err == nil || !strings.Contains(err.Error(), "does not exist") {
 		t.Errorf("expected 'does not exist' error, got: %v", err)
 	}
@@ -186,7 +288,7 @@ func TestPushNoHTMLFiles(t *testing.T) {
 	SaveConfig(&Config{Token: "tok", Server: "http://localhost"})
 	dir := t.TempDir()
 	os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("no html"), 0644)
-	err := Push(dir, "test", "")
+	err := Push(dir, "test", "", "")
 	if err == nil || !strings.Contains(err.Error(), ".html file") {
 		t.Errorf("expected '.html file' error, got: %v", err)
 	}
@@ -209,12 +311,183 @@ func TestPushDefaultName(t *testing.T) {
 	os.MkdirAll(dir, 0755)
 	os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
 
-	Push(dir, "", "")
+	Push(dir, "", "", "")
 	if receivedName != "my-project" {
 		t.Errorf("name = %q, want 'my-project'", receivedName)
 	}
 }
 
+func TestPushSendsDirectoryNameAsFilename(t *testing.T) {
+	setTestConfig(t)
+	var gotFilename, gotSource string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseMultipartForm(10 << 20)
+		if _, fh, err := r.FormFile("file"); err == nil {
+			gotFilename = fh.Filename
+		}
+		gotSource = r.FormValue("source")
+		json.NewEncoder(w).Encode(map[string]any{
+			"project_id": "p1", "version_id": "v1", "version_num": 1,
+		})
+	}))
+	defer srv.Close()
+
+	SaveConfig(&Config{Token: "tok", Server: srv.URL})
+	dir := filepath.Join(t.TempDir(), "landing-page")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
+
+	if err := Push(dir, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if gotFilename != "landing-page.zip" {
+		t.Errorf("filename = %q, want landing-page.zip", gotFilename)
+	}
+	if gotSource != "design-reviewer-cli" {
+		t.Errorf("source = %q, want design-reviewer-cli", gotSource)
+	}
+}
+
+func TestPushSendsProjectID(t *testing.T) {
+	setTestConfig(t)
+	var gotProjectID string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseMultipartForm(10 << 20)
+		gotProjectID = r.FormValue("project_id")
+		json.NewEncoder(w).Encode(map[string]any{
+			"project_id": "p42", "version_id": "v1", "version_num": 1,
+		})
+	}))
+	defer srv.Close()
+
+	SaveConfig(&Config{Token: "tok", Server: srv.URL})
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
+
+	if err := Push(dir, "", "", "p42"); err != nil {
+		t.Fatal(err)
+	}
+	if gotProjectID != "p42" {
+		t.Errorf("project_id = %q, want p42", gotProjectID)
+	}
+}
+
+func TestPushSingleHTMLFile(t *testing.T) {
+	setTestConfig(t)
+	var gotName, gotFile, gotContent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseMultipartForm(10 << 20)
+		gotName = r.FormValue("name")
+		f, fh, err := r.FormFile("file")
+		if err == nil {
+			data, _ := io.ReadAll(f)
+			gotFile, gotContent = fh.Filename, string(data)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"project_id": "p1", "version_id": "v1", "version_num": 1,
+		})
+	}))
+	defer srv.Close()
+	SaveConfig(&Config{Token: "tok", Server: srv.URL})
+
+	page := filepath.Join(t.TempDir(), "landing.html")
+	os.WriteFile(page, []byte("<html>launch</html>"), 0644)
+	if err := Push(page, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if gotName != "landing" || gotFile != "landing.html" || gotContent != "<html>launch</html>" {
+		t.Errorf("got name=%q file=%q content=%q", gotName, gotFile, gotContent)
+	}
+}
+
+func TestPushSendsChecksum(t *testing.T) {
+	setTestConfig(t)
+	var gotSum, wantSum string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSum = r.Header.Get("X-Upload-SHA256")
+		r.ParseMultipartForm(10 << 20)
+		if f, _, err := r.FormFile("file"); err == nil {
+			data, _ := io.ReadAll(f)
+			sum := sha256.Sum256(data)
+			wantSum = hex.EncodeToString(sum[:])
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"project_id": "p1", "version_id": "v1", "version_num": 1,
+		})
+	}))
+	defer srv.Close()
+	SaveConfig(&Config{Token: "tok", Server: srv.URL})
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>hi</html>"), 0644)
+	if err := Push(dir, "sum", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if wantSum == "" || gotSum != wantSum {
+		t.Errorf("checksum header = %q, want %q", gotSum, wantSum)
+	}
+}
+
+func TestPushWithProfile(t *testing.T) {
+	setTestConfig(t)
+	var hits []string
+	newServer := func(label string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits = append(hits, label+" "+r.Header.Get("Authorization"))
+			json.NewEncoder(w).Encode(map[string]any{
+				"project_id": "p1", "version_id": "v1", "version_num": 1,
+			})
+		}))
+	}
+	mainSrv := newServer("main")
+	defer mainSrv.Close()
+	clientSrv := newServer("client")
+	defer clientSrv.Close()
+
+	cfg := &Config{Server: mainSrv.URL, Token: "main-tok"}
+	cfg.SetProfile("client", Profile{Server: clientSrv.URL, Token: "client-tok"})
+	SaveConfig(cfg)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
+
+	if err := PushWithOptions(dir, "test", "", PushOptions{Profile: "client"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := PushWithOptions(dir, "test", "", PushOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(hits, ","); got != "client Bearer client-tok,main Bearer main-tok" {
+		t.Errorf("hits = %q", got)
+	}
+	if err := PushWithOptions(dir, "test", "", PushOptions{Profile: "missing"}); err == nil || !strings.Contains(err.Error(), "unknown profile") {
+		t.Errorf("expected unknown profile error, got %v", err)
+	}
+}
+
+func TestPushWithOptionsSendsCanvasSize(t *testing.T) {
+	setTestConfig(t)
+	var gotWidth, gotHeight string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseMultipartForm(10 << 20)
+		gotWidth, gotHeight = r.FormValue("width"), r.FormValue("height")
+		json.NewEncoder(w).Encode(map[string]any{
+			"project_id": "p1", "version_id": "v1", "version_num": 1,
+		})
+	}))
+	defer srv.Close()
+
+	SaveConfig(&Config{Token: "tok", Server: srv.URL})
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
+
+	if err := PushWithOptions(dir, "proj", "", PushOptions{Width: 390, Height: 844}); err != nil {
+		t.Fatal(err)
+	}
+	if gotWidth != "390" || gotHeight != "844" {
+		t.Errorf("width, height = %q, %q, want 390, 844", gotWidth, gotHeight)
+	}
+}
+
 func TestPushSuccess(t *testing.T) {
 	setTestConfig(t)
 	var gotAuth string
@@ -240,7 +513,7 @@ func TestPushSuccess(t *testing.T) {
 	dir := t.TempDir()
 	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>test</h1>"), 0644)
 
-	err := Push(dir, "test-proj", "")
+	err := Push(dir, "test-proj", "", "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -261,7 +534,7 @@ func TestPushServerError(t *testing.T) {
 	dir := t.TempDir()
 	os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
 
-	err := Push(dir, "test", "")
+	err := Push(dir, "test", "", "")
 	if err == nil {
 		t.Error("expected error for server error")
 	}
@@ -282,7 +555,7 @@ func TestPushServerOverride(t *testing.T) {
 	dir := t.TempDir()
 	os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
 
-	Push(dir, "test", srv.URL)
+	Push(dir, "test", srv.URL, "")
 	if !called {
 		t.Error("server override not used")
 	}
@@ -318,7 +591,7 @@ func TestPushUploadContainsValidZip(t *testing.T) {
 	dir := t.TempDir()
 	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>test</h1>"), 0644)
 
-	err := Push(dir, "test", "")
+	err := Push(dir, "test", "", "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -431,7 +704,7 @@ func TestPushUsesConfigServer(t *testing.T) {
 	dir := t.TempDir()
 	os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
 
-	Push(dir, "test", "")
+	Push(dir, "test", "", "")
 	if !called {
 		t.Error("config server not used")
 	}
@@ -528,6 +801,35 @@ func TestLoginUsesRandomPort(t *testing.T) {
 	}
 }
 
+func TestLoginTimesOutWithoutCallback(t *testing.T) {
+	setTestConfig(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	err := LoginWithOptions(srv.URL, LoginOptions{CallbackHost: "127.0.0.1", Timeout: 200 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got: %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("login took %s, expected the injected timeout to apply", time.Since(start))
+	}
+	cfg, _ := LoadConfig()
+	if cfg.Token != "" {
+		t.Errorf("token should not be saved on timeout, got %q", cfg.Token)
+	}
+}
+
+func TestLoginCallbackHostBindError(t *testing.T) {
+	setTestConfig(t)
+	err := LoginWithOptions("http://localhost", LoginOptions{CallbackHost: "256.0.0.1", Timeout: time.Second})
+	if err == nil || !strings.Contains(err.Error(), "callback server") {
+		t.Errorf("expected bind error mentioning callback server, got: %v", err)
+	}
+}
+
 // --- Config edge case tests ---
 
 func TestConfigPathDefault(t *testing.T) {
@@ -584,7 +886,7 @@ func TestPushDirIsFile(t *testing.T) {
 	SaveConfig(&Config{Token: "tok", Server: "http://localhost"})
 	f := filepath.Join(t.TempDir(), "file.txt")
 	os.WriteFile(f, []byte("x"), 0644)
-	err := Push(f, "test", "")
+	err := Push(f, "test", "", "")
 	if err == nil || !strings.Contains(err.Error(), "does not exist") {
 		t.Errorf("expected 'does not exist' error for file, got: %v", err)
 	}
@@ -600,7 +902,7 @@ func TestPushServerBadJSON(t *testing.T) {
 	SaveConfig(&Config{Token: "tok", Server: srv.URL})
 	dir := t.TempDir()
 	os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
-	err := Push(dir, "test", "")
+	err := Push(dir, "test", "", "")
 	if err == nil {
 		t.Error("expected error for bad server response")
 	}
@@ -616,19 +918,37 @@ func TestPushServerJSONError(t *testing.T) {
 	SaveConfig(&Config{Token: "tok", Server: srv.URL})
 	dir := t.TempDir()
 	os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
-	err := Push(dir, "test", "")
+	err := Push(dir, "test", "", "")
 	if err == nil || !strings.Contains(err.Error(), "bad upload") {
 		t.Errorf("expected 'bad upload' error, got: %v", err)
 	}
 }
 
+func TestPushTokenErrors(t *testing.T) {
+	for code, want := range map[string]string{"token_expired": "expired", "token_invalid": "no longer valid"} {
+		setTestConfig(t)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized", "code": code})
+		}))
+		SaveConfig(&Config{Token: "tok", Server: srv.URL})
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
+		err := Push(dir, "test", "", "")
+		srv.Close()
+		if err == nil || !strings.Contains(err.Error(), want) || !strings.Contains(err.Error(), "design-reviewer login") {
+			t.Errorf("%s: got %v", code, err)
+		}
+	}
+}
+
 func TestPushLoadConfigError(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, ".design-reviewer.yaml")
 	os.MkdirAll(path, 0755) // directory instead of file
 	ConfigPathOverride = path
 	defer func() { ConfigPathOverride = "" }()
-	err := Push(t.TempDir(), "test", "")
+	err := Push(t.TempDir(), "test", "", "")
 	if err == nil {
 		t.Error("expected error from LoadConfig")
 	}
@@ -761,3 +1081,174 @@ func keys(m map[string]string) []string {
 	}
 	return ks
 }
+
+func TestPushChunkedForLargeZip(t *testing.T) {
+	setTestConfig(t)
+	origThreshold, origChunk := chunkedUploadThreshold, uploadChunkSize
+	chunkedUploadThreshold, uploadChunkSize = 10, 64
+	t.Cleanup(func() { chunkedUploadThreshold, uploadChunkSize = origThreshold, origChunk })
+
+	var assembled bytes.Buffer
+	chunks, failedOnce := 0, false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/upload/init":
+			var req map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			if req["name"] != "big" {
+				t.Errorf("init name = %q", req["name"])
+			}
+			json.NewEncoder(w).Encode(map[string]any{"upload_id": "u1"})
+		case r.URL.Path == "/api/upload/u1/chunk":
+			// Simulate a dropped chunk that the client must retry
+			if chunks == 1 && !failedOnce {
+				failedOnce = true
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			if r.URL.Query().Get("offset") != fmt.Sprint(assembled.Len()) {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(map[string]any{"received": assembled.Len()})
+				return
+			}
+			io.Copy(&assembled, r.Body)
+			chunks++
+			json.NewEncoder(w).Encode(map[string]any{"received": assembled.Len()})
+		case r.URL.Path == "/api/upload/u1/complete":
+			json.NewEncoder(w).Encode(map[string]any{"project_id": "p1", "version_num": float64(1)})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(404)
+		}
+	}))
+	defer srv.Close()
+
+	SaveConfig(&Config{Token: "tok", Server: srv.URL})
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte(strings.Repeat("<p>big</p>", 50)), 0644)
+
+	if err := Push(dir, "big", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if chunks < 2 {
+		t.Errorf("expected multiple chunks, got %d", chunks)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(assembled.Bytes()), int64(assembled.Len()))
+	if err != nil {
+		t.Fatalf("assembled upload is not a valid zip: %v", err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "index.html" {
+		t.Errorf("unexpected zip contents: %v", zr.File)
+	}
+}
+
+// --- Retry Tests ---
+
+func fastRetries(t *testing.T) {
+	t.Helper()
+	orig := retryBackoff
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() { retryBackoff = orig })
+}
+
+// failFirstDial fails the first request as if the server couldn't be
+// reached, then passes requests on.
+type failFirstDial struct {
+	calls int
+}
+
+func (f *failFirstDial) RoundTrip(req *http.Request) (*http.Response, error) {
+	if f.calls++; f.calls == 1 {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestPushRetriesConnectionError(t *testing.T) {
+	setTestConfig(t)
+	fastRetries(t)
+	var uploads int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads++
+		r.ParseMultipartForm(1 << 20)
+		if _, _, err := r.FormFile("file"); err != nil {
+			t.Errorf("retried request lost its body: %v", err)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"project_id": "p1", "version_num": float64(1)})
+	}))
+	defer srv.Close()
+	transport := &failFirstDial{}
+	http.DefaultClient.Transport = transport
+	t.Cleanup(func() { http.DefaultClient.Transport = nil })
+
+	SaveConfig(&Config{Token: "tok", Server: srv.URL})
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
+	if err := Push(dir, "test", "", ""); err != nil {
+		t.Fatalf("push should succeed on retry: %v", err)
+	}
+	if transport.calls != 2 || uploads != 1 {
+		t.Errorf("attempts = %d, uploads = %d; want 2 and 1", transport.calls, uploads)
+	}
+}
+
+func TestPushRetriesUnavailableServer(t *testing.T) {
+	setTestConfig(t)
+	fastRetries(t)
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A proxy answers 503 while the machine wakes up.
+		if requests++; requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"project_id": "p1", "version_num": float64(1)})
+	}))
+	defer srv.Close()
+
+	SaveConfig(&Config{Token: "tok", Server: srv.URL})
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
+	if err := Push(dir, "test", "", ""); err != nil {
+		t.Fatalf("push should succeed on retry: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2", requests)
+	}
+
+	// --no-retry gives up at once, naming the status.
+	requests = 0
+	err := PushWithOptions(dir, "test", "", PushOptions{NoRetry: true})
+	if err == nil || !strings.Contains(err.Error(), "HTTP 503") {
+		t.Errorf("expected an HTTP 503 error, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("requests with --no-retry = %d, want 1", requests)
+	}
+}
+
+func TestPushConnectionErrorMessage(t *testing.T) {
+	setTestConfig(t)
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	SaveConfig(&Config{Token: "tok", Server: srv.URL})
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
+	err := PushWithOptions(dir, "test", "", PushOptions{NoRetry: true})
+	if err == nil || !strings.Contains(err.Error(), "could not reach the server") {
+		t.Errorf("expected a connection error, got %v", err)
+	}
+}
+
+func TestUploadErrorNamesServerFailures(t *testing.T) {
+	if err := uploadError(http.StatusBadRequest, []byte(`{"error":"bad upload"}`)); err.Error() != "bad upload" {
+		t.Errorf("client error = %q", err)
+	}
+	if err := uploadError(http.StatusInternalServerError, []byte("server broke")); err.Error() != "server error (HTTP 500): server broke" {
+		t.Errorf("server error = %q", err)
+	}
+	if err := uploadError(http.StatusBadGateway, nil); !strings.Contains(err.Error(), "HTTP 502") {
+		t.Errorf("empty response = %q", err)
+	}
+}
@@ -1,15 +1,95 @@
 package cli
 
 import (
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+// DefaultProfile is the name of the profile kept in the top-level server and
+// token fields, which is where single-server configs have always stored them.
+const DefaultProfile = "default"
+
+// Profile is the server and token used to talk to one design-reviewer
+// instance.
+type Profile struct {
+	Server string `yaml:"server,omitempty"`
+	Token  string `yaml:"token,omitempty"`
+}
+
 type Config struct {
+	// Server and Token belong to the default profile.
 	Server string `yaml:"server,omitempty"`
 	Token  string `yaml:"token,omitempty"`
+	// Current is the profile used when none is named; empty means
+	// DefaultProfile.
+	Current string `yaml:"current_profile,omitempty"`
+	// Profiles holds the named profiles other than the default one.
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+}
+
+// resolve turns "" into the current profile's name.
+func (c *Config) resolve(name string) string {
+	if name == "" {
+		name = c.Current
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+	return name
+}
+
+// Profile returns the named profile, or the current one if name is empty.
+// A profile that doesn't exist yet comes back empty.
+func (c *Config) Profile(name string) Profile {
+	name = c.resolve(name)
+	if name == DefaultProfile {
+		return Profile{Server: c.Server, Token: c.Token}
+	}
+	return c.Profiles[name]
+}
+
+// SetProfile stores p under name, or under the current profile if name is
+// empty.
+func (c *Config) SetProfile(name string, p Profile) {
+	name = c.resolve(name)
+	if name == DefaultProfile {
+		c.Server, c.Token = p.Server, p.Token
+		return
+	}
+	if c.Profiles == nil {
+		c.Profiles = map[string]Profile{}
+	}
+	c.Profiles[name] = p
+}
+
+// HasProfile reports whether name has been configured.
+func (c *Config) HasProfile(name string) bool {
+	if name == DefaultProfile {
+		return c.Server != "" || c.Token != ""
+	}
+	_, ok := c.Profiles[name]
+	return ok
+}
+
+// ProfileNames lists the configured profiles in alphabetical order.
+func (c *Config) ProfileNames() []string {
+	var names []string
+	if c.HasProfile(DefaultProfile) {
+		names = append(names, DefaultProfile)
+	}
+	for name := range c.Profiles {
+		if name != DefaultProfile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 // ConfigPathOverride allows tests to override the config file path.
@@ -38,7 +118,46 @@ func LoadConfig() (*Config, error) {
 	return &cfg, nil
 }
 
+// CanonicalServerURL validates a server URL and strips trailing slashes so
+// paths can be appended to it directly.
+func CanonicalServerURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid server URL %q: scheme must be http or https", raw)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid server URL %q: missing host", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid server URL %q: must not contain a query or fragment", raw)
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
 func SaveConfig(cfg *Config) error {
+	if cfg.Server != "" {
+		server, err := CanonicalServerURL(cfg.Server)
+		if err != nil {
+			return err
+		}
+		cfg.Server = server
+	}
+	for name, p := range cfg.Profiles {
+		if p.Server == "" {
+			continue
+		}
+		server, err := CanonicalServerURL(p.Server)
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+		p.Server = server
+		cfg.Profiles[name] = p
+	}
 	data, err := yaml.Marshal(cfg)
 	if err != nil {
 		return err
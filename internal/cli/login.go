@@ -7,22 +7,53 @@ import (
 	"net/http"
 	"os/exec"
 	"runtime"
-	"strings"
 	"time"
 )
 
+// DefaultLoginTimeout is how long Login waits for the browser callback.
+const DefaultLoginTimeout = 2 * time.Minute
+
+// LoginOptions controls the local callback server used during login.
+type LoginOptions struct {
+	// CallbackHost is the interface the callback server binds to
+	// (default "localhost"). Use "127.0.0.1" to force IPv4 loopback.
+	CallbackHost string
+	// Timeout is how long to wait for the browser to complete the flow
+	// (default DefaultLoginTimeout).
+	Timeout time.Duration
+	// Profile is the profile the server and token are saved to; empty
+	// uses the current profile. A new name creates the profile.
+	Profile string
+}
+
 func Login(serverURL string) error {
+	return LoginWithOptions(serverURL, LoginOptions{})
+}
+
+// LoginWithOptions runs the browser login flow with a configurable callback
+// host and timeout.
+func LoginWithOptions(serverURL string, opts LoginOptions) error {
+	if opts.CallbackHost == "" {
+		opts.CallbackHost = "localhost"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultLoginTimeout
+	}
+
 	cfg, err := LoadConfig()
 	if err != nil {
 		return err
 	}
 	if serverURL == "" {
-		serverURL = cfg.Server
+		serverURL = cfg.Profile(opts.Profile).Server
 	}
 	if serverURL == "" {
 		serverURL = "http://localhost:8080"
 	}
-	serverURL = strings.TrimRight(serverURL, "/")
+	serverURL, err = CanonicalServerURL(serverURL)
+	if err != nil {
+		return err
+	}
 
 	tokenCh := make(chan string, 1)
 	errCh := make(chan error, 1)
@@ -41,13 +72,14 @@ func Login(serverURL string) error {
 		tokenCh <- token
 	})
 
-	listener, err := net.Listen("tcp", "localhost:0")
+	listener, err := net.Listen("tcp", net.JoinHostPort(opts.CallbackHost, "0"))
 	if err != nil {
-		return fmt.Errorf("failed to start local server: %w", err)
+		return fmt.Errorf("failed to start local callback server on %s: %w (try --callback-host 127.0.0.1)", opts.CallbackHost, err)
 	}
 	port := listener.Addr().(*net.TCPAddr).Port
 
 	srv := &http.Server{Handler: mux}
+	defer srv.Shutdown(context.Background())
 	go func() {
 		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
 			errCh <- err
@@ -61,8 +93,7 @@ func Login(serverURL string) error {
 	select {
 	case token := <-tokenCh:
 		name := <-nameCh
-		cfg.Server = serverURL
-		cfg.Token = token
+		cfg.SetProfile(opts.Profile, Profile{Server: serverURL, Token: token})
 		if err := SaveConfig(cfg); err != nil {
 			return fmt.Errorf("failed to save config: %w", err)
 		}
@@ -73,11 +104,9 @@ func Login(serverURL string) error {
 		}
 	case err := <-errCh:
 		return err
-	case <-time.After(2 * time.Minute):
-		return fmt.Errorf("login timed out (no callback received within 2 minutes)")
+	case <-time.After(opts.Timeout):
+		return fmt.Errorf("login timed out (no callback received within %s)", opts.Timeout)
 	}
-
-	srv.Shutdown(context.Background())
 	return nil
 }
 
@@ -3,11 +3,22 @@ package cli
 import "fmt"
 
 func Logout() error {
+	return LogoutProfile("")
+}
+
+// LogoutProfile removes the token stored for the named profile, or for the
+// current profile if name is empty.
+func LogoutProfile(name string) error {
 	cfg, err := LoadConfig()
 	if err != nil {
 		return err
 	}
-	cfg.Token = ""
+	if name != "" && !cfg.HasProfile(name) {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+	p := cfg.Profile(name)
+	p.Token = ""
+	cfg.SetProfile(name, p)
 	if err := SaveConfig(cfg); err != nil {
 		return err
 	}
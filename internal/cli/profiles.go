@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+)
+
+// ListProfiles writes one line per configured profile, marking the current
+// one with an asterisk.
+func ListProfiles(w io.Writer) error {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	names := cfg.ProfileNames()
+	if len(names) == 0 {
+		fmt.Fprintln(w, "No profiles configured. Run `design-reviewer login` first.")
+		return nil
+	}
+	current := cfg.resolve("")
+	for _, name := range names {
+		p := cfg.Profile(name)
+		mark := " "
+		if name == current {
+			mark = "*"
+		}
+		status := "logged in"
+		if p.Token == "" {
+			status = "logged out"
+		}
+		fmt.Fprintf(w, "%s %s\t%s\t(%s)\n", mark, name, p.Server, status)
+	}
+	return nil
+}
+
+// UseProfile makes name the profile commands use when --profile isn't given.
+func UseProfile(name string) error {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	if name != DefaultProfile && !cfg.HasProfile(name) {
+		return fmt.Errorf("unknown profile %q. Run `design-reviewer login --profile %s` to create it.", name, name)
+	}
+	cfg.Current = name
+	if name == DefaultProfile {
+		cfg.Current = ""
+	}
+	if err := SaveConfig(cfg); err != nil {
+		return err
+	}
+	fmt.Printf("Now using profile %s\n", name)
+	return nil
+}
@@ -3,6 +3,8 @@ package cli
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,29 +12,126 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
-func Push(dir, name, serverURL string) error {
+// PushOptions are the optional settings for a push.
+type PushOptions struct {
+	// ProjectID adds the version to that project instead of finding or
+	// creating one by name.
+	ProjectID string
+	// Width and Height record the canvas size the design was made for, in
+	// CSS pixels, overriding design.json. Zero leaves them unset.
+	Width, Height int
+	// Profile picks the server and token to push with; empty uses the
+	// current profile.
+	Profile string
+	// NoRetry fails on the first network error or unavailable server
+	// instead of retrying with backoff.
+	NoRetry bool
+}
+
+// Push zips dir and uploads it as a new version; dir may also be a single
+// .html file, which is uploaded as it is. With a projectID the
+// version is added to that project; otherwise the project is found or
+// created by name.
+func Push(dir, name, serverURL, projectID string) error {
+	return PushWithOptions(dir, name, serverURL, PushOptions{ProjectID: projectID})
+}
+
+// PushWithOptions is Push with a canvas size and the other PushOptions.
+func PushWithOptions(dir, name, serverURL string, opts PushOptions) error {
 	cfg, err := LoadConfig()
 	if err != nil {
 		return err
 	}
-	if cfg.Token == "" {
+	if opts.Profile != "" && !cfg.HasProfile(opts.Profile) {
+		return fmt.Errorf("unknown profile %q. Run `design-reviewer login --profile %s` first.", opts.Profile, opts.Profile)
+	}
+	profile := cfg.Profile(opts.Profile)
+	if profile.Token == "" {
 		return fmt.Errorf("Not logged in. Run `design-reviewer login` first.")
 	}
 	if serverURL == "" {
-		serverURL = cfg.Server
+		serverURL = profile.Server
 	}
 	if serverURL == "" {
 		serverURL = "http://localhost:8080"
 	}
-	serverURL = strings.TrimRight(serverURL, "/")
+	serverURL, err = CanonicalServerURL(serverURL)
+	if err != nil {
+		return err
+	}
+
+	var upload *bytes.Buffer
+	var uploadName string
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() && isHTMLFile(info.Name()) {
+		// A single page is uploaded as is; the server stores it as index.html.
+		data, err := os.ReadFile(dir)
+		if err != nil {
+			return err
+		}
+		upload, uploadName = bytes.NewBuffer(data), info.Name()
+		if name == "" {
+			name = strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
+		}
+	} else {
+		upload, uploadName, err = zipDesign(dir)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			name = filepath.Base(dir)
+		}
+	}
+
+	// The server checks the upload against this to catch corruption in
+	// transit.
+	sum := sha256.Sum256(upload.Bytes())
+	checksum := hex.EncodeToString(sum[:])
+
+	var result map[string]any
+	if int64(upload.Len()) > chunkedUploadThreshold {
+		result, err = uploadChunked(serverURL, profile.Token, name, opts, uploadName, checksum, upload.Bytes())
+	} else {
+		result, err = uploadSingle(serverURL, profile.Token, name, opts, uploadName, checksum, upload)
+	}
+	if err != nil {
+		return err
+	}
+
+	versionNum := result["version_num"]
+	fmt.Printf("Uploaded %s v%.0f\n", name, versionNum)
+	fmt.Printf("Review URL: %s/projects/%v\n", serverURL, result["project_id"])
+	if warnings, ok := result["warnings"].([]any); ok {
+		for _, w := range warnings {
+			fmt.Printf("Warning: %v\n", w)
+		}
+	}
+	return nil
+}
 
-	// Validate directory
+// Zips larger than chunkedUploadThreshold are sent in uploadChunkSize pieces
+// so a dropped connection only costs the current chunk.
+var (
+	chunkedUploadThreshold int64 = 8 << 20
+	uploadChunkSize        int64 = 4 << 20
+)
+
+// isHTMLFile reports whether name has an HTML extension.
+func isHTMLFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".html" || ext == ".htm"
+}
+
+// zipDesign checks that dir is a design directory and zips it, returning
+// the zip and the file name to upload it as.
+func zipDesign(dir string) (*bytes.Buffer, string, error) {
 	info, err := os.Stat(dir)
 	if err != nil || !info.IsDir() {
-		return fmt.Errorf("directory does not exist: %s", dir)
+		return nil, "", fmt.Errorf("directory does not exist: %s", dir)
 	}
 
 	// Check for at least one .html file
@@ -44,66 +143,181 @@ func Push(dir, name, serverURL string) error {
 		return nil
 	})
 	if !hasHTML {
-		return fmt.Errorf("Directory must contain at least one .html file")
-	}
-
-	if name == "" {
-		name = filepath.Base(dir)
+		return nil, "", fmt.Errorf("Directory must contain at least one .html file")
 	}
 
-	// Create zip
 	zipBuf, err := ZipDirectory(dir)
 	if err != nil {
-		return fmt.Errorf("failed to create zip: %w", err)
+		return nil, "", fmt.Errorf("failed to create zip: %w", err)
 	}
+	zipName := "upload.zip"
+	if abs, err := filepath.Abs(dir); err == nil {
+		zipName = filepath.Base(abs) + ".zip"
+	}
+	return zipBuf, zipName, nil
+}
+
+const chunkRetries = 3
 
-	// Build multipart request
+// checksumHeader carries the upload's hex SHA-256 for the server to verify.
+const checksumHeader = "X-Upload-SHA256"
+
+func uploadSingle(serverURL, token, name string, opts PushOptions, zipName, checksum string, zipData io.Reader) (map[string]any, error) {
 	var body bytes.Buffer
 	writer := multipart.NewWriter(&body)
-	part, err := writer.CreateFormFile("file", "upload.zip")
+	part, err := writer.CreateFormFile("file", zipName)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	io.Copy(part, zipBuf)
+	io.Copy(part, zipData)
 	writer.WriteField("name", name)
+	if opts.ProjectID != "" {
+		writer.WriteField("project_id", opts.ProjectID)
+	}
+	if opts.Width > 0 {
+		writer.WriteField("width", strconv.Itoa(opts.Width))
+	}
+	if opts.Height > 0 {
+		writer.WriteField("height", strconv.Itoa(opts.Height))
+	}
+	writer.WriteField("source", "design-reviewer-cli")
 	writer.Close()
 
 	req, err := http.NewRequest("POST", serverURL+"/api/upload", &body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	req.Header.Set(checksumHeader, checksum)
+	return doUploadRequest(req, token, opts.NoRetry)
+}
 
-	resp, err := http.DefaultClient.Do(req)
+func uploadChunked(serverURL, token, name string, opts PushOptions, zipName, checksum string, data []byte) (map[string]any, error) {
+	initBody, _ := json.Marshal(map[string]any{
+		"name":       name,
+		"project_id": opts.ProjectID,
+		"filename":   zipName,
+		"source":     "design-reviewer-cli",
+		"width":      opts.Width,
+		"height":     opts.Height,
+	})
+	req, err := http.NewRequest("POST", serverURL+"/api/upload/init", bytes.NewReader(initBody))
 	if err != nil {
-		return fmt.Errorf("upload failed: %w", err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	initResult, err := doUploadRequest(req, token, opts.NoRetry)
+	if err != nil {
+		return nil, err
+	}
+	uploadID, _ := initResult["upload_id"].(string)
+	if uploadID == "" {
+		return nil, fmt.Errorf("upload failed: server did not return an upload id")
 	}
-	defer resp.Body.Close()
-
-	var result map[string]any
-	respBody, _ := io.ReadAll(resp.Body)
 
-	if resp.StatusCode != http.StatusOK {
-		if err := json.Unmarshal(respBody, &result); err == nil {
-			if errMsg, ok := result["error"].(string); ok {
-				return fmt.Errorf("%s", errMsg)
+	maxFailures := chunkRetries
+	if opts.NoRetry {
+		maxFailures = 0
+	}
+	var offset int64
+	failures := 0
+	for offset < int64(len(data)) {
+		end := min(offset+uploadChunkSize, int64(len(data)))
+		req, err := http.NewRequest("PUT", fmt.Sprintf("%s/api/upload/%s/chunk?offset=%d", serverURL, uploadID, offset), bytes.NewReader(data[offset:end]))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil || resp.StatusCode >= 500 {
+			if resp != nil {
+				resp.Body.Close()
 			}
+			if failures++; failures > maxFailures {
+				if err == nil {
+					err = fmt.Errorf("server returned HTTP %d", resp.StatusCode)
+				} else {
+					err = networkError(req, err)
+				}
+				return nil, fmt.Errorf("upload failed at byte %d: %w", offset, err)
+			}
+			time.Sleep(retryBackoff << (failures - 1))
+			continue
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		var chunkResult struct {
+			Received *int64 `json:"received"`
+		}
+		json.Unmarshal(respBody, &chunkResult)
+		if resp.StatusCode == http.StatusConflict && chunkResult.Received != nil {
+			// Server has a different view of progress; resume from there
+			offset = *chunkResult.Received
+			continue
 		}
-		msg := strings.TrimSpace(string(respBody))
-		if msg == "" {
-			msg = "upload failed"
+		if resp.StatusCode != http.StatusOK {
+			return nil, uploadError(resp.StatusCode, respBody)
 		}
-		return fmt.Errorf("%s", msg)
+		if chunkResult.Received == nil {
+			return nil, fmt.Errorf("upload failed: unexpected chunk response")
+		}
+		offset = *chunkResult.Received
+		failures = 0
+	}
+
+	req, err = http.NewRequest("POST", serverURL+"/api/upload/"+uploadID+"/complete", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(checksumHeader, checksum)
+	return doUploadRequest(req, token, opts.NoRetry)
+}
+
+func doUploadRequest(req *http.Request, token string, noRetry bool) (map[string]any, error) {
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := doWithRetry(req, noRetry)
+	if err != nil {
+		return nil, fmt.Errorf("upload failed: %w", err)
 	}
+	defer resp.Body.Close()
 
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, uploadError(resp.StatusCode, respBody)
+	}
+	var result map[string]any
 	json.Unmarshal(respBody, &result)
+	return result, nil
+}
 
-	versionNum := result["version_num"]
-	projectID := result["project_id"]
-	fmt.Printf("Uploaded %s v%.0f\n", name, versionNum)
-	fmt.Printf("Review URL: %s/projects/%s\n", serverURL, projectID)
-	return nil
+// uploadError turns an error response into a message for the user. The
+// server's own explanation of a rejected upload is shown as it is; server
+// failures and responses without one name the HTTP status.
+func uploadError(status int, respBody []byte) error {
+	var result map[string]any
+	if err := json.Unmarshal(respBody, &result); err == nil {
+		switch result["code"] {
+		case "token_expired":
+			return fmt.Errorf("your login has expired. Run `design-reviewer login` to sign in again")
+		case "token_invalid":
+			return fmt.Errorf("your login is no longer valid. Run `design-reviewer login` to sign in again")
+		}
+		if errMsg, ok := result["error"].(string); ok {
+			if status >= 500 {
+				return fmt.Errorf("server error (HTTP %d): %s", status, errMsg)
+			}
+			return fmt.Errorf("%s", errMsg)
+		}
+	}
+	msg := strings.TrimSpace(string(respBody))
+	if msg == "" {
+		return fmt.Errorf("upload failed: server returned HTTP %d", status)
+	}
+	if status >= 500 {
+		return fmt.Errorf("server error (HTTP %d): %s", status, msg)
+	}
+	return fmt.Errorf("%s", msg)
 }
 
 func ZipDirectory(dir string) (*bytes.Buffer, error) {
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Requests that never reached a running server are retried up to
+// maxRetries times, waiting retryBackoff and then twice as long each time.
+// That covers a connection that couldn't be opened, and a proxy answering
+// 502 or 503 while the app starts (such as a machine waking from idle).
+// Anything else may have been acted on, so it isn't retried.
+const maxRetries = 3
+
+var retryBackoff = 500 * time.Millisecond
+
+// doWithRetry sends req with the retries above, or just once when noRetry
+// is set. A request with a body must have GetBody, as http.NewRequest sets
+// for in-memory readers.
+func doWithRetry(req *http.Request, noRetry bool) (*http.Response, error) {
+	delay := retryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := http.DefaultClient.Do(req)
+		retry := isDialError(err) || (err == nil && (resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable))
+		if !retry || noRetry || attempt == maxRetries {
+			if err != nil {
+				return nil, networkError(req, err)
+			}
+			return resp, nil
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		time.Sleep(delay)
+		delay *= 2
+		req = req.Clone(req.Context())
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// isDialError reports whether err means no connection to the server could
+// be opened, so the request wasn't sent.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// networkError describes a request that failed without an HTTP response,
+// as opposed to one the server answered with an error status.
+func networkError(req *http.Request, err error) error {
+	return fmt.Errorf("could not reach the server at %s (check your network and the server URL): %w", req.URL.Host, err)
+}
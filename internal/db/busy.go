@@ -0,0 +1,71 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// DefaultBusyTimeout is how long a connection waits for another writer to
+// finish before SQLite reports the database busy.
+const DefaultBusyTimeout = 5 * time.Second
+
+// A write still busy after the timeout is tried maxBusyRetries more times,
+// waiting busyRetryDelay and then twice as long each time. A busy statement
+// was never applied, so running it again is safe.
+const maxBusyRetries = 3
+
+var busyRetryDelay = 50 * time.Millisecond
+
+// isBusy reports whether err is SQLite refusing a statement because another
+// connection holds the lock it needs.
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// retryBusy runs fn, running it again while it fails with a busy error.
+func retryBusy(fn func() error) error {
+	delay := busyRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if !isBusy(err) || attempt == maxBusyRetries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// Exec is sql.DB's Exec, retried while the database is busy.
+func (d *DB) Exec(query string, args ...any) (sql.Result, error) {
+	var res sql.Result
+	err := retryBusy(func() (err error) {
+		res, err = d.DB.Exec(query, args...)
+		return err
+	})
+	return res, err
+}
+
+// writeRow runs a write that returns a row, such as an INSERT ... RETURNING,
+// and scans the row into dest, retrying while the database is busy. A busy
+// QueryRow only reports its error from Scan, so the two are retried together.
+func (d *DB) writeRow(query string, args []any, dest ...any) error {
+	return retryBusy(func() error {
+		return d.DB.QueryRow(query, args...).Scan(dest...)
+	})
+}
+
+// Begin starts a transaction, retrying while the database is busy.
+// Transactions take the write lock up front (see NewWithBusyTimeout), so
+// once one has begun its writes don't fail for want of the lock.
+func (d *DB) Begin() (*sql.Tx, error) {
+	var tx *sql.Tx
+	err := retryBusy(func() (err error) {
+		tx, err = d.DB.Begin()
+		return err
+	})
+	return tx, err
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestConcurrentWritesSucceed(t *testing.T) {
+	d, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	p, _ := d.CreateProject("busy", "")
+	v, _ := d.CreateVersion(p.ID, "")
+	first, _ := d.CreateComment(v.ID, "index.html", 1, 1, "A", "a@test.com", "first")
+
+	const n = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*n)
+	for i := 0; i < n; i++ {
+		wg.Add(4)
+		// A transaction that reads before it writes, as several do, can't
+		// wait out another writer once its snapshot is stale.
+		go func() {
+			defer wg.Done()
+			if err := readThenWrite(d, v.ID); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := d.CreateComment(v.ID, "index.html", 1, 1, "A", "a@test.com", "hi"); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := d.CreateReply(first.ID, "B", "b@test.com", "re"); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := d.ToggleResolve(first.ID, "a@test.com"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent write failed: %v", err)
+	}
+	if count, _ := d.CountCommentsForVersion(v.ID); count != n+1 {
+		t.Errorf("comments = %d, want %d", count, n+1)
+	}
+}
+
+func TestConcurrentPushesSucceed(t *testing.T) {
+	d, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	p, _ := d.CreateProject("busy", "")
+	v, _ := d.CreateVersion(p.ID, "")
+
+	const n = 30
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := d.CreateVersion(p.ID, "b@test.com"); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := readThenWrite(d, v.ID); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent write failed: %v", err)
+	}
+	versions, _ := d.ListVersions(p.ID)
+	seen := map[int]bool{}
+	for _, v := range versions {
+		seen[v.VersionNum] = true
+	}
+	if len(versions) != n+1 || len(seen) != n+1 {
+		t.Errorf("got %d versions with %d distinct numbers, want %d", len(versions), len(seen), n+1)
+	}
+}
+
+func readThenWrite(d *DB, versionID string) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM comments WHERE version_id = ?`, versionID).Scan(&count); err != nil {
+		return err
+	}
+	// Other writers commit meanwhile, as they would while a handler works.
+	time.Sleep(time.Millisecond)
+	if _, err := tx.Exec(`UPDATE versions SET canvas_width = ? WHERE id = ?`, count, versionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func TestRetryBusy(t *testing.T) {
+	old := busyRetryDelay
+	busyRetryDelay = 0
+	t.Cleanup(func() { busyRetryDelay = old })
+
+	calls := 0
+	err := retryBusy(func() error {
+		calls++
+		if calls < 3 {
+			return sqlite3.Error{Code: sqlite3.ErrBusy}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("got %v after %d calls, want success on the third", err, calls)
+	}
+
+	calls = 0
+	err = retryBusy(func() error { calls++; return sqlite3.Error{Code: sqlite3.ErrLocked} })
+	if !isBusy(err) || calls != maxBusyRetries+1 {
+		t.Errorf("got %v after %d calls, want the busy error after %d", err, calls, maxBusyRetries+1)
+	}
+
+	calls = 0
+	err = retryBusy(func() error { calls++; return sqlite3.Error{Code: sqlite3.ErrConstraint} })
+	if calls != 1 || isBusy(err) {
+		t.Errorf("other errors should not be retried: %v after %d calls", err, calls)
+	}
+}
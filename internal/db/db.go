@@ -5,11 +5,15 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 type Project struct {
@@ -24,6 +28,8 @@ type Project struct {
 type ProjectInvite struct {
 	ID        string
 	ProjectID string
+	// Token is the plaintext invite token, set only on the invite returned
+	// at creation; the database keeps just its hash.
 	Token     string
 	CreatedBy string
 	CreatedAt time.Time
@@ -33,17 +39,69 @@ type ProjectInvite struct {
 type ProjectMember struct {
 	ProjectID string
 	UserEmail string
+	Role      string
 	AddedAt   time.Time
 }
 
-type Version struct {
+// Project visibility. Private projects are seen by their owners and
+// members only; org projects by every signed-in user of the instance; public
+// projects also by anonymous visitors, read-only.
+const (
+	VisibilityPrivate = "private"
+	VisibilityOrg     = "org"
+	VisibilityPublic  = "public"
+)
+
+// Member roles. Co-owners ("owner") share the primary owner's capabilities.
+const (
+	RoleMember = "member"
+	RoleOwner  = "owner"
+)
+
+// PublicShare is a read-only link that lets anyone view a project without
+// signing in. CommentMode controls what anonymous viewers can do with comments.
+type PublicShare struct {
 	ID          string
 	ProjectID   string
-	VersionNum  int
-	StoragePath string
+	Token       string
+	CreatedBy   string
+	CommentMode string
 	CreatedAt   time.Time
 }
 
+// CommentTemplate is a canned comment a project's reviewers can insert
+// instead of typing the same feedback again.
+type CommentTemplate struct {
+	ID        string
+	ProjectID string
+	Body      string
+	CreatedBy string
+	CreatedAt time.Time
+}
+
+// Comment modes for public shares.
+const (
+	CommentModeHidden   = "hidden"   // comments are not shown
+	CommentModeReadOnly = "readonly" // comments are shown but can't be added
+	CommentModeOpen     = "open"     // anyone can comment under a display name
+)
+
+type Version struct {
+	ID             string
+	ProjectID      string
+	VersionNum     int
+	StoragePath    string
+	UploadFilename string
+	UploadSource   string
+	UploadSHA256   string // hex SHA-256 of the uploaded file, if the client sent one and it matched
+	CreatedByEmail string
+	Warnings       []string          // problems found in the upload, e.g. JavaScript that won't run
+	PageTitles     map[string]string // display titles for page tabs, keyed by file name
+	CanvasWidth    int               // width in CSS pixels the design was made for; 0 = unspecified
+	CanvasHeight   int               // optional canvas height; 0 = unspecified
+	CreatedAt      time.Time
+}
+
 type Comment struct {
 	ID          string
 	VersionID   string
@@ -54,7 +112,10 @@ type Comment struct {
 	AuthorEmail string
 	Body        string
 	Resolved    bool
+	Anchor      *string // CSS selector of the element the pin sits on; nil = position by percentages only
+	Assignee    string  // email of the reviewer the comment is assigned to; "" = unassigned
 	CreatedAt   time.Time
+	ResolvedAt  *time.Time // when the comment was last resolved; nil while open
 }
 
 type Reply struct {
@@ -63,11 +124,65 @@ type Reply struct {
 	AuthorName  string
 	AuthorEmail string
 	Body        string
+	Resolved    bool
 	CreatedAt   time.Time
 }
 
+// Comment event actions.
+const (
+	CommentEventResolve = "resolve"
+	CommentEventReopen  = "reopen"
+)
+
+// CommentEvent records who resolved or reopened a comment, and when.
+type CommentEvent struct {
+	ID         int64
+	CommentID  string
+	Action     string
+	ActorEmail string
+	CreatedAt  time.Time
+}
+
+type StatusChange struct {
+	ProjectID  string
+	FromStatus string
+	ToStatus   string
+	ChangedAt  time.Time
+}
+
+type ProjectSubscription struct {
+	ProjectID    string
+	UserEmail    string
+	LastDigestAt time.Time
+	CreatedAt    time.Time
+}
+
+// ProjectActivity is the new activity on a project within a time window.
+type ProjectActivity struct {
+	Comments      []Comment
+	Replies       []Reply
+	StatusChanges []StatusChange
+}
+
+// Empty reports whether there is no activity.
+func (a *ProjectActivity) Empty() bool {
+	return len(a.Comments) == 0 && len(a.Replies) == 0 && len(a.StatusChanges) == 0
+}
+
 type DB struct {
 	*sql.DB
+	// PrivateOnly treats every project as private whatever its visibility
+	// setting, for servers that disable public features.
+	PrivateOnly bool
+}
+
+// openToSignedIn is the SQL condition under which project p is open to
+// every signed-in user because of its visibility.
+func (d *DB) openToSignedIn() string {
+	if d.PrivateOnly {
+		return "0"
+	}
+	return "p.visibility IN ('org', 'public')"
 }
 
 const schema = `
@@ -76,6 +191,13 @@ CREATE TABLE IF NOT EXISTS projects (
     name TEXT UNIQUE NOT NULL,
     owner_email TEXT,
     status TEXT NOT NULL DEFAULT 'draft',
+    default_assignee_email TEXT NOT NULL DEFAULT '',
+    require_resolved_for_approval BOOLEAN NOT NULL DEFAULT 0,
+    visibility TEXT NOT NULL DEFAULT 'private',
+    pinned_version_id TEXT REFERENCES versions(id),
+    archived_at DATETIME,
+    keep BOOLEAN NOT NULL DEFAULT 0,
+    auto_in_review_on_comment BOOLEAN NOT NULL DEFAULT 0,
     created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
@@ -85,6 +207,15 @@ CREATE TABLE IF NOT EXISTS versions (
     project_id TEXT NOT NULL REFERENCES projects(id),
     version_num INTEGER NOT NULL,
     storage_path TEXT NOT NULL,
+    upload_filename TEXT NOT NULL DEFAULT '',
+    upload_source TEXT NOT NULL DEFAULT '',
+    upload_sha256 TEXT NOT NULL DEFAULT '',
+    created_by_email TEXT NOT NULL DEFAULT '',
+    page_order TEXT NOT NULL DEFAULT '',
+    warnings TEXT NOT NULL DEFAULT '',
+    page_titles TEXT NOT NULL DEFAULT '',
+    canvas_width INTEGER NOT NULL DEFAULT 0,
+    canvas_height INTEGER NOT NULL DEFAULT 0,
     created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -98,7 +229,10 @@ CREATE TABLE IF NOT EXISTS comments (
     author_email TEXT NOT NULL,
     body TEXT NOT NULL,
     resolved BOOLEAN NOT NULL DEFAULT 0,
-    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+    anchor TEXT,
+    assignee_email TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at DATETIME
 );
 
 CREATE TABLE IF NOT EXISTS replies (
@@ -107,6 +241,15 @@ CREATE TABLE IF NOT EXISTS replies (
     author_name TEXT NOT NULL,
     author_email TEXT NOT NULL,
     body TEXT NOT NULL,
+    resolved BOOLEAN NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS comment_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    comment_id TEXT NOT NULL REFERENCES comments(id),
+    action TEXT NOT NULL,
+    actor_email TEXT NOT NULL,
     created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -124,29 +267,127 @@ CREATE TABLE IF NOT EXISTS project_invites (
     token TEXT NOT NULL UNIQUE,
     created_by TEXT NOT NULL,
     created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    expires_at DATETIME
+    expires_at DATETIME,
+    token_hashed BOOLEAN NOT NULL DEFAULT 1
 );
 
 CREATE TABLE IF NOT EXISTS project_members (
     project_id TEXT NOT NULL REFERENCES projects(id),
     user_email TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member',
     added_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     PRIMARY KEY (project_id, user_email)
 );
 
+CREATE TABLE IF NOT EXISTS public_shares (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    token TEXT NOT NULL UNIQUE,
+    created_by TEXT NOT NULL,
+    comment_mode TEXT NOT NULL DEFAULT 'hidden',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS comment_templates (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    body TEXT NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
 CREATE TABLE IF NOT EXISTS sessions (
     id TEXT PRIMARY KEY,
     user_name TEXT NOT NULL,
     user_email TEXT NOT NULL,
     created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
+
+CREATE TABLE IF NOT EXISTS project_status_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    changed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS project_subscriptions (
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    user_email TEXT NOT NULL,
+    last_digest_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, user_email)
+);
+
+CREATE TABLE IF NOT EXISTS comment_watchers (
+    comment_id TEXT NOT NULL REFERENCES comments(id),
+    user_email TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (comment_id, user_email)
+);
+
+CREATE TABLE IF NOT EXISTS reply_notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_email TEXT NOT NULL,
+    comment_id TEXT NOT NULL REFERENCES comments(id),
+    reply_id TEXT NOT NULL REFERENCES replies(id),
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS settings (
+    key TEXT PRIMARY KEY,
+    value BLOB NOT NULL,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_prefs (
+    user_email TEXT PRIMARY KEY COLLATE NOCASE,
+    display_name TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
 `
 
 func New(dbPath string) (*DB, error) {
-	sqlDB, err := sql.Open("sqlite3", dbPath)
+	return NewWithBusyTimeout(dbPath, DefaultBusyTimeout)
+}
+
+// NewWithBusyTimeout opens the database at dbPath, where a connection waits
+// up to timeout for another writer before giving up. Transactions begin
+// IMMEDIATE: one that read first and then wrote could otherwise fail at once
+// when another writer committed in between.
+func NewWithBusyTimeout(dbPath string, timeout time.Duration) (*DB, error) {
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	dsn := fmt.Sprintf("%s%s_busy_timeout=%d&_txlock=immediate", dbPath, sep, timeout.Milliseconds())
+	sqlDB, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	return setup(sqlDB)
+}
+
+// NewInMemory returns a database that lives only in memory, for tests and
+// embedding. SQLite gives each connection its own memory database, so the
+// pool is held to a single connection.
+func NewInMemory() (*DB, error) {
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
 	if err != nil {
 		return nil, err
 	}
+	sqlDB.SetMaxOpenConns(1)
+	// The database is gone once its connection closes, so never let the
+	// pool drop it.
+	sqlDB.SetMaxIdleConns(1)
+	sqlDB.SetConnMaxLifetime(0)
+	sqlDB.SetConnMaxIdleTime(0)
+	return setup(sqlDB)
+}
+
+// setup applies the pragmas, schema and migrations to a freshly opened
+// database.
+func setup(sqlDB *sql.DB) (*DB, error) {
 	if _, err := sqlDB.Exec("PRAGMA journal_mode=WAL"); err != nil {
 		return nil, err
 	}
@@ -158,7 +399,77 @@ func New(dbPath string) (*DB, error) {
 	}
 	// Migration: add expires_at to tokens if missing
 	sqlDB.Exec(`ALTER TABLE tokens ADD COLUMN expires_at DATETIME DEFAULT '2099-12-31 23:59:59'`)
-	return &DB{sqlDB}, nil
+	// Migration: add upload_filename/upload_source to versions if missing
+	sqlDB.Exec(`ALTER TABLE versions ADD COLUMN upload_filename TEXT NOT NULL DEFAULT ''`)
+	sqlDB.Exec(`ALTER TABLE versions ADD COLUMN upload_source TEXT NOT NULL DEFAULT ''`)
+	sqlDB.Exec(`ALTER TABLE versions ADD COLUMN upload_sha256 TEXT NOT NULL DEFAULT ''`)
+	sqlDB.Exec(`ALTER TABLE versions ADD COLUMN created_by_email TEXT NOT NULL DEFAULT ''`)
+	sqlDB.Exec(`ALTER TABLE versions ADD COLUMN page_order TEXT NOT NULL DEFAULT ''`)
+	sqlDB.Exec(`ALTER TABLE versions ADD COLUMN warnings TEXT NOT NULL DEFAULT ''`)
+	sqlDB.Exec(`ALTER TABLE versions ADD COLUMN page_titles TEXT NOT NULL DEFAULT ''`)
+	sqlDB.Exec(`ALTER TABLE versions ADD COLUMN canvas_width INTEGER NOT NULL DEFAULT 0`)
+	sqlDB.Exec(`ALTER TABLE versions ADD COLUMN canvas_height INTEGER NOT NULL DEFAULT 0`)
+	sqlDB.Exec(`ALTER TABLE project_members ADD COLUMN role TEXT NOT NULL DEFAULT 'member'`)
+	sqlDB.Exec(`ALTER TABLE replies ADD COLUMN resolved BOOLEAN NOT NULL DEFAULT 0`)
+	sqlDB.Exec(`ALTER TABLE comments ADD COLUMN anchor TEXT`)
+	sqlDB.Exec(`ALTER TABLE comments ADD COLUMN assignee_email TEXT NOT NULL DEFAULT ''`)
+	sqlDB.Exec(`ALTER TABLE comments ADD COLUMN resolved_at DATETIME`)
+	sqlDB.Exec(`ALTER TABLE projects ADD COLUMN default_assignee_email TEXT NOT NULL DEFAULT ''`)
+	sqlDB.Exec(`ALTER TABLE projects ADD COLUMN require_resolved_for_approval BOOLEAN NOT NULL DEFAULT 0`)
+	sqlDB.Exec(`ALTER TABLE projects ADD COLUMN visibility TEXT NOT NULL DEFAULT 'private'`)
+	sqlDB.Exec(`ALTER TABLE projects ADD COLUMN pinned_version_id TEXT REFERENCES versions(id)`)
+	sqlDB.Exec(`ALTER TABLE projects ADD COLUMN archived_at DATETIME`)
+	sqlDB.Exec(`ALTER TABLE projects ADD COLUMN keep BOOLEAN NOT NULL DEFAULT 0`)
+	sqlDB.Exec(`ALTER TABLE projects ADD COLUMN auto_in_review_on_comment BOOLEAN NOT NULL DEFAULT 0`)
+	// Two pushes racing for the same version number must not both win. This
+	// is skipped on a database that already holds duplicates.
+	sqlDB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_versions_project_num ON versions(project_id, version_num)`)
+	// Author emails are stored trimmed and lowercased; bring older rows in
+	// line so author filters match them.
+	sqlDB.Exec(`UPDATE comments SET author_email = lower(trim(author_email)) WHERE author_email != lower(trim(author_email))`)
+	sqlDB.Exec(`UPDATE replies SET author_email = lower(trim(author_email)) WHERE author_email != lower(trim(author_email))`)
+	if err := hashInviteTokens(sqlDB); err != nil {
+		return nil, err
+	}
+	return &DB{DB: sqlDB}, nil
+}
+
+// hashInviteTokens migrates a project_invites table from before invite
+// tokens were hashed: adding token_hashed only succeeds on such a table, and
+// its existing plaintext tokens are hashed in the same transaction, so no
+// token is ever hashed twice.
+func hashInviteTokens(sqlDB *sql.DB) error {
+	tx, err := sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`ALTER TABLE project_invites ADD COLUMN token_hashed BOOLEAN NOT NULL DEFAULT 1`); err != nil {
+		return nil
+	}
+	rows, err := tx.Query(`SELECT id, token FROM project_invites`)
+	if err != nil {
+		return err
+	}
+	tokens := map[string]string{}
+	for rows.Next() {
+		var id, token string
+		if err := rows.Scan(&id, &token); err != nil {
+			rows.Close()
+			return err
+		}
+		tokens[id] = token
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, token := range tokens {
+		if _, err := tx.Exec(`UPDATE project_invites SET token = ? WHERE id = ?`, hashToken(token), id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 // --- Projects ---
@@ -174,10 +485,10 @@ func (d *DB) CreateProject(name, ownerEmail string) (*Project, error) {
 		owner = &ownerEmail
 	}
 	p.OwnerEmail = owner
-	err := d.QueryRow(
+	err := d.writeRow(
 		`INSERT INTO projects (id, name, owner_email, status) VALUES (?, ?, ?, ?) RETURNING created_at, updated_at`,
-		p.ID, p.Name, owner, p.Status,
-	).Scan(&p.CreatedAt, &p.UpdatedAt)
+		[]any{p.ID, p.Name, owner, p.Status},
+		&p.CreatedAt, &p.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -205,7 +516,7 @@ func (d *DB) GetProjectByName(name string) (*Project, error) {
 }
 
 func (d *DB) ListProjects() ([]Project, error) {
-	rows, err := d.Query(`SELECT id, name, owner_email, status, created_at, updated_at FROM projects ORDER BY updated_at DESC`)
+	rows, err := d.Query(`SELECT id, name, owner_email, status, created_at, updated_at FROM projects ORDER BY updated_at DESC, created_at DESC, id`)
 	if err != nil {
 		return nil, err
 	}
@@ -225,17 +536,26 @@ type ProjectWithVersionCount struct {
 	ID           string
 	Name         string
 	Status       string
+	OwnerEmail   string // empty for projects without an owner
 	VersionCount int
 	UpdatedAt    time.Time
+	// IsOwner is whether the user passed to
+	// ListProjectsWithVersionCountForUser owns or co-owns the project.
+	IsOwner  bool
+	Archived bool // archived by the retention job for inactivity
 }
 
+// ListProjectsWithVersionCount returns projects most recently updated first.
+// Ties on updated_at fall back to created_at and then id so the order is
+// stable across calls.
 func (d *DB) ListProjectsWithVersionCount() ([]ProjectWithVersionCount, error) {
 	rows, err := d.Query(`
-		SELECT p.id, p.name, p.status, COUNT(v.id) AS version_count, p.updated_at
+		SELECT p.id, p.name, p.status, COALESCE(p.owner_email, ''), COUNT(v.id) AS version_count, p.updated_at,
+		       p.archived_at IS NOT NULL
 		FROM projects p
 		LEFT JOIN versions v ON v.project_id = p.id
 		GROUP BY p.id
-		ORDER BY p.updated_at DESC`)
+		ORDER BY p.updated_at DESC, p.created_at DESC, p.id`)
 	if err != nil {
 		return nil, err
 	}
@@ -243,7 +563,7 @@ func (d *DB) ListProjectsWithVersionCount() ([]ProjectWithVersionCount, error) {
 	var projects []ProjectWithVersionCount
 	for rows.Next() {
 		var p ProjectWithVersionCount
-		if err := rows.Scan(&p.ID, &p.Name, &p.Status, &p.VersionCount, &p.UpdatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.Status, &p.OwnerEmail, &p.VersionCount, &p.UpdatedAt, &p.Archived); err != nil {
 			return nil, err
 		}
 		projects = append(projects, p)
@@ -256,73 +576,249 @@ var validStatuses = map[string]bool{
 }
 
 func (d *DB) UpdateProjectStatus(id, status string) error {
+	return d.UpdateProjectStatuses([]string{id}, status)
+}
+
+// UpdateProjectStatuses sets the status of every project in ids in one
+// transaction: if any of them doesn't exist, none are changed and the
+// error is sql.ErrNoRows.
+func (d *DB) UpdateProjectStatuses(ids []string, status string) error {
 	if !validStatuses[status] {
 		return fmt.Errorf("invalid status %q: must be one of draft, in_review, approved, handed_off", status)
 	}
-	res, err := d.Exec(`UPDATE projects SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, status, id)
+	tx, err := d.Begin()
 	if err != nil {
 		return err
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		return sql.ErrNoRows
+	defer tx.Rollback()
+	for _, id := range ids {
+		// Record actual transitions only; uploads re-save the same status to bump updated_at.
+		if _, err := tx.Exec(
+			`INSERT INTO project_status_changes (project_id, from_status, to_status)
+			 SELECT id, status, ? FROM projects WHERE id = ? AND status != ?`,
+			status, id, status); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`UPDATE projects SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, status, id)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			return sql.ErrNoRows
+		}
 	}
-	return nil
+	return tx.Commit()
 }
 
 // --- Versions ---
 
+const versionColumns = `id, project_id, version_num, storage_path, upload_filename, upload_source, upload_sha256, created_by_email, warnings, page_titles, canvas_width, canvas_height, created_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVersion(row rowScanner, v *Version) error {
+	var warnings, titles string
+	if err := row.Scan(&v.ID, &v.ProjectID, &v.VersionNum, &v.StoragePath, &v.UploadFilename, &v.UploadSource, &v.UploadSHA256, &v.CreatedByEmail, &warnings, &titles, &v.CanvasWidth, &v.CanvasHeight, &v.CreatedAt); err != nil {
+		return err
+	}
+	if warnings != "" {
+		if err := json.Unmarshal([]byte(warnings), &v.Warnings); err != nil {
+			return err
+		}
+	}
+	if titles != "" {
+		return json.Unmarshal([]byte(titles), &v.PageTitles)
+	}
+	return nil
+}
+
 func (d *DB) CreateVersion(projectID, storagePath string) (*Version, error) {
+	return d.CreateVersionBy(projectID, storagePath, "")
+}
+
+// ErrVersionConflict is returned by CreateVersionBy when a concurrent push
+// took the version number first. Trying again picks the next number.
+var ErrVersionConflict = errors.New("version number already taken")
+
+// CreateVersionBy creates a version recording the email of the user who
+// pushed it. createdBy may be empty (auth disabled, seed data).
+func (d *DB) CreateVersionBy(projectID, storagePath, createdBy string) (*Version, error) {
 	v := &Version{
-		ID:          uuid.NewString(),
-		ProjectID:   projectID,
-		StoragePath: storagePath,
+		ID:             uuid.NewString(),
+		ProjectID:      projectID,
+		StoragePath:    storagePath,
+		CreatedByEmail: createdBy,
 	}
-	err := d.QueryRow(
-		`INSERT INTO versions (id, project_id, version_num, storage_path)
-		 VALUES (?, ?, COALESCE((SELECT MAX(version_num) FROM versions WHERE project_id = ?), 0) + 1, ?)
+	err := d.writeRow(
+		`INSERT INTO versions (id, project_id, version_num, storage_path, created_by_email)
+		 VALUES (?, ?, COALESCE((SELECT MAX(version_num) FROM versions WHERE project_id = ?), 0) + 1, ?, ?)
 		 RETURNING version_num, created_at`,
-		v.ID, v.ProjectID, v.ProjectID, v.StoragePath,
-	).Scan(&v.VersionNum, &v.CreatedAt)
+		[]any{v.ID, v.ProjectID, v.ProjectID, v.StoragePath, v.CreatedByEmail},
+		&v.VersionNum, &v.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, ErrVersionConflict
+	}
 	if err != nil {
 		return nil, err
 	}
+	// A new version is activity, so it brings an archived project back.
+	if _, err := d.Exec(`UPDATE projects SET archived_at = NULL WHERE id = ?`, projectID); err != nil {
+		return nil, err
+	}
 	return v, nil
 }
 
+// isUniqueViolation reports whether err is SQLite rejecting a duplicate
+// value in a unique column or index.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// SetVersionUploadInfo records the original upload filename and the client
+// that sent it.
+func (d *DB) SetVersionUploadInfo(id, filename, source string) error {
+	_, err := d.Exec(`UPDATE versions SET upload_filename = ?, upload_source = ? WHERE id = ?`, filename, source, id)
+	return err
+}
+
+// SetVersionChecksum records the verified SHA-256 of a version's upload,
+// for auditing it later.
+func (d *DB) SetVersionChecksum(id, sum string) error {
+	_, err := d.Exec(`UPDATE versions SET upload_sha256 = ? WHERE id = ?`, sum, id)
+	return err
+}
+
+// SetVersionWarnings records problems found in a version's upload. An
+// empty list clears them.
+func (d *DB) SetVersionWarnings(id string, warnings []string) error {
+	raw := ""
+	if len(warnings) > 0 {
+		b, err := json.Marshal(warnings)
+		if err != nil {
+			return err
+		}
+		raw = string(b)
+	}
+	_, err := d.Exec(`UPDATE versions SET warnings = ? WHERE id = ?`, raw, id)
+	return err
+}
+
+// SetPageTitles stores display titles for a version's page tabs, keyed by
+// file name. An empty map clears them.
+func (d *DB) SetPageTitles(versionID string, titles map[string]string) error {
+	raw := ""
+	if len(titles) > 0 {
+		b, err := json.Marshal(titles)
+		if err != nil {
+			return err
+		}
+		raw = string(b)
+	}
+	_, err := d.Exec(`UPDATE versions SET page_titles = ? WHERE id = ?`, raw, versionID)
+	return err
+}
+
+// SetCanvasSize records the frame size a version was designed for. Zero
+// leaves a dimension unspecified.
+func (d *DB) SetCanvasSize(versionID string, width, height int) error {
+	if width < 0 || height < 0 {
+		return fmt.Errorf("invalid canvas size %dx%d", width, height)
+	}
+	_, err := d.Exec(`UPDATE versions SET canvas_width = ?, canvas_height = ? WHERE id = ?`, width, height, versionID)
+	return err
+}
+
+// GetPageOrder returns the custom page tab order for a version, or nil if
+// none has been set.
+func (d *DB) GetPageOrder(versionID string) ([]string, error) {
+	var raw string
+	if err := d.QueryRow(`SELECT page_order FROM versions WHERE id = ?`, versionID).Scan(&raw); err != nil {
+		return nil, err
+	}
+	if raw == "" {
+		return nil, nil
+	}
+	var pages []string
+	if err := json.Unmarshal([]byte(raw), &pages); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// SetPageOrder stores a custom page tab order for a version. An empty list
+// restores the default order.
+func (d *DB) SetPageOrder(versionID string, pages []string) error {
+	raw := ""
+	if len(pages) > 0 {
+		b, err := json.Marshal(pages)
+		if err != nil {
+			return err
+		}
+		raw = string(b)
+	}
+	res, err := d.Exec(`UPDATE versions SET page_order = ? WHERE id = ?`, raw, versionID)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 func (d *DB) GetVersion(id string) (*Version, error) {
 	v := &Version{}
-	err := d.QueryRow(`SELECT id, project_id, version_num, storage_path, created_at FROM versions WHERE id = ?`, id).
-		Scan(&v.ID, &v.ProjectID, &v.VersionNum, &v.StoragePath, &v.CreatedAt)
-	if err != nil {
+	if err := scanVersion(d.QueryRow(`SELECT `+versionColumns+` FROM versions WHERE id = ?`, id), v); err != nil {
 		return nil, err
 	}
 	return v, nil
 }
 
 func (d *DB) ListVersions(projectID string) ([]Version, error) {
-	rows, err := d.Query(`SELECT id, project_id, version_num, storage_path, created_at FROM versions WHERE project_id = ? ORDER BY version_num DESC`, projectID)
+	versions, _, err := d.ListVersionsPage(projectID, 0, 0)
+	return versions, err
+}
+
+// ListVersionsPage returns a project's versions newest first, skipping
+// offset and returning at most limit (0 = no limit), together with the
+// total number of versions in the project.
+func (d *DB) ListVersionsPage(projectID string, limit, offset int) ([]Version, int, error) {
+	var total int
+	if err := d.QueryRow(`SELECT COUNT(*) FROM versions WHERE project_id = ?`, projectID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 {
+		limit = -1 // SQLite: no limit
+	}
+	rows, err := d.Query(
+		`SELECT `+versionColumns+` FROM versions WHERE project_id = ? ORDER BY version_num DESC LIMIT ? OFFSET ?`,
+		projectID, limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 	var versions []Version
 	for rows.Next() {
 		var v Version
-		if err := rows.Scan(&v.ID, &v.ProjectID, &v.VersionNum, &v.StoragePath, &v.CreatedAt); err != nil {
-			return nil, err
+		if err := scanVersion(rows, &v); err != nil {
+			return nil, 0, err
 		}
 		versions = append(versions, v)
 	}
-	return versions, rows.Err()
+	return versions, total, rows.Err()
 }
 
 func (d *DB) GetLatestVersion(projectID string) (*Version, error) {
 	v := &Version{}
-	err := d.QueryRow(
-		`SELECT id, project_id, version_num, storage_path, created_at FROM versions WHERE project_id = ? ORDER BY version_num DESC LIMIT 1`,
+	err := scanVersion(d.QueryRow(
+		`SELECT `+versionColumns+` FROM versions WHERE project_id = ? ORDER BY version_num DESC LIMIT 1`,
 		projectID,
-	).Scan(&v.ID, &v.ProjectID, &v.VersionNum, &v.StoragePath, &v.CreatedAt)
+	), v)
 	if err != nil {
 		return nil, err
 	}
@@ -331,7 +827,28 @@ func (d *DB) GetLatestVersion(projectID string) (*Version, error) {
 
 // --- Comments ---
 
+// commentColumns selects a comment from the "comments c" table alias.
+const commentColumns = `c.id, c.version_id, c.page, c.x_percent, c.y_percent, c.author_name, c.author_email, c.body, c.resolved, c.anchor, c.assignee_email, c.created_at, c.resolved_at`
+
+func scanComment(row rowScanner, c *Comment) error {
+	return row.Scan(&c.ID, &c.VersionID, &c.Page, &c.XPercent, &c.YPercent, &c.AuthorName, &c.AuthorEmail, &c.Body, &c.Resolved, &c.Anchor, &c.Assignee, &c.CreatedAt, &c.ResolvedAt)
+}
+
+// nullIfEmpty stores an empty string as NULL.
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
 func (d *DB) CreateComment(versionID, page string, xPercent, yPercent float64, authorName, authorEmail, body string) (*Comment, error) {
+	return d.CreateCommentWithAnchor(versionID, page, xPercent, yPercent, "", authorName, authorEmail, body)
+}
+
+// CreateCommentWithAnchor creates a comment pinned to the element matched by
+// anchor. An empty anchor stores NULL.
+func (d *DB) CreateCommentWithAnchor(versionID, page string, xPercent, yPercent float64, anchor, authorName, authorEmail, body string) (*Comment, error) {
 	c := &Comment{
 		ID:          uuid.NewString(),
 		VersionID:   versionID,
@@ -341,22 +858,55 @@ func (d *DB) CreateComment(versionID, page string, xPercent, yPercent float64, a
 		AuthorName:  authorName,
 		AuthorEmail: authorEmail,
 		Body:        body,
+		Anchor:      nullIfEmpty(anchor),
 	}
-	err := d.QueryRow(
-		`INSERT INTO comments (id, version_id, page, x_percent, y_percent, author_name, author_email, body)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING resolved, created_at`,
-		c.ID, c.VersionID, c.Page, c.XPercent, c.YPercent, c.AuthorName, c.AuthorEmail, c.Body,
+	tx, err := d.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRow(
+		`INSERT INTO comments (id, version_id, page, x_percent, y_percent, author_name, author_email, body, anchor)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING resolved, created_at`,
+		c.ID, c.VersionID, c.Page, c.XPercent, c.YPercent, c.AuthorName, c.AuthorEmail, c.Body, c.Anchor,
 	).Scan(&c.Resolved, &c.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
-	return c, nil
+	// The author watches their comment for replies.
+	if c.AuthorEmail != "" {
+		if _, err := tx.Exec(`INSERT INTO comment_watchers (comment_id, user_email) VALUES (?, ?)`, c.ID, c.AuthorEmail); err != nil {
+			return nil, err
+		}
+	}
+	return c, tx.Commit()
+}
+
+// SetCommentAssignee assigns a comment to a reviewer; an empty email
+// unassigns it.
+func (d *DB) SetCommentAssignee(id, email string) error {
+	res, err := d.Exec(`UPDATE comments SET assignee_email = ? WHERE id = ?`, email, id)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CountCommentsForVersion returns how many comments were left on a version,
+// resolved or not. Carried-over comments count toward their own version.
+func (d *DB) CountCommentsForVersion(versionID string) (int, error) {
+	var n int
+	err := d.QueryRow(`SELECT COUNT(*) FROM comments WHERE version_id = ?`, versionID).Scan(&n)
+	return n, err
 }
 
 func (d *DB) GetCommentsForVersion(versionID string) ([]Comment, error) {
 	rows, err := d.Query(
-		`SELECT id, version_id, page, x_percent, y_percent, author_name, author_email, body, resolved, created_at
-		 FROM comments WHERE version_id = ?`, versionID)
+		`SELECT `+commentColumns+` FROM comments c WHERE c.version_id = ?`, versionID)
 	if err != nil {
 		return nil, err
 	}
@@ -364,7 +914,7 @@ func (d *DB) GetCommentsForVersion(versionID string) ([]Comment, error) {
 	var comments []Comment
 	for rows.Next() {
 		var c Comment
-		if err := rows.Scan(&c.ID, &c.VersionID, &c.Page, &c.XPercent, &c.YPercent, &c.AuthorName, &c.AuthorEmail, &c.Body, &c.Resolved, &c.CreatedAt); err != nil {
+		if err := scanComment(rows, &c); err != nil {
 			return nil, err
 		}
 		comments = append(comments, c)
@@ -374,7 +924,7 @@ func (d *DB) GetCommentsForVersion(versionID string) ([]Comment, error) {
 
 func (d *DB) GetUnresolvedCommentsUpTo(versionID string) ([]Comment, error) {
 	rows, err := d.Query(
-		`SELECT c.id, c.version_id, c.page, c.x_percent, c.y_percent, c.author_name, c.author_email, c.body, c.resolved, c.created_at
+		`SELECT `+commentColumns+`
 		 FROM comments c
 		 JOIN versions v ON c.version_id = v.id
 		 WHERE c.resolved = 0
@@ -388,7 +938,38 @@ func (d *DB) GetUnresolvedCommentsUpTo(versionID string) ([]Comment, error) {
 	var comments []Comment
 	for rows.Next() {
 		var c Comment
-		if err := rows.Scan(&c.ID, &c.VersionID, &c.Page, &c.XPercent, &c.YPercent, &c.AuthorName, &c.AuthorEmail, &c.Body, &c.Resolved, &c.CreatedAt); err != nil {
+		if err := scanComment(rows, &c); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// GetVersionCommentsOnPage returns the comments shown on one page of a
+// version: unresolved ones carried over from earlier versions plus resolved
+// ones left on this version, in the same order as merging
+// GetUnresolvedCommentsUpTo and GetCommentsForVersion.
+func (d *DB) GetVersionCommentsOnPage(versionID, page string) ([]Comment, error) {
+	rows, err := d.Query(
+		`SELECT `+commentColumns+`
+		 FROM comments c
+		 JOIN versions v ON c.version_id = v.id
+		 WHERE c.page = ?
+		   AND ((c.resolved = 0
+		         AND v.project_id = (SELECT project_id FROM versions WHERE id = ?)
+		         AND v.version_num <= (SELECT version_num FROM versions WHERE id = ?))
+		     OR (c.resolved = 1 AND c.version_id = ?))
+		 ORDER BY c.resolved, c.rowid`,
+		page, versionID, versionID, versionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var comments []Comment
+	for rows.Next() {
+		var c Comment
+		if err := scanComment(rows, &c); err != nil {
 			return nil, err
 		}
 		comments = append(comments, c)
@@ -398,28 +979,291 @@ func (d *DB) GetUnresolvedCommentsUpTo(versionID string) ([]Comment, error) {
 
 func (d *DB) GetComment(id string) (*Comment, error) {
 	c := &Comment{}
-	err := d.QueryRow(`SELECT id, version_id, page, x_percent, y_percent, author_name, author_email, body, resolved, created_at FROM comments WHERE id = ?`, id).
-		Scan(&c.ID, &c.VersionID, &c.Page, &c.XPercent, &c.YPercent, &c.AuthorName, &c.AuthorEmail, &c.Body, &c.Resolved, &c.CreatedAt)
-	if err != nil {
+	if err := scanComment(d.QueryRow(`SELECT `+commentColumns+` FROM comments c WHERE c.id = ?`, id), c); err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
+// GetCommentWithReplies returns a comment and its replies, oldest first, in
+// one query. It returns sql.ErrNoRows if the comment doesn't exist.
+func (d *DB) GetCommentWithReplies(id string) (*Comment, []Reply, error) {
+	rows, err := d.Query(
+		`SELECT `+commentColumns+`, r.id, r.author_name, r.author_email, r.body, r.resolved, r.created_at
+		 FROM comments c
+		 LEFT JOIN replies r ON r.comment_id = c.id
+		 WHERE c.id = ?
+		 ORDER BY r.created_at ASC, r.rowid ASC`, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var c *Comment
+	var replies []Reply
+	for rows.Next() {
+		var row Comment
+		var replyID, name, email, body *string
+		var resolved *bool
+		var createdAt *time.Time
+		if err := rows.Scan(&row.ID, &row.VersionID, &row.Page, &row.XPercent, &row.YPercent, &row.AuthorName, &row.AuthorEmail, &row.Body, &row.Resolved, &row.Anchor, &row.Assignee, &row.CreatedAt, &row.ResolvedAt,
+			&replyID, &name, &email, &body, &resolved, &createdAt); err != nil {
+			return nil, nil, err
+		}
+		if c == nil {
+			c = &row
+		}
+		// A comment without replies comes back as one row of NULLs.
+		if replyID != nil {
+			replies = append(replies, Reply{
+				ID: *replyID, CommentID: c.ID, AuthorName: *name, AuthorEmail: *email,
+				Body: *body, Resolved: *resolved, CreatedAt: *createdAt,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if c == nil {
+		return nil, nil, sql.ErrNoRows
+	}
+	return c, replies, nil
+}
+
 func (d *DB) MoveComment(id string, x, y float64) error {
-	_, err := d.Exec("UPDATE comments SET x_percent=?, y_percent=? WHERE id=?", x, y, id)
+	return d.MoveCommentWithAnchor(id, x, y, "")
+}
+
+// MoveCommentWithAnchor repositions a comment and replaces its anchor. The
+// old anchor no longer describes the new position, so an empty anchor
+// clears it.
+func (d *DB) MoveCommentWithAnchor(id string, x, y float64, anchor string) error {
+	_, err := d.Exec("UPDATE comments SET x_percent=?, y_percent=?, anchor=? WHERE id=?", x, y, nullIfEmpty(anchor), id)
 	return err
 }
 
-func (d *DB) ToggleResolve(commentID string) (bool, error) {
-	var resolved bool
-	err := d.QueryRow(`UPDATE comments SET resolved = NOT resolved WHERE id = ? RETURNING resolved`, commentID).Scan(&resolved)
+// UpdateCommentPage moves a comment to another page, for comments left on
+// a page that was renamed in a later version.
+func (d *DB) UpdateCommentPage(id, page string) error {
+	res, err := d.Exec("UPDATE comments SET page=? WHERE id=?", page, id)
 	if err != nil {
-		return false, err
+		return err
 	}
-	return resolved, nil
-}
-
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MoveCommentsToPage moves every comment on page from to page to, as
+// UpdateCommentPage does for one, for a version including comments carried
+// over from earlier versions. It returns how many comments were moved.
+func (d *DB) MoveCommentsToPage(versionID, from, to string) (int, error) {
+	tx, err := d.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(
+		`UPDATE comments SET page = ?
+		 WHERE page = ? AND version_id IN (
+		   SELECT id FROM versions
+		   WHERE project_id = (SELECT project_id FROM versions WHERE id = ?)
+		     AND version_num <= (SELECT version_num FROM versions WHERE id = ?))`,
+		to, from, versionID, versionID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+// ToggleResolve flips a comment's resolved state and records the change as
+// a comment event by actorEmail, which may be empty when auth is disabled.
+func (d *DB) ToggleResolve(commentID, actorEmail string) (bool, error) {
+	tx, err := d.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var resolved bool
+	// The CASE sees the old value of resolved, so resolving stamps the time
+	// and reopening clears it.
+	err = tx.QueryRow(
+		`UPDATE comments SET resolved = NOT resolved,
+		   resolved_at = CASE WHEN resolved THEN NULL ELSE CURRENT_TIMESTAMP END
+		 WHERE id = ? RETURNING resolved`, commentID).Scan(&resolved)
+	if err != nil {
+		return false, err
+	}
+	action := CommentEventReopen
+	if resolved {
+		action = CommentEventResolve
+	}
+	if _, err := tx.Exec(`INSERT INTO comment_events (comment_id, action, actor_email) VALUES (?, ?, ?)`,
+		commentID, action, actorEmail); err != nil {
+		return false, err
+	}
+	return resolved, tx.Commit()
+}
+
+// ResolveCommentsByAuthor resolves every open comment by authorEmail shown
+// on a version, including those carried over from earlier versions, and
+// records a resolve event by actorEmail for each, all in one transaction.
+// It returns how many comments were resolved.
+func (d *DB) ResolveCommentsByAuthor(versionID, authorEmail, actorEmail string) (int, error) {
+	tx, err := d.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query(
+		`UPDATE comments SET resolved = 1, resolved_at = CURRENT_TIMESTAMP
+		 WHERE resolved = 0 AND author_email = ? COLLATE NOCASE
+		   AND version_id IN (
+		     SELECT id FROM versions
+		     WHERE project_id = (SELECT project_id FROM versions WHERE id = ?)
+		       AND version_num <= (SELECT version_num FROM versions WHERE id = ?))
+		 RETURNING id`, authorEmail, versionID, versionID)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if _, err := tx.Exec(`INSERT INTO comment_events (comment_id, action, actor_email) VALUES (?, ?, ?)`,
+			id, CommentEventResolve, actorEmail); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+// ErrAlreadyResolved is returned by ResolveWithReply for a comment that is
+// already resolved.
+var ErrAlreadyResolved = errors.New("comment is already resolved")
+
+// ResolveWithReply resolves an open comment and adds a closing reply by the
+// actor in one transaction, so the comment is never resolved without its
+// note or the other way round.
+func (d *DB) ResolveWithReply(commentID, actorName, actorEmail, body string) (*Reply, error) {
+	tx, err := d.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(
+		`UPDATE comments SET resolved = 1, resolved_at = CURRENT_TIMESTAMP WHERE id = ? AND NOT resolved`, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var exists bool
+		if err := tx.QueryRow(`SELECT 1 FROM comments WHERE id = ?`, commentID).Scan(&exists); err != nil {
+			return nil, err
+		}
+		return nil, ErrAlreadyResolved
+	}
+	if _, err := tx.Exec(`INSERT INTO comment_events (comment_id, action, actor_email) VALUES (?, ?, ?)`,
+		commentID, CommentEventResolve, actorEmail); err != nil {
+		return nil, err
+	}
+	r := &Reply{
+		ID:          uuid.NewString(),
+		CommentID:   commentID,
+		AuthorName:  actorName,
+		AuthorEmail: actorEmail,
+		Body:        body,
+	}
+	err = tx.QueryRow(
+		`INSERT INTO replies (id, comment_id, author_name, author_email, body)
+		 VALUES (?, ?, ?, ?, ?) RETURNING created_at`,
+		r.ID, r.CommentID, r.AuthorName, r.AuthorEmail, r.Body,
+	).Scan(&r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := notifyWatchers(tx, r); err != nil {
+		return nil, err
+	}
+	return r, tx.Commit()
+}
+
+// CommentMetrics summarises how a project's comments get resolved. The
+// resolve times only cover comments with a recorded resolved_at, so they are
+// nil when none has one.
+type CommentMetrics struct {
+	Open                 int
+	Resolved             int
+	AvgResolveSeconds    *float64
+	MedianResolveSeconds *float64
+}
+
+// GetCommentMetrics counts a project's open and resolved comments and
+// computes the average and median time from creation to resolution.
+func (d *DB) GetCommentMetrics(projectID string) (*CommentMetrics, error) {
+	const resolveSeconds = `(julianday(c.resolved_at) - julianday(c.created_at)) * 86400`
+	const projectComments = `FROM comments c JOIN versions v ON c.version_id = v.id WHERE v.project_id = ?`
+	m := &CommentMetrics{}
+	var timed int
+	err := d.QueryRow(
+		`SELECT COALESCE(SUM(c.resolved = 0), 0), COALESCE(SUM(c.resolved = 1), 0),
+		        COUNT(c.resolved_at), AVG(`+resolveSeconds+`) `+projectComments,
+		projectID).Scan(&m.Open, &m.Resolved, &timed, &m.AvgResolveSeconds)
+	if err != nil {
+		return nil, err
+	}
+	if timed == 0 {
+		return m, nil
+	}
+	// The median is the middle value, or the mean of the two middle values
+	// when the count is even.
+	var median float64
+	err = d.QueryRow(
+		`SELECT AVG(s) FROM (SELECT `+resolveSeconds+` AS s `+projectComments+`
+		   AND c.resolved_at IS NOT NULL ORDER BY s LIMIT ? OFFSET ?)`,
+		projectID, 2-timed%2, (timed-1)/2).Scan(&median)
+	if err != nil {
+		return nil, err
+	}
+	m.MedianResolveSeconds = &median
+	return m, nil
+}
+
+// GetCommentEvents returns a comment's resolve/reopen history, oldest first.
+func (d *DB) GetCommentEvents(commentID string) ([]CommentEvent, error) {
+	rows, err := d.Query(
+		`SELECT id, comment_id, action, actor_email, created_at FROM comment_events
+		 WHERE comment_id = ? ORDER BY id`, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []CommentEvent
+	for rows.Next() {
+		var e CommentEvent
+		if err := rows.Scan(&e.ID, &e.CommentID, &e.Action, &e.ActorEmail, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
 // --- Replies ---
 
 func (d *DB) CreateReply(commentID, authorName, authorEmail, body string) (*Reply, error) {
@@ -430,7 +1274,12 @@ func (d *DB) CreateReply(commentID, authorName, authorEmail, body string) (*Repl
 		AuthorEmail: authorEmail,
 		Body:        body,
 	}
-	err := d.QueryRow(
+	tx, err := d.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRow(
 		`INSERT INTO replies (id, comment_id, author_name, author_email, body)
 		 VALUES (?, ?, ?, ?, ?) RETURNING created_at`,
 		r.ID, r.CommentID, r.AuthorName, r.AuthorEmail, r.Body,
@@ -438,12 +1287,15 @@ func (d *DB) CreateReply(commentID, authorName, authorEmail, body string) (*Repl
 	if err != nil {
 		return nil, err
 	}
-	return r, nil
+	if err := notifyWatchers(tx, r); err != nil {
+		return nil, err
+	}
+	return r, tx.Commit()
 }
 
 func (d *DB) GetReplies(commentID string) ([]Reply, error) {
 	rows, err := d.Query(
-		`SELECT id, comment_id, author_name, author_email, body, created_at
+		`SELECT id, comment_id, author_name, author_email, body, resolved, created_at
 		 FROM replies WHERE comment_id = ? ORDER BY created_at ASC`, commentID)
 	if err != nil {
 		return nil, err
@@ -452,7 +1304,7 @@ func (d *DB) GetReplies(commentID string) ([]Reply, error) {
 	var replies []Reply
 	for rows.Next() {
 		var r Reply
-		if err := rows.Scan(&r.ID, &r.CommentID, &r.AuthorName, &r.AuthorEmail, &r.Body, &r.CreatedAt); err != nil {
+		if err := rows.Scan(&r.ID, &r.CommentID, &r.AuthorName, &r.AuthorEmail, &r.Body, &r.Resolved, &r.CreatedAt); err != nil {
 			return nil, err
 		}
 		replies = append(replies, r)
@@ -460,6 +1312,28 @@ func (d *DB) GetReplies(commentID string) ([]Reply, error) {
 	return replies, rows.Err()
 }
 
+func (d *DB) GetReply(id string) (*Reply, error) {
+	r := &Reply{}
+	err := d.QueryRow(
+		`SELECT id, comment_id, author_name, author_email, body, resolved, created_at FROM replies WHERE id = ?`, id,
+	).Scan(&r.ID, &r.CommentID, &r.AuthorName, &r.AuthorEmail, &r.Body, &r.Resolved, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ToggleReplyResolve flips a single reply's resolved flag. The parent
+// comment's resolution is left untouched.
+func (d *DB) ToggleReplyResolve(replyID string) (bool, error) {
+	var resolved bool
+	err := d.writeRow(`UPDATE replies SET resolved = NOT resolved WHERE id = ? RETURNING resolved`, []any{replyID}, &resolved)
+	if err != nil {
+		return false, err
+	}
+	return resolved, nil
+}
+
 // --- Tokens ---
 
 func hashToken(token string) string {
@@ -472,23 +1346,38 @@ func (d *DB) CreateToken(token, userName, userEmail string) error {
 	return err
 }
 
+// ErrTokenExpired is returned by GetUserByToken for a token that exists but
+// is past its expiry. Unknown tokens give sql.ErrNoRows.
+var ErrTokenExpired = errors.New("token expired")
+
 func (d *DB) GetUserByToken(token string) (name, email string, err error) {
-	err = d.QueryRow(`SELECT user_name, user_email FROM tokens WHERE token = ? AND expires_at > CURRENT_TIMESTAMP`, hashToken(token)).Scan(&name, &email)
-	return
+	var valid bool
+	err = d.QueryRow(`SELECT user_name, user_email, COALESCE(expires_at > CURRENT_TIMESTAMP, 0) FROM tokens WHERE token = ?`, hashToken(token)).Scan(&name, &email, &valid)
+	if err != nil {
+		return "", "", err
+	}
+	if !valid {
+		return "", "", ErrTokenExpired
+	}
+	return name, email, nil
 }
 
 // --- Sharing ---
 
 func (d *DB) ListProjectsWithVersionCountForUser(email string) ([]ProjectWithVersionCount, error) {
 	rows, err := d.Query(`
-		SELECT p.id, p.name, p.status, COUNT(v.id) AS version_count, p.updated_at
+		SELECT p.id, p.name, p.status, COALESCE(p.owner_email, ''), COUNT(v.id) AS version_count, p.updated_at,
+		       COALESCE(p.owner_email = ?, 0)
+		          OR EXISTS (SELECT 1 FROM project_members pm WHERE pm.project_id = p.id AND pm.user_email = ? AND pm.role = ?),
+		       p.archived_at IS NOT NULL
 		FROM projects p
 		LEFT JOIN versions v ON v.project_id = p.id
 		WHERE p.owner_email IS NULL
 		   OR p.owner_email = ?
+		   OR (`+d.openToSignedIn()+` AND ? != '')
 		   OR EXISTS (SELECT 1 FROM project_members pm WHERE pm.project_id = p.id AND pm.user_email = ?)
 		GROUP BY p.id
-		ORDER BY p.updated_at DESC`, email, email)
+		ORDER BY p.updated_at DESC, p.created_at DESC, p.id`, email, email, RoleOwner, email, email, email)
 	if err != nil {
 		return nil, err
 	}
@@ -496,7 +1385,7 @@ func (d *DB) ListProjectsWithVersionCountForUser(email string) ([]ProjectWithVer
 	var projects []ProjectWithVersionCount
 	for rows.Next() {
 		var p ProjectWithVersionCount
-		if err := rows.Scan(&p.ID, &p.Name, &p.Status, &p.VersionCount, &p.UpdatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.Status, &p.OwnerEmail, &p.VersionCount, &p.UpdatedAt, &p.IsOwner, &p.Archived); err != nil {
 			return nil, err
 		}
 		projects = append(projects, p)
@@ -504,7 +1393,53 @@ func (d *DB) ListProjectsWithVersionCountForUser(email string) ([]ProjectWithVer
 	return projects, rows.Err()
 }
 
+// ProjectSummary counts the projects a user can access.
+type ProjectSummary struct {
+	Projects         int
+	Owned            int // owned or co-owned by the user
+	WithOpenComments int // with at least one unresolved comment
+}
+
+// GetProjectSummary counts the projects ListProjectsWithVersionCountForUser
+// would list for email, or every project when email is empty.
+func (d *DB) GetProjectSummary(email string) (*ProjectSummary, error) {
+	var s ProjectSummary
+	err := d.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(owned), 0), COALESCE(SUM(open), 0) FROM (
+			SELECT COALESCE(p.owner_email = ?, 0)
+			          OR EXISTS (SELECT 1 FROM project_members pm WHERE pm.project_id = p.id AND pm.user_email = ? AND pm.role = ?) AS owned,
+			       EXISTS (SELECT 1 FROM comments c JOIN versions v ON c.version_id = v.id
+			               WHERE v.project_id = p.id AND c.resolved = 0) AS open
+			FROM projects p
+			WHERE ? = ''
+			   OR p.owner_email IS NULL
+			   OR p.owner_email = ?
+			   OR `+d.openToSignedIn()+`
+			   OR EXISTS (SELECT 1 FROM project_members pm WHERE pm.project_id = p.id AND pm.user_email = ?)
+		)`, email, email, RoleOwner, email, email, email).Scan(&s.Projects, &s.Owned, &s.WithOpenComments)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
 func (d *DB) CanAccessProject(projectID, email string) (bool, error) {
+	var count int
+	err := d.QueryRow(`
+		SELECT COUNT(*) FROM projects p
+		WHERE p.id = ?
+		  AND (p.owner_email IS NULL OR p.owner_email = ?
+		       OR (`+d.openToSignedIn()+` AND ? != '')
+		       OR EXISTS (SELECT 1 FROM project_members pm WHERE pm.project_id = p.id AND pm.user_email = ?))`,
+		projectID, email, email, email).Scan(&count)
+	return count > 0, err
+}
+
+// CanWriteProject is CanAccessProject without visibility: org and public
+// projects can be read by every signed-in user, but only their owners and
+// members may push versions or post to them. Projects without an owner stay
+// open to everyone.
+func (d *DB) CanWriteProject(projectID, email string) (bool, error) {
 	var count int
 	err := d.QueryRow(`
 		SELECT COUNT(*) FROM projects p
@@ -515,99 +1450,943 @@ func (d *DB) CanAccessProject(projectID, email string) (bool, error) {
 	return count > 0, err
 }
 
-func (d *DB) GetProjectOwner(projectID string) (string, error) {
-	var owner sql.NullString
-	err := d.QueryRow(`SELECT owner_email FROM projects WHERE id = ?`, projectID).Scan(&owner)
-	if err != nil {
-		return "", err
-	}
-	return owner.String, nil
+// GetDefaultAssignee returns the email new comments on the project are
+// assigned to, or "" if auto-assignment is off.
+func (d *DB) GetDefaultAssignee(projectID string) (string, error) {
+	var email string
+	err := d.QueryRow(`SELECT default_assignee_email FROM projects WHERE id = ?`, projectID).Scan(&email)
+	return email, err
 }
 
-func (d *DB) CreateInvite(projectID, createdBy string) (*ProjectInvite, error) {
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
-		return nil, err
-	}
-	inv := &ProjectInvite{
-		ID:        uuid.NewString(),
-		ProjectID: projectID,
-		Token:     hex.EncodeToString(b),
-		CreatedBy: createdBy,
-	}
+// GetDefaultAssigneeForVersion is GetDefaultAssignee for the project a
+// version belongs to. It returns "" if the version does not exist.
+func (d *DB) GetDefaultAssigneeForVersion(versionID string) (string, error) {
+	var email string
 	err := d.QueryRow(
-		`INSERT INTO project_invites (id, project_id, token, created_by, expires_at) VALUES (?, ?, ?, ?, datetime('now', '+7 days')) RETURNING created_at, expires_at`,
-		inv.ID, inv.ProjectID, inv.Token, inv.CreatedBy,
-	).Scan(&inv.CreatedAt, &inv.ExpiresAt)
+		`SELECT p.default_assignee_email FROM projects p JOIN versions v ON v.project_id = p.id WHERE v.id = ?`,
+		versionID).Scan(&email)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return email, err
+}
+
+// SetDefaultAssignee sets the project's default assignee; an empty email
+// turns auto-assignment off.
+func (d *DB) SetDefaultAssignee(projectID, email string) error {
+	res, err := d.Exec(`UPDATE projects SET default_assignee_email = ? WHERE id = ?`, email, projectID)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return inv, nil
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-func (d *DB) GetInviteByToken(token string) (*ProjectInvite, error) {
-	inv := &ProjectInvite{}
-	err := d.QueryRow(
-		`SELECT id, project_id, token, created_by, created_at, expires_at FROM project_invites WHERE token = ?`, token,
-	).Scan(&inv.ID, &inv.ProjectID, &inv.Token, &inv.CreatedBy, &inv.CreatedAt, &inv.ExpiresAt)
+// GetProjectVisibility returns VisibilityPrivate, VisibilityOrg or
+// VisibilityPublic.
+func (d *DB) GetProjectVisibility(projectID string) (string, error) {
+	var visibility string
+	err := d.QueryRow(`SELECT visibility FROM projects WHERE id = ?`, projectID).Scan(&visibility)
+	return visibility, err
+}
+
+// SetProjectVisibility makes a project private, visible to every signed-in
+// user, or public.
+func (d *DB) SetProjectVisibility(projectID, visibility string) error {
+	if visibility != VisibilityPrivate && visibility != VisibilityOrg && visibility != VisibilityPublic {
+		return fmt.Errorf("invalid visibility %q: must be private, org or public", visibility)
+	}
+	res, err := d.Exec(`UPDATE projects SET visibility = ? WHERE id = ?`, visibility, projectID)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if inv.ExpiresAt == nil || inv.ExpiresAt.Before(time.Now()) {
-		return nil, sql.ErrNoRows
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
 	}
-	return inv, nil
+	return nil
 }
 
-func (d *DB) DeleteInvite(id string) error {
-	_, err := d.Exec(`DELETE FROM project_invites WHERE id = ?`, id)
-	return err
+// ErrVersionNotInProject is returned when pinning a version that isn't one
+// of the project's.
+var ErrVersionNotInProject = errors.New("version does not belong to the project")
+
+// GetPinnedVersion returns the ID of the version the project's viewer opens
+// by default, or "" if none is pinned and it opens the latest.
+func (d *DB) GetPinnedVersion(projectID string) (string, error) {
+	var versionID sql.NullString
+	err := d.QueryRow(`SELECT pinned_version_id FROM projects WHERE id = ?`, projectID).Scan(&versionID)
+	return versionID.String, err
 }
 
-func (d *DB) AddMember(projectID, email string) error {
-	_, err := d.Exec(
-		`INSERT OR IGNORE INTO project_members (project_id, user_email) VALUES (?, ?)`,
-		projectID, email)
-	return err
+// SetPinnedVersion pins one of the project's versions; an empty versionID
+// unpins. It returns ErrVersionNotInProject for a version of another
+// project or one that doesn't exist.
+func (d *DB) SetPinnedVersion(projectID, versionID string) error {
+	var pinned any
+	if versionID != "" {
+		var owner string
+		err := d.QueryRow(`SELECT project_id FROM versions WHERE id = ?`, versionID).Scan(&owner)
+		if err == sql.ErrNoRows || (err == nil && owner != projectID) {
+			return ErrVersionNotInProject
+		}
+		if err != nil {
+			return err
+		}
+		pinned = versionID
+	}
+	res, err := d.Exec(`UPDATE projects SET pinned_version_id = ? WHERE id = ?`, pinned, projectID)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-func (d *DB) ListMembers(projectID string) ([]ProjectMember, error) {
-	rows, err := d.Query(
-		`SELECT project_id, user_email, added_at FROM project_members WHERE project_id = ? ORDER BY added_at`, projectID)
+// ArchiveStaleProjects archives every project with no new version, comment
+// or reply since cutoff (a project with none at all counts from its
+// creation), skipping projects already archived or with the keep flag. It
+// returns the projects it archived.
+func (d *DB) ArchiveStaleProjects(cutoff time.Time) ([]Project, error) {
+	var archived []Project
+	err := retryBusy(func() error {
+		archived = nil
+		return d.archiveStaleProjects(cutoff, &archived)
+	})
+	return archived, err
+}
+
+func (d *DB) archiveStaleProjects(cutoff time.Time, archived *[]Project) error {
+	rows, err := d.DB.Query(`
+		UPDATE projects SET archived_at = CURRENT_TIMESTAMP
+		WHERE archived_at IS NULL AND NOT keep
+		  AND MAX(
+		        created_at,
+		        COALESCE((SELECT MAX(v.created_at) FROM versions v WHERE v.project_id = projects.id), ''),
+		        COALESCE((SELECT MAX(c.created_at) FROM comments c JOIN versions v ON c.version_id = v.id
+		                  WHERE v.project_id = projects.id), ''),
+		        COALESCE((SELECT MAX(r.created_at) FROM replies r JOIN comments c ON r.comment_id = c.id
+		                  JOIN versions v ON c.version_id = v.id WHERE v.project_id = projects.id), '')
+		      ) < ?
+		RETURNING id, name, owner_email, status, created_at, updated_at`, sqliteTime(cutoff))
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
-	var members []ProjectMember
 	for rows.Next() {
-		var m ProjectMember
-		if err := rows.Scan(&m.ProjectID, &m.UserEmail, &m.AddedAt); err != nil {
-			return nil, err
+		var p Project
+		if err := rows.Scan(&p.ID, &p.Name, &p.OwnerEmail, &p.Status, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return err
 		}
-		members = append(members, m)
+		*archived = append(*archived, p)
 	}
-	return members, rows.Err()
+	return rows.Err()
 }
 
-func (d *DB) RemoveMember(projectID, email string) error {
-	_, err := d.Exec(`DELETE FROM project_members WHERE project_id = ? AND user_email = ?`, projectID, email)
-	return err
+// SetProjectKeep sets whether the retention job leaves the project alone.
+// Keeping a project also brings it back if it was already archived.
+func (d *DB) SetProjectKeep(projectID string, keep bool) error {
+	query := `UPDATE projects SET keep = ? WHERE id = ?`
+	if keep {
+		query = `UPDATE projects SET keep = ?, archived_at = NULL WHERE id = ?`
+	}
+	res, err := d.Exec(query, keep, projectID)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-// --- Sessions ---
+// GetProjectRetention returns whether the project has the keep flag and
+// whether it is archived.
+func (d *DB) GetProjectRetention(projectID string) (keep, archived bool, err error) {
+	err = d.QueryRow(`SELECT keep, archived_at IS NOT NULL FROM projects WHERE id = ?`, projectID).Scan(&keep, &archived)
+	return keep, archived, err
+}
 
-func (d *DB) CreateSession(id, userName, userEmail string) error {
-	_, err := d.Exec(`INSERT INTO sessions (id, user_name, user_email) VALUES (?, ?, ?)`, id, userName, userEmail)
-	return err
+// GetRequireResolvedForApproval reports whether the project may only be
+// approved once every comment on its latest version is resolved.
+func (d *DB) GetRequireResolvedForApproval(projectID string) (bool, error) {
+	var required bool
+	err := d.QueryRow(`SELECT require_resolved_for_approval FROM projects WHERE id = ?`, projectID).Scan(&required)
+	return required, err
 }
 
-func (d *DB) GetSession(id string) (string, string, error) {
-	var name, email string
-	err := d.QueryRow(`SELECT user_name, user_email FROM sessions WHERE id = ?`, id).Scan(&name, &email)
-	return name, email, err
+// SetRequireResolvedForApproval turns the approval gate on or off.
+func (d *DB) SetRequireResolvedForApproval(projectID string, required bool) error {
+	res, err := d.Exec(`UPDATE projects SET require_resolved_for_approval = ? WHERE id = ?`, required, projectID)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-func (d *DB) DeleteSession(id string) error {
-	_, err := d.Exec(`DELETE FROM sessions WHERE id = ?`, id)
-	return err
+// GetAutoInReviewOnComment reports whether the project moves from draft to
+// in_review when its first comment is left.
+func (d *DB) GetAutoInReviewOnComment(projectID string) (bool, error) {
+	var enabled bool
+	err := d.QueryRow(`SELECT auto_in_review_on_comment FROM projects WHERE id = ?`, projectID).Scan(&enabled)
+	return enabled, err
+}
+
+// SetAutoInReviewOnComment turns the draft-to-in_review transition on the
+// first comment on or off.
+func (d *DB) SetAutoInReviewOnComment(projectID string, enabled bool) error {
+	res, err := d.Exec(`UPDATE projects SET auto_in_review_on_comment = ? WHERE id = ?`, enabled, projectID)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// StartReviewOnFirstComment moves the version's project from draft to
+// in_review, recording the status change, if the project has
+// auto_in_review_on_comment set and the comment just left is its only one.
+// It reports whether the status changed.
+func (d *DB) StartReviewOnFirstComment(versionID string) (bool, error) {
+	tx, err := d.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var projectID string
+	err = tx.QueryRow(
+		`SELECT p.id FROM projects p JOIN versions v ON v.project_id = p.id
+		 WHERE v.id = ? AND p.status = 'draft' AND p.auto_in_review_on_comment
+		   AND (SELECT COUNT(*) FROM comments c JOIN versions cv ON c.version_id = cv.id WHERE cv.project_id = p.id) = 1`,
+		versionID).Scan(&projectID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO project_status_changes (project_id, from_status, to_status) VALUES (?, 'draft', 'in_review')`,
+		projectID); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`UPDATE projects SET status = 'in_review', updated_at = CURRENT_TIMESTAMP WHERE id = ?`, projectID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// IsOwner reports whether email is the primary owner or a co-owner of the
+// project. It returns sql.ErrNoRows if the project does not exist.
+func (d *DB) IsOwner(projectID, email string) (bool, error) {
+	var owner sql.NullString
+	if err := d.QueryRow(`SELECT owner_email FROM projects WHERE id = ?`, projectID).Scan(&owner); err != nil {
+		return false, err
+	}
+	if email == "" {
+		return false, nil
+	}
+	if owner.Valid && owner.String == email {
+		return true, nil
+	}
+	var count int
+	err := d.QueryRow(
+		`SELECT COUNT(*) FROM project_members WHERE project_id = ? AND user_email = ? AND role = ?`,
+		projectID, email, RoleOwner).Scan(&count)
+	return count > 0, err
+}
+
+// GetProjectOwner returns the primary owner's email, used for display.
+func (d *DB) GetProjectOwner(projectID string) (string, error) {
+	var owner sql.NullString
+	err := d.QueryRow(`SELECT owner_email FROM projects WHERE id = ?`, projectID).Scan(&owner)
+	if err != nil {
+		return "", err
+	}
+	return owner.String, nil
+}
+
+func (d *DB) CreateInvite(projectID, createdBy string) (*ProjectInvite, error) {
+	return d.createInvite(projectID, createdBy, longInviteToken)
+}
+
+// CreateShortInvite is CreateInvite with a 22-character base62 token, which
+// is easier to paste into chat than the 64-character hex one. Its 128
+// random bits still can't be guessed.
+func (d *DB) CreateShortInvite(projectID, createdBy string) (*ProjectInvite, error) {
+	return d.createInvite(projectID, createdBy, shortInviteToken)
+}
+
+// maxInviteAttempts bounds how many tokens createInvite tries when a new
+// token collides with an existing one.
+const maxInviteAttempts = 3
+
+func (d *DB) createInvite(projectID, createdBy string, newToken func() (string, error)) (*ProjectInvite, error) {
+	for attempt := 1; ; attempt++ {
+		token, err := newToken()
+		if err != nil {
+			return nil, err
+		}
+		inv := &ProjectInvite{
+			ID:        uuid.NewString(),
+			ProjectID: projectID,
+			Token:     token,
+			CreatedBy: createdBy,
+		}
+		err = d.writeRow(
+			`INSERT INTO project_invites (id, project_id, token, created_by, expires_at) VALUES (?, ?, ?, ?, datetime('now', '+7 days')) RETURNING created_at, expires_at`,
+			[]any{inv.ID, inv.ProjectID, hashToken(inv.Token), inv.CreatedBy},
+			&inv.CreatedAt, &inv.ExpiresAt)
+		if isUniqueViolation(err) && attempt < maxInviteAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return inv, nil
+	}
+}
+
+// longInviteToken is 32 random bytes in hex.
+func longInviteToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// shortInviteLen is the length of 16 random bytes in base62.
+const shortInviteLen = 22
+
+// shortInviteToken is 16 random bytes in base62, zero-padded so every token
+// has the same length.
+func shortInviteToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := new(big.Int).SetBytes(b).Text(62)
+	return strings.Repeat("0", shortInviteLen-len(s)) + s, nil
+}
+
+// GetInviteByToken looks an invite up by the hash of its plaintext token.
+// The returned invite's Token is left empty.
+func (d *DB) GetInviteByToken(token string) (*ProjectInvite, error) {
+	inv := &ProjectInvite{}
+	err := d.QueryRow(
+		`SELECT id, project_id, created_by, created_at, expires_at FROM project_invites WHERE token = ?`, hashToken(token),
+	).Scan(&inv.ID, &inv.ProjectID, &inv.CreatedBy, &inv.CreatedAt, &inv.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if inv.ExpiresAt == nil || inv.ExpiresAt.Before(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	return inv, nil
+}
+
+func (d *DB) DeleteInvite(id string) error {
+	_, err := d.Exec(`DELETE FROM project_invites WHERE id = ?`, id)
+	return err
+}
+
+func (d *DB) AddMember(projectID, email string) error {
+	_, err := d.Exec(
+		`INSERT OR IGNORE INTO project_members (project_id, user_email) VALUES (?, ?)`,
+		projectID, email)
+	return err
+}
+
+func (d *DB) ListMembers(projectID string) ([]ProjectMember, error) {
+	rows, err := d.Query(
+		`SELECT project_id, user_email, role, added_at FROM project_members WHERE project_id = ? ORDER BY added_at`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []ProjectMember
+	for rows.Next() {
+		var m ProjectMember
+		if err := rows.Scan(&m.ProjectID, &m.UserEmail, &m.Role, &m.AddedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// SetMemberRole changes an existing member's role. It returns
+// sql.ErrNoRows if email is not a member of the project.
+func (d *DB) SetMemberRole(projectID, email, role string) error {
+	res, err := d.Exec(`UPDATE project_members SET role = ? WHERE project_id = ? AND user_email = ?`, role, projectID, email)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *DB) RemoveMember(projectID, email string) error {
+	_, err := d.Exec(`DELETE FROM project_members WHERE project_id = ? AND user_email = ?`, projectID, email)
+	return err
+}
+
+// IsMemberOfAnyProject reports whether email has been added as a member of
+// at least one project.
+func (d *DB) IsMemberOfAnyProject(email string) (bool, error) {
+	var count int
+	err := d.QueryRow(`SELECT COUNT(*) FROM project_members WHERE user_email = ?`, email).Scan(&count)
+	return count > 0, err
+}
+
+// --- Public shares ---
+
+func (d *DB) CreatePublicShare(projectID, createdBy, commentMode string) (*PublicShare, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	ps := &PublicShare{
+		ID:          uuid.NewString(),
+		ProjectID:   projectID,
+		Token:       hex.EncodeToString(b),
+		CreatedBy:   createdBy,
+		CommentMode: commentMode,
+	}
+	err := d.writeRow(
+		`INSERT INTO public_shares (id, project_id, token, created_by, comment_mode) VALUES (?, ?, ?, ?, ?) RETURNING created_at`,
+		[]any{ps.ID, ps.ProjectID, ps.Token, ps.CreatedBy, ps.CommentMode},
+		&ps.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+func (d *DB) GetPublicShareByToken(token string) (*PublicShare, error) {
+	ps := &PublicShare{}
+	err := d.QueryRow(
+		`SELECT id, project_id, token, created_by, comment_mode, created_at FROM public_shares WHERE token = ?`, token,
+	).Scan(&ps.ID, &ps.ProjectID, &ps.Token, &ps.CreatedBy, &ps.CommentMode, &ps.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+func (d *DB) ListPublicShares(projectID string) ([]PublicShare, error) {
+	rows, err := d.Query(
+		`SELECT id, project_id, token, created_by, comment_mode, created_at FROM public_shares WHERE project_id = ? ORDER BY created_at`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var shares []PublicShare
+	for rows.Next() {
+		var ps PublicShare
+		if err := rows.Scan(&ps.ID, &ps.ProjectID, &ps.Token, &ps.CreatedBy, &ps.CommentMode, &ps.CreatedAt); err != nil {
+			return nil, err
+		}
+		shares = append(shares, ps)
+	}
+	return shares, rows.Err()
+}
+
+// SetPublicShareCommentMode changes a share's comment mode. It returns
+// sql.ErrNoRows if the share does not belong to the project.
+func (d *DB) SetPublicShareCommentMode(projectID, id, commentMode string) error {
+	res, err := d.Exec(`UPDATE public_shares SET comment_mode = ? WHERE id = ? AND project_id = ?`, commentMode, id, projectID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *DB) DeletePublicShare(projectID, id string) error {
+	_, err := d.Exec(`DELETE FROM public_shares WHERE id = ? AND project_id = ?`, id, projectID)
+	return err
+}
+
+// --- Comment templates ---
+
+func (d *DB) CreateCommentTemplate(projectID, body, createdBy string) (*CommentTemplate, error) {
+	ct := &CommentTemplate{
+		ID:        uuid.NewString(),
+		ProjectID: projectID,
+		Body:      body,
+		CreatedBy: createdBy,
+	}
+	err := d.writeRow(
+		`INSERT INTO comment_templates (id, project_id, body, created_by) VALUES (?, ?, ?, ?) RETURNING created_at`,
+		[]any{ct.ID, ct.ProjectID, ct.Body, ct.CreatedBy},
+		&ct.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+// ListCommentTemplates returns a project's templates, oldest first.
+func (d *DB) ListCommentTemplates(projectID string) ([]CommentTemplate, error) {
+	rows, err := d.Query(
+		`SELECT id, project_id, body, created_by, created_at FROM comment_templates WHERE project_id = ? ORDER BY created_at, rowid`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var templates []CommentTemplate
+	for rows.Next() {
+		var ct CommentTemplate
+		if err := rows.Scan(&ct.ID, &ct.ProjectID, &ct.Body, &ct.CreatedBy, &ct.CreatedAt); err != nil {
+			return nil, err
+		}
+		templates = append(templates, ct)
+	}
+	return templates, rows.Err()
+}
+
+// DeleteCommentTemplate deletes a template. It returns sql.ErrNoRows if the
+// template does not belong to the project.
+func (d *DB) DeleteCommentTemplate(projectID, id string) error {
+	res, err := d.Exec(`DELETE FROM comment_templates WHERE id = ? AND project_id = ?`, id, projectID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// --- Comment watchers ---
+
+// ReplyNotification tells a comment's watcher about a reply to it.
+type ReplyNotification struct {
+	ID              int64
+	CommentID       string
+	ReplyID         string
+	ProjectID       string
+	VersionID       string
+	Page            string
+	ReplyAuthorName string
+	ReplyBody       string
+	CreatedAt       time.Time
+}
+
+// notifyWatchers records a notification of reply r for everyone watching
+// its comment except the reply's author.
+func notifyWatchers(tx *sql.Tx, r *Reply) error {
+	_, err := tx.Exec(
+		`INSERT INTO reply_notifications (user_email, comment_id, reply_id)
+		 SELECT user_email, comment_id, ? FROM comment_watchers WHERE comment_id = ? AND user_email != ?`,
+		r.ID, r.CommentID, r.AuthorEmail)
+	return err
+}
+
+func (d *DB) WatchComment(commentID, email string) error {
+	_, err := d.Exec(
+		`INSERT OR IGNORE INTO comment_watchers (comment_id, user_email) VALUES (?, ?)`,
+		commentID, email)
+	return err
+}
+
+func (d *DB) UnwatchComment(commentID, email string) error {
+	_, err := d.Exec(`DELETE FROM comment_watchers WHERE comment_id = ? AND user_email = ?`, commentID, email)
+	return err
+}
+
+func (d *DB) IsWatchingComment(commentID, email string) (bool, error) {
+	var count int
+	err := d.QueryRow(
+		`SELECT COUNT(*) FROM comment_watchers WHERE comment_id = ? AND user_email = ?`,
+		commentID, email).Scan(&count)
+	return count > 0, err
+}
+
+// ListReplyNotifications returns up to limit of a user's reply
+// notifications, newest first.
+func (d *DB) ListReplyNotifications(email string, limit int) ([]ReplyNotification, error) {
+	rows, err := d.Query(
+		`SELECT n.id, n.comment_id, n.reply_id, v.project_id, c.version_id, c.page, r.author_name, r.body, n.created_at
+		 FROM reply_notifications n
+		 JOIN replies r ON r.id = n.reply_id
+		 JOIN comments c ON c.id = n.comment_id
+		 JOIN versions v ON v.id = c.version_id
+		 WHERE n.user_email = ?
+		 ORDER BY n.id DESC LIMIT ?`, email, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var notes []ReplyNotification
+	for rows.Next() {
+		var n ReplyNotification
+		if err := rows.Scan(&n.ID, &n.CommentID, &n.ReplyID, &n.ProjectID, &n.VersionID, &n.Page, &n.ReplyAuthorName, &n.ReplyBody, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// --- Subscriptions ---
+
+// sqliteTime formats t the way SQLite's CURRENT_TIMESTAMP does so the two
+// compare correctly as text.
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// GetSetting returns an instance setting and when it was last set. It
+// returns sql.ErrNoRows if the setting was never set.
+func (d *DB) GetSetting(key string) ([]byte, time.Time, error) {
+	var value []byte
+	var updated time.Time
+	err := d.QueryRow(`SELECT value, updated_at FROM settings WHERE key = ?`, key).Scan(&value, &updated)
+	return value, updated, err
+}
+
+// SetSettings stores instance settings together, so settings that belong
+// together never get out of step.
+func (d *DB) SetSettings(values map[string][]byte) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for key, value := range values {
+		if _, err := tx.Exec(
+			`INSERT INTO settings (key, value) VALUES (?, ?)
+			 ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`,
+			key, value); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetDisplayName returns the name the user chose to be shown as, or "" if
+// they haven't set one.
+func (d *DB) GetDisplayName(email string) (string, error) {
+	var name string
+	err := d.QueryRow(`SELECT display_name FROM user_prefs WHERE user_email = ?`, email).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return name, err
+}
+
+// SetDisplayName sets the name the user is shown as on new comments and
+// replies; "" clears it, falling back to the name from sign-in.
+func (d *DB) SetDisplayName(email, name string) error {
+	_, err := d.Exec(
+		`INSERT INTO user_prefs (user_email, display_name) VALUES (?, ?)
+		 ON CONFLICT (user_email) DO UPDATE SET display_name = excluded.display_name, updated_at = CURRENT_TIMESTAMP`,
+		email, name)
+	return err
+}
+
+func (d *DB) Subscribe(projectID, email string) error {
+	_, err := d.Exec(
+		`INSERT OR IGNORE INTO project_subscriptions (project_id, user_email) VALUES (?, ?)`,
+		projectID, email)
+	return err
+}
+
+func (d *DB) Unsubscribe(projectID, email string) error {
+	_, err := d.Exec(`DELETE FROM project_subscriptions WHERE project_id = ? AND user_email = ?`, projectID, email)
+	return err
+}
+
+func (d *DB) IsSubscribed(projectID, email string) (bool, error) {
+	var count int
+	err := d.QueryRow(
+		`SELECT COUNT(*) FROM project_subscriptions WHERE project_id = ? AND user_email = ?`,
+		projectID, email).Scan(&count)
+	return count > 0, err
+}
+
+func (d *DB) ListSubscriptions() ([]ProjectSubscription, error) {
+	rows, err := d.Query(
+		`SELECT project_id, user_email, last_digest_at, created_at FROM project_subscriptions ORDER BY project_id, user_email`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var subs []ProjectSubscription
+	for rows.Next() {
+		var s ProjectSubscription
+		if err := rows.Scan(&s.ProjectID, &s.UserEmail, &s.LastDigestAt, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// MarkDigestSent records that a subscriber has been sent activity up to at.
+func (d *DB) MarkDigestSent(projectID, email string, at time.Time) error {
+	_, err := d.Exec(
+		`UPDATE project_subscriptions SET last_digest_at = ? WHERE project_id = ? AND user_email = ?`,
+		sqliteTime(at), projectID, email)
+	return err
+}
+
+// GetProjectActivity returns comments, replies and status changes on a
+// project created after since and at or before until.
+func (d *DB) GetProjectActivity(projectID string, since, until time.Time) (*ProjectActivity, error) {
+	from, to := sqliteTime(since), sqliteTime(until)
+	a := &ProjectActivity{}
+
+	rows, err := d.Query(
+		`SELECT `+commentColumns+`
+		 FROM comments c
+		 JOIN versions v ON c.version_id = v.id
+		 WHERE v.project_id = ? AND c.created_at > ? AND c.created_at <= ?
+		 ORDER BY c.created_at`, projectID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c Comment
+		if err := scanComment(rows, &c); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		a.Comments = append(a.Comments, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = d.Query(
+		`SELECT r.id, r.comment_id, r.author_name, r.author_email, r.body, r.created_at
+		 FROM replies r
+		 JOIN comments c ON r.comment_id = c.id
+		 JOIN versions v ON c.version_id = v.id
+		 WHERE v.project_id = ? AND r.created_at > ? AND r.created_at <= ?
+		 ORDER BY r.created_at`, projectID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var r Reply
+		if err := rows.Scan(&r.ID, &r.CommentID, &r.AuthorName, &r.AuthorEmail, &r.Body, &r.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		a.Replies = append(a.Replies, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = d.Query(
+		`SELECT project_id, from_status, to_status, changed_at FROM project_status_changes
+		 WHERE project_id = ? AND changed_at > ? AND changed_at <= ?
+		 ORDER BY id`, projectID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sc StatusChange
+		if err := rows.Scan(&sc.ProjectID, &sc.FromStatus, &sc.ToStatus, &sc.ChangedAt); err != nil {
+			return nil, err
+		}
+		a.StatusChanges = append(a.StatusChanges, sc)
+	}
+	return a, rows.Err()
+}
+
+// --- Sessions ---
+
+func (d *DB) CreateSession(id, userName, userEmail string) error {
+	_, err := d.Exec(`INSERT INTO sessions (id, user_name, user_email) VALUES (?, ?, ?)`, id, userName, userEmail)
+	return err
+}
+
+func (d *DB) GetSession(id string) (string, string, error) {
+	var name, email string
+	err := d.QueryRow(`SELECT user_name, user_email FROM sessions WHERE id = ?`, id).Scan(&name, &email)
+	return name, email, err
+}
+
+func (d *DB) DeleteSession(id string) error {
+	_, err := d.Exec(`DELETE FROM sessions WHERE id = ?`, id)
+	return err
+}
+
+// --- Users ---
+
+// UserSummary is a user seen anywhere on the instance, for admins.
+type UserSummary struct {
+	Email         string
+	Name          string // from their most recent session or API token; "" if they never signed in
+	OwnedProjects int    // owned or co-owned
+}
+
+// ListUsers returns every distinct email that owns a project, is a project
+// member, or has signed in (a session or API token), sorted by email.
+func (d *DB) ListUsers() ([]UserSummary, error) {
+	rows, err := d.Query(`
+		WITH users(email) AS (
+			SELECT owner_email FROM projects WHERE owner_email IS NOT NULL AND owner_email != ''
+			UNION SELECT user_email FROM project_members
+			UNION SELECT user_email FROM sessions
+			UNION SELECT user_email FROM tokens
+		)
+		SELECT u.email,
+		       COALESCE(
+		           (SELECT s.user_name FROM sessions s WHERE s.user_email = u.email ORDER BY s.created_at DESC LIMIT 1),
+		           (SELECT t.user_name FROM tokens t WHERE t.user_email = u.email ORDER BY t.created_at DESC LIMIT 1),
+		           ''),
+		       (SELECT COUNT(*) FROM projects p
+		        WHERE p.owner_email = u.email
+		           OR EXISTS (SELECT 1 FROM project_members pm WHERE pm.project_id = p.id AND pm.user_email = u.email AND pm.role = ?))
+		FROM users u
+		ORDER BY u.email`, RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []UserSummary
+	for rows.Next() {
+		var u UserSummary
+		if err := rows.Scan(&u.Email, &u.Name, &u.OwnedProjects); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// --- Import ---
+
+// ImportedVersion is a version, with its comments, being recreated from a
+// project archive.
+type ImportedVersion struct {
+	Version
+	PageOrder []string
+	Comments  []ImportedComment
+}
+
+// ImportedComment is a comment and its replies being recreated from a
+// project archive.
+type ImportedComment struct {
+	Comment
+	Replies []Reply
+}
+
+// timestamp formats t the way SQLite's CURRENT_TIMESTAMP does, so imported
+// rows sort alongside new ones. A zero time becomes NULL.
+func timestamp(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// ImportProject recreates a project from an archive in one transaction.
+// Everything gets a new id; version numbers, timestamps, authors and
+// resolved state are kept, so unresolved comments carry over as they did
+// before. An unknown status becomes draft. save, if not nil, is called with
+// the new version ids, in the order the versions were given, before the
+// transaction commits; if it fails nothing is imported. It returns the new
+// project and those ids.
+func (d *DB) ImportProject(name, ownerEmail, status string, versions []ImportedVersion, save func(ids []string) error) (*Project, []string, error) {
+	if !validStatuses[status] {
+		status = "draft"
+	}
+	tx, err := d.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	p := &Project{ID: uuid.NewString(), Name: name, Status: status}
+	if ownerEmail != "" {
+		p.OwnerEmail = &ownerEmail
+	}
+	if err := tx.QueryRow(
+		`INSERT INTO projects (id, name, owner_email, status) VALUES (?, ?, ?, ?) RETURNING created_at, updated_at`,
+		p.ID, p.Name, p.OwnerEmail, p.Status,
+	).Scan(&p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]string, len(versions))
+	for i, v := range versions {
+		ids[i] = uuid.NewString()
+		var order, warnings, titles string
+		if len(v.PageOrder) > 0 {
+			b, _ := json.Marshal(v.PageOrder)
+			order = string(b)
+		}
+		if len(v.Warnings) > 0 {
+			b, _ := json.Marshal(v.Warnings)
+			warnings = string(b)
+		}
+		if len(v.PageTitles) > 0 {
+			b, _ := json.Marshal(v.PageTitles)
+			titles = string(b)
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO versions (id, project_id, version_num, storage_path, upload_filename, upload_source, upload_sha256, created_by_email, page_order, warnings, page_titles, canvas_width, canvas_height, created_at)
+			 VALUES (?, ?, ?, '', ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP))`,
+			ids[i], p.ID, v.VersionNum, v.UploadFilename, v.UploadSource, v.UploadSHA256, v.CreatedByEmail, order, warnings, titles, v.CanvasWidth, v.CanvasHeight, timestamp(v.CreatedAt),
+		); err != nil {
+			return nil, nil, err
+		}
+		for _, c := range v.Comments {
+			commentID := uuid.NewString()
+			if _, err := tx.Exec(
+				`INSERT INTO comments (id, version_id, page, x_percent, y_percent, author_name, author_email, body, resolved, anchor, assignee_email, created_at)
+				 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP))`,
+				commentID, ids[i], c.Page, c.XPercent, c.YPercent, c.AuthorName, c.AuthorEmail, c.Body, c.Resolved, c.Anchor, c.Assignee, timestamp(c.CreatedAt),
+			); err != nil {
+				return nil, nil, err
+			}
+			for _, r := range c.Replies {
+				if _, err := tx.Exec(
+					`INSERT INTO replies (id, comment_id, author_name, author_email, body, resolved, created_at)
+					 VALUES (?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP))`,
+					uuid.NewString(), commentID, r.AuthorName, r.AuthorEmail, r.Body, r.Resolved, timestamp(r.CreatedAt),
+				); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+	}
+	if save != nil {
+		if err := save(ids); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return p, ids, nil
 }
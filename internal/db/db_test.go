@@ -2,14 +2,19 @@ package db
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"math"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"testing"
 	"time"
 )
 
 func newTestDB(t *testing.T) *DB {
 	t.Helper()
-	d, err := New(filepath.Join(t.TempDir(), "test.db"))
+	d, err := NewInMemory()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -17,6 +22,56 @@ func newTestDB(t *testing.T) *DB {
 	return d
 }
 
+func TestNewInMemory(t *testing.T) {
+	d, err := NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	p, err := d.CreateProject("mem", "alice@t.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := d.CreateVersion(p.ID, "/tmp/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := d.CreateComment(v.ID, "index.html", 1, 2, "A", "a@t.com", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.CreateReply(c.ID, "B", "b@t.com", "ok"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ToggleResolve(c.ID, "a@t.com"); err != nil {
+		t.Fatal(err)
+	}
+	comments, err := d.GetCommentsForVersion(v.ID)
+	if err != nil || len(comments) != 1 || !comments[0].Resolved {
+		t.Fatalf("unexpected comments: %+v, %v", comments, err)
+	}
+	projects, err := d.ListProjectsWithVersionCountForUser("alice@t.com")
+	if err != nil || len(projects) != 1 || projects[0].VersionCount != 1 {
+		t.Fatalf("unexpected projects: %+v, %v", projects, err)
+	}
+
+	// Foreign keys are enforced.
+	if _, err := d.CreateVersion("no-such-project", "/tmp/v"); err == nil {
+		t.Error("expected foreign key error")
+	}
+
+	// Each in-memory database is separate.
+	other, err := NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if _, err := other.GetProject(p.ID); err != sql.ErrNoRows {
+		t.Errorf("expected ErrNoRows from a second database, got %v", err)
+	}
+}
+
 func TestGetProject(t *testing.T) {
 	d := newTestDB(t)
 	p, _ := d.CreateProject("gp", "")
@@ -109,6 +164,24 @@ func TestUpdateProjectStatusNotFound(t *testing.T) {
 	}
 }
 
+func TestUpdateProjectStatuses(t *testing.T) {
+	d := newTestDB(t)
+	a, _ := d.CreateProject("a", "")
+	b, _ := d.CreateProject("b", "")
+	if err := d.UpdateProjectStatuses([]string{a.ID, b.ID}, "in_review"); err != nil {
+		t.Fatal(err)
+	}
+	// A missing id rolls back the whole batch.
+	if err := d.UpdateProjectStatuses([]string{a.ID, "nonexistent"}, "approved"); err != sql.ErrNoRows {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+	for _, id := range []string{a.ID, b.ID} {
+		if got, _ := d.GetProject(id); got.Status != "in_review" {
+			t.Errorf("%s: status = %q, want in_review", got.Name, got.Status)
+		}
+	}
+}
+
 func TestGetVersion(t *testing.T) {
 	d := newTestDB(t)
 	p, _ := d.CreateProject("vp", "")
@@ -122,6 +195,54 @@ func TestGetVersion(t *testing.T) {
 	}
 }
 
+func TestSetVersionUploadInfo(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("upinfo", "")
+	v, _ := d.CreateVersion(p.ID, "/path")
+	if v.UploadFilename != "" || v.UploadSource != "" {
+		t.Errorf("new version should have empty upload info, got %q/%q", v.UploadFilename, v.UploadSource)
+	}
+	if err := d.SetVersionUploadInfo(v.ID, "my-design.zip", "design-reviewer-cli"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := d.GetVersion(v.ID)
+	if got.UploadFilename != "my-design.zip" || got.UploadSource != "design-reviewer-cli" {
+		t.Errorf("got %q/%q", got.UploadFilename, got.UploadSource)
+	}
+}
+
+func TestCreateVersionByRecordsCreator(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("creator", "alice@test.com")
+	v, err := d.CreateVersionBy(p.ID, "/path", "bob@test.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := d.GetVersion(v.ID)
+	if got.CreatedByEmail != "bob@test.com" {
+		t.Errorf("CreatedByEmail = %q, want bob@test.com", got.CreatedByEmail)
+	}
+	seed, _ := d.CreateVersion(p.ID, "/path")
+	got, _ = d.GetVersion(seed.ID)
+	if got.CreatedByEmail != "" {
+		t.Errorf("expected empty creator, got %q", got.CreatedByEmail)
+	}
+}
+
+func TestVersionNumberUnique(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("proj", "")
+	d.CreateVersion(p.ID, "/tmp/v1")
+
+	_, err := d.Exec(`INSERT INTO versions (id, project_id, version_num, storage_path) VALUES ('dup', ?, 1, '')`, p.ID)
+	if err == nil {
+		t.Fatal("expected a duplicate version number to be rejected")
+	}
+	if v, err := d.CreateVersion(p.ID, "/tmp/v2"); err != nil || v.VersionNum != 2 {
+		t.Errorf("next version = %+v, %v; want number 2", v, err)
+	}
+}
+
 func TestGetVersionNotFound(t *testing.T) {
 	d := newTestDB(t)
 	_, err := d.GetVersion("nonexistent")
@@ -226,7 +347,7 @@ func TestListProjectsWithVersionCountMultiple(t *testing.T) {
 		t.Fatalf("expected 2 projects, got %d", len(projects))
 	}
 
-	// Results ordered by updated_at DESC; both created at ~same time, check counts by name
+	// Same-second projects fall back to id order; check counts by name
 	counts := map[string]int{}
 	for _, p := range projects {
 		counts[p.Name] = p.VersionCount
@@ -239,6 +360,35 @@ func TestListProjectsWithVersionCountMultiple(t *testing.T) {
 	}
 }
 
+func TestListProjectsWithVersionCountStableOrder(t *testing.T) {
+	d := newTestDB(t)
+	for _, name := range []string{"c", "a", "d", "b"} {
+		d.CreateProject(name, "")
+	}
+	d.Exec(`UPDATE projects SET created_at = '2024-01-01 00:00:00', updated_at = '2024-01-01 00:00:00'`)
+
+	ids := func() []string {
+		projects, err := d.ListProjectsWithVersionCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, p := range projects {
+			out = append(out, p.ID)
+		}
+		return out
+	}
+	first := ids()
+	if !sort.StringsAreSorted(first) {
+		t.Errorf("same-second projects should be ordered by id, got %v", first)
+	}
+	for i := 0; i < 5; i++ {
+		if got := ids(); !reflect.DeepEqual(got, first) {
+			t.Fatalf("order changed between calls: %v vs %v", first, got)
+		}
+	}
+}
+
 func TestListProjectsWithVersionCountOrderByUpdatedAt(t *testing.T) {
 	d := newTestDB(t)
 	// Create "older" first, then manually set its updated_at to the past
@@ -291,7 +441,7 @@ func TestToggleResolve(t *testing.T) {
 	v, _ := d.CreateVersion(p.ID, "/tmp/v1")
 	c, _ := d.CreateComment(v.ID, "index.html", 10, 20, "Alice", "a@t.com", "fix")
 
-	resolved, err := d.ToggleResolve(c.ID)
+	resolved, err := d.ToggleResolve(c.ID, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -299,18 +449,165 @@ func TestToggleResolve(t *testing.T) {
 		t.Error("expected resolved=true")
 	}
 
-	resolved, _ = d.ToggleResolve(c.ID)
+	resolved, _ = d.ToggleResolve(c.ID, "")
 	if resolved {
 		t.Error("expected resolved=false")
 	}
 }
 
+func TestToggleResolveRecordsEvents(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("proj", "")
+	v, _ := d.CreateVersion(p.ID, "/tmp/v1")
+	c, _ := d.CreateComment(v.ID, "index.html", 10, 20, "Alice", "a@t.com", "fix")
+
+	d.ToggleResolve(c.ID, "bob@t.com")
+	d.ToggleResolve(c.ID, "carol@t.com")
+
+	events, err := d.GetCommentEvents(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].Action != CommentEventResolve || events[0].ActorEmail != "bob@t.com" {
+		t.Errorf("first event = %+v, want resolve by bob", events[0])
+	}
+	if events[1].Action != CommentEventReopen || events[1].ActorEmail != "carol@t.com" {
+		t.Errorf("second event = %+v, want reopen by carol", events[1])
+	}
+}
+
+func TestResolveWithReply(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("proj", "")
+	v, _ := d.CreateVersion(p.ID, "/tmp/v1")
+	c, _ := d.CreateComment(v.ID, "index.html", 10, 20, "Alice", "a@t.com", "fix")
+
+	reply, err := d.ResolveWithReply(c.ID, "Bob", "bob@t.com", "done")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Body != "done" || reply.AuthorEmail != "bob@t.com" {
+		t.Errorf("reply = %+v", reply)
+	}
+	got, _ := d.GetComment(c.ID)
+	if !got.Resolved || got.ResolvedAt == nil {
+		t.Errorf("expected comment resolved with resolved_at, got %+v", got)
+	}
+	events, _ := d.GetCommentEvents(c.ID)
+	if len(events) != 1 || events[0].Action != CommentEventResolve || events[0].ActorEmail != "bob@t.com" {
+		t.Errorf("events = %+v, want one resolve by bob", events)
+	}
+
+	// Already resolved: nothing changes, not even the replies.
+	if _, err := d.ResolveWithReply(c.ID, "Bob", "bob@t.com", "again"); err != ErrAlreadyResolved {
+		t.Errorf("expected ErrAlreadyResolved, got %v", err)
+	}
+	replies, _ := d.GetReplies(c.ID)
+	if len(replies) != 1 {
+		t.Errorf("expected 1 reply, got %d", len(replies))
+	}
+
+	if _, err := d.ResolveWithReply("nonexistent", "Bob", "bob@t.com", "x"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestToggleResolveSetsResolvedAt(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("proj", "")
+	v, _ := d.CreateVersion(p.ID, "/tmp/v1")
+	c, _ := d.CreateComment(v.ID, "index.html", 10, 20, "Alice", "a@t.com", "fix")
+	if c.ResolvedAt != nil {
+		t.Fatalf("new comment has resolved_at %v", c.ResolvedAt)
+	}
+
+	d.ToggleResolve(c.ID, "")
+	got, _ := d.GetComment(c.ID)
+	if got.ResolvedAt == nil {
+		t.Fatal("expected resolved_at after resolving")
+	}
+	if got.ResolvedAt.Before(got.CreatedAt) {
+		t.Errorf("resolved_at %v is before created_at %v", got.ResolvedAt, got.CreatedAt)
+	}
+
+	d.ToggleResolve(c.ID, "")
+	got, _ = d.GetComment(c.ID)
+	if got.ResolvedAt != nil {
+		t.Errorf("expected resolved_at cleared on reopen, got %v", got.ResolvedAt)
+	}
+}
+
+func TestGetCommentMetrics(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("proj", "")
+	v1, _ := d.CreateVersion(p.ID, "/tmp/v1")
+	v2, _ := d.CreateVersion(p.ID, "/tmp/v2")
+	other, _ := d.CreateProject("other", "")
+	ov, _ := d.CreateVersion(other.ID, "/tmp/o1")
+	d.CreateComment(ov.ID, "index.html", 0, 0, "A", "a@t.com", "elsewhere")
+
+	m, err := d.GetCommentMetrics(p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Open != 0 || m.Resolved != 0 || m.AvgResolveSeconds != nil || m.MedianResolveSeconds != nil {
+		t.Errorf("empty project metrics = %+v", m)
+	}
+
+	// Resolve three comments after 60s, 120s and 600s; leave one open.
+	for i, secs := range []int{60, 120, 600} {
+		vid := v1.ID
+		if i == 2 {
+			vid = v2.ID
+		}
+		c, _ := d.CreateComment(vid, "index.html", 0, 0, "A", "a@t.com", "fix")
+		d.ToggleResolve(c.ID, "")
+		d.Exec(`UPDATE comments SET created_at = '2026-01-01 00:00:00',
+		        resolved_at = datetime('2026-01-01 00:00:00', ?) WHERE id = ?`,
+			fmt.Sprintf("+%d seconds", secs), c.ID)
+	}
+	d.CreateComment(v2.ID, "index.html", 0, 0, "A", "a@t.com", "open")
+
+	m, err = d.GetCommentMetrics(p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Open != 1 || m.Resolved != 3 {
+		t.Errorf("open, resolved = %d, %d, want 1, 3", m.Open, m.Resolved)
+	}
+	near := func(got *float64, want float64) bool {
+		return got != nil && math.Abs(*got-want) < 0.01
+	}
+	if !near(m.AvgResolveSeconds, 260) {
+		t.Errorf("avg = %v, want 260", m.AvgResolveSeconds)
+	}
+	if !near(m.MedianResolveSeconds, 120) {
+		t.Errorf("median = %v, want 120", m.MedianResolveSeconds)
+	}
+
+	// With an even count the median averages the middle two.
+	c, _ := d.CreateComment(v2.ID, "index.html", 0, 0, "A", "a@t.com", "fix")
+	d.ToggleResolve(c.ID, "")
+	d.Exec(`UPDATE comments SET created_at = '2026-01-01 00:00:00',
+	        resolved_at = '2026-01-01 00:30:00' WHERE id = ?`, c.ID)
+	m, _ = d.GetCommentMetrics(p.ID)
+	if !near(m.MedianResolveSeconds, 360) {
+		t.Errorf("even median = %v, want 360", m.MedianResolveSeconds)
+	}
+}
+
 func TestToggleResolveNotFound(t *testing.T) {
 	d := newTestDB(t)
-	_, err := d.ToggleResolve("nonexistent")
+	_, err := d.ToggleResolve("nonexistent", "")
 	if err == nil {
 		t.Error("expected error for nonexistent comment")
 	}
+	if events, _ := d.GetCommentEvents("nonexistent"); len(events) != 0 {
+		t.Error("no event should be recorded for a nonexistent comment")
+	}
 }
 
 func TestCreateReplyAndGet(t *testing.T) {
@@ -346,7 +643,7 @@ func TestGetUnresolvedCommentsUpTo(t *testing.T) {
 	d.CreateComment(v1.ID, "index.html", 10, 20, "Alice", "a@t.com", "unresolved")
 	// Resolved on v1
 	resolved, _ := d.CreateComment(v1.ID, "index.html", 30, 40, "Bob", "b@t.com", "resolved")
-	d.ToggleResolve(resolved.ID)
+	d.ToggleResolve(resolved.ID, "")
 	// Unresolved on v2
 	d.CreateComment(v2.ID, "index.html", 50, 60, "Carol", "c@t.com", "new on v2")
 
@@ -493,8 +790,8 @@ func TestExpiredTokenRejected(t *testing.T) {
 	d.CreateToken("exp-tok", "Alice", "alice@test.com")
 	d.Exec(`UPDATE tokens SET expires_at = datetime('now', '-1 second') WHERE token = ?`, hashToken("exp-tok"))
 	_, _, err := d.GetUserByToken("exp-tok")
-	if err != sql.ErrNoRows {
-		t.Errorf("expected ErrNoRows for expired token, got %v", err)
+	if err != ErrTokenExpired {
+		t.Errorf("expected ErrTokenExpired for expired token, got %v", err)
 	}
 }
 
@@ -633,7 +930,7 @@ func TestGetUnresolvedCommentsUpToClosedDB(t *testing.T) {
 
 func TestToggleResolveClosedDB(t *testing.T) {
 	d := closedDB(t)
-	_, err := d.ToggleResolve("x")
+	_, err := d.ToggleResolve("x", "")
 	if err == nil {
 		t.Error("expected error")
 	}
@@ -773,6 +1070,56 @@ func TestListProjectsWithVersionCountForUser(t *testing.T) {
 	}
 }
 
+func TestProjectVisibility(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("p", "alice@test.com")
+
+	if v, err := d.GetProjectVisibility(p.ID); err != nil || v != VisibilityPrivate {
+		t.Fatalf("default visibility = %q, %v", v, err)
+	}
+	if err := d.SetProjectVisibility(p.ID, "everyone"); err == nil {
+		t.Error("expected error for unknown visibility")
+	}
+	if err := d.SetProjectVisibility("nonexistent", VisibilityOrg); err != sql.ErrNoRows {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+
+	if err := d.SetProjectVisibility(p.ID, VisibilityOrg); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := d.CanAccessProject(p.ID, "bob@test.com"); !ok {
+		t.Error("signed-in non-member should see an org project")
+	}
+	if ok, _ := d.CanAccessProject(p.ID, ""); ok {
+		t.Error("anonymous user should not see an org project")
+	}
+	if projects, _ := d.ListProjectsWithVersionCountForUser("bob@test.com"); len(projects) != 1 {
+		t.Errorf("bob should see 1 project, got %d", len(projects))
+	}
+	if owner, _ := d.IsOwner(p.ID, "bob@test.com"); owner {
+		t.Error("org visibility should not grant ownership")
+	}
+	if ok, _ := d.CanWriteProject(p.ID, "bob@test.com"); ok {
+		t.Error("org visibility should not let a non-member write")
+	}
+	d.AddMember(p.ID, "carol@test.com")
+	if ok, _ := d.CanWriteProject(p.ID, "carol@test.com"); !ok {
+		t.Error("a member should be able to write")
+	}
+
+	if err := d.SetProjectVisibility(p.ID, VisibilityPublic); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := d.CanAccessProject(p.ID, "bob@test.com"); !ok {
+		t.Error("signed-in non-member should see a public project")
+	}
+
+	d.SetProjectVisibility(p.ID, VisibilityPrivate)
+	if ok, _ := d.CanAccessProject(p.ID, "bob@test.com"); ok {
+		t.Error("non-member should lose access once the project is private again")
+	}
+}
+
 func TestCreateInviteAndGetByToken(t *testing.T) {
 	d := newTestDB(t)
 	p, _ := d.CreateProject("p", "alice@test.com")
@@ -793,6 +1140,71 @@ func TestCreateInviteAndGetByToken(t *testing.T) {
 	}
 }
 
+func TestCreateShortInvite(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("p", "alice@test.com")
+	seen := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		inv, err := d.CreateShortInvite(p.ID, "alice@test.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(inv.Token) != shortInviteLen || len(inv.Token) >= 64 {
+			t.Errorf("token %q: len = %d, want %d", inv.Token, len(inv.Token), shortInviteLen)
+		}
+		for _, r := range inv.Token {
+			if !('0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z') {
+				t.Errorf("token %q is not base62", inv.Token)
+				break
+			}
+		}
+		if seen[inv.Token] {
+			t.Errorf("duplicate token %q", inv.Token)
+		}
+		seen[inv.Token] = true
+
+		got, err := d.GetInviteByToken(inv.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ProjectID != p.ID {
+			t.Errorf("project mismatch")
+		}
+	}
+}
+
+func TestCreateInviteRetriesTokenCollision(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("p", "alice@test.com")
+	taken, _ := d.CreateShortInvite(p.ID, "alice@test.com")
+
+	// The first candidate collides; the next one is used.
+	calls := 0
+	inv, err := d.createInvite(p.ID, "alice@test.com", func() (string, error) {
+		calls++
+		if calls == 1 {
+			return taken.Token, nil
+		}
+		return shortInviteToken()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || inv.Token == taken.Token {
+		t.Errorf("calls = %d, token = %q", calls, inv.Token)
+	}
+
+	// A token that keeps colliding gives up after maxInviteAttempts.
+	calls = 0
+	_, err = d.createInvite(p.ID, "alice@test.com", func() (string, error) {
+		calls++
+		return taken.Token, nil
+	})
+	if err == nil || calls != maxInviteAttempts {
+		t.Errorf("err = %v after %d attempts", err, calls)
+	}
+}
+
 func TestGetInviteByTokenNotFound(t *testing.T) {
 	d := newTestDB(t)
 	_, err := d.GetInviteByToken("nonexistent")
@@ -852,6 +1264,55 @@ func TestDeleteInvite(t *testing.T) {
 	}
 }
 
+func TestInviteTokenHashedAtRest(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("p", "a@t.com")
+	inv, err := d.CreateInvite(p.ID, "a@t.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored string
+	d.QueryRow(`SELECT token FROM project_invites WHERE id = ?`, inv.ID).Scan(&stored)
+	if stored != hashToken(inv.Token) {
+		t.Errorf("stored token = %q, want the hash of %q", stored, inv.Token)
+	}
+	got, err := d.GetInviteByToken(inv.Token)
+	if err != nil || got.ID != inv.ID {
+		t.Fatalf("plaintext token doesn't resolve: %v", err)
+	}
+	if got.Token != "" {
+		t.Errorf("looked-up invite exposes token %q", got.Token)
+	}
+	if _, err := d.GetInviteByToken(stored); err != sql.ErrNoRows {
+		t.Errorf("stored hash used as a token: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestInviteTokensHashedOnUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	d, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := d.CreateProject("p", "a@t.com")
+	// An invite as stored before tokens were hashed.
+	d.Exec(`ALTER TABLE project_invites DROP COLUMN token_hashed`)
+	d.Exec(`INSERT INTO project_invites (id, project_id, token, created_by, expires_at) VALUES ('old', ?, 'plain-token', 'a@t.com', datetime('now', '+1 day'))`, p.ID)
+	d.Close()
+
+	// Opening twice checks the token isn't hashed a second time.
+	for range 2 {
+		d, err = New(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inv, err := d.GetInviteByToken("plain-token"); err != nil || inv.ID != "old" {
+			t.Errorf("old invite doesn't resolve: %v", err)
+		}
+		d.Close()
+	}
+}
+
 func TestAddMemberDuplicate(t *testing.T) {
 	d := newTestDB(t)
 	p, _ := d.CreateProject("p", "a@t.com")
@@ -982,6 +1443,36 @@ func TestMoveComment(t *testing.T) {
 	}
 }
 
+func TestCommentAnchorRoundTrip(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("anchor", "")
+	v, _ := d.CreateVersion(p.ID, "/tmp/v")
+	c, err := d.CreateCommentWithAnchor(v.ID, "index.html", 10, 20, "#hero > h1", "A", "a@t.com", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := d.GetComment(c.ID)
+	if got.Anchor == nil || *got.Anchor != "#hero > h1" {
+		t.Errorf("anchor = %v, want #hero > h1", got.Anchor)
+	}
+
+	// Moving with a new anchor replaces it; moving without one clears it.
+	d.MoveCommentWithAnchor(c.ID, 30, 40, "main > p:nth-of-type(2)")
+	unresolved, _ := d.GetUnresolvedCommentsUpTo(v.ID)
+	if len(unresolved) != 1 || unresolved[0].Anchor == nil || *unresolved[0].Anchor != "main > p:nth-of-type(2)" {
+		t.Errorf("unexpected anchor after move: %+v", unresolved)
+	}
+	d.MoveComment(c.ID, 50, 60)
+	if got, _ := d.GetComment(c.ID); got.Anchor != nil {
+		t.Errorf("anchor = %q, want nil", *got.Anchor)
+	}
+
+	plain, _ := d.CreateComment(v.ID, "index.html", 1, 2, "A", "a@t.com", "no anchor")
+	if got, _ := d.GetComment(plain.ID); got.Anchor != nil {
+		t.Errorf("anchor = %q, want nil", *got.Anchor)
+	}
+}
+
 func TestMoveCommentNonexistent(t *testing.T) {
 	d := newTestDB(t)
 	// Should not error — UPDATE affects 0 rows
@@ -1025,6 +1516,39 @@ func TestGetCommentNotFound(t *testing.T) {
 	}
 }
 
+func TestGetCommentWithReplies(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("gcr", "")
+	v, _ := d.CreateVersion(p.ID, "/tmp/v")
+	c, _ := d.CreateComment(v.ID, "index.html", 10, 20, "Alice", "a@t.com", "hello")
+	d.CreateReply(c.ID, "Bob", "b@t.com", "first")
+	d.CreateReply(c.ID, "Carol", "c@t.com", "second")
+	lonely, _ := d.CreateComment(v.ID, "index.html", 30, 40, "Alice", "a@t.com", "no replies")
+
+	got, replies, err := d.GetCommentWithReplies(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Body != "hello" || got.VersionID != v.ID {
+		t.Errorf("unexpected comment: %+v", got)
+	}
+	if len(replies) != 2 || replies[0].Body != "first" || replies[1].Body != "second" || replies[1].AuthorEmail != "c@t.com" || replies[0].CommentID != c.ID {
+		t.Errorf("unexpected replies: %+v", replies)
+	}
+
+	got, replies, err = d.GetCommentWithReplies(lonely.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Body != "no replies" || len(replies) != 0 {
+		t.Errorf("unexpected comment without replies: %+v, %+v", got, replies)
+	}
+
+	if _, _, err := d.GetCommentWithReplies("nonexistent"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
 func TestGetCommentClosedDB(t *testing.T) {
 	d := closedDB(t)
 	_, err := d.GetComment("x")
@@ -1153,3 +1677,538 @@ func TestDeleteSessionClosedDB(t *testing.T) {
 		t.Error("expected error")
 	}
 }
+
+// --- Subscriptions ---
+
+func TestDisplayName(t *testing.T) {
+	d := newTestDB(t)
+	if name, err := d.GetDisplayName("a@test.com"); err != nil || name != "" {
+		t.Fatalf("unset: got %q, %v", name, err)
+	}
+	if err := d.SetDisplayName("a@test.com", "Ann"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetDisplayName("A@Test.com", "Ann B."); err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := d.GetDisplayName("a@TEST.com"); name != "Ann B." {
+		t.Errorf("name = %q, want the latest, keyed case-insensitively", name)
+	}
+	d.SetDisplayName("a@test.com", "")
+	if name, _ := d.GetDisplayName("a@test.com"); name != "" {
+		t.Errorf("cleared name = %q", name)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	d := newTestDB(t)
+	if _, _, err := d.GetSetting("k"); err != sql.ErrNoRows {
+		t.Fatalf("unset: expected sql.ErrNoRows, got %v", err)
+	}
+	if err := d.SetSettings(map[string][]byte{"k": []byte("one"), "j": []byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetSettings(map[string][]byte{"k": []byte("two")}); err != nil {
+		t.Fatal(err)
+	}
+	if v, updated, err := d.GetSetting("k"); err != nil || string(v) != "two" || updated.IsZero() {
+		t.Errorf("k = %q at %v, %v; want the latest value", v, updated, err)
+	}
+	if v, _, _ := d.GetSetting("j"); string(v) != "x" {
+		t.Errorf("j = %q, want it untouched", v)
+	}
+}
+
+func TestCommentTemplates(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("tmpl", "owner@test.com")
+	other, _ := d.CreateProject("tmpl-other", "owner@test.com")
+	first, err := d.CreateCommentTemplate(p.ID, "Increase contrast", "owner@test.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.CreateCommentTemplate(p.ID, "Align to grid", "owner@test.com")
+	d.CreateCommentTemplate(other.ID, "Elsewhere", "owner@test.com")
+
+	list, err := d.ListCommentTemplates(p.ID)
+	if err != nil || len(list) != 2 || list[0].Body != "Increase contrast" || list[1].Body != "Align to grid" {
+		t.Fatalf("list = %+v, %v", list, err)
+	}
+	if err := d.DeleteCommentTemplate(other.ID, first.ID); err != sql.ErrNoRows {
+		t.Errorf("delete through another project: expected sql.ErrNoRows, got %v", err)
+	}
+	if err := d.DeleteCommentTemplate(p.ID, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := d.ListCommentTemplates(p.ID); len(list) != 1 {
+		t.Errorf("after delete: %+v", list)
+	}
+}
+
+func TestCommentWatchersNotifiedOfReplies(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("p", "alice@test.com")
+	v, _ := d.CreateVersion(p.ID, "")
+	c, _ := d.CreateComment(v.ID, "index.html", 1, 1, "Alice", "alice@test.com", "hi")
+	anon, _ := d.CreateComment(v.ID, "index.html", 1, 1, "Guest", "", "anon")
+	if ok, _ := d.IsWatchingComment(c.ID, "alice@test.com"); !ok {
+		t.Error("author should watch their new comment")
+	}
+	if ok, _ := d.IsWatchingComment(anon.ID, ""); ok {
+		t.Error("a comment without an author email has no watcher")
+	}
+	d.WatchComment(c.ID, "bob@test.com")
+	d.WatchComment(c.ID, "bob@test.com")
+
+	r, err := d.CreateReply(c.ID, "Bob", "bob@test.com", "re")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := d.ResolveWithReply(c.ID, "Carol", "carol@test.com", "fixed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notes, err := d.ListReplyNotifications("alice@test.com", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 2 || notes[0].ReplyID != rr.ID || notes[1].ReplyID != r.ID {
+		t.Fatalf("alice's notifications = %+v", notes)
+	}
+	if n := notes[1]; n.CommentID != c.ID || n.ProjectID != p.ID || n.VersionID != v.ID || n.Page != "index.html" || n.ReplyAuthorName != "Bob" || n.ReplyBody != "re" {
+		t.Errorf("notification = %+v", n)
+	}
+	// Bob isn't told about his own reply.
+	if notes, _ := d.ListReplyNotifications("bob@test.com", 10); len(notes) != 1 || notes[0].ReplyID != rr.ID {
+		t.Errorf("bob's notifications = %+v", notes)
+	}
+	if notes, _ := d.ListReplyNotifications("alice@test.com", 1); len(notes) != 1 {
+		t.Errorf("limit 1 gave %d notifications", len(notes))
+	}
+
+	d.UnwatchComment(c.ID, "bob@test.com")
+	if ok, _ := d.IsWatchingComment(c.ID, "bob@test.com"); ok {
+		t.Error("bob should no longer watch the comment")
+	}
+}
+
+func TestSubscribeAndUnsubscribe(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("sub", "owner@test.com")
+	if err := d.Subscribe(p.ID, "a@test.com"); err != nil {
+		t.Fatal(err)
+	}
+	// Subscribing twice is a no-op
+	if err := d.Subscribe(p.ID, "a@test.com"); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := d.IsSubscribed(p.ID, "a@test.com")
+	if err != nil || !ok {
+		t.Fatalf("expected subscribed, got %v %v", ok, err)
+	}
+	subs, _ := d.ListSubscriptions()
+	if len(subs) != 1 || subs[0].UserEmail != "a@test.com" {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+	if err := d.Unsubscribe(p.ID, "a@test.com"); err != nil {
+		t.Fatal(err)
+	}
+	ok, _ = d.IsSubscribed(p.ID, "a@test.com")
+	if ok {
+		t.Error("expected unsubscribed")
+	}
+}
+
+func TestUpdateProjectStatusRecordsChange(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("sc", "")
+	d.UpdateProjectStatus(p.ID, "in_review")
+	d.UpdateProjectStatus(p.ID, "in_review") // unchanged, not recorded
+	a, err := d.GetProjectActivity(p.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.StatusChanges) != 1 {
+		t.Fatalf("expected 1 status change, got %d", len(a.StatusChanges))
+	}
+	if a.StatusChanges[0].FromStatus != "draft" || a.StatusChanges[0].ToStatus != "in_review" {
+		t.Errorf("unexpected change: %+v", a.StatusChanges[0])
+	}
+}
+
+func TestGetProjectActivityWindow(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("act", "")
+	v, _ := d.CreateVersion(p.ID, "/tmp")
+	c, _ := d.CreateComment(v.ID, "index.html", 1, 2, "A", "a@test.com", "hello")
+	d.CreateReply(c.ID, "B", "b@test.com", "hi")
+
+	a, err := d.GetProjectActivity(p.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Comments) != 1 || len(a.Replies) != 1 || a.Empty() {
+		t.Fatalf("expected 1 comment and 1 reply, got %+v", a)
+	}
+
+	// Activity before since is excluded
+	a, err = d.GetProjectActivity(p.ID, time.Now().Add(time.Minute), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Empty() {
+		t.Errorf("expected no activity, got %+v", a)
+	}
+}
+
+func TestMarkDigestSent(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("md", "")
+	d.Subscribe(p.ID, "a@test.com")
+	at := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := d.MarkDigestSent(p.ID, "a@test.com", at); err != nil {
+		t.Fatal(err)
+	}
+	subs, _ := d.ListSubscriptions()
+	if len(subs) != 1 || !subs[0].LastDigestAt.Equal(at) {
+		t.Errorf("expected last_digest_at %v, got %+v", at, subs)
+	}
+}
+
+func TestIsMemberOfAnyProject(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("m", "owner@test.com")
+	d.AddMember(p.ID, "guest@test.com")
+	if ok, _ := d.IsMemberOfAnyProject("guest@test.com"); !ok {
+		t.Error("expected member")
+	}
+	if ok, _ := d.IsMemberOfAnyProject("stranger@test.com"); ok {
+		t.Error("expected non-member")
+	}
+}
+
+func TestIsOwnerIncludesCoOwners(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("co", "alice@test.com")
+	d.AddMember(p.ID, "bob@test.com")
+
+	if ok, _ := d.IsOwner(p.ID, "alice@test.com"); !ok {
+		t.Error("primary owner should be an owner")
+	}
+	if ok, _ := d.IsOwner(p.ID, "bob@test.com"); ok {
+		t.Error("plain member should not be an owner")
+	}
+	if err := d.SetMemberRole(p.ID, "bob@test.com", RoleOwner); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := d.IsOwner(p.ID, "bob@test.com"); !ok {
+		t.Error("co-owner should be an owner")
+	}
+	if owner, _ := d.GetProjectOwner(p.ID); owner != "alice@test.com" {
+		t.Errorf("primary owner = %q, want alice", owner)
+	}
+	if err := d.SetMemberRole(p.ID, "nobody@test.com", RoleOwner); err != sql.ErrNoRows {
+		t.Errorf("expected ErrNoRows for non-member, got %v", err)
+	}
+	if _, err := d.IsOwner("missing", "alice@test.com"); err != sql.ErrNoRows {
+		t.Errorf("expected ErrNoRows for missing project, got %v", err)
+	}
+}
+
+func TestToggleReplyResolve(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("rr", "")
+	v, _ := d.CreateVersion(p.ID, "/tmp")
+	c, _ := d.CreateComment(v.ID, "index.html", 1, 2, "A", "a@test.com", "two things")
+	r, _ := d.CreateReply(c.ID, "B", "b@test.com", "first thing fixed")
+
+	resolved, err := d.ToggleReplyResolve(r.ID)
+	if err != nil || !resolved {
+		t.Fatalf("expected resolved, got %v %v", resolved, err)
+	}
+	got, _ := d.GetReply(r.ID)
+	if !got.Resolved {
+		t.Error("reply should be resolved")
+	}
+	gc, _ := d.GetComment(c.ID)
+	if gc.Resolved {
+		t.Error("parent comment should stay unresolved")
+	}
+	resolved, _ = d.ToggleReplyResolve(r.ID)
+	if resolved {
+		t.Error("expected unresolved after second toggle")
+	}
+	if _, err := d.ToggleReplyResolve("missing"); err != sql.ErrNoRows {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+}
+
+func TestPublicShareLifecycle(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("p", "alice@test.com")
+	other, _ := d.CreateProject("other", "bob@test.com")
+	ps, err := d.CreatePublicShare(p.ID, "alice@test.com", CommentModeHidden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps.Token) != 64 {
+		t.Errorf("token len = %d, want 64", len(ps.Token))
+	}
+
+	got, err := d.GetPublicShareByToken(ps.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ProjectID != p.ID || got.CommentMode != CommentModeHidden {
+		t.Errorf("got %+v", got)
+	}
+
+	if err := d.SetPublicShareCommentMode(p.ID, ps.ID, CommentModeOpen); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = d.GetPublicShareByToken(ps.Token)
+	if got.CommentMode != CommentModeOpen {
+		t.Errorf("comment mode = %q, want open", got.CommentMode)
+	}
+	// A share can't be changed or deleted through another project.
+	if err := d.SetPublicShareCommentMode(other.ID, ps.ID, CommentModeHidden); err != sql.ErrNoRows {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+	d.DeletePublicShare(other.ID, ps.ID)
+	if shares, _ := d.ListPublicShares(p.ID); len(shares) != 1 {
+		t.Fatalf("expected 1 share, got %d", len(shares))
+	}
+
+	if err := d.DeletePublicShare(p.ID, ps.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetPublicShareByToken(ps.Token); err != sql.ErrNoRows {
+		t.Errorf("expected ErrNoRows after delete, got %v", err)
+	}
+}
+
+func TestDefaultAssignee(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("assign", "alice@t.com")
+	v, _ := d.CreateVersion(p.ID, "/tmp/v")
+
+	if email, err := d.GetDefaultAssigneeForVersion(v.ID); err != nil || email != "" {
+		t.Fatalf("expected no default assignee, got %q, %v", email, err)
+	}
+	if err := d.SetDefaultAssignee(p.ID, "bob@t.com"); err != nil {
+		t.Fatal(err)
+	}
+	if email, _ := d.GetDefaultAssignee(p.ID); email != "bob@t.com" {
+		t.Errorf("GetDefaultAssignee = %q, want bob@t.com", email)
+	}
+	if email, _ := d.GetDefaultAssigneeForVersion(v.ID); email != "bob@t.com" {
+		t.Errorf("GetDefaultAssigneeForVersion = %q, want bob@t.com", email)
+	}
+	if err := d.SetDefaultAssignee("missing", "bob@t.com"); err != sql.ErrNoRows {
+		t.Errorf("expected ErrNoRows for missing project, got %v", err)
+	}
+
+	c, _ := d.CreateComment(v.ID, "index.html", 1, 2, "A", "a@t.com", "hi")
+	if err := d.SetCommentAssignee(c.ID, "bob@t.com"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := d.GetComment(c.ID)
+	if got.Assignee != "bob@t.com" {
+		t.Errorf("Assignee = %q, want bob@t.com", got.Assignee)
+	}
+}
+
+func TestRequireResolvedForApproval(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("gate", "")
+
+	if required, err := d.GetRequireResolvedForApproval(p.ID); err != nil || required {
+		t.Fatalf("expected gate off by default, got %v, %v", required, err)
+	}
+	if err := d.SetRequireResolvedForApproval(p.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if required, _ := d.GetRequireResolvedForApproval(p.ID); !required {
+		t.Error("expected gate on")
+	}
+	if err := d.SetRequireResolvedForApproval("missing", true); err != sql.ErrNoRows {
+		t.Errorf("expected ErrNoRows for missing project, got %v", err)
+	}
+}
+
+func TestPageOrder(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("order", "")
+	v, _ := d.CreateVersion(p.ID, "/tmp/v")
+
+	if order, err := d.GetPageOrder(v.ID); err != nil || order != nil {
+		t.Fatalf("expected no order, got %v, %v", order, err)
+	}
+	if err := d.SetPageOrder(v.ID, []string{"b.html", "a.html"}); err != nil {
+		t.Fatal(err)
+	}
+	order, _ := d.GetPageOrder(v.ID)
+	if len(order) != 2 || order[0] != "b.html" || order[1] != "a.html" {
+		t.Errorf("order = %v, want [b.html a.html]", order)
+	}
+	d.SetPageOrder(v.ID, nil)
+	if order, _ := d.GetPageOrder(v.ID); order != nil {
+		t.Errorf("order = %v after clearing, want nil", order)
+	}
+	if err := d.SetPageOrder("missing", []string{"a.html"}); err != sql.ErrNoRows {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+}
+
+func TestListVersionsPage(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("paged", "")
+	for i := 0; i < 3; i++ {
+		d.CreateVersion(p.ID, "")
+	}
+	versions, total, err := d.ListVersionsPage(p.ID, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(versions) != 1 || versions[0].VersionNum != 2 {
+		t.Errorf("got %d versions (total %d), want v2 of 3", len(versions), total)
+	}
+	if versions, _, _ := d.ListVersionsPage(p.ID, 0, 0); len(versions) != 3 {
+		t.Errorf("limit 0 should return all, got %d", len(versions))
+	}
+}
+
+func TestImportProject(t *testing.T) {
+	d := newTestDB(t)
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var saved []string
+	p, ids, err := d.ImportProject("imported", "alice@t.com", "bogus", []ImportedVersion{
+		{
+			Version: Version{VersionNum: 3, UploadSHA256: "abc123", CreatedAt: created},
+			Comments: []ImportedComment{{
+				Comment: Comment{Page: "index.html", AuthorName: "A", AuthorEmail: "a@t.com", Body: "hi", Resolved: true, CreatedAt: created},
+				Replies: []Reply{{AuthorName: "B", AuthorEmail: "b@t.com", Body: "ok"}},
+			}},
+		},
+	}, func(ids []string) error {
+		saved = ids
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0] != ids[0] {
+		t.Errorf("save got ids %v, want %v", saved, ids)
+	}
+	if p.Status != "draft" {
+		t.Errorf("unknown status should become draft, got %q", p.Status)
+	}
+	v, err := d.GetVersion(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.VersionNum != 3 || !v.CreatedAt.Equal(created) {
+		t.Errorf("version = %d at %v, want 3 at %v", v.VersionNum, v.CreatedAt, created)
+	}
+	if v.UploadSHA256 != "abc123" {
+		t.Errorf("upload checksum = %q, want abc123", v.UploadSHA256)
+	}
+	comments, _ := d.GetCommentsForVersion(v.ID)
+	if len(comments) != 1 || !comments[0].Resolved || !comments[0].CreatedAt.Equal(created) {
+		t.Fatalf("unexpected comments: %+v", comments)
+	}
+	if replies, _ := d.GetReplies(comments[0].ID); len(replies) != 1 {
+		t.Errorf("expected 1 reply, got %d", len(replies))
+	}
+
+	// Names stay unique.
+	if _, _, err := d.ImportProject("imported", "", "draft", nil, nil); err == nil {
+		t.Error("expected error for duplicate name")
+	}
+
+	// A failing save leaves nothing behind.
+	if _, _, err := d.ImportProject("unsaved", "", "draft", []ImportedVersion{{Version: Version{VersionNum: 1}}}, func([]string) error {
+		return errors.New("disk full")
+	}); err == nil {
+		t.Error("expected the save error")
+	}
+	if _, err := d.GetProjectByName("unsaved"); err != sql.ErrNoRows {
+		t.Errorf("project after failed save: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestPinnedVersion(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("proj", "")
+	v, _ := d.CreateVersion(p.ID, "/tmp/v1")
+	other, _ := d.CreateProject("other", "")
+	otherV, _ := d.CreateVersion(other.ID, "/tmp/o1")
+
+	if got, err := d.GetPinnedVersion(p.ID); err != nil || got != "" {
+		t.Fatalf("new project: pinned = %q, %v", got, err)
+	}
+	if err := d.SetPinnedVersion(p.ID, v.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := d.GetPinnedVersion(p.ID); got != v.ID {
+		t.Errorf("pinned = %q, want %q", got, v.ID)
+	}
+	if err := d.SetPinnedVersion(p.ID, otherV.ID); err != ErrVersionNotInProject {
+		t.Errorf("other project's version: got %v", err)
+	}
+	if err := d.SetPinnedVersion(p.ID, "nonexistent"); err != ErrVersionNotInProject {
+		t.Errorf("unknown version: got %v", err)
+	}
+	if err := d.SetPinnedVersion(p.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := d.GetPinnedVersion(p.ID); got != "" {
+		t.Errorf("expected unpinned, got %q", got)
+	}
+	if err := d.SetPinnedVersion("nonexistent", ""); err != sql.ErrNoRows {
+		t.Errorf("unknown project: got %v", err)
+	}
+}
+
+func TestUpdateCommentPage(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("proj", "")
+	v, _ := d.CreateVersion(p.ID, "/tmp/v1")
+	c, _ := d.CreateComment(v.ID, "old.html", 10, 20, "Alice", "a@t.com", "fix")
+
+	if err := d.UpdateCommentPage(c.ID, "new.html"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := d.GetComment(c.ID); got.Page != "new.html" {
+		t.Errorf("page = %q, want new.html", got.Page)
+	}
+	if err := d.UpdateCommentPage("nonexistent", "new.html"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestAuthorEmailsNormalizedOnOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	d, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := d.CreateProject("norm", "")
+	v, _ := d.CreateVersion(p.ID, "")
+	c, _ := d.CreateComment(v.ID, "index.html", 1, 1, "Alice", " Alice@Example.COM", "hi")
+	r, _ := d.CreateReply(c.ID, "Bob", "BOB@example.com", "re")
+	d.Close()
+
+	d, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if got, _ := d.GetComment(c.ID); got.AuthorEmail != "alice@example.com" {
+		t.Errorf("comment author_email = %q", got.AuthorEmail)
+	}
+	if replies, _ := d.GetReplies(c.ID); len(replies) != 1 || replies[0].ID != r.ID || replies[0].AuthorEmail != "bob@example.com" {
+		t.Errorf("replies = %+v", replies)
+	}
+}
@@ -0,0 +1,107 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ab/design-reviewer/internal/db"
+	"github.com/ab/design-reviewer/internal/mail"
+)
+
+// Runner compiles per-project activity digests for subscribers and emails them.
+type Runner struct {
+	DB      *db.DB
+	Sender  mail.Sender // nil = digests disabled
+	BaseURL string
+}
+
+// RunOnce sends a digest to every subscriber with new activity since their
+// last digest. Subscribers with no new activity are skipped.
+func (r *Runner) RunOnce(now time.Time) error {
+	if r.Sender == nil {
+		return nil
+	}
+	subs, err := r.DB.ListSubscriptions()
+	if err != nil {
+		return err
+	}
+	for _, s := range subs {
+		// Subscribers who lost access (e.g. removed as members) get nothing.
+		ok, err := r.DB.CanAccessProject(s.ProjectID, s.UserEmail)
+		if err != nil || !ok {
+			continue
+		}
+		activity, err := r.DB.GetProjectActivity(s.ProjectID, s.LastDigestAt, now)
+		if err != nil {
+			log.Printf("digest: activity for %s: %v", s.ProjectID, err)
+			continue
+		}
+		if activity.Empty() {
+			continue
+		}
+		p, err := r.DB.GetProject(s.ProjectID)
+		if err != nil {
+			continue
+		}
+		subject := fmt.Sprintf("[Design Reviewer] Daily digest for %s", p.Name)
+		if err := r.Sender.Send(s.UserEmail, subject, r.format(p, activity)); err != nil {
+			log.Printf("digest: send to %s: %v", s.UserEmail, err)
+			continue
+		}
+		if err := r.DB.MarkDigestSent(s.ProjectID, s.UserEmail, now); err != nil {
+			log.Printf("digest: mark sent for %s: %v", s.UserEmail, err)
+		}
+	}
+	return nil
+}
+
+// Start runs RunOnce every interval until ctx is cancelled.
+func (r *Runner) Start(ctx context.Context, interval time.Duration) {
+	if r.Sender == nil || interval <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				if err := r.RunOnce(now); err != nil {
+					log.Printf("digest: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (r *Runner) format(p *db.Project, a *db.ProjectActivity) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "New activity on %s:\n\n", p.Name)
+	for _, sc := range a.StatusChanges {
+		fmt.Fprintf(&b, "Status changed: %s -> %s\n", sc.FromStatus, sc.ToStatus)
+	}
+	if len(a.StatusChanges) > 0 {
+		b.WriteString("\n")
+	}
+	if len(a.Comments) > 0 {
+		fmt.Fprintf(&b, "%d new comment(s):\n", len(a.Comments))
+		for _, c := range a.Comments {
+			fmt.Fprintf(&b, "- %s on %s: %s\n", c.AuthorName, c.Page, c.Body)
+		}
+		b.WriteString("\n")
+	}
+	if len(a.Replies) > 0 {
+		fmt.Fprintf(&b, "%d new reply(ies):\n", len(a.Replies))
+		for _, rp := range a.Replies {
+			fmt.Fprintf(&b, "- %s: %s\n", rp.AuthorName, rp.Body)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "Open the project: %s/projects/%s\n", r.BaseURL, p.ID)
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package digest
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ab/design-reviewer/internal/db"
+)
+
+type sentMail struct{ to, subject, body string }
+
+type fakeSender struct{ sent []sentMail }
+
+func (f *fakeSender) Send(to, subject, body string) error {
+	f.sent = append(f.sent, sentMail{to, subject, body})
+	return nil
+}
+
+func newTestDB(t *testing.T) *db.DB {
+	t.Helper()
+	d, err := db.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestRunOnceSendsOnlyNewActivity(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("digest-proj", "owner@test.com")
+	v, _ := d.CreateVersion(p.ID, "/tmp")
+	d.Subscribe(p.ID, "owner@test.com")
+	d.MarkDigestSent(p.ID, "owner@test.com", time.Now().Add(-time.Hour))
+	d.CreateComment(v.ID, "index.html", 1, 2, "Bob", "bob@test.com", "tighten spacing")
+
+	f := &fakeSender{}
+	r := &Runner{DB: d, Sender: f, BaseURL: "http://example.com"}
+	now := time.Now().Add(time.Second)
+	if err := r.RunOnce(now); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.sent) != 1 {
+		t.Fatalf("expected 1 email, got %d", len(f.sent))
+	}
+	m := f.sent[0]
+	if m.to != "owner@test.com" || !strings.Contains(m.subject, "digest-proj") {
+		t.Errorf("unexpected email: %+v", m)
+	}
+	if !strings.Contains(m.body, "tighten spacing") || !strings.Contains(m.body, "http://example.com/projects/"+p.ID) {
+		t.Errorf("unexpected body: %s", m.body)
+	}
+
+	// Nothing new since the last digest
+	if err := r.RunOnce(now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.sent) != 1 {
+		t.Errorf("expected no new email, got %d", len(f.sent))
+	}
+}
+
+func TestRunOnceSkipsSubscribersWithoutAccess(t *testing.T) {
+	d := newTestDB(t)
+	p, _ := d.CreateProject("private", "owner@test.com")
+	v, _ := d.CreateVersion(p.ID, "/tmp")
+	d.Subscribe(p.ID, "outsider@test.com")
+	d.MarkDigestSent(p.ID, "outsider@test.com", time.Now().Add(-time.Hour))
+	d.CreateComment(v.ID, "index.html", 1, 2, "Bob", "bob@test.com", "hi")
+
+	f := &fakeSender{}
+	r := &Runner{DB: d, Sender: f}
+	r.RunOnce(time.Now().Add(time.Second))
+	if len(f.sent) != 0 {
+		t.Errorf("expected no email, got %d", len(f.sent))
+	}
+}
+
+func TestRunOnceNilSender(t *testing.T) {
+	r := &Runner{}
+	if err := r.RunOnce(time.Now()); err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+}
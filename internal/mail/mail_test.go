@@ -0,0 +1,38 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSMTPFromEnvDisabled(t *testing.T) {
+	t.Setenv("SMTP_HOST", "")
+	t.Setenv("SMTP_FROM", "")
+	if s := SMTPFromEnv(); s != nil {
+		t.Errorf("expected nil sender, got %+v", s)
+	}
+}
+
+func TestSMTPFromEnv(t *testing.T) {
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_FROM", "noreply@example.com")
+	t.Setenv("SMTP_PORT", "")
+	s := SMTPFromEnv()
+	if s == nil || s.Host != "smtp.example.com" || s.Port != 587 {
+		t.Errorf("unexpected sender: %+v", s)
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	msg := string(BuildMessage("a@x.com", "b@x.com", "Hi", "line1\nline2"))
+	if !strings.Contains(msg, "Subject: Hi\r\n") || !strings.HasSuffix(msg, "line1\r\nline2") {
+		t.Errorf("unexpected message: %q", msg)
+	}
+}
+
+func TestSendRejectsHeaderInjection(t *testing.T) {
+	s := &SMTPSender{Host: "localhost", Port: 25, From: "a@x.com"}
+	if err := s.Send("b@x.com\r\nBcc: c@x.com", "Hi", "body"); err == nil {
+		t.Error("expected error for CRLF in recipient")
+	}
+}
@@ -0,0 +1,53 @@
+package retention
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ab/design-reviewer/internal/db"
+)
+
+// Runner archives projects that have gone without new versions, comments
+// or replies for longer than MaxIdle.
+type Runner struct {
+	DB      *db.DB
+	MaxIdle time.Duration // 0 = retention disabled
+}
+
+// RunOnce archives every stale project, logging each one, and returns how
+// many it archived. Projects with the keep flag are left alone.
+func (r *Runner) RunOnce(now time.Time) (int, error) {
+	if r.MaxIdle <= 0 {
+		return 0, nil
+	}
+	archived, err := r.DB.ArchiveStaleProjects(now.Add(-r.MaxIdle))
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range archived {
+		log.Printf("retention: archived project %q (%s) after %s without activity", p.Name, p.ID, r.MaxIdle)
+	}
+	return len(archived), nil
+}
+
+// Start runs RunOnce every interval until ctx is cancelled.
+func (r *Runner) Start(ctx context.Context, interval time.Duration) {
+	if r.MaxIdle <= 0 || interval <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				if _, err := r.RunOnce(now); err != nil {
+					log.Printf("retention: %v", err)
+				}
+			}
+		}
+	}()
+}
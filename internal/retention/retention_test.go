@@ -0,0 +1,81 @@
+package retention
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ab/design-reviewer/internal/db"
+)
+
+func newTestDB(t *testing.T) *db.DB {
+	t.Helper()
+	d, err := db.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// seedIdle creates a project with one version, both dated 60 days ago.
+func seedIdle(t *testing.T, d *db.DB, name string) (*db.Project, *db.Version) {
+	t.Helper()
+	p, _ := d.CreateProject(name, "owner@test.com")
+	v, _ := d.CreateVersion(p.ID, "/tmp")
+	old := time.Now().AddDate(0, 0, -60).UTC().Format("2006-01-02 15:04:05")
+	d.Exec(`UPDATE projects SET created_at = ? WHERE id = ?`, old, p.ID)
+	d.Exec(`UPDATE versions SET created_at = ? WHERE id = ?`, old, v.ID)
+	return p, v
+}
+
+func archivedNames(t *testing.T, d *db.DB) map[string]bool {
+	t.Helper()
+	projects, err := d.ListProjectsWithVersionCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, p := range projects {
+		if p.Archived {
+			names[p.Name] = true
+		}
+	}
+	return names
+}
+
+func TestRunOnceArchivesStaleProjects(t *testing.T) {
+	d := newTestDB(t)
+	stale, _ := seedIdle(t, d, "stale")
+	_, v := seedIdle(t, d, "commented")
+	d.CreateComment(v.ID, "index.html", 1, 2, "Bob", "bob@test.com", "still looking")
+	kept, _ := seedIdle(t, d, "kept")
+	d.SetProjectKeep(kept.ID, true)
+
+	r := &Runner{DB: d, MaxIdle: 30 * 24 * time.Hour}
+	n, err := r.RunOnce(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := archivedNames(t, d); n != 1 || len(got) != 1 || !got["stale"] {
+		t.Fatalf("expected only stale archived, got %d: %v", n, got)
+	}
+	if n, _ := r.RunOnce(time.Now()); n != 0 {
+		t.Errorf("second run archived %d, want 0", n)
+	}
+
+	// Pushing a new version brings the project back.
+	d.CreateVersion(stale.ID, "/tmp")
+	if got := archivedNames(t, d); len(got) != 0 {
+		t.Errorf("new version should unarchive, still archived: %v", got)
+	}
+}
+
+func TestRunOnceDisabled(t *testing.T) {
+	d := newTestDB(t)
+	seedIdle(t, d, "stale")
+	r := &Runner{DB: d}
+	if n, err := r.RunOnce(time.Now()); err != nil || n != 0 {
+		t.Errorf("disabled runner archived %d (err %v)", n, err)
+	}
+}
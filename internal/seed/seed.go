@@ -12,20 +12,23 @@ import (
 //go:embed landing/*
 var landingFiles embed.FS
 
-func Run(database *db.DB, uploadsDir string) {
+// Run creates the demo landing-page project, owned by nobody, and returns
+// it. It only seeds an empty database, so running it again, or against real
+// data, creates nothing and returns nil.
+func Run(database *db.DB, uploadsDir string) *db.Project {
 	projects, err := database.ListProjects()
 	if err != nil || len(projects) > 0 {
-		return
+		return nil
 	}
 	p, err := database.CreateProject("Design Reviewer — Landing Page", "")
 	if err != nil {
 		log.Printf("seed: create project: %v", err)
-		return
+		return nil
 	}
 	v, err := database.CreateVersion(p.ID, filepath.Join(uploadsDir, "seed"))
 	if err != nil {
 		log.Printf("seed: create version: %v", err)
-		return
+		return nil
 	}
 	dir := filepath.Join(uploadsDir, v.ID)
 	os.MkdirAll(dir, 0o755)
@@ -35,4 +38,5 @@ func Run(database *db.DB, uploadsDir string) {
 		os.WriteFile(filepath.Join(dir, e.Name()), data, 0o644)
 	}
 	log.Printf("seed: created default project %q", p.Name)
+	return p
 }
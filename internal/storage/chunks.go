@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// partialDir holds in-progress chunked uploads. It sits alongside version
+// directories but can never collide with one since version IDs are UUIDs.
+const partialDir = ".partial"
+
+// ErrOffsetMismatch is returned when a chunk does not start where the
+// previous one ended.
+var ErrOffsetMismatch = errors.New("chunk offset does not match received size")
+
+// ErrUploadTooLarge is returned when a chunk would grow an upload past its limit.
+var ErrUploadTooLarge = errors.New("upload exceeds size limit")
+
+// PartialUpload describes a chunked upload that has not been completed yet.
+type PartialUpload struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	ProjectID string    `json:"project_id,omitempty"`
+	Filename  string    `json:"filename"`
+	Source    string    `json:"source"`
+	Width     int       `json:"width,omitempty"`
+	Height    int       `json:"height,omitempty"`
+	Owner     string    `json:"owner"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *Storage) partialPath(id, ext string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", fmt.Errorf("invalid upload id")
+	}
+	return filepath.Join(s.BasePath, partialDir, id+ext), nil
+}
+
+// CreatePartialUpload starts a new chunked upload and assigns it an ID.
+func (s *Storage) CreatePartialUpload(p PartialUpload) (*PartialUpload, error) {
+	p.ID = uuid.NewString()
+	p.CreatedAt = time.Now()
+	if err := os.MkdirAll(filepath.Join(s.BasePath, partialDir), 0o755); err != nil {
+		return nil, err
+	}
+	meta, _ := s.partialPath(p.ID, ".json")
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(meta, data, 0o644); err != nil {
+		return nil, err
+	}
+	part, _ := s.partialPath(p.ID, ".part")
+	if err := os.WriteFile(part, nil, 0o644); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPartialUpload returns an upload's metadata and the number of bytes
+// received so far.
+func (s *Storage) GetPartialUpload(id string) (*PartialUpload, int64, error) {
+	meta, err := s.partialPath(id, ".json")
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := os.ReadFile(meta)
+	if err != nil {
+		return nil, 0, err
+	}
+	var p PartialUpload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, 0, err
+	}
+	part, _ := s.partialPath(id, ".part")
+	info, err := os.Stat(part)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &p, info.Size(), nil
+}
+
+// uploadLock returns the mutex that serializes appends to an upload.
+func (s *Storage) uploadLock(id string) *sync.Mutex {
+	mu, _ := s.appendLocks.LoadOrStore(id, &sync.Mutex{})
+	return mu.(*sync.Mutex)
+}
+
+// AppendChunk writes a chunk at offset, which must equal the bytes received
+// so far. It returns the new received size. Appends to one upload run one
+// at a time, so of two chunks sent for the same offset only the first is
+// written and the other gets ErrOffsetMismatch.
+func (s *Storage) AppendChunk(id string, offset int64, chunk io.Reader, maxSize int64) (int64, error) {
+	part, err := s.partialPath(id, ".part")
+	if err != nil {
+		return 0, err
+	}
+	mu := s.uploadLock(id)
+	mu.Lock()
+	defer mu.Unlock()
+	f, err := os.OpenFile(part, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if offset != info.Size() {
+		return info.Size(), ErrOffsetMismatch
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, io.LimitReader(chunk, maxSize-offset+1))
+	if err != nil {
+		f.Truncate(offset)
+		return offset, err
+	}
+	if offset+n > maxSize {
+		f.Truncate(offset)
+		return offset, ErrUploadTooLarge
+	}
+	return offset + n, nil
+}
+
+// ReadPartialUpload returns the assembled bytes of an upload.
+func (s *Storage) ReadPartialUpload(id string) ([]byte, error) {
+	part, err := s.partialPath(id, ".part")
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(part)
+}
+
+// DeletePartialUpload removes an upload's data and metadata.
+func (s *Storage) DeletePartialUpload(id string) error {
+	meta, err := s.partialPath(id, ".json")
+	if err != nil {
+		return err
+	}
+	part, _ := s.partialPath(id, ".part")
+	os.Remove(part)
+	s.appendLocks.Delete(id)
+	return os.Remove(meta)
+}
+
+// CleanupPartialUploads deletes uploads started more than maxAge ago.
+func (s *Storage) CleanupPartialUploads(maxAge time.Duration) {
+	entries, err := os.ReadDir(filepath.Join(s.BasePath, partialDir))
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-maxAge)
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		p, _, err := s.GetPartialUpload(id)
+		if err != nil || p.CreatedAt.Before(cutoff) {
+			s.DeletePartialUpload(id)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAppendChunkAssemblesTwoChunks(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "uploads"))
+	p, err := s.CreatePartialUpload(PartialUpload{Name: "proj", Owner: "a@test.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := s.AppendChunk(p.ID, 0, strings.NewReader("hello "), 100)
+	if err != nil || n != 6 {
+		t.Fatalf("first chunk: n=%d err=%v", n, err)
+	}
+	n, err = s.AppendChunk(p.ID, 6, strings.NewReader("world"), 100)
+	if err != nil || n != 11 {
+		t.Fatalf("second chunk: n=%d err=%v", n, err)
+	}
+	data, _ := s.ReadPartialUpload(p.ID)
+	if string(data) != "hello world" {
+		t.Errorf("assembled = %q", data)
+	}
+	got, size, err := s.GetPartialUpload(p.ID)
+	if err != nil || size != 11 || got.Name != "proj" || got.Owner != "a@test.com" {
+		t.Errorf("unexpected upload: %+v size=%d err=%v", got, size, err)
+	}
+}
+
+func TestAppendChunkOffsetMismatch(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "uploads"))
+	p, _ := s.CreatePartialUpload(PartialUpload{Name: "proj"})
+	s.AppendChunk(p.ID, 0, strings.NewReader("abc"), 100)
+
+	n, err := s.AppendChunk(p.ID, 10, strings.NewReader("def"), 100)
+	if !errors.Is(err, ErrOffsetMismatch) || n != 3 {
+		t.Errorf("expected ErrOffsetMismatch with received=3, got n=%d err=%v", n, err)
+	}
+}
+
+// slowReader hands out its data after a pause, keeping a chunk upload in
+// flight long enough for another to start.
+type slowReader struct {
+	data []byte
+	done bool
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, io.EOF
+	}
+	time.Sleep(10 * time.Millisecond)
+	r.done = true
+	return copy(p, r.data), nil
+}
+
+func TestAppendChunkConcurrentSameOffset(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "uploads"))
+	p, _ := s.CreatePartialUpload(PartialUpload{Name: "proj"})
+
+	const n = 8
+	var wg sync.WaitGroup
+	results := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.AppendChunk(p.ID, 0, &slowReader{data: []byte(fmt.Sprintf("chunk-%d", i))}, 100)
+			results <- err
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+	ok := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			ok++
+		case !errors.Is(err, ErrOffsetMismatch):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if ok != 1 {
+		t.Errorf("%d chunks written at offset 0, want 1", ok)
+	}
+	data, _ := s.ReadPartialUpload(p.ID)
+	if len(data) != len("chunk-0") || !strings.HasPrefix(string(data), "chunk-") {
+		t.Errorf("assembled = %q, want a single chunk", data)
+	}
+}
+
+func TestAppendChunkTooLarge(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "uploads"))
+	p, _ := s.CreatePartialUpload(PartialUpload{Name: "proj"})
+	s.AppendChunk(p.ID, 0, strings.NewReader("abc"), 5)
+
+	_, err := s.AppendChunk(p.ID, 3, bytes.NewReader([]byte("defg")), 5)
+	if !errors.Is(err, ErrUploadTooLarge) {
+		t.Fatalf("expected ErrUploadTooLarge, got %v", err)
+	}
+	data, _ := s.ReadPartialUpload(p.ID)
+	if string(data) != "abc" {
+		t.Errorf("rejected chunk should be discarded, got %q", data)
+	}
+}
+
+func TestPartialUploadRejectsInvalidID(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "uploads"))
+	if _, _, err := s.GetPartialUpload("../../etc/passwd"); err == nil {
+		t.Error("expected error for invalid id")
+	}
+	if _, err := s.AppendChunk("../x", 0, strings.NewReader("a"), 10); err == nil {
+		t.Error("expected error for invalid id")
+	}
+}
+
+func TestCleanupPartialUploads(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "uploads"))
+	old, _ := s.CreatePartialUpload(PartialUpload{Name: "old"})
+	fresh, _ := s.CreatePartialUpload(PartialUpload{Name: "fresh"})
+
+	// Backdate the old upload's metadata
+	meta, _ := s.partialPath(old.ID, ".json")
+	old.CreatedAt = time.Now().Add(-48 * time.Hour)
+	data, _ := json.Marshal(old)
+	os.WriteFile(meta, data, 0o644)
+
+	s.CleanupPartialUploads(24 * time.Hour)
+	if _, _, err := s.GetPartialUpload(old.ID); err == nil {
+		t.Error("expected old upload to be removed")
+	}
+	if _, _, err := s.GetPartialUpload(fresh.ID); err != nil {
+		t.Errorf("expected fresh upload to remain: %v", err)
+	}
+}
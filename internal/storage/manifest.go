@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ManifestFile is the optional file at the root of an upload that gives
+// pages display titles and a tab order, and the width the design was made for.
+const ManifestFile = "design.json"
+
+// Manifest is the parsed ManifestFile, e.g.
+//
+//	{"width": 1080, "pages": [{"file": "Frame_12.html", "title": "Home"}, {"file": "Frame_3.html"}]}
+//
+// Pages are listed in tab order; a title is optional. Width and the
+// optional height are in CSS pixels; zero means unspecified.
+type Manifest struct {
+	Width  int            `json:"width"`
+	Height int            `json:"height"`
+	Pages  []ManifestPage `json:"pages"`
+}
+
+type ManifestPage struct {
+	File  string `json:"file"`
+	Title string `json:"title"`
+}
+
+// ReadManifest returns the manifest stored with a version, or nil if the
+// upload didn't include one. Entries naming pages that aren't in the
+// version are an error, as is malformed JSON.
+func (s *Storage) ReadManifest(versionID string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(s.BasePath, versionID, ManifestFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", ManifestFile, err)
+	}
+	if m.Width < 0 || m.Height < 0 {
+		return nil, fmt.Errorf("%s: invalid size %dx%d", ManifestFile, m.Width, m.Height)
+	}
+
+	pages, err := s.ListHTMLFiles(versionID)
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(pages))
+	for _, p := range pages {
+		exists[p] = true
+	}
+	for _, p := range m.Pages {
+		if !exists[p.File] {
+			return nil, fmt.Errorf("%s: unknown page %q", ManifestFile, p.File)
+		}
+	}
+	return &m, nil
+}
+
+// Order returns the page files in manifest order.
+func (m *Manifest) Order() []string {
+	order := make([]string, len(m.Pages))
+	for i, p := range m.Pages {
+		order[i] = p.File
+	}
+	return order
+}
+
+// Titles returns the display title of each page that has one.
+func (m *Manifest) Titles() map[string]string {
+	titles := make(map[string]string)
+	for _, p := range m.Pages {
+		if p.Title != "" {
+			titles[p.File] = p.Title
+		}
+	}
+	return titles
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// contentTypes covers asset types used by designs. The system MIME table
+// varies between hosts (minimal containers often lack one entirely), so
+// these are fixed rather than looked up.
+var contentTypes = map[string]string{
+	".html":  "text/html; charset=utf-8",
+	".htm":   "text/html; charset=utf-8",
+	".css":   "text/css; charset=utf-8",
+	".js":    "text/javascript; charset=utf-8",
+	".mjs":   "text/javascript; charset=utf-8",
+	".json":  "application/json",
+	".map":   "application/json",
+	".svg":   "image/svg+xml",
+	".png":   "image/png",
+	".jpg":   "image/jpeg",
+	".jpeg":  "image/jpeg",
+	".gif":   "image/gif",
+	".webp":  "image/webp",
+	".avif":  "image/avif",
+	".ico":   "image/x-icon",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".mp4":   "video/mp4",
+	".webm":  "video/webm",
+	".wasm":  "application/wasm",
+	".txt":   "text/plain; charset=utf-8",
+}
+
+// ContentType returns the MIME type for a design file based on its
+// extension, or "" if the type is unknown and should be sniffed.
+func ContentType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ct, ok := contentTypes[ext]; ok {
+		return ct
+	}
+	return mime.TypeByExtension(ext)
+}
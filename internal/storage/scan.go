@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// ScriptWarnings reports each file in a stored version that uses
+// JavaScript: script files, and HTML pages with a <script> tag. Designs are
+// meant to be HTML and CSS only, so these are surfaced to the uploader
+// rather than rejected.
+func (s *Storage) ScriptWarnings(versionID string) ([]string, error) {
+	files, err := s.ListAllFiles(versionID)
+	if err != nil {
+		return nil, err
+	}
+	var warnings []string
+	for _, f := range files {
+		switch strings.ToLower(filepath.Ext(f.Path)) {
+		case ".js", ".mjs":
+			warnings = append(warnings, f.Path+" is a JavaScript file; JavaScript isn't supported in designs")
+		case ".html", ".htm":
+			data, err := os.ReadFile(s.GetFilePath(versionID, filepath.FromSlash(f.Path)))
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Contains(bytes.ToLower(data), []byte("<script")) {
+				warnings = append(warnings, f.Path+" has a <script> tag; JavaScript isn't supported in designs")
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// MarkupWarnings reports each HTML page in a stored version that would
+// render blank: empty files, binary data saved as .html, and pages whose
+// <body> has nothing in it once parsed (often a truncated file). Like
+// ScriptWarnings, these are surfaced to the uploader rather than rejected.
+func (s *Storage) MarkupWarnings(versionID string) ([]string, error) {
+	files, err := s.ListAllFiles(versionID)
+	if err != nil {
+		return nil, err
+	}
+	var warnings []string
+	for _, f := range files {
+		switch strings.ToLower(filepath.Ext(f.Path)) {
+		case ".html", ".htm":
+		default:
+			continue
+		}
+		data, err := os.ReadFile(s.GetFilePath(versionID, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return nil, err
+		}
+		if problem := markupProblem(data); problem != "" {
+			warnings = append(warnings, f.Path+" "+problem)
+		}
+	}
+	return warnings, nil
+}
+
+// markupProblem describes why a page would render blank, or returns "".
+// The parse is as lenient as a browser's, so sloppy but visible markup
+// passes.
+func markupProblem(data []byte) string {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return "is empty; it will render blank"
+	}
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return "isn't HTML (it looks like binary data); it won't render"
+	}
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return "couldn't be parsed as HTML; it may not render"
+	}
+	if body := findElement(doc, "body"); body == nil || !hasVisibleContent(body) {
+		return "has nothing in its <body>; it will render blank"
+	}
+	return ""
+}
+
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// hasVisibleContent reports whether n holds text or any element that can
+// show something. Scripts, styles and templates don't count.
+func hasVisibleContent(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch c.Type {
+		case html.TextNode:
+			if strings.TrimSpace(c.Data) != "" {
+				return true
+			}
+		case html.ElementNode:
+			switch c.Data {
+			case "script", "style", "template":
+			default:
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -5,13 +5,20 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 )
 
 type Storage struct {
 	BasePath string
+
+	// appendLocks maps a chunked upload's ID to the *sync.Mutex that
+	// serializes appends to it.
+	appendLocks sync.Map
 }
 
 func New(basePath string) *Storage {
@@ -22,6 +29,20 @@ func New(basePath string) *Storage {
 const maxDecompressedSize = 500 << 20 // 500 MB
 const maxFileCount = 1000
 
+// NoHTMLError is returned by SaveUpload when a zip has no .html or .htm file to
+// use as an entry page. Found lists the file extensions it did contain.
+type NoHTMLError struct {
+	Found []string
+}
+
+func (e *NoHTMLError) Error() string {
+	msg := "zip must contain at least one .html file (e.g. index.html)"
+	if len(e.Found) > 0 {
+		msg += "; found only " + strings.Join(e.Found, ", ") + " files"
+	}
+	return msg
+}
+
 func (s *Storage) SaveUpload(versionID string, zipData io.Reader) error {
 	data, err := io.ReadAll(zipData)
 	if err != nil {
@@ -38,14 +59,28 @@ func (s *Storage) SaveUpload(versionID string, zipData io.Reader) error {
 		return fmt.Errorf("zip contains too many files (max %d)", maxFileCount)
 	}
 	hasHTML := false
+	exts := map[string]bool{}
 	for _, f := range zr.File {
-		if strings.HasSuffix(strings.ToLower(f.Name), ".html") && !f.FileInfo().IsDir() {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(f.Name))
+		if ext == ".html" || ext == ".htm" {
 			hasHTML = true
 			break
 		}
+		if ext == "" {
+			ext = "extensionless"
+		}
+		exts[ext] = true
 	}
 	if !hasHTML {
-		return fmt.Errorf("zip must contain at least one .html file")
+		found := make([]string, 0, len(exts))
+		for ext := range exts {
+			found = append(found, ext)
+		}
+		sort.Strings(found)
+		return &NoHTMLError{Found: found}
 	}
 	dir := filepath.Join(s.BasePath, versionID)
 	var totalWritten int64
@@ -82,6 +117,14 @@ func (s *Storage) SaveUpload(versionID string, zipData io.Reader) error {
 	return nil
 }
 
+// DeleteUpload removes a version's stored files.
+func (s *Storage) DeleteUpload(versionID string) error {
+	if versionID == "" || strings.ContainsAny(versionID, `/\.`) {
+		return fmt.Errorf("invalid version id %q", versionID)
+	}
+	return os.RemoveAll(filepath.Join(s.BasePath, versionID))
+}
+
 func (s *Storage) GetFilePath(versionID, filePath string) string {
 	return filepath.Join(s.BasePath, versionID, filePath)
 }
@@ -94,9 +137,53 @@ func (s *Storage) ListHTMLFiles(versionID string) ([]string, error) {
 	}
 	var files []string
 	for _, e := range entries {
-		if !e.IsDir() && strings.HasSuffix(strings.ToLower(e.Name()), ".html") {
+		if ext := strings.ToLower(filepath.Ext(e.Name())); !e.IsDir() && (ext == ".html" || ext == ".htm") {
 			files = append(files, e.Name())
 		}
 	}
 	return files, nil
 }
+
+// FileInfo describes one file in a stored version.
+type FileInfo struct {
+	Path        string // slash-separated, relative to the version root
+	Size        int64
+	ContentType string
+}
+
+// ListAllFiles walks a version directory and returns every regular file,
+// including nested ones. Symlinks are not followed.
+func (s *Storage) ListAllFiles(versionID string) ([]FileInfo, error) {
+	base := filepath.Clean(s.BasePath)
+	dir := filepath.Join(base, versionID)
+	if !strings.HasPrefix(dir, base+string(os.PathSeparator)) {
+		return nil, fmt.Errorf("invalid version id")
+	}
+	var files []FileInfo
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		ct := ContentType(path)
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		files = append(files, FileInfo{Path: filepath.ToSlash(rel), Size: info.Size(), ContentType: ct})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
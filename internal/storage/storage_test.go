@@ -3,9 +3,11 @@ package storage
 import (
 	"archive/zip"
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
 	"testing"
@@ -54,11 +56,16 @@ func TestSaveUploadAndGetFilePath(t *testing.T) {
 
 func TestSaveUploadNoHTML(t *testing.T) {
 	s := New(filepath.Join(t.TempDir(), "uploads"))
-	z := makeZip(t, map[string]string{"readme.txt": "no html"})
+	z := makeZip(t, map[string]string{"readme.txt": "no html", "style.css": "", "img/a.png": "", "LICENSE": ""})
 
 	err := s.SaveUpload("v1", z)
-	if err == nil {
-		t.Error("expected error for zip without HTML")
+	var noHTML *NoHTMLError
+	if !errors.As(err, &noHTML) {
+		t.Fatalf("expected NoHTMLError, got %v", err)
+	}
+	want := []string{".css", ".png", ".txt", "extensionless"}
+	if !reflect.DeepEqual(noHTML.Found, want) {
+		t.Errorf("Found = %v, want %v", noHTML.Found, want)
 	}
 }
 
@@ -96,6 +103,20 @@ func TestListHTMLFiles(t *testing.T) {
 	}
 }
 
+func TestListHTMLFilesHTM(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "uploads"))
+	z := makeZip(t, map[string]string{"index.htm": "a", "About.HTML": "b"})
+	if err := s.SaveUpload("v1", z); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := s.ListHTMLFiles("v1")
+	sort.Strings(files)
+	if len(files) != 2 || files[0] != "About.HTML" || files[1] != "index.htm" {
+		t.Errorf("files = %v, want [About.HTML index.htm]", files)
+	}
+}
+
 func TestListHTMLFilesNoDir(t *testing.T) {
 	s := New(filepath.Join(t.TempDir(), "uploads"))
 	_, err := s.ListHTMLFiles("nonexistent")
@@ -104,6 +125,27 @@ func TestListHTMLFilesNoDir(t *testing.T) {
 	}
 }
 
+func TestDeleteUpload(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "uploads"))
+	if err := s.SaveUpload("v1", makeZip(t, map[string]string{"css/site.css": "p{}", "index.html": "x"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteUpload("v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(s.BasePath, "v1")); !os.IsNotExist(err) {
+		t.Errorf("version dir still exists: %v", err)
+	}
+	for _, id := range []string{"", "..", "v1/../v2"} {
+		if err := s.DeleteUpload(id); err == nil {
+			t.Errorf("DeleteUpload(%q) should fail", id)
+		}
+	}
+	if _, err := os.Stat(s.BasePath); err != nil {
+		t.Errorf("base dir removed: %v", err)
+	}
+}
+
 func TestGetFilePath(t *testing.T) {
 	s := &Storage{BasePath: "/base"}
 	got := s.GetFilePath("v1", "index.html")
@@ -261,3 +303,156 @@ func TestSaveUploadDecompressedSizeWithinLimit(t *testing.T) {
 		t.Fatalf("upload within limit should succeed: %v", err)
 	}
 }
+
+func TestListAllFilesNested(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "uploads"))
+	buf := makeZip(t, map[string]string{
+		"index.html":          "<h1>hi</h1>",
+		"css/site.css":        "body{}",
+		"assets/img/logo.png": "12345",
+	})
+	if err := s.SaveUpload("v1", buf); err != nil {
+		t.Fatal(err)
+	}
+	files, err := s.ListAllFiles("v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	want := []FileInfo{
+		{"assets/img/logo.png", 5, "image/png"},
+		{"css/site.css", 6, "text/css; charset=utf-8"},
+		{"index.html", 11, "text/html; charset=utf-8"},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("expected %d files, got %+v", len(want), files)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("file %d = %+v, want %+v", i, files[i], want[i])
+		}
+	}
+}
+
+func TestListAllFilesRejectsTraversal(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "uploads"))
+	for _, id := range []string{"..", "../other", ""} {
+		if _, err := s.ListAllFiles(id); err == nil {
+			t.Errorf("expected error for version id %q", id)
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	cases := map[string]string{
+		"app.mjs":           "text/javascript; charset=utf-8",
+		"lib/main.JS":       "text/javascript; charset=utf-8",
+		"img/photo.webp":    "image/webp",
+		"img/photo.avif":    "image/avif",
+		"fonts/inter.woff2": "font/woff2",
+		"data.json":         "application/json",
+		"README":            "",
+	}
+	for path, want := range cases {
+		if got := ContentType(path); got != want {
+			t.Errorf("ContentType(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestScriptWarnings(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "uploads"))
+	z := makeZip(t, map[string]string{
+		"index.html":   "<h1>hi</h1><SCRIPT>alert(1)</SCRIPT>",
+		"about.html":   "<p>clean</p>",
+		"js/app.js":    "console.log(1)",
+		"css/site.css": "body{}",
+	})
+	if err := s.SaveUpload("v1", z); err != nil {
+		t.Fatal(err)
+	}
+	warnings, err := s.ScriptWarnings("v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 2 || !strings.HasPrefix(warnings[0], "index.html ") || !strings.HasPrefix(warnings[1], "js/app.js ") {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+
+	if err := s.SaveUpload("v2", makeZip(t, map[string]string{"index.html": "<p>clean</p>"})); err != nil {
+		t.Fatal(err)
+	}
+	if warnings, _ := s.ScriptWarnings("v2"); len(warnings) != 0 {
+		t.Errorf("clean upload should have no warnings, got %v", warnings)
+	}
+}
+
+func TestMarkupWarnings(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "uploads"))
+	z := makeZip(t, map[string]string{
+		"a-empty.html":     "  \n",
+		"b-binary.html":    "\x89PNG\r\n\x1a\n\x00\x00",
+		"c-truncated.html": "<html><head><style>body{color:red}",
+		"d-sloppy.html":    "<h1>hi<p>unclosed",
+		"e-text.html":      "just text",
+		"f-page.htm":       "<!DOCTYPE html><html><body><div></div></body></html>",
+		"g-style.css":      "",
+	})
+	if err := s.SaveUpload("v1", z); err != nil {
+		t.Fatal(err)
+	}
+	warnings, err := s.MarkupWarnings("v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a-empty.html is empty", "b-binary.html isn't HTML", "c-truncated.html has nothing in its <body>"}
+	if len(warnings) != len(want) {
+		t.Fatalf("expected %d warnings, got %v", len(want), warnings)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(warnings[i], w) {
+			t.Errorf("warning %d = %q, want prefix %q", i, warnings[i], w)
+		}
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "uploads"))
+	save := func(id string, files map[string]string) {
+		t.Helper()
+		if err := s.SaveUpload(id, makeZip(t, files)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	save("v1", map[string]string{"index.html": "i", "a.html": "a", ManifestFile: `{"pages":[{"file":"a.html","title":"About"},{"file":"index.html"}]}`})
+	m, err := s.ReadManifest("v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m.Order(), []string{"a.html", "index.html"}) {
+		t.Errorf("Order() = %v", m.Order())
+	}
+	if !reflect.DeepEqual(m.Titles(), map[string]string{"a.html": "About"}) {
+		t.Errorf("Titles() = %v", m.Titles())
+	}
+
+	save("v2", map[string]string{"index.html": "i"})
+	if m, err := s.ReadManifest("v2"); m != nil || err != nil {
+		t.Errorf("no manifest: got %v, %v", m, err)
+	}
+
+	save("v3", map[string]string{"index.html": "i", ManifestFile: `{"pages":[{"file":"gone.html"}]}`})
+	if _, err := s.ReadManifest("v3"); err == nil {
+		t.Error("expected error for unknown page")
+	}
+
+	save("v4", map[string]string{"index.html": "i", ManifestFile: `{"width":390}`})
+	if m, err := s.ReadManifest("v4"); err != nil || m.Width != 390 {
+		t.Errorf("width: got %+v, %v", m, err)
+	}
+	save("v5", map[string]string{"index.html": "i", ManifestFile: `{"width":-1}`})
+	if _, err := s.ReadManifest("v5"); err == nil {
+		t.Error("expected error for negative width")
+	}
+}
@@ -0,0 +1,53 @@
+// Package version reports which build of the server or CLI is running.
+package version
+
+import (
+	"runtime/debug"
+)
+
+// Version and Commit can be set at build time:
+//
+//	go build -ldflags "-X github.com/ab/design-reviewer/internal/version.Version=v1.2.0 \
+//	    -X github.com/ab/design-reviewer/internal/version.Commit=$(git rev-parse HEAD)"
+//
+// When unset they fall back to the module version and VCS revision that the
+// Go toolchain embeds in the binary.
+var (
+	Version = ""
+	Commit  = ""
+)
+
+// Info returns the build version and git commit. The version is "dev" and
+// the commit "unknown" when neither ldflags nor build info provide them.
+func Info() (version, commit string) {
+	version, commit = Version, Commit
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			version = bi.Main.Version
+		}
+		if commit == "" {
+			for _, s := range bi.Settings {
+				if s.Key == "vcs.revision" {
+					commit = s.Value
+				}
+			}
+		}
+	}
+	if version == "" {
+		version = "dev"
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	return version, commit
+}
+
+// String returns the version and commit in a single line, e.g.
+// "v1.2.0 (commit 3f2a9c1)".
+func String() string {
+	v, c := Info()
+	if len(c) > 12 {
+		c = c[:12]
+	}
+	return v + " (commit " + c + ")"
+}
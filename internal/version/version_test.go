@@ -0,0 +1,24 @@
+package version
+
+import "testing"
+
+func TestInfoDefaults(t *testing.T) {
+	v, c := Info()
+	if v == "" || c == "" {
+		t.Errorf("Info() = %q, %q; want non-empty", v, c)
+	}
+}
+
+func TestInfoUsesLdflags(t *testing.T) {
+	oldV, oldC := Version, Commit
+	t.Cleanup(func() { Version, Commit = oldV, oldC })
+	Version, Commit = "v1.2.3", "0123456789abcdef0123"
+
+	v, c := Info()
+	if v != "v1.2.3" || c != "0123456789abcdef0123" {
+		t.Errorf("Info() = %q, %q", v, c)
+	}
+	if s := String(); s != "v1.2.3 (commit 0123456789ab)" {
+		t.Errorf("String() = %q", s)
+	}
+}
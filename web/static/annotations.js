@@ -2,6 +2,16 @@ document.addEventListener("DOMContentLoaded", function () {
     var layout = document.querySelector("[data-version-id]");
     if (!layout) return;
     var versionID = layout.dataset.versionId;
+    var apiBase = window.apiBase || "";
+    // Public share links may hide comments or make them read-only, and
+    // anonymous visitors can never resolve or move them.
+    var commentMode = window.commentMode || "";
+    // ?comments_from= overlays another version's comments; new comments
+    // would belong to the version on screen, so posting is off meanwhile.
+    var commentsVersionID = layout.dataset.commentsVersionId || versionID;
+    var overlaid = commentsVersionID !== versionID;
+    var canPost = commentMode !== "hidden" && commentMode !== "readonly" && !overlaid;
+    var canModerate = commentMode === "";
 
     var overlay = document.getElementById("pin-overlay");
     var frame = document.getElementById("design-frame");
@@ -34,9 +44,41 @@ document.addEventListener("DOMContentLoaded", function () {
 
     currentPage = getCurrentPage();
 
+    // Canned comments set up by the project's owners, offered as one-click
+    // inserts in the comment and reply boxes. Share links don't get them.
+    var commentTemplates = [];
+    if (canPost && commentMode === "") {
+        fetch(apiBase + "/api/projects/" + layout.dataset.projectId + "/comment-templates")
+            .then(function (r) { return r.ok ? r.json() : []; })
+            .then(function (data) { commentTemplates = data || []; })
+            .catch(function () {});
+    }
+
+    function templateChips() {
+        if (!commentTemplates.length) return "";
+        return '<div class="comment-templates">' + commentTemplates.map(function (t, i) {
+            return '<button type="button" class="template-chip" data-template="' + i + '" title="' + esc(t.body) + '">' + esc(t.body) + '</button>';
+        }).join("") + '</div>';
+    }
+
+    // Clicking a chip appends its text to the box, so several can be combined.
+    function wireTemplateChips(textareaID) {
+        panel.querySelectorAll(".template-chip").forEach(function (btn) {
+            btn.addEventListener("click", function () {
+                var textarea = document.getElementById(textareaID);
+                var t = commentTemplates[btn.dataset.template];
+                if (!textarea || !t) return;
+                var current = textarea.value.replace(/\s+$/, "");
+                textarea.value = current ? current + " " + t.body : t.body;
+                textarea.focus();
+            });
+        });
+    }
+
     // Load comments from API
     function loadComments() {
-        return fetch("/api/versions/" + versionID + "/comments")
+        if (commentMode === "hidden") return Promise.resolve();
+        return fetch(apiBase + "/api/versions/" + commentsVersionID + "/comments")
             .then(function (r) { return r.json(); })
             .then(function (data) {
                 comments = data || [];
@@ -44,6 +86,49 @@ document.addEventListener("DOMContentLoaded", function () {
             });
     }
 
+    // Anchors tie a pin to the element under it so carried-over pins follow
+    // layout changes between versions. Percentages remain the fallback.
+    function frameDoc() {
+        try { return frame.contentDocument; } catch (e) { return null; }
+    }
+
+    function selectorFor(el) {
+        var parts = [];
+        while (el && el.nodeType === 1 && el.tagName !== "BODY" && el.tagName !== "HTML") {
+            var named = el.getAttribute("data-dr-anchor");
+            if (named) { parts.unshift('[data-dr-anchor="' + CSS.escape(named) + '"]'); return parts.join(" > "); }
+            if (el.id) { parts.unshift("#" + CSS.escape(el.id)); return parts.join(" > "); }
+            var idx = 1, sib = el;
+            while ((sib = sib.previousElementSibling)) { if (sib.tagName === el.tagName) idx++; }
+            parts.unshift(el.tagName.toLowerCase() + ":nth-of-type(" + idx + ")");
+            el = el.parentElement;
+        }
+        return parts.length ? "body > " + parts.join(" > ") : "";
+    }
+
+    function anchorAt(xPct, yPct) {
+        var doc = frameDoc();
+        if (!doc || !overlay.offsetWidth) return "";
+        var el = doc.elementFromPoint((xPct / 100) * overlay.offsetWidth, (yPct / 100) * overlay.offsetHeight);
+        return el ? selectorFor(el) : "";
+    }
+
+    // Keep the stored position while it still falls on the anchored element;
+    // otherwise the layout changed, so move the pin to the element's center.
+    function pinPosition(c) {
+        var pos = { x: c.x_percent, y: c.y_percent };
+        var doc = c.anchor && frameDoc();
+        var w = overlay.offsetWidth, h = overlay.offsetHeight;
+        if (!doc || !w || !h) return pos;
+        var el;
+        try { el = doc.querySelector(c.anchor); } catch (e) { return pos; }
+        if (!el) return pos;
+        var r = el.getBoundingClientRect();
+        var px = (pos.x / 100) * w, py = (pos.y / 100) * h;
+        if (px >= r.left && px <= r.right && py >= r.top && py <= r.bottom) return pos;
+        return { x: ((r.left + r.width / 2) / w) * 100, y: ((r.top + r.height / 2) / h) * 100 };
+    }
+
     // Render pin markers on overlay
     function renderPins() {
         overlay.querySelectorAll(".pin-marker").forEach(function (el) { el.remove(); });
@@ -55,8 +140,9 @@ document.addEventListener("DOMContentLoaded", function () {
             if (currentFilter === "resolved" && !c.resolved) return;
             var pin = document.createElement("div");
             pin.className = "pin-marker" + (c.resolved ? " pin-resolved" : "");
-            pin.style.left = c.x_percent + "%";
-            pin.style.top = c.y_percent + "%";
+            var pos = pinPosition(c);
+            pin.style.left = pos.x + "%";
+            pin.style.top = pos.y + "%";
             pin.textContent = num;
             pin.dataset.index = i;
             pin.addEventListener("click", function (e) {
@@ -66,6 +152,7 @@ document.addEventListener("DOMContentLoaded", function () {
             });
             pin.addEventListener("mousedown", function (e) {
                 e.stopPropagation();
+                if (!canModerate) return;
                 e.preventDefault();
                 var startX = e.clientX, startY = e.clientY;
                 var dragging = false;
@@ -88,10 +175,10 @@ document.addEventListener("DOMContentLoaded", function () {
                     var rect = overlay.getBoundingClientRect();
                     var nx = Math.max(0, Math.min(100, ((ev.clientX - rect.left) / rect.width) * 100));
                     var ny = Math.max(0, Math.min(100, ((ev.clientY - rect.top) / rect.height) * 100));
-                    fetch("/api/comments/" + c.id + "/move", {
+                    fetch(apiBase + "/api/comments/" + c.id + "/move", {
                         method: "PATCH",
                         headers: { "Content-Type": "application/json" },
-                        body: JSON.stringify({ x_percent: nx, y_percent: ny })
+                        body: JSON.stringify({ x_percent: nx, y_percent: ny, anchor: anchorAt(nx, ny) })
                     }).then(function () { loadComments(); });
                 }
                 document.addEventListener("mousemove", onMove);
@@ -104,6 +191,7 @@ document.addEventListener("DOMContentLoaded", function () {
     // Click overlay to create new pin
     overlay.addEventListener("click", function (e) {
         if (e.ctrlKey || e.metaKey) return;
+        if (!canPost) return;
         var rect = overlay.getBoundingClientRect();
         var xPct = ((e.clientX - rect.left) / rect.width) * 100;
         var yPct = ((e.clientY - rect.top) / rect.height) * 100;
@@ -131,6 +219,7 @@ document.addEventListener("DOMContentLoaded", function () {
             '<div class="panel-body">' +
             nameField +
             '<textarea class="comment-input" placeholder="Add a comment..." id="nc-body" rows="3"></textarea>' +
+            templateChips() +
             '<span class="shortcut-hint">' + shortcutHint + '</span>' +
             '<button class="btn-submit" id="nc-submit">Post</button>' +
             '</div>';
@@ -145,12 +234,13 @@ document.addEventListener("DOMContentLoaded", function () {
             panelBackdrop.classList.remove("open");
             savedPanelPosition = null;
         };
+        wireTemplateChips("nc-body");
         document.getElementById("nc-submit").addEventListener("click", function () {
             var nameEl = document.getElementById("nc-name");
             var name = window.authUser ? window.authUser.name : (nameEl ? nameEl.value.trim() : "Anonymous");
             var body = document.getElementById("nc-body").value.trim();
             if (!body) return;
-            fetch("/api/versions/" + versionID + "/comments", {
+            fetch(apiBase + "/api/versions/" + versionID + "/comments", {
                 method: "POST",
                 headers: { "Content-Type": "application/json" },
                 body: JSON.stringify({
@@ -159,7 +249,8 @@ document.addEventListener("DOMContentLoaded", function () {
                     y_percent: yPct,
                     author_name: name || "Anonymous",
                     author_email: "",
-                    body: body
+                    body: body,
+                    anchor: anchorAt(xPct, yPct)
                 })
             }).then(function () {
                 panelBackdrop.classList.remove("open");
@@ -176,7 +267,7 @@ document.addEventListener("DOMContentLoaded", function () {
 
     // Open comment panel for existing pin
     function openPanel(c, sourceElement) {
-        var resolveBtn = c.resolved
+        var resolveBtn = !canModerate ? '' : c.resolved
             ? '<button class="btn-resolve-header" id="rp-resolve"><svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" fill="currentColor" viewBox="0 0 256 256"><path d="M173.66,98.34a8,8,0,0,1,0,11.32l-56,56a8,8,0,0,1-11.32,0l-24-24a8,8,0,0,1,11.32-11.32L112,148.69l50.34-50.35A8,8,0,0,1,173.66,98.34ZM232,128A104,104,0,1,1,128,24,104.11,104.11,0,0,1,232,128Zm-16,0a88,88,0,1,0-88,88A88.1,88.1,0,0,0,216,128Z"></path></svg>Unresolve</button>'
             : '<button class="btn-resolve-header" id="rp-resolve"><svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" fill="currentColor" viewBox="0 0 256 256"><path d="M173.66,98.34a8,8,0,0,1,0,11.32l-56,56a8,8,0,0,1-11.32,0l-24-24a8,8,0,0,1,11.32-11.32L112,148.69l50.34-50.35A8,8,0,0,1,173.66,98.34ZM232,128A104,104,0,1,1,128,24,104.11,104.11,0,0,1,232,128Zm-16,0a88,88,0,1,0-88,88A88.1,88.1,0,0,0,216,128Z"></path></svg>Resolve</button>';
 
@@ -184,7 +275,8 @@ document.addEventListener("DOMContentLoaded", function () {
             '<p class="comment-body">' + esc(c.body) + '</p></div>';
         if (c.replies) {
             c.replies.forEach(function (r) {
-                commentsHtml += '<div class="reply-item"><strong class="comment-author">' + esc(r.author_name) + '</strong> <span class="comment-time">' + fmtTime(r.created_at) + '</span>' +
+                commentsHtml += '<div class="reply-item' + (r.resolved ? ' done' : '') + '"><strong class="comment-author">' + esc(r.author_name) + '</strong> <span class="comment-time">' + fmtTime(r.created_at) + '</span>' +
+                    (canModerate ? '<label class="reply-done"><input type="checkbox" data-reply-id="' + esc(r.id) + '"' + (r.resolved ? ' checked' : '') + '> Done</label>' : '') +
                     '<p class="comment-body">' + esc(r.body) + '</p></div>';
             });
         }
@@ -193,12 +285,13 @@ document.addEventListener("DOMContentLoaded", function () {
             '<div class="panel-header"><span>Comment</span><div class="panel-actions">' + resolveBtn + '<button class="panel-close">&times;</button></div></div>' +
             '<div class="panel-body">' +
             '<div class="comments-scroll">' + commentsHtml + '</div>' +
-            '<div class="reply-form">' +
+            (canPost ? '<div class="reply-form">' +
             (window.authUser ? '' : '<input class="comment-input" placeholder="Your name" id="rp-name">') +
             '<textarea class="comment-input" placeholder="Reply..." id="rp-body" rows="2"></textarea>' +
+            templateChips() +
             '<span class="shortcut-hint">' + shortcutHint + '</span>' +
             '<button class="btn-submit" id="rp-submit">Reply</button>' +
-            '</div></div>';
+            '</div>' : '') + '</div>';
         panel.innerHTML = html;
 
         // Position the panel next to the source element or use saved position
@@ -215,25 +308,39 @@ document.addEventListener("DOMContentLoaded", function () {
             panelBackdrop.classList.remove("open");
             savedPanelPosition = null;
         };
-        document.getElementById("rp-submit").addEventListener("click", function () {
+        if (canPost) wireTemplateChips("rp-body");
+        if (canPost) document.getElementById("rp-submit").addEventListener("click", function () {
             var nameEl = document.getElementById("rp-name");
             var name = window.authUser ? window.authUser.name : (nameEl ? nameEl.value.trim() : "Anonymous");
             var body = document.getElementById("rp-body").value.trim();
             if (!body) return;
-            fetch("/api/comments/" + c.id + "/replies", {
+            fetch(apiBase + "/api/comments/" + c.id + "/replies", {
                 method: "POST",
                 headers: { "Content-Type": "application/json" },
                 body: JSON.stringify({ author_name: name || "Anonymous", author_email: "", body: body })
             }).then(function () { loadComments().then(function () { openPanelById(c.id); }); });
         });
-        document.getElementById("rp-body").addEventListener("keydown", function (e) {
+        if (canPost) document.getElementById("rp-body").addEventListener("keydown", function (e) {
             if (e.key === "Enter" && (e.ctrlKey || e.metaKey)) {
                 e.preventDefault();
                 document.getElementById("rp-submit").click();
             }
         });
-        document.getElementById("rp-resolve").addEventListener("click", function () {
-            fetch("/api/comments/" + c.id + "/resolve", { method: "PATCH" })
+        panel.querySelectorAll(".reply-done input").forEach(function (cb) {
+            cb.addEventListener("change", function () {
+                var item = cb.closest(".reply-item");
+                fetch(apiBase + "/api/replies/" + cb.dataset.replyId + "/resolve", { method: "PATCH" })
+                    .then(function (r) { return r.json(); })
+                    .then(function (data) {
+                        cb.checked = data.resolved;
+                        item.classList.toggle("done", data.resolved);
+                        var rp = (c.replies || []).find(function (x) { return x.id === cb.dataset.replyId; });
+                        if (rp) rp.resolved = data.resolved;
+                    });
+            });
+        });
+        if (canModerate) document.getElementById("rp-resolve").addEventListener("click", function () {
+            fetch(apiBase + "/api/comments/" + c.id + "/resolve", { method: "PATCH" })
                 .then(function () {
                     loadComments();
                     panelBackdrop.classList.remove("open");
@@ -347,6 +454,7 @@ document.addEventListener("DOMContentLoaded", function () {
     // Expose reload hook for version switching
     window.reloadComments = function (newVersionID) {
         versionID = newVersionID;
+        if (!overlaid) commentsVersionID = newVersionID;
         currentPage = getCurrentPage();
         panelBackdrop.classList.remove("open");
         loadComments();
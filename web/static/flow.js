@@ -21,7 +21,7 @@
 
         container.innerHTML = '<div style="color:var(--text-muted);padding:2rem;text-align:center">Loading flow graph…</div>';
 
-        fetch("/api/versions/" + versionID + "/flow")
+        fetch((window.apiBase || "") + "/api/versions/" + versionID + "/flow")
             .then(function (r) { return r.json(); })
             .then(function (data) {
                 if (!data.nodes || data.nodes.length === 0) {
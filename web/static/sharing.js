@@ -4,16 +4,22 @@
 
     const dialog = document.getElementById('share-dialog');
     const generateBtn = document.getElementById('generate-invite');
+    const shortInvite = document.getElementById('invite-short');
     const linkBox = document.getElementById('invite-link-box');
     const linkInput = document.getElementById('invite-link');
     const copyBtn = document.getElementById('copy-invite');
     const closeBtn = document.getElementById('close-share');
     const membersList = document.getElementById('members-list');
+    const publicSharesList = document.getElementById('public-shares-list');
+    const publicShareMode = document.getElementById('public-share-mode');
+    const createPublicShareBtn = document.getElementById('create-public-share');
     const projectID = document.querySelector('.viewer-layout').dataset.projectId;
+    const base = window.basePath || '';
 
     shareBtn.addEventListener('click', function() {
         dialog.style.display = 'flex';
         loadMembers();
+        loadPublicShares();
     });
 
     closeBtn.addEventListener('click', function() {
@@ -21,7 +27,8 @@
     });
 
     generateBtn.addEventListener('click', function() {
-        fetch('/api/projects/' + projectID + '/invites', { method: 'POST' })
+        const query = shortInvite.checked ? '?short=true' : '';
+        fetch(base + '/api/projects/' + projectID + '/invites' + query, { method: 'POST' })
             .then(r => r.json())
             .then(data => {
                 linkInput.value = data.invite_url;
@@ -29,6 +36,14 @@
             });
     });
 
+    createPublicShareBtn.addEventListener('click', function() {
+        fetch(base + '/api/projects/' + projectID + '/public-shares', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ comment_mode: publicShareMode.value })
+        }).then(() => loadPublicShares());
+    });
+
     copyBtn.addEventListener('click', function() {
         linkInput.select();
         navigator.clipboard.writeText(linkInput.value);
@@ -42,22 +57,74 @@
         return d.innerHTML.replace(/"/g, '&quot;').replace(/'/g, '&#39;');
     }
 
+    const commentModes = { hidden: 'Comments hidden', readonly: 'Comments read-only', open: 'Anyone can comment' };
+
+    function loadPublicShares() {
+        fetch(base + '/api/projects/' + projectID + '/public-shares')
+            .then(r => r.json())
+            .then(shares => {
+                if (!shares || shares.length === 0) {
+                    publicSharesList.innerHTML = '<p class="empty">No public links</p>';
+                    return;
+                }
+                publicSharesList.innerHTML = shares.map(s =>
+                    '<div class="public-share-row">' +
+                    '<input type="text" readonly class="invite-link-input" value="' + esc(s.url) + '">' +
+                    '<select class="comment-mode-select" data-id="' + esc(s.id) + '">' +
+                    Object.keys(commentModes).map(m =>
+                        '<option value="' + m + '"' + (m === s.comment_mode ? ' selected' : '') + '>' + commentModes[m] + '</option>'
+                    ).join('') +
+                    '</select>' +
+                    '<button class="btn-remove" data-id="' + esc(s.id) + '">Revoke</button>' +
+                    '</div>'
+                ).join('');
+                publicSharesList.querySelectorAll('select').forEach(sel => {
+                    sel.addEventListener('change', function() {
+                        fetch(base + '/api/projects/' + projectID + '/public-shares/' + this.dataset.id, {
+                            method: 'PATCH',
+                            headers: { 'Content-Type': 'application/json' },
+                            body: JSON.stringify({ comment_mode: this.value })
+                        });
+                    });
+                });
+                publicSharesList.querySelectorAll('.btn-remove').forEach(btn => {
+                    btn.addEventListener('click', function() {
+                        fetch(base + '/api/projects/' + projectID + '/public-shares/' + this.dataset.id, { method: 'DELETE' })
+                            .then(() => loadPublicShares());
+                    });
+                });
+            });
+    }
+
     function loadMembers() {
-        fetch('/api/projects/' + projectID + '/members')
+        fetch(base + '/api/projects/' + projectID + '/members')
             .then(r => r.json())
             .then(members => {
                 if (!members || members.length === 0) {
                     membersList.innerHTML = '<p class="empty">No members yet</p>';
                     return;
                 }
-                membersList.innerHTML = members.map(m =>
-                    '<div class="member-row"><span>' + esc(m.email) + '</span>' +
-                    (window.isOwner ? '<button class="btn-remove" data-email="' + esc(m.email) + '">Remove</button>' : '') +
+                membersList.innerHTML = members.map(m => m.primary ?
+                    '<div class="member-row"><span>' + esc(m.email) + ' <em class="member-role">owner</em></span></div>' :
+                    '<div class="member-row"><span>' + esc(m.email) +
+                    (m.role === 'owner' ? ' <em class="member-role">co-owner</em>' : '') + '</span>' +
+                    (window.isOwner ? '<button class="btn-role" data-email="' + esc(m.email) + '" data-role="' + (m.role === 'owner' ? 'member' : 'owner') + '">' +
+                        (m.role === 'owner' ? 'Make member' : 'Make co-owner') + '</button>' +
+                        '<button class="btn-remove" data-email="' + esc(m.email) + '">Remove</button>' : '') +
                     '</div>'
                 ).join('');
+                membersList.querySelectorAll('.btn-role').forEach(btn => {
+                    btn.addEventListener('click', function() {
+                        fetch(base + '/api/projects/' + projectID + '/members/' + encodeURIComponent(this.dataset.email) + '/role', {
+                            method: 'PUT',
+                            headers: { 'Content-Type': 'application/json' },
+                            body: JSON.stringify({ role: this.dataset.role })
+                        }).then(() => loadMembers());
+                    });
+                });
                 membersList.querySelectorAll('.btn-remove').forEach(btn => {
                     btn.addEventListener('click', function() {
-                        fetch('/api/projects/' + projectID + '/members/' + encodeURIComponent(this.dataset.email), { method: 'DELETE' })
+                        fetch(base + '/api/projects/' + projectID + '/members/' + encodeURIComponent(this.dataset.email), { method: 'DELETE' })
                             .then(() => loadMembers());
                     });
                 });
@@ -0,0 +1,31 @@
+// Applies the system light/dark preference until the visitor picks a theme
+// with the toggle; an explicit choice is rendered by the server as
+// data-theme on <html>. Loaded in <head> so pages don't flash the wrong
+// theme.
+(function () {
+    var root = document.documentElement;
+    var prefersLight = window.matchMedia ? window.matchMedia("(prefers-color-scheme: light)") : null;
+    if (!root.dataset.theme) {
+        var follow = function () {
+            root.dataset.theme = prefersLight && prefersLight.matches ? "light" : "dark";
+        };
+        follow();
+        if (prefersLight && prefersLight.addEventListener) {
+            prefersLight.addEventListener("change", function () {
+                follow();
+                updateToggle();
+            });
+        }
+    }
+
+    // The toggle switches to whichever theme isn't showing.
+    function updateToggle() {
+        var btn = document.querySelector(".theme-toggle button");
+        if (!btn) return;
+        var next = root.dataset.theme === "light" ? "dark" : "light";
+        btn.value = next;
+        btn.title = "Switch to " + next + " theme";
+        btn.textContent = next === "light" ? "☀" : "☾";
+    }
+    document.addEventListener("DOMContentLoaded", updateToggle);
+})();
@@ -0,0 +1,15 @@
+// Exposes the settings the server renders into #viewer-config. They are
+// data attributes rather than an inline script so the Content-Security-Policy
+// can forbid inline scripts. Must load before the other viewer scripts.
+(function () {
+    var el = document.getElementById("viewer-config");
+    if (!el) return;
+    var d = el.dataset;
+    window.authUser = d.userName ? { name: d.userName } : null;
+    window.isOwner = d.isOwner === "true";
+    window.basePath = d.basePath || "";
+    window.apiBase = d.apiBase || "";
+    window.viewerURL = d.viewerUrl || "";
+    window.commentMode = d.commentMode || "";
+    window.keepAliveSeconds = parseInt(d.keepAlive, 10) || 0;
+})();
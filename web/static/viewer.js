@@ -3,6 +3,9 @@ document.addEventListener("DOMContentLoaded", function () {
     if (!layout) return;
 
     var projectID = layout.dataset.projectId;
+    // Prefix for API and design requests: the base path, plus the share
+    // link on public share pages.
+    var apiBase = window.apiBase || "";
     var currentVersionID = layout.dataset.versionId;
     var frame = document.getElementById("design-frame");
     var tabs = document.getElementById("page-tabs");
@@ -103,7 +106,7 @@ document.addEventListener("DOMContentLoaded", function () {
     window.addEventListener("resize", resizeFrame);
 
     // Fetch and render version list in sidebar
-    fetch("/api/projects/" + projectID + "/versions")
+    fetch(apiBase + "/api/projects/" + projectID + "/versions")
         .then(function (r) { return r.json(); })
         .then(function (versions) {
             var list = document.getElementById("version-list");
@@ -113,19 +116,95 @@ document.addEventListener("DOMContentLoaded", function () {
                 var item = document.createElement("div");
                 item.className = "version-item" + (v.id === currentVersionID ? " active" : "");
                 item.textContent = "v" + v.version_num + " — " + new Date(v.created_at).toLocaleDateString();
+                if (v.created_by_email) {
+                    var by = document.createElement("span");
+                    by.className = "version-author";
+                    by.textContent = v.created_by_email;
+                    item.appendChild(by);
+                }
                 item.dataset.versionId = v.id;
                 item.dataset.pages = JSON.stringify(v.pages || []);
+                if (v.pinned) pinnedVersionID = v.id;
+                if (window.isOwner) {
+                    var pin = document.createElement("button");
+                    pin.className = "version-pin-btn";
+                    pin.addEventListener("click", function (e) {
+                        e.stopPropagation();
+                        setPinnedVersion(pinnedVersionID === v.id ? "" : v.id);
+                    });
+                    item.appendChild(pin);
+                }
                 item.addEventListener("click", function () {
-                    switchVersion(v.id, v.pages || []);
+                    switchVersion(v.id, v.pages || [], v.warnings || [], v.page_titles || {}, v);
                 });
                 list.appendChild(item);
             });
+            showPinned();
         });
 
-    function switchVersion(versionID, pages) {
+    // The pinned version is the one the project opens on without ?version=.
+    var pinnedVersionID = "";
+
+    function showPinned() {
+        document.querySelectorAll(".version-item").forEach(function (el) {
+            var isPinned = el.dataset.versionId === pinnedVersionID;
+            el.classList.toggle("pinned", isPinned);
+            var btn = el.querySelector(".version-pin-btn");
+            if (btn) {
+                btn.textContent = isPinned ? "Unpin" : "Pin";
+                btn.title = isPinned ? "Open the latest version by default" : "Open this version by default";
+            }
+        });
+        var badge = document.getElementById("pinned-badge");
+        if (badge) badge.hidden = !pinnedVersionID || currentVersionID !== pinnedVersionID;
+    }
+
+    function setPinnedVersion(versionID) {
+        fetch(window.basePath + "/api/projects/" + projectID + "/pinned-version", {
+            method: "PATCH",
+            headers: {"Content-Type": "application/json"},
+            body: JSON.stringify({version_id: versionID})
+        }).then(function (r) {
+            if (!r.ok) return;
+            pinnedVersionID = versionID;
+            showPinned();
+        });
+    }
+
+    function showWarnings(warnings) {
+        var box = document.getElementById("design-warnings");
+        if (!box) return;
+        var list = box.querySelector("ul");
+        list.innerHTML = "";
+        warnings.forEach(function (w) {
+            var li = document.createElement("li");
+            li.textContent = w;
+            list.appendChild(li);
+        });
+        box.hidden = warnings.length === 0;
+    }
+
+    // applyCanvas frames the design at the size its version was made for.
+    function applyCanvas(width, height) {
+        var w = (width || 1080) + "px";
+        frame.style.width = w;
+        frame.style.minWidth = w;
+        frame.style.minHeight = height ? height + "px" : "";
+        document.querySelectorAll(".viewport-btn").forEach(function (b) {
+            b.classList.toggle("active", b.dataset.width === String(width || 1080));
+        });
+    }
+
+    function switchVersion(versionID, pages, warnings, titles, version) {
         if (versionID === currentVersionID) return;
         currentVersionID = versionID;
         layout.dataset.versionId = versionID;
+        if (version) applyCanvas(version.canvas_width, version.canvas_height);
+
+        var banner = document.getElementById("older-version-banner");
+        if (banner) banner.hidden = versionID === layout.dataset.latestVersionId;
+        showWarnings(warnings || []);
+        showPinned();
 
         // Update sidebar highlight
         document.querySelectorAll(".version-item").forEach(function (el) {
@@ -133,7 +212,8 @@ document.addEventListener("DOMContentLoaded", function () {
         });
 
         // Update page tabs
-        var defaultPage = pages.indexOf("index.html") >= 0 ? "index.html" : (pages[0] || "");
+        // Pages arrive in tab order; the first is shown on load.
+        var defaultPage = pages[0] || "";
         if (tabs) {
             tabs.innerHTML = "";
             var flowBtn = document.createElement("button");
@@ -145,7 +225,7 @@ document.addEventListener("DOMContentLoaded", function () {
                 var btn = document.createElement("button");
                 btn.className = "page-tab" + (p === defaultPage ? " active" : "");
                 btn.dataset.page = p;
-                btn.textContent = p;
+                btn.textContent = (titles && titles[p]) || p;
                 tabs.appendChild(btn);
             });
         }
@@ -157,14 +237,14 @@ document.addEventListener("DOMContentLoaded", function () {
         if (iframeWrapper) iframeWrapper.style.display = "";
 
         // Update iframe
-        frame.src = "/designs/" + versionID + "/" + defaultPage;
+        frame.src = apiBase + "/designs/" + versionID + "/" + defaultPage;
         frame.parentElement.scrollTop = 0;
 
         // Reset flow graph for new version
         if (window.resetFlowGraph) window.resetFlowGraph();
 
         // Update URL
-        history.replaceState(null, "", "/projects/" + projectID + "?version=" + versionID);
+        history.replaceState(null, "", window.viewerURL + "?version=" + versionID);
 
         // Reload comments for new version
         if (window.reloadComments) {
@@ -198,7 +278,7 @@ document.addEventListener("DOMContentLoaded", function () {
             } else {
                 if (flowContainer) flowContainer.style.display = "none";
                 if (iframeWrapper) iframeWrapper.style.display = "";
-                frame.src = "/designs/" + currentVersionID + "/" + page;
+                frame.src = apiBase + "/designs/" + currentVersionID + "/" + page;
                 frame.parentElement.scrollTop = 0;
                 if (window.setFlowActiveNode) window.setFlowActiveNode(page);
             }
@@ -210,15 +290,20 @@ document.addEventListener("DOMContentLoaded", function () {
     if (statusSelect) {
         statusSelect.addEventListener("change", function () {
             var status = statusSelect.value;
-            fetch("/api/projects/" + projectID + "/status", {
+            fetch(window.basePath + "/api/projects/" + projectID + "/status", {
                 method: "PATCH",
                 headers: {"Content-Type": "application/json"},
                 body: JSON.stringify({status: status})
             }).then(function (r) {
                 if (!r.ok) {
                     statusSelect.value = statusSelect.dataset.prev;
+                    if (r.status === 409) {
+                        // Approval blocked by open comments; show why on hover
+                        r.text().then(function (msg) { statusSelect.title = msg.trim(); });
+                    }
                     return;
                 }
+                statusSelect.title = "";
                 statusSelect.className = "status-select badge badge-" + status;
                 statusSelect.dataset.prev = status;
             });
@@ -235,6 +320,7 @@ document.addEventListener("DOMContentLoaded", function () {
 
     function switchMode(mode) {
         if (mode === currentMode) return;
+        if (mode === "comment" && window.commentMode === "hidden") return;
         currentMode = mode;
 
         // Update active button
@@ -319,4 +405,13 @@ document.addEventListener("DOMContentLoaded", function () {
             // Cross-origin iframe, can't attach event listener
         }
     });
+
+    // Keep an auto-stopping machine awake while the review is open. Hidden
+    // tabs skip the ping so a forgotten tab doesn't keep it running forever.
+    if (window.keepAliveSeconds > 0) {
+        setInterval(function () {
+            if (document.visibilityState !== "visible") return;
+            fetch((window.basePath || "") + "/ping", { cache: "no-store" }).catch(function () {});
+        }, window.keepAliveSeconds * 1000);
+    }
 });